@@ -252,7 +252,7 @@ show_patch_tools_usage() {
     echo -e "${COLOR_SKYBLUE}用法: $0 patch-tools <操作> [选项]${COLOR_RESET}"
     echo
     echo -e "${COLOR_YELLOW}操作:${COLOR_RESET}"
-    echo -e "  ${COLOR_GREEN}name${COLOR_RESET}                     配置 frida-tools 魔改名，5个（a-zA-Z）字符，留空则读取配置的名称\"${COLOR_GREEN}${FRIDA_NAME}${COLOR_RESET}\"，否则随机生成"
+    echo -e "  ${COLOR_GREEN}name${COLOR_RESET}                     配置 frida-tools 魔改名，1-16 个字母或数字（字母开头），留空则读取配置的名称\"${COLOR_GREEN}${FRIDA_NAME}${COLOR_RESET}\"，否则随机生成"
     echo -e "  ${COLOR_GREEN}restore${COLOR_RESET}                  恢复 frida-tools 到原版"
     echo
     echo -e "${COLOR_WHITE}示例:${COLOR_RESET}"
@@ -724,9 +724,9 @@ interactive_config_editor() {
             read -p "输入新的 Frida 魔改名 (当前: ${FRIDA_NAME:-未设置}): " new_name
             if [ -n "$new_name" ]; then
                 # 检查新名称是否有效
-                if [[ ! "$new_name" =~ ^[a-zA-Z]{5}$ ]]; then
+                if ! is_valid_frida_name "$new_name"; then
                     log_error "无效的魔改名: $new_name"
-                    log_info "魔改名必须是恰好 5 个字母（a-z 或 A-Z）"
+                    log_info "$FRIDA_NAME_RULE"
                 else
                     set_config frida-name "$new_name"
                 fi
@@ -1271,12 +1271,12 @@ patch_frida_module() {
     if [ -z "$FRIDA_NAME" ]; then
         log_error "未指定 Frida 魔改名，请使用 config set frida-name 命令指定"
         read -p "请输入本次所采用的 Frida 魔改名: " value
-        if [[ "$value" =~ ^[a-zA-Z]{5}$ ]]; then
+        if is_valid_frida_name "$value"; then
             FRIDA_NAME="$value"
             log_success "Frida 魔改名已设置为: $FRIDA_NAME"
         else
             log_error "无效的 Frida 魔改名: $value"
-            log_info "Frida 魔改名必须是恰好 5 个字母（a-z 或 A-Z）"
+            log_info "$FRIDA_NAME_RULE"
             return 1
         fi
     else
@@ -1833,6 +1833,11 @@ find_frida_path() {
     log_error "无法找到 frida-tools 路径。请确保 frida-tools 已正确安装。"
     return 1
 }
+# 魔改名规则与 Go 端 utils.ValidateMagicName 一致
+FRIDA_NAME_RULE="魔改名必须以字母开头、只包含字母和数字，长度 1-16 个字符（超过 5 个字符时，被替换的字符串后需要有足够的剩余空间）"
+is_valid_frida_name() {
+    [[ "$1" =~ ^[a-zA-Z][a-zA-Z0-9]{0,15}$ ]]
+}
 generate_random_name() {
     cat /dev/urandom | env LC_CTYPE=C tr -dc 'a-z' | fold -w 5 | head -n 1
 }
@@ -1853,9 +1858,9 @@ patch_frida_tools() {
     fi
 
     # 检查新名称是否有效
-    if [[ ! "$local_frida_name" =~ ^[a-zA-Z]{5}$ ]]; then
+    if ! is_valid_frida_name "$local_frida_name"; then
         log_error "无效的魔改名: $local_frida_name"
-        log_info "魔改名必须是恰好 5 个字母（a-z 或 A-Z）"
+        log_info "$FRIDA_NAME_RULE"
         return 1
     fi
 
@@ -1917,7 +1922,7 @@ modify_core_py() {
 
         if [[ $line =~ [\'\"](([^\'\"]+):rpc)[\'\"] ]]; then
             old=${BASH_REMATCH[2]}
-            new=$(printf "%-5s" "${frida_name:0:5}")
+            new="$frida_name"
             new_line=${line//$old:rpc/$new:rpc}
             if [ "$new_line" != "$line" ]; then
                 echo "Replaced \"$old:rpc\" with \"$new:rpc\"" >&2
@@ -2079,7 +2084,7 @@ build_frida() {
     # 如果 FRIDA_NAME 为空，生成一个新的
     if [ -z "$FRIDA_NAME" ]; then
         FRIDA_NAME=$(generate_random_name)
-        if [[ ! "$FRIDA_NAME" =~ ^[a-z]{5}$ ]]; then
+        if ! is_valid_frida_name "$FRIDA_NAME"; then
             log_error "无法生成有效的 Frida 魔改名"
             exit 1
         fi
@@ -1,3 +1,15 @@
-module github.com/suifei/fridare/hexreplace
+module fridare-gui/hexreplace
 
 go 1.22.3
+
+require fridare-gui v0.0.0
+
+require (
+	github.com/go-resty/resty/v2 v2.16.5 // indirect
+	github.com/klauspost/compress v1.17.11 // indirect
+	github.com/ulikunitz/xz v0.5.13 // indirect
+	golang.org/x/net v0.35.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace fridare-gui => ../ui
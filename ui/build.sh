@@ -14,12 +14,16 @@ echo "清理旧的构建文件..."
 rm -f build/fridare-gui.exe
 rm -f build/fridare-create.exe
 rm -f build/fridare-patch.exe
+rm -f build/fridare-apk.exe
+rm -f build/fridare-ipa.exe
 
 # 使用 fyne build 构建（包含更好的图标和资源打包）
 echo "构建应用程序..."
 fyne build --src cmd/gui -o ../../build/fridare-gui.exe
 go build -o build/fridare-create.exe cmd/create/main.go
 go build -o build/fridare-patch.exe cmd/patch/main.go
+go build -o build/fridare-apk.exe cmd/apk/main.go
+go build -o build/fridare-ipa.exe cmd/ipa/main.go
 
 echo ""
 echo "✅ 构建完成！"
@@ -28,6 +32,8 @@ echo "生成的文件："
 ls -la build/fridare-gui.exe
 ls -la build/fridare-create.exe
 ls -la build/fridare-patch.exe
+ls -la build/fridare-apk.exe
+ls -la build/fridare-ipa.exe
 
 echo ""
 echo "运行应用程序："
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"fridare-gui/internal/core"
+	"fridare-gui/internal/utils"
+)
+
+// gadgetFlags 可重复的 -gadget 参数
+type gadgetFlags []string
+
+func (g *gadgetFlags) String() string { return strings.Join(*g, ",") }
+
+func (g *gadgetFlags) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+func main() {
+	var gadgets gadgetFlags
+	flag.Var(&gadgets, "gadget", "已魔改的frida-gadget库, 格式 [ABI=]路径, 可重复指定 (必需, 未指定ABI时按ELF架构识别)")
+	var (
+		apkPath     = flag.String("apk", "", "输入APK文件路径 (必需)")
+		outputPath  = flag.String("output", "", "输出APK文件路径 (必需)")
+		magicName   = flag.String("magic", "", "魔改名称 (1-5个字符, 必需)")
+		libName     = flag.String("lib", "", "注入的库名, 不含lib前缀和.so后缀 (默认: <魔改名>-gadget)")
+		loaderClass = flag.String("class", "", "加载gadget的Application类名 (默认: <包名>.<魔改名>Application)")
+		mode        = flag.String("mode", "listen", "gadget模式: listen 或 script (默认: listen)")
+		address     = flag.String("address", "127.0.0.1", "listen 模式监听地址 (默认: 127.0.0.1)")
+		port        = flag.Int("port", 27042, "listen 模式监听端口 (默认: 27042)")
+		onLoad      = flag.String("on-load", "wait", "listen 模式加载时行为: wait 或 resume (默认: wait)")
+		scriptFile  = flag.String("script", "", "script 模式随APK打包的本地脚本文件")
+		scriptPath  = flag.String("script-path", "", "script 模式设备上的脚本路径 (未指定 -script 时使用)")
+		keystore    = flag.String("ks", "", "签名密钥库 (JKS / PKCS#12 / PEM)")
+		ksPass      = flag.String("ks-pass", "", "密钥库密码")
+		ksAlias     = flag.String("ks-alias", "", "密钥别名 (默认: 第一个私钥)")
+		keyPass     = flag.String("key-pass", "", "私钥密码 (默认: 与密钥库密码相同)")
+		keyPath     = flag.String("key", "", "PEM私钥文件 (与 -cert 一起代替 -ks)")
+		certPath    = flag.String("cert", "", "PEM证书文件")
+		help        = flag.Bool("help", false, "显示帮助信息")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Fridare APK gadget注入工具\n\n")
+		fmt.Fprintf(os.Stderr, "用法: %s [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "选项:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n示例:\n")
+		fmt.Fprintf(os.Stderr, "  # 注入arm64和arm的gadget, 监听 0.0.0.0:27043\n")
+		fmt.Fprintf(os.Stderr, "  %s -apk app.apk -output app-gadget.apk -magic agent -gadget gadget-arm64.so -gadget gadget-arm.so -address 0.0.0.0 -port 27043 -ks release.jks -ks-pass 123456\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 打包脚本, 启动时自动执行\n")
+		fmt.Fprintf(os.Stderr, "  %s -apk app.apk -output app-gadget.apk -magic agent -gadget arm64-v8a=gadget.so -mode script -script hook.js -key key.pem -cert cert.pem\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "注意:\n")
+		fmt.Fprintf(os.Stderr, "  - gadget库需先使用 fridare-patch 魔改\n")
+		fmt.Fprintf(os.Stderr, "  - APK已包含原生库时只为已有的ABI注入gadget\n")
+		fmt.Fprintf(os.Stderr, "  - gadget由继承应用Application的新增类加载, 不修改启动Activity; 应用的Application类为final (Kotlin默认) 时无法注入\n")
+		fmt.Fprintf(os.Stderr, "  - 输出APK使用v1和v2签名, 签名与原APK不同, 需卸载原应用后安装\n")
+	}
+
+	flag.Parse()
+
+	if *help {
+		flag.Usage()
+		return
+	}
+
+	// 验证必需参数
+	if *apkPath == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定输入APK文件路径 (-apk)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *outputPath == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定输出APK文件路径 (-output)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *magicName == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定魔改名称 (-magic)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := utils.ValidateMagicName(*magicName); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	if len(gadgets) == 0 {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定至少一个frida-gadget库 (-gadget)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *keystore == "" && (*keyPath == "" || *certPath == "") {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定签名密钥库 (-ks) 或PEM私钥和证书 (-key, -cert)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*apkPath); os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "错误: APK文件不存在: %s\n", *apkPath)
+		os.Exit(1)
+	}
+
+	injector := core.NewAPKInjector(*apkPath, *outputPath, *magicName)
+	injector.LibName = *libName
+	injector.LoaderClass = *loaderClass
+	injector.Config = core.GadgetConfig{
+		Mode:       *mode,
+		Address:    *address,
+		Port:       *port,
+		OnLoad:     *onLoad,
+		ScriptPath: *scriptPath,
+		ScriptFile: *scriptFile,
+	}
+
+	// 解析gadget库，未指定ABI时按ELF架构识别
+	for _, spec := range gadgets {
+		abi, gadgetPath, ok := strings.Cut(spec, "=")
+		if !ok {
+			gadgetPath = spec
+			detected, err := core.DetectGadgetABI(gadgetPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: 识别gadget %s 的ABI失败: %v\n", gadgetPath, err)
+				os.Exit(1)
+			}
+			abi = detected
+		}
+		if existing, ok := injector.Gadgets[abi]; ok {
+			fmt.Fprintf(os.Stderr, "错误: ABI %s 重复指定: %s, %s\n", abi, existing, gadgetPath)
+			os.Exit(1)
+		}
+		injector.Gadgets[abi] = gadgetPath
+	}
+
+	// 加载签名密钥
+	var err error
+	if *keystore != "" {
+		injector.Key, err = core.LoadSigningKey(*keystore, *ksPass, *ksAlias, *keyPass)
+	} else {
+		injector.Key, err = core.LoadPEMSigningKey(*keyPath, *certPath, *keyPass)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: 加载签名密钥失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示配置信息
+	fmt.Printf("=== Fridare APK gadget注入工具 ===\n")
+	fmt.Printf("输入文件: %s\n", *apkPath)
+	fmt.Printf("输出文件: %s\n", *outputPath)
+	fmt.Printf("魔改名:   %s\n", *magicName)
+	for abi, gadgetPath := range injector.Gadgets {
+		fmt.Printf("gadget:   %s -> %s\n", abi, gadgetPath)
+	}
+	if *mode == "script" {
+		fmt.Printf("模式:     script (%s)\n", map[bool]string{true: *scriptFile, false: *scriptPath}[*scriptFile != ""])
+	} else {
+		fmt.Printf("模式:     %s (%s:%d, %s)\n", *mode, *address, *port, *onLoad)
+	}
+	fmt.Printf("签名证书: %s\n", injector.Key.Certificate().Subject)
+	fmt.Printf("=================================\n\n")
+
+	// 执行注入
+	err = injector.Inject(func(progress float64, status string) {
+		fmt.Printf("[%3.0f%%] %s\n", progress*100, status)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: APK注入失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示结果
+	result := injector.Result
+	fmt.Printf("\n✅ APK注入成功!\n")
+	fmt.Printf("输出文件: %s\n", *outputPath)
+	fmt.Printf("包名:     %s\n", result.Package)
+	fmt.Printf("启动Activity: %s\n", result.LauncherActivity)
+	fmt.Printf("加载类:   %s (%s)\n", result.LoaderClass, result.DexName)
+	for _, lib := range result.Libraries {
+		fmt.Printf("  + %s\n", lib)
+	}
+	if len(result.SkippedABIs) > 0 {
+		fmt.Printf("跳过的ABI: %s\n", strings.Join(result.SkippedABIs, ", "))
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("警告: %s\n", warning)
+	}
+	if stat, err := os.Stat(*outputPath); err == nil {
+		fmt.Printf("文件大小: %.2f MB\n", float64(stat.Size())/(1024*1024))
+	}
+
+	fmt.Printf("\n📦 安装命令:\n")
+	fmt.Printf("  adb uninstall %s\n", result.Package)
+	fmt.Printf("  adb install %s\n", *outputPath)
+	if *mode != "script" {
+		fmt.Printf("\n🌐 连接信息:\n")
+		fmt.Printf("  adb forward tcp:%d tcp:%d\n", *port, *port)
+		fmt.Printf("  frida -H 127.0.0.1:%d Gadget\n", *port)
+	}
+}
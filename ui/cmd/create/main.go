@@ -5,20 +5,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"fridare-gui/internal/core"
+	"fridare-gui/internal/utils"
 )
 
 func main() {
 	var (
-		fridaServerPath  = flag.String("server", "", "frida-server文件路径 (必需)")
+		fridaServerPath  = flag.String("server", "", "frida-server文件路径 (必需, magisk 格式可用逗号分隔多个 [ABI=]路径)")
 		fridaAgentPath   = flag.String("agent", "", "frida-agent.dylib文件路径 (必需)")
 		outputPath       = flag.String("output", "", "输出DEB文件路径 (必需)")
-		magicName        = flag.String("magic", "", "魔改名称 (5个字符, 必需)")
+		magicName        = flag.String("magic", "", "魔改名称 (1-5个字符, 必需)")
 		port             = flag.Int("port", 27042, "服务端口 (默认: 27042)")
 		isRootless       = flag.Bool("rootless", false, "是否为rootless结构 (默认: false, 即root结构)")
 		packageName      = flag.String("name", "", "包名 (可选, 自动生成)")
-		version          = flag.String("version", "17.2.17", "版本号 (默认: 17.2.17)")
+		version          = flag.String("version", "17.2.17", "版本号, 同时用于筛选按版本限定的替换规则 (默认: 17.2.17)")
 		architecture     = flag.String("arch", "iphoneos-arm64", "架构 (默认: iphoneos-arm64)")
 		maintainer       = flag.String("maintainer", "Fridare Team <support@fridare.com>", "维护者")
 		description      = flag.String("desc", "", "包描述 (可选, 自动生成)")
@@ -28,6 +31,28 @@ func main() {
 		homepage         = flag.String("homepage", "https://frida.re/", "主页 (默认: https://frida.re/)")
 		extractDebPath   = flag.String("extract-deb", "", "从现有DEB包中提取frida-agent.dylib (可选)")
 		extractAgentOnly = flag.Bool("extract-agent-only", false, "仅提取agent文件到当前目录，不创建新DEB包")
+		rulesSpec        = flag.String("rules", "", "替换规则 (规则文件路径或配置目录 rules 下的规则名, 默认: default)")
+		patchPort        = flag.Bool("patch-port", false, "同时修补frida-server二进制中的默认端口 (ELF 和 Mach-O arm64, windows 格式不支持; 默认: false, 仅修改启动参数)")
+		archesFlag       = flag.String("arches", "", "精简fat Mach-O，仅保留指定架构切片，逗号分隔 (如 arm64,arm64e)")
+		entitlementsPath = flag.String("entitlements", "", "写入frida-server签名的权限plist文件, 与原有权限合并 (可选)")
+		replaceEnts      = flag.Bool("replace-entitlements", false, "使用 -entitlements 文件替换原有权限而不是合并")
+		printEnts        = flag.Bool("print-entitlements", false, "输出 -server 指定文件的现有权限plist后退出")
+		format           = flag.String("format", "deb", "输出格式: deb (iOS DEB包), magisk (Android Magisk/KernelSU 模块), linux-deb 或 linux-rpm (Linux 服务包), windows (Windows 服务zip)")
+		listenAddress    = flag.String("address", "0.0.0.0", "frida-server监听地址 (默认: 0.0.0.0)")
+		certificate      = flag.String("certificate", "", "启用TLS的证书PEM文件 (包含证书和私钥), 随包安装为 <魔改名>.pem (可选)")
+		genCert          = flag.String("gen-cert", "", "生成自签名TLS证书到指定文件 (文件已存在时直接使用) 并随包安装, 客户端使用同一文件连接")
+		certHosts        = flag.String("cert-hosts", "", "-gen-cert 证书包含的域名或IP, 逗号分隔 (默认: 监听地址或 localhost)")
+		token            = flag.String("token", "", "frida-server认证令牌, 客户端需使用 --token 连接 (可选)")
+		origin           = flag.String("origin", "", "frida-server仅接受指定 Origin 的 WebSocket 连接 (可选)")
+		assetRoot        = flag.String("asset-root", "", "frida-server通过HTTP提供静态文件的设备上目录 (可选)")
+		initSystem       = flag.String("init", core.LinuxInitSystemd, "linux 格式的服务管理方式: systemd, openrc 或 sysvinit (默认: systemd)")
+		prefix           = flag.String("prefix", "/usr", "linux 格式的安装前缀, frida-server安装到 <前缀>/sbin (默认: /usr)")
+		wrapperPath      = flag.String("wrapper", "", "windows 格式随包附带的 WinSW 可执行文件 (可选, 未指定时安装需要 nssm.exe)")
+		noFirewall       = flag.Bool("no-firewall", false, "windows 格式安装时不添加防火墙规则")
+		compression      = flag.String("compression", core.DebCompressionXz, "deb / linux-deb 格式成员的压缩方式: gzip, xz, zstd 或 none (默认: xz)")
+		selinuxContext   = flag.String("selinux", "", "magisk 格式启动frida-server的SELinux上下文 (可选, 如 u:r:magisk:s0)")
+		reproducible     = flag.Bool("reproducible", false, "可复现构建: 固定时间戳、所有者和权限，相同输入生成逐字节相同的包")
+		sourceDateEpoch  = flag.Int64("source-date-epoch", -1, "可复现构建使用的时间戳 (Unix 秒, 隐含 -reproducible; 默认读取 SOURCE_DATE_EPOCH 环境变量, 未设置时为 0)")
 		help             = flag.Bool("help", false, "显示帮助信息")
 	)
 
@@ -45,11 +70,26 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  %s -server frida-server -extract-deb frida_17.2.17_iphoneos-arm64.deb -magic agent -output agent.deb\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  # 仅从DEB包中提取agent文件\n")
 		fmt.Fprintf(os.Stderr, "  %s -extract-deb frida_17.2.17_iphoneos-arm64.deb -extract-agent-only\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 导出frida-server现有权限, 编辑后合并写入新DEB包\n")
+		fmt.Fprintf(os.Stderr, "  %s -server frida-server -print-entitlements > ents.plist\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s -server frida-server -agent frida-agent.dylib -magic agent -entitlements ents.plist -output agent.deb\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 创建Android Magisk/KernelSU 模块, 包含arm64和arm的frida-server\n")
+		fmt.Fprintf(os.Stderr, "  %s -format magisk -server frida-server-android-arm64,frida-server-android-arm -magic agent -port 27043 -output agent-magisk.zip\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 创建Linux systemd 服务的 RPM 包\n")
+		fmt.Fprintf(os.Stderr, "  %s -format linux-rpm -server frida-server-linux-x86_64 -magic agent -port 27043 -prefix /opt/agent -output agent.rpm\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 创建Windows服务zip (WinSW 包装)\n")
+		fmt.Fprintf(os.Stderr, "  %s -format windows -server frida-server-windows-x86_64.exe -wrapper WinSW-x64.exe -magic agent -port 27043 -output agent-windows.zip\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 仅监听局域网地址, 启用TLS (生成自签名证书) 和令牌认证\n")
+		fmt.Fprintf(os.Stderr, "  %s -server frida-server -agent frida-agent.dylib -magic agent -address 192.168.1.20 -gen-cert agent.pem -token secret -output agent.deb\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 可复现构建, 供CI校验发布包的哈希\n")
+		fmt.Fprintf(os.Stderr, "  SOURCE_DATE_EPOCH=1700000000 %s -server frida-server -agent frida-agent.dylib -magic agent -reproducible -output agent.deb\n\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "注意:\n")
-		fmt.Fprintf(os.Stderr, "  - magic名称必须是5个字符，且符合命名规则 (字母开头，包含字母数字)\n")
+		fmt.Fprintf(os.Stderr, "  - magic名称为1-5个字符，且符合命名规则 (字母开头，包含字母数字)\n")
+		fmt.Fprintf(os.Stderr, "  - 更长的magic名称仅当二进制中的字符串有足够剩余空间时可用\n")
 		fmt.Fprintf(os.Stderr, "  - rootless结构用于现代越狱环境 (如checkra1n, unc0ver等)\n")
 		fmt.Fprintf(os.Stderr, "  - root结构用于传统越狱环境\n")
 		fmt.Fprintf(os.Stderr, "  - frida-agent.dylib文件是必需的，确保完整功能\n")
+		fmt.Fprintf(os.Stderr, "  - magisk 格式未指定ABI时按ELF架构识别, 安装时按设备架构选择frida-server\n")
 	}
 
 	flag.Parse()
@@ -59,6 +99,43 @@ func main() {
 		return
 	}
 
+	switch *compression {
+	case core.DebCompressionGzip, core.DebCompressionXz, core.DebCompressionZstd, core.DebCompressionNone:
+	default:
+		fmt.Fprintf(os.Stderr, "错误: 不支持的压缩方式: %s (gzip, xz, zstd 或 none)\n", *compression)
+		os.Exit(1)
+	}
+	var sourceDate time.Time
+	if *sourceDateEpoch >= 0 {
+		*reproducible = true
+		sourceDate = time.Unix(*sourceDateEpoch, 0).UTC()
+	} else if *reproducible {
+		epoch, err := core.SourceDateEpoch()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+			os.Exit(1)
+		}
+		sourceDate = epoch
+	}
+	switch *format {
+	case "deb", "magisk", "linux-deb", "linux-rpm", "windows":
+	default:
+		fmt.Fprintf(os.Stderr, "错误: 不支持的输出格式: %s (deb, magisk, linux-deb, linux-rpm 或 windows)\n", *format)
+		os.Exit(1)
+	}
+
+	runtime, generated, err := runtimeOptions(*listenAddress, *certificate, *genCert, *certHosts, *token, *origin, *assetRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	if generated {
+		fmt.Printf("已生成自签名TLS证书: %s (客户端使用同一文件连接)\n", runtime.Certificate)
+		if *reproducible {
+			fmt.Fprintf(os.Stderr, "注意: 新生成的证书每次不同, 可复现构建请使用已有证书\n")
+		}
+	}
+
 	// 处理仅提取agent文件的情况
 	if *extractAgentOnly {
 		if *extractDebPath == "" {
@@ -81,6 +158,27 @@ func main() {
 		fmt.Printf("INFO: 请手动提取agent文件并使用 -agent 参数指定\n")
 	}
 
+	// 仅输出现有权限
+	if *printEnts {
+		if *fridaServerPath == "" {
+			fmt.Fprintf(os.Stderr, "错误: 使用 -print-entitlements 时必须指定 -server 参数\n\n")
+			flag.Usage()
+			os.Exit(1)
+		}
+		entitlements, err := core.ReadEntitlements(*fridaServerPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 读取权限失败: %v\n", err)
+			os.Exit(1)
+		}
+		data, err := entitlements.Plist()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 编码权限失败: %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(data)
+		return
+	}
+
 	// 验证必需参数
 	if *fridaServerPath == "" {
 		fmt.Fprintf(os.Stderr, "错误: 必须指定frida-server文件路径 (-server)\n\n")
@@ -88,14 +186,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	if *fridaAgentPath == "" && *extractDebPath == "" {
+	if *format == "deb" && *fridaAgentPath == "" && *extractDebPath == "" {
 		fmt.Fprintf(os.Stderr, "错误: 必须指定frida-agent.dylib文件路径 (-agent) 或使用 -extract-deb 从现有DEB包提取\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	if *outputPath == "" {
-		fmt.Fprintf(os.Stderr, "错误: 必须指定输出DEB文件路径 (-output)\n\n")
+		fmt.Fprintf(os.Stderr, "错误: 必须指定输出文件路径 (-output)\n\n")
 		flag.Usage()
 		os.Exit(1)
 	}
@@ -107,14 +205,72 @@ func main() {
 	}
 
 	// 验证magic名称
-	if len(*magicName) != 5 {
-		fmt.Fprintf(os.Stderr, "错误: 魔改名称必须是5个字符，当前: %d个字符\n", len(*magicName))
+	if err := utils.ValidateMagicName(*magicName); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 		os.Exit(1)
 	}
+	if len(*magicName) > utils.MaxSafeMagicNameLen {
+		fmt.Fprintf(os.Stderr, "注意: 魔改名称超过%d个字符，仅当二进制中的字符串有足够剩余空间时才能替换\n", utils.MaxSafeMagicNameLen)
+	}
 
-	if !isValidMagicName(*magicName) {
-		fmt.Fprintf(os.Stderr, "错误: 魔改名称格式无效，必须以字母开头，包含字母和数字\n")
-		os.Exit(1)
+	if *format == "magisk" {
+		if *port < 1 || *port > 65535 {
+			fmt.Fprintf(os.Stderr, "错误: 端口必须在1-65535范围内\n")
+			os.Exit(1)
+		}
+		packager := core.NewMagiskModulePackager(*outputPath, *magicName, *port)
+		packager.RuntimeOptions = runtime
+		packager.SELinuxContext = *selinuxContext
+		packager.PatchPort = *patchPort
+		if *packageName != "" {
+			packager.ModuleID = *packageName
+		}
+		packager.Version = *version
+		packager.Description = *description
+		createMagiskModule(packager, *fridaServerPath, *rulesSpec)
+		return
+	}
+	if *format == "linux-deb" || *format == "linux-rpm" {
+		if _, err := os.Stat(*fridaServerPath); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "错误: frida-server文件不存在: %s\n", *fridaServerPath)
+			os.Exit(1)
+		}
+		packager := core.NewLinuxServicePackager(*fridaServerPath, *outputPath, strings.TrimPrefix(*format, "linux-"), *magicName, *port)
+		packager.InitSystem = *initSystem
+		packager.RuntimeOptions = runtime
+		packager.Prefix = *prefix
+		packager.PackageName = *packageName
+		packager.Version = *version
+		packager.Maintainer = *maintainer
+		packager.Description = *description
+		packager.Homepage = *homepage
+		packager.PatchPort = *patchPort
+		packager.Compression = *compression
+		packager.Reproducible = *reproducible
+		packager.SourceDate = sourceDate
+		createLinuxPackage(packager, *rulesSpec)
+		return
+	}
+	if *format == "windows" {
+		if *patchPort {
+			fmt.Fprintf(os.Stderr, "错误: windows 格式不支持 -patch-port (端口定位仅支持 ELF 和 Mach-O arm64)，端口已由服务参数 -l 指定\n")
+			os.Exit(1)
+		}
+		for _, file := range []string{*fridaServerPath, *wrapperPath} {
+			if _, err := os.Stat(file); file != "" && os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "错误: 文件不存在: %s\n", file)
+				os.Exit(1)
+			}
+		}
+		packager := core.NewWindowsServicePackager(*fridaServerPath, *outputPath, *magicName, *port)
+		packager.RuntimeOptions = runtime
+		packager.ServiceName = *packageName
+		packager.Version = *version
+		packager.Description = *description
+		packager.WrapperPath = *wrapperPath
+		packager.Firewall = !*noFirewall
+		createWindowsPackage(packager, *rulesSpec)
+		return
 	}
 
 	// 验证文件存在
@@ -143,6 +299,20 @@ func main() {
 		}
 	}
 
+	// 加载权限文件
+	var entitlements core.Entitlements
+	if *entitlementsPath != "" {
+		var err error
+		entitlements, err = core.LoadEntitlementsFile(*entitlementsPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 加载权限文件失败: %v\n", err)
+			os.Exit(1)
+		}
+	} else if *replaceEnts {
+		fmt.Fprintf(os.Stderr, "错误: 使用 -replace-entitlements 时必须指定 -entitlements 参数\n")
+		os.Exit(1)
+	}
+
 	// 验证端口范围
 	if *port < 1 || *port > 65535 {
 		fmt.Fprintf(os.Stderr, "错误: 端口必须在1-65535范围内\n")
@@ -176,7 +346,16 @@ func main() {
 	fmt.Printf("  架构:     %s\n", *architecture)
 	fmt.Printf("  魔改名:   %s\n", *magicName)
 	fmt.Printf("  端口:     %d\n", *port)
+	fmt.Printf("  端口修补: %v\n", *patchPort)
+	if *archesFlag != "" {
+		fmt.Printf("  保留架构: %s\n", *archesFlag)
+	}
+	if entitlements != nil {
+		fmt.Printf("  权限文件: %s (%s, %d 项)\n", *entitlementsPath, map[bool]string{true: "替换", false: "合并"}[*replaceEnts], len(entitlements))
+	}
 	fmt.Printf("  结构:     %s\n", map[bool]string{true: "Rootless", false: "Root"}[*isRootless])
+	fmt.Printf("  监听:     %s\n", runtime.ListenAddress(*port))
+	printRuntimeOptions("  ", runtime)
 	fmt.Printf("  维护者:   %s\n", *maintainer)
 	fmt.Printf("  描述:     %s\n", *description)
 	fmt.Printf("=============================\n\n")
@@ -195,6 +374,8 @@ func main() {
 		Port:         *port,
 		MagicName:    *magicName,
 		IsRootless:   *isRootless,
+
+		RuntimeOptions: runtime,
 	}
 
 	// 创建DEB构建器
@@ -202,9 +383,25 @@ func main() {
 	if *fridaAgentPath != "" {
 		creator.FridaAgentPath = *fridaAgentPath
 	}
+	creator.PatchPort = *patchPort
+	creator.Arches = core.ParseArchList(*archesFlag)
+	creator.Entitlements = entitlements
+	creator.ReplaceEntitlements = *replaceEnts
+	creator.Compression = *compression
+	creator.Reproducible = *reproducible
+	creator.SourceDate = sourceDate
+	if *rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(*rulesSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 加载替换规则失败: %v\n", err)
+			os.Exit(1)
+		}
+		creator.Rules = rules
+		fmt.Printf("替换规则: %s (%d 条)\n", rules.Name, len(rules.Rules))
+	}
 
 	// 执行构建
-	err := creator.CreateDebPackage()
+	err = creator.CreateDebPackage()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "错误: DEB包创建失败: %v\n", err)
 		os.Exit(1)
@@ -213,6 +410,9 @@ func main() {
 	// 显示成功信息
 	fmt.Printf("\n✅ DEB包创建成功!\n")
 	fmt.Printf("输出文件: %s\n", *outputPath)
+	for _, report := range creator.Reports {
+		fmt.Printf("残留特征 %s: %s\n", report.File, core.SummarizeFingerprints(report.Residual))
+	}
 
 	// 显示文件大小
 	if stat, err := os.Stat(*outputPath); err == nil {
@@ -231,27 +431,266 @@ func main() {
 	}
 	fmt.Printf("\n🌐 连接信息:\n")
 	fmt.Printf("  端口: %d\n", *port)
-	fmt.Printf("  frida命令: frida -H <设备IP>:%d <进程名>\n", *port)
+	fmt.Printf("  frida命令: %s\n", clientCommand("<设备IP>", *port, runtime))
+}
+
+// createMagiskModule 创建Android Magisk/KernelSU 模块，serverSpec 为逗号分隔的 [ABI=]路径
+func createMagiskModule(packager *core.MagiskModulePackager, serverSpec, rulesSpec string) {
+	// 解析frida-server，未指定ABI时按ELF架构识别
+	for _, spec := range strings.Split(serverSpec, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		abi, serverPath, ok := strings.Cut(spec, "=")
+		if !ok {
+			serverPath = spec
+		}
+		if _, err := os.Stat(serverPath); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "错误: frida-server文件不存在: %s\n", serverPath)
+			os.Exit(1)
+		}
+		if !ok {
+			detected, err := core.DetectAndroidABI(serverPath)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "错误: 识别frida-server %s 的ABI失败: %v\n", serverPath, err)
+				os.Exit(1)
+			}
+			abi = detected
+		}
+		if existing, ok := packager.Servers[abi]; ok {
+			fmt.Fprintf(os.Stderr, "错误: ABI %s 重复指定: %s, %s\n", abi, existing, serverPath)
+			os.Exit(1)
+		}
+		packager.Servers[abi] = serverPath
+	}
+	if rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(rulesSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 加载替换规则失败: %v\n", err)
+			os.Exit(1)
+		}
+		packager.Rules = rules
+		fmt.Printf("替换规则: %s (%d 条)\n", rules.Name, len(rules.Rules))
+	}
+
+	// 显示配置信息
+	fmt.Printf("=== Fridare Magisk模块创建工具 ===\n")
+	for abi, serverPath := range packager.Servers {
+		fmt.Printf("frida-server: %s -> %s\n", abi, serverPath)
+	}
+	fmt.Printf("输出文件: %s\n", packager.OutputPath)
+	fmt.Printf("魔改名:   %s\n", packager.MagicName)
+	fmt.Printf("监听:     %s\n", packager.ListenAddress(packager.Port))
+	printRuntimeOptions("", packager.RuntimeOptions)
+	fmt.Printf("端口修补: %v\n", packager.PatchPort)
+	if packager.SELinuxContext != "" {
+		fmt.Printf("SELinux:  %s\n", packager.SELinuxContext)
+	}
+	fmt.Printf("=================================\n\n")
+
+	err := packager.CreateModule(func(progress float64, status string) {
+		fmt.Printf("[%3.0f%%] %s\n", progress*100, status)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: Magisk模块创建失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示成功信息
+	fmt.Printf("\n✅ Magisk模块创建成功!\n")
+	fmt.Printf("输出文件: %s\n", packager.OutputPath)
+	for _, report := range packager.Reports {
+		fmt.Printf("残留特征 %s: %s\n", report.File, core.SummarizeFingerprints(report.Residual))
+	}
+	if stat, err := os.Stat(packager.OutputPath); err == nil {
+		fmt.Printf("文件大小: %.2f MB\n", float64(stat.Size())/(1024*1024))
+	}
+
+	fmt.Printf("\n📦 安装命令:\n")
+	fmt.Printf("  adb push %s /sdcard/\n", filepath.Base(packager.OutputPath))
+	fmt.Printf("  adb shell su -c magisk --install-module /sdcard/%s\n", filepath.Base(packager.OutputPath))
+	fmt.Printf("  (KernelSU: ksud module install /sdcard/%s)\n", filepath.Base(packager.OutputPath))
+	fmt.Printf("\n🌐 连接信息:\n")
+	fmt.Printf("  重启后frida-server监听 %s\n", packager.ListenAddress(packager.Port))
+	fmt.Printf("  adb forward tcp:%d tcp:%d\n", packager.Port, packager.Port)
+	fmt.Printf("  %s\n", clientCommand("127.0.0.1", packager.Port, packager.RuntimeOptions))
+}
+
+// createLinuxPackage 创建Linux frida-server服务包 (.deb 或 .rpm)
+func createLinuxPackage(packager *core.LinuxServicePackager, rulesSpec string) {
+	if rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(rulesSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 加载替换规则失败: %v\n", err)
+			os.Exit(1)
+		}
+		packager.Rules = rules
+		fmt.Printf("替换规则: %s (%d 条)\n", rules.Name, len(rules.Rules))
+	}
+
+	// 显示配置信息
+	fmt.Printf("=== Fridare Linux服务包创建工具 ===\n")
+	fmt.Printf("frida-server: %s\n", packager.ServerPath)
+	fmt.Printf("输出文件: %s (%s)\n", packager.OutputPath, packager.Format)
+	fmt.Printf("魔改名:   %s\n", packager.MagicName)
+	fmt.Printf("监听:     %s\n", packager.ListenAddress(packager.Port))
+	printRuntimeOptions("", packager.RuntimeOptions)
+	fmt.Printf("安装路径: %s/sbin/%s\n", strings.TrimSuffix(packager.Prefix, "/"), packager.MagicName)
+	fmt.Printf("服务管理: %s\n", packager.InitSystem)
+	fmt.Printf("=================================\n\n")
+
+	err := packager.CreatePackage(func(progress float64, status string) {
+		fmt.Printf("[%3.0f%%] %s\n", progress*100, status)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: Linux服务包创建失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示成功信息
+	fmt.Printf("\n✅ Linux服务包创建成功!\n")
+	fmt.Printf("输出文件: %s (%s)\n", packager.OutputPath, packager.Arch)
+	for _, report := range packager.Reports {
+		fmt.Printf("残留特征 %s: %s\n", report.File, core.SummarizeFingerprints(report.Residual))
+	}
+	if stat, err := os.Stat(packager.OutputPath); err == nil {
+		fmt.Printf("文件大小: %.2f MB\n", float64(stat.Size())/(1024*1024))
+	}
+
+	fmt.Printf("\n📦 安装命令:\n")
+	if packager.Format == core.LinuxPackageRPM {
+		fmt.Printf("  rpm -i %s\n", filepath.Base(packager.OutputPath))
+	} else {
+		fmt.Printf("  dpkg -i %s\n", filepath.Base(packager.OutputPath))
+	}
+	fmt.Printf("\n🔧 服务控制:\n")
+	switch packager.InitSystem {
+	case core.LinuxInitOpenRC:
+		fmt.Printf("  rc-service %s start|stop|status\n", packager.MagicName)
+	case core.LinuxInitSysVinit:
+		fmt.Printf("  /etc/init.d/%s start|stop|status\n", packager.MagicName)
+	default:
+		fmt.Printf("  systemctl start|stop|status %s\n", packager.MagicName)
+	}
+	fmt.Printf("\n🌐 连接信息:\n")
+	fmt.Printf("  %s\n", clientCommand("<主机IP>", packager.Port, packager.RuntimeOptions))
 }
 
-// isValidMagicName 验证魔改名称格式
-func isValidMagicName(s string) bool {
-	// 必须以字母开头
-	if len(s) == 0 {
-		return false
+// createWindowsPackage 创建Windows frida-server服务zip
+func createWindowsPackage(packager *core.WindowsServicePackager, rulesSpec string) {
+	if rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(rulesSpec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "错误: 加载替换规则失败: %v\n", err)
+			os.Exit(1)
+		}
+		packager.Rules = rules
+		fmt.Printf("替换规则: %s (%d 条)\n", rules.Name, len(rules.Rules))
 	}
 
-	first := s[0]
-	if !((first >= 'A' && first <= 'Z') || (first >= 'a' && first <= 'z')) {
-		return false
+	// 显示配置信息
+	fmt.Printf("=== Fridare Windows服务包创建工具 ===\n")
+	fmt.Printf("frida-server: %s\n", packager.ServerPath)
+	fmt.Printf("输出文件: %s\n", packager.OutputPath)
+	fmt.Printf("魔改名:   %s\n", packager.MagicName)
+	fmt.Printf("监听:     %s\n", packager.ListenAddress(packager.Port))
+	printRuntimeOptions("", packager.RuntimeOptions)
+	if packager.WrapperPath != "" {
+		fmt.Printf("服务包装: WinSW (%s)\n", packager.WrapperPath)
+	} else {
+		fmt.Printf("服务包装: NSSM (安装时从 PATH 查找)\n")
+	}
+	fmt.Printf("=================================\n\n")
+
+	err := packager.CreatePackage(func(progress float64, status string) {
+		fmt.Printf("[%3.0f%%] %s\n", progress*100, status)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: Windows服务包创建失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示成功信息
+	fmt.Printf("\n✅ Windows服务包创建成功!\n")
+	fmt.Printf("输出文件: %s (%s)\n", packager.OutputPath, packager.Arch)
+	for _, report := range packager.Reports {
+		fmt.Printf("残留特征 %s: %s\n", report.File, core.SummarizeFingerprints(report.Residual))
+	}
+	if stat, err := os.Stat(packager.OutputPath); err == nil {
+		fmt.Printf("文件大小: %.2f MB\n", float64(stat.Size())/(1024*1024))
+	}
+
+	fmt.Printf("\n📦 安装方法:\n")
+	fmt.Printf("  解压后以管理员身份运行 install.bat, 卸载运行 uninstall.bat\n")
+	fmt.Printf("\n🌐 连接信息:\n")
+	fmt.Printf("  %s\n", clientCommand("<主机IP>", packager.Port, packager.RuntimeOptions))
+}
+
+// runtimeOptions 由命令行参数生成frida-server运行参数，genCert 指定的证书不存在时生成自签名证书
+func runtimeOptions(address, certificate, genCert, certHosts, token, origin, assetRoot string) (core.RuntimeOptions, bool, error) {
+	runtime := core.RuntimeOptions{
+		Address:     address,
+		Certificate: certificate,
+		Token:       token,
+		Origin:      origin,
+		AssetRoot:   assetRoot,
+	}
+	if genCert == "" {
+		return runtime, false, nil
+	}
+	if certificate != "" {
+		return runtime, false, fmt.Errorf("-certificate 和 -gen-cert 不能同时使用")
+	}
+	runtime.Certificate = genCert
+	if _, err := os.Stat(genCert); err == nil {
+		return runtime, false, nil
 	}
 
-	// 检查其余字符必须是字母或数字
-	for _, c := range s {
-		if !((c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
-			return false
+	var hosts []string
+	for _, host := range strings.Split(certHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
 		}
 	}
+	if len(hosts) == 0 && address != "" && address != "0.0.0.0" && address != "::" {
+		hosts = []string{address}
+	}
+	data, err := core.GenerateSelfSignedCertificate(hosts, 10*365*24*time.Hour)
+	if err != nil {
+		return runtime, false, err
+	}
+	// 文件包含私钥
+	if err := os.WriteFile(genCert, data, 0600); err != nil {
+		return runtime, false, fmt.Errorf("写入证书失败: %v", err)
+	}
+	return runtime, true, nil
+}
 
-	return true
+// printRuntimeOptions 显示监听地址以外的运行参数
+func printRuntimeOptions(indent string, runtime core.RuntimeOptions) {
+	if runtime.Certificate != "" {
+		fmt.Printf("%sTLS证书:  %s\n", indent, runtime.Certificate)
+	}
+	if runtime.Token != "" {
+		fmt.Printf("%s认证令牌: 已设置\n", indent)
+	}
+	if runtime.Origin != "" {
+		fmt.Printf("%sOrigin:   %s\n", indent, runtime.Origin)
+	}
+	if runtime.AssetRoot != "" {
+		fmt.Printf("%s静态文件: %s\n", indent, runtime.AssetRoot)
+	}
+}
+
+// clientCommand 返回连接frida-server的客户端命令
+func clientCommand(host string, port int, runtime core.RuntimeOptions) string {
+	command := fmt.Sprintf("frida -H %s:%d", host, port)
+	if runtime.Certificate != "" {
+		command += " --certificate " + runtime.Certificate
+	}
+	if runtime.Token != "" {
+		command += " --token " + runtime.Token
+	}
+	return command + " <进程名>"
 }
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"fridare-gui/internal/core"
+	"fridare-gui/internal/utils"
+)
+
+func main() {
+	var (
+		ipaPath    = flag.String("ipa", "", "输入IPA文件路径 (必需)")
+		outputPath = flag.String("output", "", "输出IPA文件路径 (必需)")
+		magicName  = flag.String("magic", "", "魔改名称 (1-5个字符, 必需)")
+		gadgetPath = flag.String("gadget", "", "frida-gadget dylib (FridaGadget.dylib, 必需)")
+		patched    = flag.Bool("patched", false, "gadget已使用 fridare-patch 魔改, 不再魔改")
+		name       = flag.String("name", "", "注入的dylib名, 不含.dylib后缀 (默认: <魔改名>Gadget)")
+		mode       = flag.String("mode", "listen", "gadget模式: listen 或 script (默认: listen)")
+		address    = flag.String("address", "127.0.0.1", "listen 模式监听地址 (默认: 127.0.0.1)")
+		port       = flag.Int("port", 27042, "listen 模式监听端口 (默认: 27042)")
+		onLoad     = flag.String("on-load", "wait", "listen 模式加载时行为: wait 或 resume (默认: wait)")
+		scriptFile = flag.String("script", "", "script 模式随IPA打包的本地脚本文件")
+		scriptPath = flag.String("script-path", "", "script 模式设备上的脚本路径 (未指定 -script 时使用)")
+		signing    = flag.String("sign", core.IPASigningAdhoc, "签名方式: adhoc 或 none (none 时输出外部签名清单)")
+		help       = flag.Bool("help", false, "显示帮助信息")
+	)
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Fridare IPA gadget注入工具\n\n")
+		fmt.Fprintf(os.Stderr, "用法: %s [选项]\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "选项:\n")
+		flag.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\n示例:\n")
+		fmt.Fprintf(os.Stderr, "  # 注入并魔改gadget, 监听 0.0.0.0:27043, ad-hoc 签名\n")
+		fmt.Fprintf(os.Stderr, "  %s -ipa app.ipa -output app-gadget.ipa -magic agent -gadget FridaGadget.dylib -address 0.0.0.0 -port 27043\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  # 打包脚本, 由外部工具重新签名\n")
+		fmt.Fprintf(os.Stderr, "  %s -ipa app.ipa -output app-gadget.ipa -magic agent -gadget FridaGadget.dylib -mode script -script hook.js -sign none\n\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "注意:\n")
+		fmt.Fprintf(os.Stderr, "  - App Store 下载的IPA需先解密\n")
+		fmt.Fprintf(os.Stderr, "  - ad-hoc 签名的IPA只能在越狱或 TrollStore 等环境安装\n")
+		fmt.Fprintf(os.Stderr, "  - -sign none 时在输出文件旁写出 .signing.json, 按 sign_order 顺序签名\n")
+	}
+
+	flag.Parse()
+
+	if *help {
+		flag.Usage()
+		return
+	}
+
+	// 验证必需参数
+	if *ipaPath == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定输入IPA文件路径 (-ipa)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *outputPath == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定输出IPA文件路径 (-output)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *magicName == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定魔改名称 (-magic)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err := utils.ValidateMagicName(*magicName); err != nil {
+		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+		os.Exit(1)
+	}
+	if *gadgetPath == "" {
+		fmt.Fprintf(os.Stderr, "错误: 必须指定frida-gadget库 (-gadget)\n\n")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if *signing != core.IPASigningAdhoc && *signing != core.IPASigningNone {
+		fmt.Fprintf(os.Stderr, "错误: 不支持的签名方式: %s (adhoc 或 none)\n", *signing)
+		os.Exit(1)
+	}
+	for _, file := range []string{*ipaPath, *gadgetPath} {
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "错误: 文件不存在: %s\n", file)
+			os.Exit(1)
+		}
+	}
+
+	injector := core.NewIPAInjector(*ipaPath, *outputPath, *magicName)
+	injector.GadgetPath = *gadgetPath
+	injector.PatchGadget = !*patched
+	injector.GadgetName = *name
+	injector.Signing = *signing
+	injector.Config = core.GadgetConfig{
+		Mode:       *mode,
+		Address:    *address,
+		Port:       *port,
+		OnLoad:     *onLoad,
+		ScriptPath: *scriptPath,
+		ScriptFile: *scriptFile,
+	}
+
+	// 显示配置信息
+	fmt.Printf("=== Fridare IPA gadget注入工具 ===\n")
+	fmt.Printf("输入文件: %s\n", *ipaPath)
+	fmt.Printf("输出文件: %s\n", *outputPath)
+	fmt.Printf("魔改名:   %s\n", *magicName)
+	fmt.Printf("gadget:   %s (魔改: %v)\n", *gadgetPath, !*patched)
+	if *mode == "script" {
+		fmt.Printf("模式:     script (%s)\n", map[bool]string{true: *scriptFile, false: *scriptPath}[*scriptFile != ""])
+	} else {
+		fmt.Printf("模式:     %s (%s:%d, %s)\n", *mode, *address, *port, *onLoad)
+	}
+	fmt.Printf("签名:     %s\n", *signing)
+	fmt.Printf("=================================\n\n")
+
+	// 执行注入
+	err := injector.Inject(func(progress float64, status string) {
+		fmt.Printf("[%3.0f%%] %s\n", progress*100, status)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "错误: IPA注入失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 显示结果
+	result := injector.Result
+	fmt.Printf("\n✅ IPA注入成功!\n")
+	fmt.Printf("输出文件: %s\n", *outputPath)
+	fmt.Printf("应用:     %s (%s)\n", result.Bundle, result.BundleID)
+	fmt.Printf("主程序:   %s\n", result.Executable)
+	fmt.Printf("加载命令: %s\n", result.DylibPath)
+	for _, slice := range result.Slices {
+		fmt.Printf("  %s: 剩余头部空间 %d 字节\n", slice.Arch, slice.FreeSpace)
+	}
+	for _, file := range result.Files {
+		fmt.Printf("  + %s\n", file)
+	}
+	if result.GadgetReport != nil {
+		fmt.Printf("gadget魔改: 替换 %d 处字符串\n", result.GadgetReport.Count())
+	}
+	for _, slice := range result.Signed {
+		fmt.Printf("已签名:   %s (%s)\n", slice.Arch, slice.Identifier)
+	}
+	if result.Manifest != "" {
+		fmt.Printf("签名清单: %s\n", result.Manifest)
+	}
+	for _, warning := range result.Warnings {
+		fmt.Printf("警告: %s\n", warning)
+	}
+	if stat, err := os.Stat(*outputPath); err == nil {
+		fmt.Printf("文件大小: %.2f MB\n", float64(stat.Size())/(1024*1024))
+	}
+
+	if *mode != "script" {
+		fmt.Printf("\n🌐 连接信息:\n")
+		if *address == "127.0.0.1" {
+			fmt.Printf("  iproxy %d %d\n", *port, *port)
+		}
+		fmt.Printf("  frida -H %s:%d Gadget\n", strings.Replace(*address, "0.0.0.0", "<设备IP>", 1), *port)
+	}
+}
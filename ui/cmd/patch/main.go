@@ -1,35 +1,75 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"fridare-gui/internal/core"
 )
 
 func main() {
-	if len(os.Args) < 4 {
-		fmt.Println("用法: fridare-patch.exe <输入DEB文件> <输出DEB文件> <魔改名称> [端口]")
-		fmt.Println("示例: fridare-patch.exe frida_17.2.17_iphoneos-arm64.deb frida_modified.deb test-frida 27042")
-		fmt.Println("")
-		fmt.Println("说明:")
-		fmt.Println("  - 输入DEB文件: 原始的frida DEB包文件路径")
-		fmt.Println("  - 输出DEB文件: 修改后的DEB包输出路径")
-		fmt.Println("  - 魔改名称: 用于替换frida字符串的5字符名称")
-		fmt.Println("  - 端口: 可选，服务端口号，默认27042")
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		runInspect(os.Args[2:])
+		return
+	}
+
+	var (
+		dryRun       = flag.Bool("dry-run", false, "仅预演替换，不生成输出文件")
+		reportFormat = flag.String("report", "", "输出替换报告: text 或 json (dry-run 默认 text)")
+		rulesFlag    = flag.String("rules", "", "替换规则: 规则文件路径或配置目录 rules 下的规则名，默认 default")
+		rewriteFlag  = flag.String("rewrite", "", "DEB改写规则文件 (JSON/YAML)，描述包内文件的重命名、内容变换和control字段，默认使用内置规则")
+		portFlag     = flag.Int("port", 27042, "服务端口 (也可作为第4个参数指定)")
+		patchPort    = flag.Bool("patch-port", false, "同时修补frida-server二进制中的默认端口 (ELF arm/arm64/x86/x86_64, Mach-O arm64)")
+		archesFlag   = flag.String("arches", "", "精简fat Mach-O，仅保留指定架构切片，逗号分隔 (如 arm64,arm64e)")
+		reproducible = flag.Bool("reproducible", false, "可复现构建: 固定时间戳、所有者和权限，相同输入生成逐字节相同的DEB")
+		compression  = flag.String("compression", "", "输出DEB成员的压缩方式: gzip, xz, zstd 或 none (默认与输入包相同)")
+		sourceEpoch  = flag.Int64("source-date-epoch", -1, "可复现构建使用的时间戳 (Unix 秒, 隐含 --reproducible; 默认读取 SOURCE_DATE_EPOCH 环境变量, 未设置时为 0)")
+	)
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+
+	if *reportFormat != "" && *reportFormat != "text" && *reportFormat != "json" {
+		fmt.Fprintf(os.Stderr, "错误: 未知的报告格式: %s (可选 text 或 json)\n", *reportFormat)
 		os.Exit(1)
 	}
 
-	inputPath := os.Args[1]
-	outputPath := os.Args[2]
-	magicName := os.Args[3]
-	port := 27042
-	if len(os.Args) > 4 {
-		fmt.Sscanf(os.Args[4], "%d", &port)
+	switch *compression {
+	case "", core.DebCompressionGzip, core.DebCompressionXz, core.DebCompressionZstd, core.DebCompressionNone:
+	default:
+		fmt.Fprintf(os.Stderr, "错误: 不支持的压缩方式: %s (可选 gzip, xz, zstd 或 none)\n", *compression)
+		os.Exit(1)
+	}
+
+	if *dryRun {
+		// 预演接受 <输入DEB文件> <魔改名称>，也接受与修改相同的参数 (忽略输出路径)
+		switch {
+		case len(args) == 2:
+			runDryRun(args[0], args[1], *rulesFlag, *rewriteFlag, *reportFormat, *portFlag, *patchPort, core.ParseArchList(*archesFlag))
+		case len(args) >= 3 && len(args) <= 5:
+			magicName, port, rulesSpec := positionalArgs(args, *portFlag, *rulesFlag)
+			runDryRun(args[0], magicName, rulesSpec, *rewriteFlag, *reportFormat, port, *patchPort, core.ParseArchList(*archesFlag))
+		default:
+			usage()
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(args) < 3 || len(args) > 5 {
+		usage()
+		os.Exit(1)
 	}
 
+	inputPath := args[0]
+	outputPath := args[1]
+	magicName, port, rulesSpec := positionalArgs(args, *portFlag, *rulesFlag)
+
 	// 设置日志格式
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -38,6 +78,36 @@ func main() {
 	fmt.Printf("输出文件: %s\n", outputPath)
 	fmt.Printf("魔改名称: %s\n", magicName)
 	fmt.Printf("端口: %d\n", port)
+	if *patchPort {
+		fmt.Println("修补二进制默认端口: 是")
+	}
+	arches := core.ParseArchList(*archesFlag)
+	if len(arches) > 0 {
+		fmt.Printf("保留架构: %s\n", strings.Join(arches, ", "))
+	}
+	var sourceDate time.Time
+	if *sourceEpoch >= 0 {
+		*reproducible = true
+		sourceDate = time.Unix(*sourceEpoch, 0).UTC()
+	} else if *reproducible {
+		epoch, err := core.SourceDateEpoch()
+		if err != nil {
+			log.Fatalf("错误: %v", err)
+		}
+		sourceDate = epoch
+	}
+	if *reproducible {
+		fmt.Printf("可复现构建: 是 (时间戳 %d)\n", sourceDate.Unix())
+	}
+	if rulesSpec != "" {
+		fmt.Printf("替换规则: %s\n", rulesSpec)
+	}
+	if *rewriteFlag != "" {
+		fmt.Printf("改写规则: %s\n", *rewriteFlag)
+	}
+	if *compression != "" {
+		fmt.Printf("压缩方式: %s\n", *compression)
+	}
 	fmt.Println("=============================")
 	fmt.Println()
 
@@ -54,6 +124,25 @@ func main() {
 
 	// 创建DEB修改器
 	modifier := core.NewDebModifier(inputPath, outputPath, magicName, port)
+	modifier.PatchPort = *patchPort
+	modifier.Arches = arches
+	modifier.Compression = *compression
+	modifier.Reproducible = *reproducible
+	modifier.SourceDate = sourceDate
+	if rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(rulesSpec)
+		if err != nil {
+			log.Fatalf("错误: 加载替换规则失败: %v", err)
+		}
+		modifier.Rules = rules
+	}
+	if *rewriteFlag != "" {
+		rewriteRules, err := core.LoadDebRewriteRules(*rewriteFlag)
+		if err != nil {
+			log.Fatalf("错误: 加载改写规则失败: %v", err)
+		}
+		modifier.RewriteRules = rewriteRules
+	}
 
 	// 进度回调函数
 	progressCallback := func(progress float64, message string) {
@@ -69,6 +158,18 @@ func main() {
 	fmt.Println()
 	fmt.Println("✅ DEB包修改成功完成!")
 
+	// 显示残留特征扫描结果
+	for _, report := range modifier.Reports {
+		fmt.Printf("残留特征 %s: %s\n", report.File, core.SummarizeFingerprints(report.Residual))
+	}
+
+	if *reportFormat != "" {
+		fmt.Println()
+		if err := core.WritePatchReports(os.Stdout, modifier.Reports, *reportFormat); err != nil {
+			log.Fatalf("错误: 输出替换报告失败: %v", err)
+		}
+	}
+
 	// 显示输出文件信息
 	if stat, err := os.Stat(outputPath); err == nil {
 		fmt.Printf("输出文件: %s\n", outputPath)
@@ -87,3 +188,124 @@ func main() {
 	fmt.Printf("  端口: %d\n", port)
 	fmt.Printf("  frida命令: frida -H <设备IP>:%d <进程名>\n", port)
 }
+
+func usage() {
+	fmt.Println("用法: fridare-patch.exe [选项] <输入DEB文件> <输出DEB文件> <魔改名称> [端口] [替换规则]")
+	fmt.Println("      fridare-patch.exe --dry-run [--report text|json] <输入DEB文件> <魔改名称>")
+	fmt.Println("      fridare-patch.exe --dry-run [--report text|json] <输入DEB文件> <输出DEB文件> <魔改名称> [端口] [替换规则]")
+	fmt.Println("      fridare-patch.exe inspect [--format text|json] <DEB文件>")
+	fmt.Println("示例: fridare-patch.exe frida_17.2.17_iphoneos-arm64.deb frida_modified.deb test-frida 27042")
+	fmt.Println("      fridare-patch.exe --dry-run --report json frida_17.2.17_iphoneos-arm64.deb abcde")
+	fmt.Println("      fridare-patch.exe --patch-port frida_17.2.17_iphoneos-arm64.deb frida_modified.deb abcde 31337")
+	fmt.Println("      fridare-patch.exe --arches arm64 frida_17.2.17_iphoneos-arm64.deb frida_modified.deb abcde")
+	fmt.Println("      fridare-patch.exe --reproducible frida_17.2.17_iphoneos-arm64.deb frida_modified.deb abcde")
+	fmt.Println("      fridare-patch.exe --rewrite my-layout.yaml repackaged-frida.deb frida_modified.deb abcde")
+	fmt.Println("      fridare-patch.exe inspect --format json frida_modified.deb")
+	fmt.Println("")
+	fmt.Println("说明:")
+	fmt.Println("  - 输入DEB文件: 原始的frida DEB包文件路径")
+	fmt.Println("  - 输出DEB文件: 修改后的DEB包输出路径")
+	fmt.Println("  - 魔改名称: 用于替换frida字符串的名称，1-5个字符 (更长的名称需字符串有剩余空间)")
+	fmt.Println("  - 端口: 可选，服务端口号，默认27042")
+	fmt.Println("  - 替换规则: 可选，规则文件路径或配置目录 rules 下的规则名，默认 default")
+	fmt.Println("  - --dry-run: 只预演不写文件，使用与修改相同的参数时输出DEB文件被忽略")
+	fmt.Println("  - 改写规则: --rewrite 指定，布局不同的第三方frida DEB包可参考内置规则 internal/core/rules/deb-default.yaml 编写")
+	fmt.Println("  - inspect: 查看DEB包的ar成员、压缩方式、control字段、维护脚本、文件列表 (权限/所有者/大小/哈希)、Mach-O切片和签名以及 rootful/rootless 布局")
+	fmt.Println("")
+	fmt.Println("选项:")
+	flag.PrintDefaults()
+}
+
+// runDryRun 预演DEB包修改并输出替换报告
+// positionalArgs 解析 <输入DEB文件> <输出DEB文件> <魔改名称> [端口] [替换规则] 中的
+// 魔改名称、端口和替换规则，未指定的端口和规则使用选项的值
+func positionalArgs(args []string, port int, rulesSpec string) (string, int, string) {
+	if len(args) > 3 {
+		fmt.Sscanf(args[3], "%d", &port)
+	}
+	if len(args) > 4 {
+		rulesSpec = args[4]
+	}
+	return args[2], port, rulesSpec
+}
+
+func runDryRun(inputPath, magicName, rulesSpec, rewritePath, reportFormat string, port int, patchPort bool, arches []string) {
+	if reportFormat == "" {
+		reportFormat = "text"
+	}
+
+	// 预演模式下日志输出到stderr，stdout只保留报告
+	log.SetOutput(os.Stderr)
+
+	if _, err := os.Stat(inputPath); os.IsNotExist(err) {
+		log.Fatalf("错误: 输入文件不存在: %s", inputPath)
+	}
+
+	modifier := core.NewDebModifier(inputPath, "", magicName, port)
+	modifier.PatchPort = patchPort
+	modifier.Arches = arches
+	if rulesSpec != "" {
+		rules, err := core.ResolveRuleSet(rulesSpec)
+		if err != nil {
+			log.Fatalf("错误: 加载替换规则失败: %v", err)
+		}
+		modifier.Rules = rules
+	}
+	if rewritePath != "" {
+		rewriteRules, err := core.LoadDebRewriteRules(rewritePath)
+		if err != nil {
+			log.Fatalf("错误: 加载改写规则失败: %v", err)
+		}
+		modifier.RewriteRules = rewriteRules
+	}
+
+	reports, err := modifier.PlanDebPackage(func(progress float64, message string) {
+		log.Printf("[%.0f%%] %s", progress*100, message)
+	})
+	if err != nil {
+		log.Fatalf("错误: 预演失败: %v", err)
+	}
+
+	if err := core.WritePatchReports(os.Stdout, reports, reportFormat); err != nil {
+		log.Fatalf("错误: 输出替换报告失败: %v", err)
+	}
+
+	for _, report := range reports {
+		if len(report.Problems) > 0 {
+			os.Exit(2)
+		}
+	}
+}
+
+// runInspect 检查DEB包结构并输出文本或JSON报告
+func runInspect(args []string) {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	format := fs.String("format", "text", "输出格式: text 或 json")
+	fs.Usage = func() {
+		fmt.Println("用法: fridare-patch.exe inspect [--format text|json] <DEB文件>")
+		fmt.Println("")
+		fmt.Println("选项:")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "错误: 未知的输出格式: %s (可选 text 或 json)\n", *format)
+		os.Exit(1)
+	}
+
+	log.SetOutput(os.Stderr)
+	inspection, err := core.InspectDeb(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("错误: 检查DEB包失败: %v", err)
+	}
+	if err := core.WriteDebInspection(os.Stdout, inspection, *format); err != nil {
+		log.Fatalf("错误: 输出检查结果失败: %v", err)
+	}
+	if len(inspection.Problems) > 0 {
+		os.Exit(2)
+	}
+}
@@ -5,7 +5,9 @@ go 1.21
 require (
 	fyne.io/fyne/v2 v2.6.2
 	github.com/go-resty/resty/v2 v2.16.5
+	github.com/klauspost/compress v1.17.11
 	github.com/ulikunitz/xz v0.5.13
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -40,5 +42,4 @@ require (
 	golang.org/x/net v0.35.0 // indirect
 	golang.org/x/sys v0.30.0 // indirect
 	golang.org/x/text v0.22.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
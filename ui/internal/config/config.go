@@ -22,6 +22,7 @@ type Config struct {
 	DefaultPort int    `json:"default_port"`
 	MagicName   string `json:"magic_name"`
 	AutoConfirm bool   `json:"auto_confirm"`
+	RuleProfile string `json:"rule_profile"` // 替换规则名, 空表示内置默认规则
 
 	// UI 配置
 	Theme        string `json:"theme"` // "light", "dark", "auto"
@@ -0,0 +1,477 @@
+package core
+
+import (
+	"archive/zip"
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"fridare-gui/internal/utils"
+)
+
+// Android ABI 名称
+var androidABIs = map[elf.Machine]string{
+	elf.EM_AARCH64: "arm64-v8a",
+	elf.EM_ARM:     "armeabi-v7a",
+	elf.EM_386:     "x86",
+	elf.EM_X86_64:  "x86_64",
+}
+
+// GadgetConfig frida-gadget 配置 (APK写入 lib<名称>.config.so，IPA写入 <名称>.config)
+type GadgetConfig struct {
+	Mode       string // listen 或 script
+	Address    string // listen 模式监听地址
+	Port       int    // listen 模式监听端口
+	OnLoad     string // listen 模式加载时行为: wait (等待连接) 或 resume
+	ScriptPath string // script 模式设备上的脚本路径
+	ScriptFile string // script 模式随APK打包的本地脚本，优先于 ScriptPath
+}
+
+// APKInjector 向APK注入frida-gadget: 按ABI写入改名后的gadget库和配置，
+// 生成在静态初始化中 System.loadLibrary 的Application子类并写入清单，
+// 最后对齐并使用用户密钥重新签名 (v1 + v2)
+//
+// 与在启动Activity中插入 System.loadLibrary 不同，gadget 由新增的 classesN.dex
+// 中的Application子类加载，不改写已有dex的字节码: 它早于任何Activity运行，覆盖
+// 应用的所有进程，并且无需重排已有dex的索引。代价是应用声明的Application类
+// 不能为final (Kotlin类默认为final)，这种APK会被拒绝而不是生成启动即崩溃的应用
+type APKInjector struct {
+	InputPath   string
+	OutputPath  string
+	MagicName   string
+	Gadgets     map[string]string // ABI -> 已魔改的frida-gadget .so 路径
+	LibName     string            // 注入的库名 (不含lib前缀和.so后缀)，默认 <魔改名>-gadget
+	LoaderClass string            // 加载gadget的Application类名，默认 <包名>.<魔改名>Application
+	Config      GadgetConfig
+	Key         *SigningKey // 重新签名使用的密钥
+	Result      *APKInjectResult
+}
+
+// APKInjectResult 注入结果
+type APKInjectResult struct {
+	Package          string   // 应用包名
+	LauncherActivity string   // 启动Activity (仅用于显示，gadget不在其中加载)
+	Application      string   // 原Application类 (空表示未声明)
+	LoaderClass      string   // 加载gadget的Application子类
+	DexName          string   // 新增的dex文件
+	Libraries        []string // 写入的gadget库、配置和脚本
+	SkippedABIs      []string // APK未包含对应原生库目录而跳过的ABI
+	Warnings         []string
+}
+
+// NewAPKInjector 创建APK注入器，默认以 listen 模式监听 127.0.0.1:27042
+func NewAPKInjector(inputPath, outputPath, magicName string) *APKInjector {
+	return &APKInjector{
+		InputPath:  inputPath,
+		OutputPath: outputPath,
+		MagicName:  magicName,
+		Gadgets:    make(map[string]string),
+		Config: GadgetConfig{
+			Mode:    "listen",
+			Address: "127.0.0.1",
+			Port:    27042,
+			OnLoad:  "wait",
+		},
+	}
+}
+
+// DetectGadgetABI 根据ELF机器类型判断gadget库的Android ABI
+func DetectGadgetABI(gadgetPath string) (string, error) {
+	f, err := elf.Open(gadgetPath)
+	if err != nil {
+		return "", fmt.Errorf("不是有效的ELF文件: %v", err)
+	}
+	defer f.Close()
+	if f.Type != elf.ET_DYN {
+		return "", fmt.Errorf("%s 不是共享库", gadgetPath)
+	}
+	return androidABI(f)
+}
+
+// DetectAndroidABI 根据ELF机器类型判断Android可执行文件 (如frida-server) 的ABI
+func DetectAndroidABI(path string) (string, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("不是有效的ELF文件: %v", err)
+	}
+	defer f.Close()
+	return androidABI(f)
+}
+
+// androidABI 返回ELF机器类型对应的Android ABI
+func androidABI(f *elf.File) (string, error) {
+	abi, ok := androidABIs[f.Machine]
+	if !ok {
+		return "", fmt.Errorf("不支持的架构: %v", f.Machine)
+	}
+	return abi, nil
+}
+
+// libraryFile 返回注入库的文件名
+func (ai *APKInjector) libraryFile(suffix string) string {
+	name := ai.LibName
+	if name == "" {
+		name = ai.MagicName + "-gadget"
+	}
+	return "lib" + name + suffix
+}
+
+// configJSON 生成gadget配置，script 为与gadget同目录打包的脚本文件名 (空表示不打包)
+func (c GadgetConfig) configJSON(script string) ([]byte, error) {
+	interaction := map[string]interface{}{}
+	switch c.Mode {
+	case "", "listen":
+		port := c.Port
+		if port == 0 {
+			port = 27042
+		}
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("端口必须在1-65535范围内")
+		}
+		address := c.Address
+		if address == "" {
+			address = "127.0.0.1"
+		}
+		onLoad := c.OnLoad
+		if onLoad == "" {
+			onLoad = "wait"
+		}
+		interaction["type"] = "listen"
+		interaction["address"] = address
+		interaction["port"] = port
+		interaction["on_port_conflict"] = "fail"
+		interaction["on_load"] = onLoad
+	case "script":
+		scriptPath := c.ScriptPath
+		if script != "" {
+			// 相对路径相对于gadget所在目录解析
+			scriptPath = script
+		}
+		if scriptPath == "" {
+			return nil, fmt.Errorf("script 模式需要指定脚本")
+		}
+		interaction["type"] = "script"
+		interaction["path"] = scriptPath
+		interaction["on_change"] = "ignore"
+	default:
+		return nil, fmt.Errorf("不支持的gadget模式: %s", c.Mode)
+	}
+	return json.MarshalIndent(map[string]interface{}{"interaction": interaction}, "", "  ")
+}
+
+// Inject 执行注入
+func (ai *APKInjector) Inject(progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始注入APK - 输入: %s, 输出: %s, 魔改名: %s", ai.InputPath, ai.OutputPath, ai.MagicName)
+	if ai.MagicName == "" {
+		return fmt.Errorf("未指定魔改名称")
+	}
+	if ai.Key == nil {
+		return fmt.Errorf("未指定签名密钥")
+	}
+	if len(ai.Gadgets) == 0 {
+		return fmt.Errorf("未指定frida-gadget库")
+	}
+	for abi, gadgetPath := range ai.Gadgets {
+		detected, err := DetectGadgetABI(gadgetPath)
+		if err != nil {
+			return fmt.Errorf("检查gadget %s 失败: %v", gadgetPath, err)
+		}
+		if detected != abi {
+			return fmt.Errorf("gadget %s 的架构为 %s，与指定的ABI %s 不符", gadgetPath, detected, abi)
+		}
+	}
+
+	progressCallback(0.1, "读取APK...")
+	reader, err := zip.OpenReader(ai.InputPath)
+	if err != nil {
+		return fmt.Errorf("打开APK失败: %v", err)
+	}
+	defer reader.Close()
+
+	files := make(map[string]*zip.File)
+	existingABIs := make(map[string]bool)
+	for _, f := range reader.File {
+		files[f.Name] = f
+		if parts := strings.Split(f.Name, "/"); len(parts) == 3 && parts[0] == "lib" && strings.HasSuffix(parts[2], ".so") {
+			existingABIs[parts[1]] = true
+		}
+	}
+	manifestFile := files["AndroidManifest.xml"]
+	if manifestFile == nil {
+		return fmt.Errorf("APK中没有AndroidManifest.xml")
+	}
+
+	// 1. 修改清单: 指定加载gadget的Application子类
+	progressCallback(0.2, "修改AndroidManifest.xml...")
+	manifestData, err := readZipFile(manifestFile)
+	if err != nil {
+		return fmt.Errorf("读取AndroidManifest.xml失败: %v", err)
+	}
+	result, newManifest, err := ai.patchManifest(manifestData)
+	if err != nil {
+		return fmt.Errorf("修改AndroidManifest.xml失败: %v", err)
+	}
+	ai.Result = result
+	log.Printf("INFO: 包名: %s, 启动Activity: %s, 原Application: %s", result.Package, result.LauncherActivity, result.Application)
+	if result.Application != "" {
+		if err := checkApplicationClass(files, result); err != nil {
+			return err
+		}
+	}
+
+	// 2. 生成加载gadget的dex
+	progressCallback(0.3, "生成加载gadget的dex...")
+	// ART 依次加载 classes.dex、classes2.dex ... 直到缺失的编号
+	result.DexName = "classes.dex"
+	for n := 2; files[result.DexName] != nil; n++ {
+		result.DexName = fmt.Sprintf("classes%d.dex", n)
+	}
+	libName := strings.TrimSuffix(strings.TrimPrefix(ai.libraryFile(".so"), "lib"), ".so")
+	superClass := result.Application
+	if superClass == "" {
+		superClass = "android.app.Application"
+	}
+	dex := buildLoaderDex(result.LoaderClass, superClass, libName)
+	log.Printf("INFO: 生成 %s: %s extends %s, 加载 lib%s.so", result.DexName, result.LoaderClass, superClass, libName)
+
+	// 3. 按ABI准备gadget库和配置
+	progressCallback(0.4, "准备frida-gadget库...")
+	var scriptData []byte
+	scriptName := ""
+	if ai.Config.Mode == "script" && ai.Config.ScriptFile != "" {
+		if scriptData, err = os.ReadFile(ai.Config.ScriptFile); err != nil {
+			return fmt.Errorf("读取脚本失败: %v", err)
+		}
+		scriptName = ai.libraryFile(".script.so")
+	}
+	config, err := ai.Config.configJSON(scriptName)
+	if err != nil {
+		return err
+	}
+
+	abis := make([]string, 0, len(ai.Gadgets))
+	for abi := range ai.Gadgets {
+		abis = append(abis, abi)
+	}
+	sort.Strings(abis)
+	added := make(map[string]*zipEntry)
+	for _, abi := range abis {
+		// APK已有原生库时只能注入这些ABI，否则设备会选择缺少应用原生库的ABI
+		if len(existingABIs) > 0 && !existingABIs[abi] {
+			result.SkippedABIs = append(result.SkippedABIs, abi)
+			log.Printf("WARNING: APK不包含 lib/%s 原生库，跳过该ABI的gadget", abi)
+			continue
+		}
+		data, err := os.ReadFile(ai.Gadgets[abi])
+		if err != nil {
+			return fmt.Errorf("读取gadget失败: %v", err)
+		}
+		dir := path.Join("lib", abi)
+		added[path.Join(dir, ai.libraryFile(".so"))] = &zipEntry{data: data, store: true}
+		added[path.Join(dir, ai.libraryFile(".config.so"))] = &zipEntry{data: config, store: true}
+		if scriptData != nil {
+			added[path.Join(dir, scriptName)] = &zipEntry{data: scriptData, store: true}
+		}
+	}
+	if len(added) == 0 {
+		return fmt.Errorf("APK的原生库ABI (%s) 与提供的gadget均不匹配", strings.Join(sortedABIs(existingABIs), ", "))
+	}
+	added[result.DexName] = &zipEntry{data: dex}
+
+	// 4. 组装新的APK条目: 去掉旧签名，替换清单
+	progressCallback(0.5, "重新打包APK...")
+	var entries []*zipEntry
+	for _, f := range reader.File {
+		switch {
+		case isAPKSignatureFile(f.Name):
+			continue
+		case added[f.Name] != nil:
+			log.Printf("WARNING: 替换APK中已有的 %s", f.Name)
+			continue
+		case f == manifestFile:
+			entries = append(entries, &zipEntry{name: f.Name, data: newManifest})
+		default:
+			entries = append(entries, &zipEntry{name: f.Name, file: f})
+		}
+	}
+	names := make([]string, 0, len(added))
+	for name := range added {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		entry := added[name]
+		entry.name = name
+		entries = append(entries, entry)
+		if strings.HasPrefix(name, "lib/") {
+			result.Libraries = append(result.Libraries, name)
+		}
+	}
+
+	// 5. 对齐并签名
+	progressCallback(0.7, "对齐并签名APK...")
+	log.Printf("INFO: 使用证书签名: %s", ai.Key.Certificate().Subject)
+	staged, err := utils.CreateAtomic(ai.OutputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer staged.Abort()
+	if err := writeSignedAPK(staged.File, entries, ai.Key); err != nil {
+		return fmt.Errorf("签名APK失败: %v", err)
+	}
+
+	progressCallback(0.9, "校验输出APK...")
+	if err := staged.Commit(func(tempPath string) error {
+		return verifyInjectedAPK(tempPath, result)
+	}); err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("WARNING: %s", warning)
+	}
+
+	progressCallback(1.0, "APK注入完成!")
+	log.Printf("SUCCESS: APK注入完成: %s", ai.OutputPath)
+	return nil
+}
+
+// patchManifest 将清单的Application替换为加载gadget的子类
+func (ai *APKInjector) patchManifest(data []byte) (*APKInjectResult, []byte, error) {
+	doc, err := parseAXML(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	manifest := doc.findElement("manifest")
+	app := doc.findElement("manifest", "application")
+	if manifest == nil || app == nil {
+		return nil, nil, fmt.Errorf("清单缺少 manifest 或 application 元素")
+	}
+
+	result := &APKInjectResult{Package: doc.attrString(manifest, 0, "package")}
+	if result.Package == "" {
+		return nil, nil, fmt.Errorf("清单缺少包名")
+	}
+	activity, target := doc.launcherActivity()
+	if target != "" {
+		activity = target
+	}
+	result.LauncherActivity = resolveClassName(result.Package, activity)
+	if result.LauncherActivity == "" {
+		result.Warnings = append(result.Warnings, "未找到启动Activity，gadget仍会在应用进程启动时加载")
+	}
+	result.Application = resolveClassName(result.Package, doc.attrString(app, androidAttrName, ""))
+
+	result.LoaderClass = ai.LoaderClass
+	if result.LoaderClass == "" {
+		result.LoaderClass = result.Package + "." + strings.ToUpper(ai.MagicName[:1]) + ai.MagicName[1:] + "Application"
+	}
+	if result.LoaderClass == result.Application {
+		return nil, nil, fmt.Errorf("APK的Application已是 %s，可能已经注入过", result.LoaderClass)
+	}
+
+	if sdk := doc.findElement("manifest", "uses-sdk"); sdk != nil {
+		if attr := doc.attr(sdk, androidAttrMinSdkVersion); attr != nil && attr.Value.Type == axmlTypeIntDec && attr.Value.Data < 21 {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("minSdkVersion为%d，Android 5.0以下系统不会加载 %s", attr.Value.Data, "classesN.dex"))
+		}
+	}
+
+	index := doc.addString(result.LoaderClass)
+	if err := doc.setAttr(app, androidAttrName, "name", axmlValue{Type: axmlTypeString, Data: index}, index); err != nil {
+		return nil, nil, err
+	}
+	// 没有代码的应用不会加载dex，压缩存储的原生库需要解压后gadget才能读取配置
+	for _, flag := range []struct {
+		id   uint32
+		name string
+	}{{androidAttrHasCode, "hasCode"}, {androidAttrExtractNativeLibs, "extractNativeLibs"}} {
+		if attr := doc.attr(app, flag.id); attr != nil && attr.Value.Type == axmlTypeBoolean && attr.Value.Data == 0 {
+			attr.Value.Data = 0xffffffff
+			result.Warnings = append(result.Warnings, fmt.Sprintf("已将 android:%s 改为 true", flag.name))
+		}
+	}
+	return result, doc.encode(), nil
+}
+
+// checkApplicationClass 确认应用声明的Application类可以被继承: ART拒绝加载
+// 继承final类的类，注入后应用会在启动时崩溃
+func checkApplicationClass(files map[string]*zip.File, result *APKInjectResult) error {
+	for name, n := "classes.dex", 2; files[name] != nil; name, n = fmt.Sprintf("classes%d.dex", n), n+1 {
+		data, err := readZipFile(files[name])
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", name, err)
+		}
+		flags, found, err := dexClassFlags(data, result.Application)
+		if err != nil {
+			return fmt.Errorf("解析 %s 失败: %v", name, err)
+		}
+		if !found {
+			continue
+		}
+		if flags&dexAccFinal != 0 {
+			return fmt.Errorf("APK的Application类 %s (%s) 为final (Kotlin类默认为final)，无法生成继承它的加载类", result.Application, name)
+		}
+		return nil
+	}
+	result.Warnings = append(result.Warnings, fmt.Sprintf("未在APK的dex中找到Application类 %s，无法确认它可以被继承", result.Application))
+	return nil
+}
+
+// verifyInjectedAPK 重新读取输出APK，确认清单和新增条目
+func verifyInjectedAPK(apkPath string, result *APKInjectResult) error {
+	reader, err := zip.OpenReader(apkPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	found := make(map[string]bool)
+	var manifest []byte
+	for _, f := range reader.File {
+		found[f.Name] = true
+		if f.Name == "AndroidManifest.xml" {
+			if manifest, err = readZipFile(f); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range append([]string{result.DexName}, result.Libraries...) {
+		if !found[name] {
+			return fmt.Errorf("缺少 %s", name)
+		}
+	}
+	doc, err := parseAXML(manifest)
+	if err != nil {
+		return err
+	}
+	app := doc.findElement("manifest", "application")
+	if app == nil || doc.attrString(app, androidAttrName, "") != result.LoaderClass {
+		return fmt.Errorf("清单的Application不是 %s", result.LoaderClass)
+	}
+	return nil
+}
+
+// readZipFile 读取ZIP条目内容
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// sortedABIs 返回排序后的ABI列表
+func sortedABIs(abis map[string]bool) []string {
+	list := make([]string, 0, len(abis))
+	for abi := range abis {
+		list = append(list, abi)
+	}
+	sort.Strings(list)
+	return list
+}
@@ -0,0 +1,511 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/big"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// APK signing constants, see https://source.android.com/docs/security/features/apksigning/v2
+const (
+	apkSigBlockMagic     = "APK Sig Block 42"
+	apkSignatureSchemeV2 = 0x7109871a
+	apkChunkSize         = 1 << 20
+
+	apkSigRSAPKCS1SHA256 = 0x0103
+	apkSigECDSASHA256    = 0x0201
+
+	zipEOCDSignature   = 0x06054b50
+	zipEOCDSize        = 22
+	zipLocalHeaderSize = 30
+	zipAlignmentExtra  = 0xd935 // zipalign's alignment extra field
+
+	// apkLibraryAlignment keeps uncompressed native libraries loadable in
+	// place on 4 KB and 16 KB page devices
+	apkLibraryAlignment = 16384
+)
+
+var (
+	oidRSAEncryption   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidPKCS7SignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// zipEntry is an entry of an APK or IPA being written: either an entry
+// copied verbatim from the source archive or new content
+type zipEntry struct {
+	name  string
+	file  *zip.File   // source entry, copied without recompressing
+	data  []byte      // new content when file is nil
+	store bool        // store new content uncompressed
+	mode  os.FileMode // permissions of new content, zero for the default
+}
+
+// aligned returns the data alignment zipalign would use for the entry
+func (e *zipEntry) aligned() int {
+	method := zip.Deflate
+	if e.file != nil {
+		method = e.file.Method
+	} else if e.store {
+		method = zip.Store
+	}
+	switch {
+	case method != zip.Store:
+		return 0
+	case strings.HasSuffix(e.name, ".so"):
+		return apkLibraryAlignment
+	}
+	return 4
+}
+
+// isAPKSignatureFile reports whether name is a v1 signature file that must
+// be dropped when an APK is re-signed
+func isAPKSignatureFile(name string) bool {
+	if !strings.HasPrefix(name, "META-INF/") || strings.Contains(name[len("META-INF/"):], "/") {
+		return false
+	}
+	base := strings.ToUpper(path.Base(name))
+	if base == "MANIFEST.MF" || strings.HasPrefix(base, "SIG-") {
+		return true
+	}
+	switch path.Ext(base) {
+	case ".SF", ".RSA", ".DSA", ".EC":
+		return true
+	}
+	return false
+}
+
+// writeSignedAPK writes entries to out as an aligned APK signed with both the
+// v1 (JAR) and v2 schemes; the unsigned intermediate is kept next to out
+func writeSignedAPK(out *os.File, entries []*zipEntry, key *SigningKey) error {
+	signature, err := signJAR(entries, key)
+	if err != nil {
+		return err
+	}
+
+	unsigned, err := os.CreateTemp(filepath.Dir(out.Name()), ".unsigned-*.apk")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(unsigned.Name())
+	defer unsigned.Close()
+
+	if err := writeAlignedZip(unsigned, append(signature, entries...)); err != nil {
+		return fmt.Errorf("error writing APK: %v", err)
+	}
+	return signAPKV2(unsigned, out, key)
+}
+
+// writeAlignedZip writes entries, padding the local headers of stored
+// entries so their data starts aligned
+func writeAlignedZip(w io.Writer, entries []*zipEntry) error {
+	counter := &countingWriter{w: w}
+	zw := zip.NewWriter(counter)
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		if seen[entry.name] {
+			return fmt.Errorf("duplicate entry %s", entry.name)
+		}
+		seen[entry.name] = true
+
+		header := &zip.FileHeader{Name: entry.name}
+		var raw io.Reader
+		if strings.HasSuffix(entry.name, "/") {
+			// Directories carry no data, whatever the source compressed
+			header.Method = zip.Store
+			if entry.file != nil {
+				header.ModifiedTime, header.ModifiedDate = entry.file.ModifiedTime, entry.file.ModifiedDate
+				header.ExternalAttrs = entry.file.ExternalAttrs
+			}
+			if _, err := zw.CreateRaw(header); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.file != nil {
+			src := entry.file.FileHeader
+			header.Method = src.Method
+			header.Flags = src.Flags &^ 0x8
+			header.CRC32 = src.CRC32
+			header.CompressedSize64 = src.CompressedSize64
+			header.UncompressedSize64 = src.UncompressedSize64
+			header.ModifiedTime, header.ModifiedDate = src.ModifiedTime, src.ModifiedDate
+			header.ExternalAttrs = src.ExternalAttrs
+			r, err := entry.file.OpenRaw()
+			if err != nil {
+				return err
+			}
+			raw = r
+		} else {
+			compressed, method, err := compressEntry(entry.data, entry.store)
+			if err != nil {
+				return err
+			}
+			header.Method = method
+			header.CRC32 = crc32.ChecksumIEEE(entry.data)
+			header.CompressedSize64 = uint64(len(compressed))
+			header.UncompressedSize64 = uint64(len(entry.data))
+			header.ModifiedTime, header.ModifiedDate = 0, 0x21 // 1980-01-01
+			if entry.mode != 0 {
+				header.SetMode(entry.mode)
+			}
+			raw = bytes.NewReader(compressed)
+		}
+
+		if align := entry.aligned(); align > 0 {
+			if err := zw.Flush(); err != nil {
+				return err
+			}
+			start := counter.n + zipLocalHeaderSize + int64(len(entry.name))
+			pad := (align - int((start+6)%int64(align))) % align
+			extra := make([]byte, 6+pad)
+			binary.LittleEndian.PutUint16(extra, zipAlignmentExtra)
+			binary.LittleEndian.PutUint16(extra[2:], uint16(2+pad))
+			binary.LittleEndian.PutUint16(extra[4:], uint16(align))
+			header.Extra = extra
+		}
+
+		fw, err := zw.CreateRaw(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(fw, raw); err != nil {
+			return fmt.Errorf("error copying %s: %v", entry.name, err)
+		}
+	}
+	return zw.Close()
+}
+
+// compressEntry deflates data unless it should be stored
+func compressEntry(data []byte, store bool) ([]byte, uint16, error) {
+	if store {
+		return data, zip.Store, nil
+	}
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, 0, err
+	}
+	fw.Write(data)
+	if err := fw.Close(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), zip.Deflate, nil
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// signJAR builds the v1 signature entries: MANIFEST.MF with the digest of
+// every entry, CERT.SF with the digests of the manifest and its sections, and
+// the PKCS#7 signature of CERT.SF
+func signJAR(entries []*zipEntry, key *SigningKey) ([]*zipEntry, error) {
+	var manifest bytes.Buffer
+	manifest.WriteString("Manifest-Version: 1.0\r\nCreated-By: 1.0 (Android)\r\n\r\n")
+	var sections bytes.Buffer
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.name, "/") {
+			continue
+		}
+		h := sha256.New()
+		if entry.file != nil {
+			r, err := entry.file.Open()
+			if err != nil {
+				return nil, err
+			}
+			_, err = io.Copy(h, r)
+			r.Close()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %v", entry.name, err)
+			}
+		} else {
+			h.Write(entry.data)
+		}
+
+		section := manifestLine("Name: "+entry.name) +
+			manifestLine("SHA-256-Digest: "+base64.StdEncoding.EncodeToString(h.Sum(nil))) + "\r\n"
+		manifest.WriteString(section)
+		sectionDigest := sha256.Sum256([]byte(section))
+		sections.WriteString(manifestLine("Name: " + entry.name))
+		sections.WriteString(manifestLine("SHA-256-Digest: " + base64.StdEncoding.EncodeToString(sectionDigest[:])))
+		sections.WriteString("\r\n")
+	}
+
+	manifestDigest := sha256.Sum256(manifest.Bytes())
+	var sf bytes.Buffer
+	sf.WriteString("Signature-Version: 1.0\r\nCreated-By: 1.0 (Android)\r\n")
+	sf.WriteString(manifestLine("SHA-256-Digest-Manifest: " + base64.StdEncoding.EncodeToString(manifestDigest[:])))
+	// Tells v2-aware verifiers to reject the APK if the v2 signature is stripped
+	sf.WriteString("X-Android-APK-Signed: 2\r\n\r\n")
+	sf.Write(sections.Bytes())
+
+	block, err := pkcs7Sign(sf.Bytes(), key)
+	if err != nil {
+		return nil, err
+	}
+	blockName := "META-INF/CERT.RSA"
+	if _, ok := key.PrivateKey.(*ecdsa.PrivateKey); ok {
+		blockName = "META-INF/CERT.EC"
+	}
+	return []*zipEntry{
+		{name: "META-INF/MANIFEST.MF", data: manifest.Bytes()},
+		{name: "META-INF/CERT.SF", data: sf.Bytes()},
+		{name: blockName, data: block},
+	}, nil
+}
+
+// manifestLine wraps a JAR manifest line at 72 bytes with continuation lines
+func manifestLine(line string) string {
+	var b strings.Builder
+	for first := true; ; first = false {
+		limit := 72
+		if !first {
+			b.WriteString(" ")
+			limit = 71
+		}
+		if len(line) <= limit {
+			b.WriteString(line)
+			b.WriteString("\r\n")
+			return b.String()
+		}
+		b.WriteString(line[:limit])
+		b.WriteString("\r\n")
+		line = line[limit:]
+	}
+}
+
+// PKCS#7 SignedData without signed attributes, as used by APK v1 signatures
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+	Certificates     asn1.RawValue     `asn1:"tag:0,optional"`
+	SignerInfos      []pkcs7SignerInfo `asn1:"set"`
+}
+
+type pkcs7SignerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     pkcs7IssuerAndSerial
+	DigestAlgorithm           pkix.AlgorithmIdentifier
+	DigestEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7IssuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+// pkcs7Sign creates a detached PKCS#7 signature of content
+func pkcs7Sign(content []byte, key *SigningKey) ([]byte, error) {
+	digest := sha256.Sum256(content)
+	signature, err := key.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error signing: %v", err)
+	}
+
+	encryption := pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}
+	if _, ok := key.PrivateKey.(*ecdsa.PrivateKey); ok {
+		encryption = pkix.AlgorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	}
+	sha256Algorithm := pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue}
+
+	var certs []byte
+	for _, cert := range key.Certificates {
+		certs = append(certs, cert.Raw...)
+	}
+	signed := pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256Algorithm},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs},
+		SignerInfos: []pkcs7SignerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: pkcs7IssuerAndSerial{
+				Issuer: asn1.RawValue{FullBytes: key.Certificate().RawIssuer},
+				Serial: key.Certificate().SerialNumber,
+			},
+			DigestAlgorithm:           sha256Algorithm,
+			DigestEncryptionAlgorithm: encryption,
+			EncryptedDigest:           signature,
+		}},
+	}
+	signed.ContentInfo.ContentType = oidPKCS7Data
+	inner, err := asn1.Marshal(signed)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidPKCS7SignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner},
+	})
+}
+
+// signAPKV2 writes the unsigned APK to out with an APK Signing Block holding
+// a v2 signature inserted between the entries and the central directory
+func signAPKV2(unsigned *os.File, out io.Writer, key *SigningKey) error {
+	info, err := unsigned.Stat()
+	if err != nil {
+		return err
+	}
+	eocdOffset, eocd, err := findEOCD(unsigned, info.Size())
+	if err != nil {
+		return err
+	}
+	cdOffset := int64(binary.LittleEndian.Uint32(eocd[16:]))
+	if cdOffset > eocdOffset {
+		return errors.New("central directory lies after its end record")
+	}
+
+	// Digest the entries, the central directory and the end record in 1 MB
+	// chunks
+	var chunks [][]byte
+	for _, section := range []io.Reader{
+		io.NewSectionReader(unsigned, 0, cdOffset),
+		io.NewSectionReader(unsigned, cdOffset, eocdOffset-cdOffset),
+		bytes.NewReader(eocd),
+	} {
+		buf := make([]byte, apkChunkSize)
+		for {
+			n, err := io.ReadFull(section, buf)
+			if n > 0 {
+				h := sha256.New()
+				h.Write([]byte{0xa5})
+				binary.Write(h, binary.LittleEndian, uint32(n))
+				h.Write(buf[:n])
+				chunks = append(chunks, h.Sum(nil))
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	top := sha256.New()
+	top.Write([]byte{0x5a})
+	binary.Write(top, binary.LittleEndian, uint32(len(chunks)))
+	for _, chunk := range chunks {
+		top.Write(chunk)
+	}
+
+	algorithm := uint32(apkSigRSAPKCS1SHA256)
+	if _, ok := key.PrivateKey.(*ecdsa.PrivateKey); ok {
+		algorithm = apkSigECDSASHA256
+	} else if _, ok := key.PrivateKey.(*rsa.PrivateKey); !ok {
+		return fmt.Errorf("unsupported signing key %T", key.PrivateKey)
+	}
+
+	var certs [][]byte
+	for _, cert := range key.Certificates {
+		certs = append(certs, cert.Raw)
+	}
+	signedData := bytes.Join([][]byte{
+		lengthPrefixed(lengthPrefixed(binary.LittleEndian.AppendUint32(nil, algorithm), lengthPrefixed(top.Sum(nil)))),
+		lengthPrefixed(lengthPrefixedList(certs)...),
+		lengthPrefixed(), // no additional attributes
+	}, nil)
+	digest := sha256.Sum256(signedData)
+	signature, err := key.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("error signing: %v", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(key.PrivateKey.Public())
+	if err != nil {
+		return err
+	}
+	signer := bytes.Join([][]byte{
+		lengthPrefixed(signedData),
+		lengthPrefixed(lengthPrefixed(binary.LittleEndian.AppendUint32(nil, algorithm), lengthPrefixed(signature))),
+		lengthPrefixed(publicKey),
+	}, nil)
+	value := lengthPrefixed(lengthPrefixed(signer))
+
+	var pair []byte
+	pair = binary.LittleEndian.AppendUint64(pair, uint64(4+len(value)))
+	pair = binary.LittleEndian.AppendUint32(pair, apkSignatureSchemeV2)
+	pair = append(pair, value...)
+	blockSize := uint64(len(pair) + 8 + len(apkSigBlockMagic))
+	block := binary.LittleEndian.AppendUint64(nil, blockSize)
+	block = append(block, pair...)
+	block = binary.LittleEndian.AppendUint64(block, blockSize)
+	block = append(block, apkSigBlockMagic...)
+
+	if _, err := io.Copy(out, io.NewSectionReader(unsigned, 0, cdOffset)); err != nil {
+		return err
+	}
+	if _, err := out.Write(block); err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(unsigned, cdOffset, eocdOffset-cdOffset)); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(eocd[16:], uint32(cdOffset+int64(len(block))))
+	_, err = out.Write(eocd)
+	return err
+}
+
+// findEOCD locates the end of central directory record
+func findEOCD(r io.ReaderAt, size int64) (int64, []byte, error) {
+	search := min(size, zipEOCDSize+0xffff)
+	buf := make([]byte, search)
+	if _, err := r.ReadAt(buf, size-search); err != nil {
+		return 0, nil, err
+	}
+	for i := len(buf) - zipEOCDSize; i >= 0; i-- {
+		if binary.LittleEndian.Uint32(buf[i:]) == zipEOCDSignature &&
+			i+zipEOCDSize+int(binary.LittleEndian.Uint16(buf[i+20:])) == len(buf) {
+			if binary.LittleEndian.Uint32(buf[i+16:]) == 0xffffffff {
+				return 0, nil, errors.New("ZIP64 APKs are not supported")
+			}
+			return size - search + int64(i), append([]byte(nil), buf[i:]...), nil
+		}
+	}
+	return 0, nil, errors.New("end of central directory not found")
+}
+
+// lengthPrefixed concatenates parts behind a little-endian uint32 length
+func lengthPrefixed(parts ...[]byte) []byte {
+	var body []byte
+	for _, part := range parts {
+		body = append(body, part...)
+	}
+	return append(binary.LittleEndian.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+// lengthPrefixedList prefixes each item with its length
+func lengthPrefixedList(items [][]byte) [][]byte {
+	out := make([][]byte, len(items))
+	for i, item := range items {
+		out[i] = lengthPrefixed(item)
+	}
+	return out
+}
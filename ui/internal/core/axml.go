@@ -0,0 +1,606 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Android binary XML chunk types, see frameworks/base/libs/androidfw/include/androidfw/ResourceTypes.h
+const (
+	axmlChunkStringPool   = 0x0001
+	axmlChunkXML          = 0x0003
+	axmlChunkStartNS      = 0x0100
+	axmlChunkEndNS        = 0x0101
+	axmlChunkStartElement = 0x0102
+	axmlChunkEndElement   = 0x0103
+	axmlChunkCData        = 0x0104
+	axmlChunkResourceMap  = 0x0180
+
+	axmlStringPoolSorted = 0x1
+	axmlStringPoolUTF8   = 0x100
+
+	axmlTypeString  = 0x03
+	axmlTypeIntDec  = 0x10
+	axmlTypeBoolean = 0x12
+
+	axmlNoIndex = 0xffffffff
+
+	androidNamespace = "http://schemas.android.com/apk/res/android"
+
+	// Framework attribute resource IDs
+	androidAttrName              = 0x01010003
+	androidAttrHasCode           = 0x0101000c
+	androidAttrTargetActivity    = 0x01010202
+	androidAttrMinSdkVersion     = 0x0101020c
+	androidAttrExtractNativeLibs = 0x010104ea
+)
+
+// axmlDocument is a parsed Android binary XML file, such as the compiled
+// AndroidManifest.xml of an APK. Strings are referenced by their index in
+// the string pool, the first of which map to attribute resource IDs.
+type axmlDocument struct {
+	strings     []string
+	poolFlags   uint32
+	styles      []uint32 // style offsets relative to the style data
+	styleData   []byte
+	resourceIDs []uint32
+	nodes       []*axmlNode
+}
+
+// axmlNode is a namespace, element or CDATA chunk. Namespaces keep their
+// prefix in NS and URI in Name; CDATA keeps its text in Name.
+type axmlNode struct {
+	Type       uint16
+	Line       uint32
+	Comment    uint32
+	NS         uint32
+	Name       uint32
+	Attrs      []axmlAttr
+	IDIndex    uint16
+	ClassIndex uint16
+	StyleIndex uint16
+	Typed      axmlValue
+}
+
+// axmlAttr is an attribute of a start element
+type axmlAttr struct {
+	NS    uint32
+	Name  uint32
+	Raw   uint32
+	Value axmlValue
+}
+
+// axmlValue is a typed Res_value
+type axmlValue struct {
+	Type uint8
+	Data uint32
+}
+
+// parseAXML parses an Android binary XML file
+func parseAXML(data []byte) (*axmlDocument, error) {
+	if len(data) < 8 || binary.LittleEndian.Uint16(data) != axmlChunkXML {
+		return nil, errors.New("not an Android binary XML file")
+	}
+	headerSize := int(binary.LittleEndian.Uint16(data[2:]))
+	size := int(binary.LittleEndian.Uint32(data[4:]))
+	if size > len(data) || headerSize < 8 || headerSize > size {
+		return nil, errors.New("truncated binary XML file")
+	}
+
+	doc := &axmlDocument{}
+	for pos := headerSize; pos+8 <= size; {
+		chunkType := binary.LittleEndian.Uint16(data[pos:])
+		chunkHeader := int(binary.LittleEndian.Uint16(data[pos+2:]))
+		chunkSize := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if chunkSize < 8 || chunkHeader > chunkSize || pos+chunkSize > size {
+			return nil, fmt.Errorf("malformed chunk at 0x%x", pos)
+		}
+		chunk := data[pos : pos+chunkSize]
+
+		switch chunkType {
+		case axmlChunkStringPool:
+			if err := doc.parseStringPool(chunk, chunkHeader); err != nil {
+				return nil, err
+			}
+		case axmlChunkResourceMap:
+			for i := chunkHeader; i+4 <= chunkSize; i += 4 {
+				doc.resourceIDs = append(doc.resourceIDs, binary.LittleEndian.Uint32(chunk[i:]))
+			}
+		case axmlChunkStartNS, axmlChunkEndNS, axmlChunkStartElement, axmlChunkEndElement, axmlChunkCData:
+			node, err := parseAXMLNode(chunkType, chunk, chunkHeader)
+			if err != nil {
+				return nil, fmt.Errorf("chunk at 0x%x: %v", pos, err)
+			}
+			doc.nodes = append(doc.nodes, node)
+		default:
+			return nil, fmt.Errorf("unsupported chunk type 0x%x at 0x%x", chunkType, pos)
+		}
+		pos += chunkSize
+	}
+	return doc, nil
+}
+
+// parseStringPool decodes a ResStringPool chunk
+func (d *axmlDocument) parseStringPool(chunk []byte, headerSize int) error {
+	if headerSize < 28 {
+		return errors.New("malformed string pool header")
+	}
+	count := int(binary.LittleEndian.Uint32(chunk[8:]))
+	styleCount := int(binary.LittleEndian.Uint32(chunk[12:]))
+	d.poolFlags = binary.LittleEndian.Uint32(chunk[16:])
+	stringsStart := int(binary.LittleEndian.Uint32(chunk[20:]))
+	stylesStart := int(binary.LittleEndian.Uint32(chunk[24:]))
+	if headerSize+4*(count+styleCount) > len(chunk) || stringsStart > len(chunk) || stylesStart > len(chunk) {
+		return errors.New("truncated string pool")
+	}
+
+	utf8 := d.poolFlags&axmlStringPoolUTF8 != 0
+	d.strings = make([]string, count)
+	for i := range d.strings {
+		offset := stringsStart + int(binary.LittleEndian.Uint32(chunk[headerSize+4*i:]))
+		s, err := decodePoolString(chunk, offset, utf8)
+		if err != nil {
+			return fmt.Errorf("string %d: %v", i, err)
+		}
+		d.strings[i] = s
+	}
+
+	if styleCount > 0 {
+		d.styles = make([]uint32, styleCount)
+		for i := range d.styles {
+			d.styles[i] = binary.LittleEndian.Uint32(chunk[headerSize+4*(count+i):])
+		}
+		if stylesStart == 0 {
+			return errors.New("string pool has styles but no style data")
+		}
+		d.styleData = append([]byte(nil), chunk[stylesStart:]...)
+	}
+	return nil
+}
+
+// decodePoolString decodes the string at offset of a string pool
+func decodePoolString(chunk []byte, offset int, utf8 bool) (string, error) {
+	if utf8 {
+		// UTF-16 length then UTF-8 length, each one or two bytes
+		_, n := poolLength8(chunk, offset)
+		if n == 0 {
+			return "", errors.New("truncated string")
+		}
+		length, m := poolLength8(chunk, offset+n)
+		start := offset + n + m
+		if m == 0 || start+length > len(chunk) {
+			return "", errors.New("truncated string")
+		}
+		return string(chunk[start : start+length]), nil
+	}
+
+	if offset+2 > len(chunk) {
+		return "", errors.New("truncated string")
+	}
+	length := int(binary.LittleEndian.Uint16(chunk[offset:]))
+	start := offset + 2
+	if length&0x8000 != 0 {
+		if offset+4 > len(chunk) {
+			return "", errors.New("truncated string")
+		}
+		length = (length&0x7fff)<<16 | int(binary.LittleEndian.Uint16(chunk[offset+2:]))
+		start += 2
+	}
+	if start+2*length > len(chunk) {
+		return "", errors.New("truncated string")
+	}
+	units := make([]uint16, length)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(chunk[start+2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// poolLength8 reads a one or two byte length of a UTF-8 string pool
+func poolLength8(chunk []byte, offset int) (int, int) {
+	if offset >= len(chunk) {
+		return 0, 0
+	}
+	length := int(chunk[offset])
+	if length&0x80 == 0 {
+		return length, 1
+	}
+	if offset+1 >= len(chunk) {
+		return 0, 0
+	}
+	return (length&0x7f)<<8 | int(chunk[offset+1]), 2
+}
+
+// parseAXMLNode decodes an XML tree node chunk
+func parseAXMLNode(chunkType uint16, chunk []byte, headerSize int) (*axmlNode, error) {
+	if headerSize < 16 {
+		return nil, errors.New("malformed node header")
+	}
+	node := &axmlNode{
+		Type:    chunkType,
+		Line:    binary.LittleEndian.Uint32(chunk[8:]),
+		Comment: binary.LittleEndian.Uint32(chunk[12:]),
+	}
+	ext := chunk[headerSize:]
+	u32 := func(off int) uint32 { return binary.LittleEndian.Uint32(ext[off:]) }
+	u16 := func(off int) uint16 { return binary.LittleEndian.Uint16(ext[off:]) }
+
+	switch chunkType {
+	case axmlChunkStartNS, axmlChunkEndNS, axmlChunkEndElement:
+		if len(ext) < 8 {
+			return nil, errors.New("truncated node")
+		}
+		node.NS, node.Name = u32(0), u32(4)
+	case axmlChunkCData:
+		if len(ext) < 12 {
+			return nil, errors.New("truncated node")
+		}
+		node.Name = u32(0)
+		node.Typed = axmlValue{Type: ext[7], Data: u32(8)}
+	case axmlChunkStartElement:
+		if len(ext) < 20 {
+			return nil, errors.New("truncated node")
+		}
+		node.NS, node.Name = u32(0), u32(4)
+		attrStart, attrSize, count := int(u16(8)), int(u16(10)), int(u16(12))
+		node.IDIndex, node.ClassIndex, node.StyleIndex = u16(14), u16(16), u16(18)
+		if attrSize < 20 || attrStart+attrSize*count > len(ext) {
+			return nil, errors.New("truncated attributes")
+		}
+		for i := 0; i < count; i++ {
+			off := attrStart + attrSize*i
+			node.Attrs = append(node.Attrs, axmlAttr{
+				NS:    u32(off),
+				Name:  u32(off + 4),
+				Raw:   u32(off + 8),
+				Value: axmlValue{Type: ext[off+15], Data: u32(off + 16)},
+			})
+		}
+	}
+	return node, nil
+}
+
+// encode serializes the document
+func (d *axmlDocument) encode() []byte {
+	var body bytes.Buffer
+	body.Write(d.encodeStringPool())
+
+	if len(d.resourceIDs) > 0 {
+		writeChunkHeader(&body, axmlChunkResourceMap, 8, 8+4*len(d.resourceIDs))
+		for _, id := range d.resourceIDs {
+			binary.Write(&body, binary.LittleEndian, id)
+		}
+	}
+
+	for _, node := range d.nodes {
+		var ext []byte
+		le := binary.LittleEndian
+		switch node.Type {
+		case axmlChunkStartNS, axmlChunkEndNS, axmlChunkEndElement:
+			ext = le.AppendUint32(le.AppendUint32(nil, node.NS), node.Name)
+		case axmlChunkCData:
+			ext = le.AppendUint32(nil, node.Name)
+			ext = append(le.AppendUint16(ext, 8), 0, node.Typed.Type)
+			ext = le.AppendUint32(ext, node.Typed.Data)
+		case axmlChunkStartElement:
+			ext = le.AppendUint32(le.AppendUint32(nil, node.NS), node.Name)
+			for _, v := range []uint16{20, 20, uint16(len(node.Attrs)), node.IDIndex, node.ClassIndex, node.StyleIndex} {
+				ext = le.AppendUint16(ext, v)
+			}
+			for _, attr := range node.Attrs {
+				ext = le.AppendUint32(le.AppendUint32(le.AppendUint32(ext, attr.NS), attr.Name), attr.Raw)
+				ext = append(le.AppendUint16(ext, 8), 0, attr.Value.Type)
+				ext = le.AppendUint32(ext, attr.Value.Data)
+			}
+		}
+		writeChunkHeader(&body, node.Type, 16, 16+len(ext))
+		binary.Write(&body, le, node.Line)
+		binary.Write(&body, le, node.Comment)
+		body.Write(ext)
+	}
+
+	var out bytes.Buffer
+	writeChunkHeader(&out, axmlChunkXML, 8, 8+body.Len())
+	out.Write(body.Bytes())
+	return out.Bytes()
+}
+
+// encodeStringPool serializes the string pool in its original encoding
+func (d *axmlDocument) encodeStringPool() []byte {
+	utf8 := d.poolFlags&axmlStringPoolUTF8 != 0
+	var data []byte
+	offsets := make([]uint32, len(d.strings))
+	for i, s := range d.strings {
+		offsets[i] = uint32(len(data))
+		if utf8 {
+			data = appendPoolLength8(data, len(utf16.Encode([]rune(s))))
+			data = appendPoolLength8(data, len(s))
+			data = append(append(data, s...), 0)
+			continue
+		}
+		units := utf16.Encode([]rune(s))
+		if len(units) > 0x7fff {
+			data = binary.LittleEndian.AppendUint16(data, uint16(len(units)>>16)|0x8000)
+		}
+		data = binary.LittleEndian.AppendUint16(data, uint16(len(units)))
+		for _, unit := range units {
+			data = binary.LittleEndian.AppendUint16(data, unit)
+		}
+		data = append(data, 0, 0)
+	}
+	for len(data)%4 != 0 {
+		data = append(data, 0)
+	}
+
+	const headerSize = 28
+	stringsStart := headerSize + 4*(len(offsets)+len(d.styles))
+	stylesStart := 0
+	if len(d.styles) > 0 {
+		stylesStart = stringsStart + len(data)
+	}
+	size := stringsStart + len(data) + len(d.styleData)
+
+	var out bytes.Buffer
+	writeChunkHeader(&out, axmlChunkStringPool, headerSize, size)
+	for _, v := range []uint32{uint32(len(offsets)), uint32(len(d.styles)), d.poolFlags, uint32(stringsStart), uint32(stylesStart)} {
+		binary.Write(&out, binary.LittleEndian, v)
+	}
+	binary.Write(&out, binary.LittleEndian, offsets)
+	binary.Write(&out, binary.LittleEndian, d.styles)
+	out.Write(data)
+	out.Write(d.styleData)
+	return out.Bytes()
+}
+
+// appendPoolLength8 appends a one or two byte length of a UTF-8 string pool
+func appendPoolLength8(data []byte, length int) []byte {
+	if length > 0x7f {
+		return append(data, byte(length>>8)|0x80, byte(length))
+	}
+	return append(data, byte(length))
+}
+
+// writeChunkHeader writes a ResChunk_header
+func writeChunkHeader(buf *bytes.Buffer, chunkType uint16, headerSize, size int) {
+	binary.Write(buf, binary.LittleEndian, chunkType)
+	binary.Write(buf, binary.LittleEndian, uint16(headerSize))
+	binary.Write(buf, binary.LittleEndian, uint32(size))
+}
+
+// str returns the string at index i, or "" for no string
+func (d *axmlDocument) str(i uint32) string {
+	if int(i) < len(d.strings) {
+		return d.strings[i]
+	}
+	return ""
+}
+
+// stringIndex returns the index of s in the string pool, or -1
+func (d *axmlDocument) stringIndex(s string) int {
+	for i, v := range d.strings {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// addString appends s to the string pool unless it is already there
+func (d *axmlDocument) addString(s string) uint32 {
+	if i := d.stringIndex(s); i >= 0 {
+		return uint32(i)
+	}
+	d.strings = append(d.strings, s)
+	d.poolFlags &^= axmlStringPoolSorted
+	return uint32(len(d.strings) - 1)
+}
+
+// attributeName returns the string index naming the attribute with the given
+// resource ID, adding it to the resource-mapped part of the pool if needed
+func (d *axmlDocument) attributeName(resID uint32, name string) uint32 {
+	for i, id := range d.resourceIDs {
+		if id == resID {
+			return uint32(i)
+		}
+	}
+
+	// Resource-mapped strings come first, so every later index shifts by one
+	at := uint32(len(d.resourceIDs))
+	d.strings = append(d.strings[:at], append([]string{name}, d.strings[at:]...)...)
+	d.resourceIDs = append(d.resourceIDs, resID)
+	d.poolFlags &^= axmlStringPoolSorted
+	shift := func(i *uint32) {
+		if *i != axmlNoIndex && *i >= at {
+			*i++
+		}
+	}
+	for _, node := range d.nodes {
+		shift(&node.Comment)
+		shift(&node.NS)
+		shift(&node.Name)
+		if node.Typed.Type == axmlTypeString {
+			shift(&node.Typed.Data)
+		}
+		for i := range node.Attrs {
+			attr := &node.Attrs[i]
+			shift(&attr.NS)
+			shift(&attr.Name)
+			shift(&attr.Raw)
+			if attr.Value.Type == axmlTypeString {
+				shift(&attr.Value.Data)
+			}
+		}
+	}
+	// Style spans start with the string index of their tag name
+	for _, offset := range d.styles {
+		for pos := int(offset); pos+12 <= len(d.styleData); pos += 12 {
+			index := binary.LittleEndian.Uint32(d.styleData[pos:])
+			if index == axmlNoIndex {
+				break
+			}
+			shift(&index)
+			binary.LittleEndian.PutUint32(d.styleData[pos:], index)
+		}
+	}
+	return at
+}
+
+// attrResourceID returns the resource ID of an attribute name, or 0
+func (d *axmlDocument) attrResourceID(attr *axmlAttr) uint32 {
+	if int(attr.Name) < len(d.resourceIDs) {
+		return d.resourceIDs[attr.Name]
+	}
+	return 0
+}
+
+// attr finds the attribute of node with the given resource ID
+func (d *axmlDocument) attr(node *axmlNode, resID uint32) *axmlAttr {
+	for i := range node.Attrs {
+		if d.attrResourceID(&node.Attrs[i]) == resID {
+			return &node.Attrs[i]
+		}
+	}
+	return nil
+}
+
+// attrString returns the string value of an attribute, matched by resource
+// ID or, when resID is 0, by its unqualified name
+func (d *axmlDocument) attrString(node *axmlNode, resID uint32, name string) string {
+	for i := range node.Attrs {
+		attr := &node.Attrs[i]
+		if resID != 0 && d.attrResourceID(attr) != resID {
+			continue
+		}
+		if resID == 0 && (attr.NS != axmlNoIndex || d.str(attr.Name) != name) {
+			continue
+		}
+		if attr.Value.Type == axmlTypeString {
+			return d.str(attr.Value.Data)
+		}
+		return d.str(attr.Raw)
+	}
+	return ""
+}
+
+// setAttr sets an android: attribute of node, inserting it in resource ID
+// order as the framework expects when it is missing
+func (d *axmlDocument) setAttr(node *axmlNode, resID uint32, name string, value axmlValue, raw uint32) error {
+	if attr := d.attr(node, resID); attr != nil {
+		attr.Raw, attr.Value = raw, value
+		return nil
+	}
+	ns := d.stringIndex(androidNamespace)
+	if ns < 0 {
+		return errors.New("manifest does not declare the android namespace")
+	}
+	count := len(d.strings)
+	nameIndex := d.attributeName(resID, name)
+	if len(d.strings) > count && value.Type == axmlTypeString && value.Data >= nameIndex {
+		// The value string shifted with the new attribute name
+		value.Data++
+		raw++
+	}
+
+	at := len(node.Attrs)
+	for i := range node.Attrs {
+		if id := d.attrResourceID(&node.Attrs[i]); id == 0 || id > resID {
+			at = i
+			break
+		}
+	}
+	attr := axmlAttr{NS: uint32(ns), Name: nameIndex, Raw: raw, Value: value}
+	node.Attrs = append(node.Attrs[:at], append([]axmlAttr{attr}, node.Attrs[at:]...)...)
+
+	// id, class and style attribute indexes are 1-based
+	for _, index := range []*uint16{&node.IDIndex, &node.ClassIndex, &node.StyleIndex} {
+		if *index != 0 && int(*index) > at {
+			*index++
+		}
+	}
+	return nil
+}
+
+// findElement returns the first start element whose path from the root
+// matches path, e.g. manifest/application
+func (d *axmlDocument) findElement(path ...string) *axmlNode {
+	var stack []string
+	for _, node := range d.nodes {
+		switch node.Type {
+		case axmlChunkStartElement:
+			stack = append(stack, d.str(node.Name))
+			if equalPath(stack, path) {
+				return node
+			}
+		case axmlChunkEndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return nil
+}
+
+// launcherActivity returns the name of the first activity or activity-alias
+// handling the MAIN action in the LAUNCHER category, with the activity an
+// alias targets
+func (d *axmlDocument) launcherActivity() (string, string) {
+	var stack []string
+	var activity, target string
+	var main, launcher bool
+	for _, node := range d.nodes {
+		switch node.Type {
+		case axmlChunkStartElement:
+			name := d.str(node.Name)
+			stack = append(stack, name)
+			switch {
+			case len(stack) == 3 && (name == "activity" || name == "activity-alias"):
+				activity = d.attrString(node, androidAttrName, "")
+				target = d.attrString(node, androidAttrTargetActivity, "")
+			case len(stack) == 4 && name == "intent-filter":
+				main, launcher = false, false
+			case len(stack) == 5 && name == "action":
+				main = main || d.attrString(node, androidAttrName, "") == "android.intent.action.MAIN"
+			case len(stack) == 5 && name == "category":
+				launcher = launcher || d.attrString(node, androidAttrName, "") == "android.intent.category.LAUNCHER"
+			}
+		case axmlChunkEndElement:
+			if len(stack) == 4 && main && launcher && activity != "" {
+				return activity, target
+			}
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return "", ""
+}
+
+// equalPath compares two element paths
+func equalPath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// resolveClassName expands the relative class names of a manifest
+func resolveClassName(pkg, name string) string {
+	switch {
+	case name == "":
+		return ""
+	case name[0] == '.':
+		return pkg + name
+	case !strings.Contains(name, "."):
+		return pkg + "." + name
+	}
+	return name
+}
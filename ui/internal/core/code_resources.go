@@ -0,0 +1,101 @@
+package core
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"io"
+	"path"
+	"strings"
+)
+
+// sealedFile is a file of a bundle, relative to the bundle root, with the
+// digests recorded in its resource seal
+type sealedFile struct {
+	Path    string
+	SHA1    []byte
+	SHA256  []byte
+	Symlink string // link target; digests are unused for symlinks
+}
+
+// sealFile digests the content of a bundle file
+func sealFile(name string, r io.Reader) (sealedFile, error) {
+	h1, h256 := sha1.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(h1, h256), r); err != nil {
+		return sealedFile{}, err
+	}
+	return sealedFile{Path: name, SHA1: h1.Sum(nil), SHA256: h256.Sum(nil)}, nil
+}
+
+// codeResourcesRules are the resource rules codesign writes for iOS bundles
+func codeResourcesRules() (map[string]interface{}, map[string]interface{}) {
+	lproj := map[string]interface{}{"optional": true, "weight": 1000.0}
+	locversion := map[string]interface{}{"omit": true, "weight": 1100.0}
+	base := map[string]interface{}{"weight": 1010.0}
+	rules := map[string]interface{}{
+		"^.*":                           true,
+		"^.*\\.lproj/":                  lproj,
+		"^.*\\.lproj/locversion.plist$": locversion,
+		"^Base\\.lproj/":                base,
+		"^version.plist$":               true,
+	}
+	rules2 := map[string]interface{}{
+		".*\\.dSYM($|/)":                map[string]interface{}{"weight": 11.0},
+		"^(.*/)?\\.DS_Store$":           map[string]interface{}{"omit": true, "weight": 2000.0},
+		"^.*":                           true,
+		"^.*\\.lproj/":                  lproj,
+		"^.*\\.lproj/locversion.plist$": locversion,
+		"^Base\\.lproj/":                base,
+		"^Info\\.plist$":                map[string]interface{}{"omit": true, "weight": 20.0},
+		"^PkgInfo$":                     map[string]interface{}{"omit": true, "weight": 20.0},
+		"^embedded\\.provisionprofile$": map[string]interface{}{"weight": 20.0},
+		"^version\\.plist$":             map[string]interface{}{"weight": 20.0},
+	}
+	return rules, rules2
+}
+
+// buildCodeResources builds the _CodeSignature/CodeResources plist sealing
+// files. The main executable and the bundle's own _CodeSignature directory
+// must not be in files. Nested bundles are sealed file by file, as codesign
+// does with the default iOS rules.
+func buildCodeResources(files []sealedFile) ([]byte, error) {
+	filesV1 := map[string]interface{}{}
+	filesV2 := map[string]interface{}{}
+	for _, f := range files {
+		base := path.Base(f.Path)
+		if base == ".DS_Store" {
+			continue
+		}
+		optional := strings.Contains("/"+f.Path, ".lproj/")
+		if optional && base == "locversion.plist" {
+			continue
+		}
+
+		if f.Symlink != "" {
+			filesV2[f.Path] = map[string]interface{}{"symlink": f.Symlink}
+			continue
+		}
+
+		if optional {
+			filesV1[f.Path] = map[string]interface{}{"hash": f.SHA1, "optional": true}
+		} else {
+			filesV1[f.Path] = f.SHA1
+		}
+
+		if f.Path == "Info.plist" || f.Path == "PkgInfo" {
+			continue
+		}
+		entry := map[string]interface{}{"hash": f.SHA1, "hash2": f.SHA256}
+		if optional {
+			entry["optional"] = true
+		}
+		filesV2[f.Path] = entry
+	}
+
+	rules, rules2 := codeResourcesRules()
+	return Entitlements{
+		"files":  filesV1,
+		"files2": filesV2,
+		"rules":  rules,
+		"rules2": rules2,
+	}.Plist()
+}
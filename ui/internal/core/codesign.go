@@ -0,0 +1,777 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"fridare-gui/internal/utils"
+	"hash"
+	"os"
+	"strings"
+)
+
+// Code signature constants, see xnu osfmk/kern/cs_blobs.h
+const (
+	csMagicRequirements      = 0xfade0c01
+	csMagicCodeDirectory     = 0xfade0c02
+	csMagicEmbeddedSignature = 0xfade0cc0
+	csMagicEntitlements      = 0xfade7171
+	csMagicEntitlementsDER   = 0xfade7172
+	csMagicBlobWrapper       = 0xfade0b01
+
+	csSlotCodeDirectory       = 0
+	csSlotInfo                = 1
+	csSlotRequirements        = 2
+	csSlotResourceDir         = 3
+	csSlotEntitlements        = 5
+	csSlotEntitlementsDER     = 7
+	csSlotAlternateCodeDirs   = 0x1000
+	csSlotAlternateCodeDirMax = 0x1005
+	csSlotSignature           = 0x10000
+
+	csHashSHA1   = 1
+	csHashSHA256 = 2
+
+	csAdhoc        = 0x2
+	csLinkerSigned = 0x20000
+
+	csExecSegMainBinary = 0x1
+
+	// CodeDirectory version 0x20400 carries the executable segment fields
+	csCodeDirectoryVersion = 0x20400
+	csCodeDirectoryHeader  = 88
+
+	machoLoadCodeSignature = 0x1d
+	machoLoadSegment       = 0x1
+	machoLoadSegment64     = 0x19
+	machoTypeExecute       = 0x2
+)
+
+// CodeSigner re-signs Mach-O files with an ad-hoc signature, recomputing the
+// CodeDirectory hashes of every slice
+type CodeSigner struct {
+	// Identifier overrides the signing identifier; empty keeps the existing one
+	Identifier string
+	// Entitlements replaces the XML entitlements plist; nil keeps the existing blobs
+	Entitlements []byte
+	// EntitlementsDER replaces the DER entitlements. When Entitlements is
+	// replaced without it, the stale DER blob is dropped
+	EntitlementsDER []byte
+	// InfoPlist and Resources are the Info.plist and _CodeSignature/CodeResources
+	// of the bundle a main executable belongs to; nil keeps the existing hashes
+	InfoPlist []byte
+	Resources []byte
+}
+
+// NewCodeSigner creates an ad-hoc signer that keeps the existing entitlements
+func NewCodeSigner() *CodeSigner {
+	return &CodeSigner{}
+}
+
+// SignedSlice describes the signature written for one Mach-O image
+type SignedSlice struct {
+	Arch         string   `json:"arch"`
+	Identifier   string   `json:"identifier"`
+	HashTypes    []string `json:"hash_types"`
+	CodeSlots    int      `json:"code_slots"`
+	Entitlements string   `json:"entitlements"` // preserved, replaced or none
+}
+
+// SignFile re-signs filePath in place
+func (cs *CodeSigner) SignFile(filePath string) ([]SignedSlice, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	signed, slices, err := cs.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if err := utils.WriteFileAtomic(filePath, signed, info.Mode().Perm()); err != nil {
+		return nil, err
+	}
+	return slices, nil
+}
+
+// Sign returns data re-signed ad-hoc. Thin and fat files are supported; every
+// image must already carry an LC_CODE_SIGNATURE load command.
+func (cs *CodeSigner) Sign(data []byte) ([]byte, []SignedSlice, error) {
+	if len(data) < 4 {
+		return nil, nil, fmt.Errorf("file too small")
+	}
+
+	switch binary.BigEndian.Uint32(data) {
+	case fatMagic, fatMagic64:
+		return cs.signFat(data)
+	}
+
+	signed, slice, err := cs.signImage(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, []SignedSlice{slice}, nil
+}
+
+// signFat signs every slice of a fat file. Slices keep their offset unless a
+// grown signature overlaps the next slice, which is then moved to the next
+// aligned offset.
+func (cs *CodeSigner) signFat(data []byte) ([]byte, []SignedSlice, error) {
+	slices, is64, err := parseFatSlices(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	images := make([][]byte, len(slices))
+	result := make([]SignedSlice, len(slices))
+	for i, s := range slices {
+		image, info, err := cs.signImage(data[s.offset : s.offset+s.size])
+		if err != nil {
+			return nil, nil, fmt.Errorf("slice %s: %v", s.arch(), err)
+		}
+		info.Arch = s.arch()
+		images[i], result[i] = image, info
+	}
+
+	out, err := writeFat(slices, images, is64, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, result, nil
+}
+
+// machoImage holds the load command locations needed for signing a thin image
+type machoImage struct {
+	is64          bool
+	cpu           uint32
+	subCpu        uint32
+	fileType      uint32
+	textOffset    uint64
+	textSize      uint64
+	linkedit      int // offset of the __LINKEDIT segment command, -1 if missing
+	signatureCmd  int // offset of LC_CODE_SIGNATURE, -1 if missing
+	signatureOff  uint32
+	signatureSize uint32
+}
+
+// parseMachOImage locates the segments and code signature of a thin image
+func parseMachOImage(data []byte) (*machoImage, error) {
+	if len(data) < 28 {
+		return nil, fmt.Errorf("truncated Mach-O header")
+	}
+	img := &machoImage{linkedit: -1, signatureCmd: -1}
+	headerSize := 28
+	switch binary.LittleEndian.Uint32(data) {
+	case macho.Magic32:
+	case macho.Magic64:
+		img.is64 = true
+		headerSize = 32
+	default:
+		return nil, fmt.Errorf("not a little-endian Mach-O image")
+	}
+	img.cpu = binary.LittleEndian.Uint32(data[4:])
+	img.subCpu = binary.LittleEndian.Uint32(data[8:])
+	img.fileType = binary.LittleEndian.Uint32(data[12:])
+	ncmds := int(binary.LittleEndian.Uint32(data[16:]))
+	sizeofcmds := int(binary.LittleEndian.Uint32(data[20:]))
+	if headerSize+sizeofcmds > len(data) {
+		return nil, fmt.Errorf("truncated load commands")
+	}
+
+	off := headerSize
+	for i := 0; i < ncmds; i++ {
+		if off+8 > headerSize+sizeofcmds {
+			return nil, fmt.Errorf("truncated load command %d", i)
+		}
+		cmd := binary.LittleEndian.Uint32(data[off:])
+		size := int(binary.LittleEndian.Uint32(data[off+4:]))
+		if size < 8 || off+size > headerSize+sizeofcmds {
+			return nil, fmt.Errorf("invalid load command %d", i)
+		}
+
+		switch cmd {
+		case machoLoadSegment, machoLoadSegment64:
+			name := strings.TrimRight(string(data[off+8:off+24]), "\x00")
+			var fileOff, fileSize uint64
+			if cmd == machoLoadSegment64 {
+				fileOff = binary.LittleEndian.Uint64(data[off+40:])
+				fileSize = binary.LittleEndian.Uint64(data[off+48:])
+			} else {
+				fileOff = uint64(binary.LittleEndian.Uint32(data[off+32:]))
+				fileSize = uint64(binary.LittleEndian.Uint32(data[off+36:]))
+			}
+			switch name {
+			case "__TEXT":
+				img.textOffset, img.textSize = fileOff, fileSize
+			case "__LINKEDIT":
+				img.linkedit = off
+			}
+		case machoLoadCodeSignature:
+			img.signatureCmd = off
+			img.signatureOff = binary.LittleEndian.Uint32(data[off+8:])
+			img.signatureSize = binary.LittleEndian.Uint32(data[off+12:])
+		}
+		off += size
+	}
+	return img, nil
+}
+
+// setLinkeditEnd grows __LINKEDIT so that it ends at fileEnd
+func (img *machoImage) setLinkeditEnd(data []byte, fileEnd uint64) {
+	off := img.linkedit
+	pageSize := uint64(0x1000)
+	if macho.Cpu(img.cpu) == macho.CpuArm64 || macho.Cpu(img.cpu) == macho.CpuArm {
+		pageSize = 0x4000
+	}
+	if img.is64 {
+		fileOff := binary.LittleEndian.Uint64(data[off+40:])
+		fileSize := fileEnd - fileOff
+		binary.LittleEndian.PutUint64(data[off+48:], fileSize)
+		if vmSize := binary.LittleEndian.Uint64(data[off+32:]); vmSize < fileSize {
+			binary.LittleEndian.PutUint64(data[off+32:], alignUp(fileSize, pageSize))
+		}
+	} else {
+		fileOff := uint64(binary.LittleEndian.Uint32(data[off+32:]))
+		fileSize := fileEnd - fileOff
+		binary.LittleEndian.PutUint32(data[off+36:], uint32(fileSize))
+		if vmSize := uint64(binary.LittleEndian.Uint32(data[off+28:])); vmSize < fileSize {
+			binary.LittleEndian.PutUint32(data[off+28:], uint32(alignUp(fileSize, pageSize)))
+		}
+	}
+}
+
+// linkeditEnd returns the file offset where __LINKEDIT ends
+func (img *machoImage) linkeditEnd(data []byte) uint64 {
+	off := img.linkedit
+	if img.is64 {
+		return binary.LittleEndian.Uint64(data[off+40:]) + binary.LittleEndian.Uint64(data[off+48:])
+	}
+	return uint64(binary.LittleEndian.Uint32(data[off+32:])) + uint64(binary.LittleEndian.Uint32(data[off+36:]))
+}
+
+// codeDirectory is the parsed content of an existing CodeDirectory
+type codeDirectory struct {
+	version      uint32
+	flags        uint32
+	hashType     uint8
+	hashSize     int
+	platform     uint8
+	pageShift    uint8
+	identifier   string
+	teamID       string
+	execSegFlags uint64
+	special      [][]byte // special slot hashes, index 0 is slot 1
+	codeLimit    uint32
+	codeHashes   []byte
+}
+
+// parseCodeDirectory parses a CodeDirectory blob
+func parseCodeDirectory(blob []byte) (*codeDirectory, error) {
+	if len(blob) < 44 || binary.BigEndian.Uint32(blob) != csMagicCodeDirectory {
+		return nil, fmt.Errorf("invalid CodeDirectory")
+	}
+	be := binary.BigEndian
+	cd := &codeDirectory{
+		version:   be.Uint32(blob[8:]),
+		flags:     be.Uint32(blob[12:]),
+		codeLimit: be.Uint32(blob[32:]),
+		hashSize:  int(blob[36]),
+		hashType:  blob[37],
+		platform:  blob[38],
+		pageShift: blob[39],
+	}
+	hashOffset := int(be.Uint32(blob[16:]))
+	identOffset := int(be.Uint32(blob[20:]))
+	nSpecial := int(be.Uint32(blob[24:]))
+	nCode := int(be.Uint32(blob[28:]))
+
+	if identOffset >= len(blob) {
+		return nil, fmt.Errorf("invalid CodeDirectory identifier")
+	}
+	ident := blob[identOffset:]
+	if end := bytes.IndexByte(ident, 0); end >= 0 {
+		ident = ident[:end]
+	}
+	cd.identifier = string(ident)
+
+	// CodeDirectory version 0x20200 added the team identifier
+	if cd.version >= 0x20200 && len(blob) >= 52 {
+		if teamOffset := int(be.Uint32(blob[48:])); teamOffset > 0 && teamOffset < len(blob) {
+			team := blob[teamOffset:]
+			if end := bytes.IndexByte(team, 0); end >= 0 {
+				team = team[:end]
+			}
+			cd.teamID = string(team)
+		}
+	}
+
+	if cd.version >= 0x20400 && len(blob) >= csCodeDirectoryHeader {
+		cd.execSegFlags = be.Uint64(blob[80:])
+	}
+
+	if hashOffset-nSpecial*cd.hashSize < 0 || hashOffset+nCode*cd.hashSize > len(blob) {
+		return nil, fmt.Errorf("invalid CodeDirectory hash slots")
+	}
+	for slot := 1; slot <= nSpecial; slot++ {
+		start := hashOffset - slot*cd.hashSize
+		cd.special = append(cd.special, blob[start:start+cd.hashSize])
+	}
+	cd.codeHashes = blob[hashOffset : hashOffset+nCode*cd.hashSize]
+	return cd, nil
+}
+
+// specialHash returns the hash of a special slot, nil if the slot is unused
+func (cd *codeDirectory) specialHash(slot int) []byte {
+	if slot < 1 || slot > len(cd.special) {
+		return nil
+	}
+	h := cd.special[slot-1]
+	for _, b := range h {
+		if b != 0 {
+			return h
+		}
+	}
+	return nil
+}
+
+// parseSuperBlob returns the blobs of an embedded signature by slot
+func parseSuperBlob(sig []byte) (map[uint32][]byte, error) {
+	be := binary.BigEndian
+	if len(sig) < 12 || be.Uint32(sig) != csMagicEmbeddedSignature {
+		return nil, fmt.Errorf("invalid embedded signature")
+	}
+	length := int(be.Uint32(sig[4:]))
+	count := int(be.Uint32(sig[8:]))
+	if length > len(sig) || 12+count*8 > length {
+		return nil, fmt.Errorf("truncated embedded signature")
+	}
+	sig = sig[:length]
+
+	blobs := make(map[uint32][]byte, count)
+	for i := 0; i < count; i++ {
+		slot := be.Uint32(sig[12+i*8:])
+		offset := int(be.Uint32(sig[16+i*8:]))
+		if offset+8 > length {
+			return nil, fmt.Errorf("blob %d out of range", slot)
+		}
+		size := int(be.Uint32(sig[offset+4:]))
+		if size < 8 || offset+size > length {
+			return nil, fmt.Errorf("blob %d out of range", slot)
+		}
+		blobs[slot] = sig[offset : offset+size]
+	}
+	return blobs, nil
+}
+
+// codeDirectories returns the CodeDirectories of a signature, primary first
+func codeDirectories(blobs map[uint32][]byte) ([]*codeDirectory, error) {
+	var result []*codeDirectory
+	for _, slot := range append([]uint32{csSlotCodeDirectory}, alternateSlots()...) {
+		blob, ok := blobs[slot]
+		if !ok {
+			continue
+		}
+		cd, err := parseCodeDirectory(blob)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, cd)
+	}
+	return result, nil
+}
+
+func alternateSlots() []uint32 {
+	var slots []uint32
+	for slot := uint32(csSlotAlternateCodeDirs); slot < csSlotAlternateCodeDirMax; slot++ {
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// newCodeHash returns the hash function of a CodeDirectory hash type
+func newCodeHash(hashType uint8) (hash.Hash, error) {
+	switch hashType {
+	case csHashSHA1:
+		return sha1.New(), nil
+	case csHashSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash type %d", hashType)
+	}
+}
+
+func hashTypeName(hashType uint8) string {
+	switch hashType {
+	case csHashSHA1:
+		return "sha1"
+	case csHashSHA256:
+		return "sha256"
+	default:
+		return fmt.Sprintf("type-%d", hashType)
+	}
+}
+
+func sumCodeHash(hashType uint8, data []byte) []byte {
+	h, _ := newCodeHash(hashType)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// makeBlob wraps payload in a generic blob with the given magic
+func makeBlob(magic uint32, payload []byte) []byte {
+	blob := make([]byte, 8+len(payload))
+	binary.BigEndian.PutUint32(blob, magic)
+	binary.BigEndian.PutUint32(blob[4:], uint32(len(blob)))
+	copy(blob[8:], payload)
+	return blob
+}
+
+// signImage re-signs a thin Mach-O image
+func (cs *CodeSigner) signImage(data []byte) ([]byte, SignedSlice, error) {
+	var slice SignedSlice
+	img, err := parseMachOImage(data)
+	if err != nil {
+		return nil, slice, err
+	}
+	slice.Arch = machoArchName(macho.Cpu(img.cpu), img.subCpu)
+	if img.signatureCmd < 0 {
+		return nil, slice, fmt.Errorf("no LC_CODE_SIGNATURE load command")
+	}
+	if img.linkedit < 0 {
+		return nil, slice, fmt.Errorf("no __LINKEDIT segment")
+	}
+	sigStart, sigEnd := uint64(img.signatureOff), uint64(img.signatureOff)+uint64(img.signatureSize)
+	if sigEnd > uint64(len(data)) {
+		return nil, slice, fmt.Errorf("code signature out of range")
+	}
+
+	oldBlobs, err := parseSuperBlob(data[sigStart:sigEnd])
+	if err != nil {
+		return nil, slice, err
+	}
+	oldCDs, err := codeDirectories(oldBlobs)
+	if err != nil {
+		return nil, slice, err
+	}
+	if len(oldCDs) == 0 {
+		return nil, slice, fmt.Errorf("signature has no CodeDirectory")
+	}
+	primary := oldCDs[0]
+
+	// Keep the hash types of the existing signature, e.g. SHA-1 plus SHA-256
+	// for binaries that still run on old iOS versions
+	var hashTypes []uint8
+	for _, cd := range oldCDs {
+		if _, err := newCodeHash(cd.hashType); err == nil {
+			hashTypes = append(hashTypes, cd.hashType)
+		}
+	}
+	if len(hashTypes) == 0 {
+		hashTypes = []uint8{csHashSHA256}
+	}
+
+	identifier := cs.Identifier
+	if identifier == "" {
+		identifier = primary.identifier
+	}
+	slice.Identifier = identifier
+
+	// Blobs hashed into special slots
+	special := map[int][]byte{
+		csSlotRequirements: makeBlob(csMagicRequirements, make([]byte, 4)), // empty requirement set
+	}
+	switch {
+	case cs.Entitlements != nil:
+		special[csSlotEntitlements] = makeBlob(csMagicEntitlements, cs.Entitlements)
+		if cs.EntitlementsDER != nil {
+			special[csSlotEntitlementsDER] = makeBlob(csMagicEntitlementsDER, cs.EntitlementsDER)
+		}
+		slice.Entitlements = "replaced"
+	case oldBlobs[csSlotEntitlements] != nil || oldBlobs[csSlotEntitlementsDER] != nil:
+		for _, slot := range []int{csSlotEntitlements, csSlotEntitlementsDER} {
+			if blob := oldBlobs[uint32(slot)]; blob != nil {
+				special[slot] = blob
+			}
+		}
+		slice.Entitlements = "preserved"
+	default:
+		slice.Entitlements = "none"
+	}
+
+	// Bundle files are hashed as they are, not wrapped in blobs
+	if cs.InfoPlist != nil {
+		special[csSlotInfo] = cs.InfoPlist
+	}
+	if cs.Resources != nil {
+		special[csSlotResourceDir] = cs.Resources
+	}
+
+	nSpecial := 0
+	for slot := range special {
+		nSpecial = max(nSpecial, slot)
+	}
+	// Info.plist and resource hashes cannot be recomputed from the binary alone
+	for _, slot := range []int{csSlotInfo, csSlotResourceDir} {
+		for _, cd := range oldCDs {
+			if cd.specialHash(slot) != nil {
+				nSpecial = max(nSpecial, slot)
+			}
+		}
+	}
+
+	pageShift := primary.pageShift
+	if pageShift == 0 {
+		pageShift = 12
+	}
+	codeLimit := sigStart
+	if codeLimit > 0xffffffff {
+		return nil, slice, fmt.Errorf("image too large to sign")
+	}
+	nCode := int((codeLimit + (1 << pageShift) - 1) >> pageShift)
+	slice.CodeSlots = nCode
+
+	// Work out the signature size before hashing, since growing the signature
+	// changes the load commands covered by the first page
+	cdSize := func(hashType uint8) int {
+		h, _ := newCodeHash(hashType)
+		return csCodeDirectoryHeader + len(identifier) + 1 + (nSpecial+nCode)*h.Size()
+	}
+	slots := []int{csSlotCodeDirectory, csSlotRequirements}
+	for _, slot := range []int{csSlotEntitlements, csSlotEntitlementsDER} {
+		if special[slot] != nil {
+			slots = append(slots, slot)
+		}
+	}
+	for i := 1; i < len(hashTypes); i++ {
+		slots = append(slots, csSlotAlternateCodeDirs+i-1)
+	}
+	slots = append(slots, csSlotSignature)
+
+	sigSize := 12 + 8*len(slots)
+	for _, hashType := range hashTypes {
+		sigSize += cdSize(hashType)
+	}
+	for _, slot := range slots {
+		if blob := special[slot]; blob != nil {
+			sigSize += len(blob)
+		}
+	}
+	sigSize += 8 // empty CMS wrapper of ad-hoc signatures
+
+	out := make([]byte, sigStart, sigStart+alignUp(uint64(sigSize), 16))
+	copy(out, data[:sigStart])
+
+	newSize := uint64(img.signatureSize)
+	if uint64(sigSize) > newSize {
+		// The signature must stay the last thing in __LINKEDIT to grow in place
+		if img.linkeditEnd(data) != sigEnd {
+			return nil, slice, fmt.Errorf("code signature is not at the end of __LINKEDIT")
+		}
+		newSize = alignUp(uint64(sigSize), 16)
+		binary.LittleEndian.PutUint32(out[img.signatureCmd+12:], uint32(newSize))
+		img.setLinkeditEnd(out, sigStart+newSize)
+	}
+
+	// Build one CodeDirectory per hash type over the final header
+	flags := (primary.flags &^ csLinkerSigned) | csAdhoc
+	execSegFlags := primary.execSegFlags
+	if primary.version < 0x20400 && img.fileType == machoTypeExecute {
+		execSegFlags = csExecSegMainBinary
+	}
+	var cds [][]byte
+	for _, hashType := range hashTypes {
+		h, _ := newCodeHash(hashType)
+		hashSize := h.Size()
+		cd := make([]byte, cdSize(hashType))
+		be := binary.BigEndian
+		identOffset := csCodeDirectoryHeader
+		hashOffset := identOffset + len(identifier) + 1 + nSpecial*hashSize
+
+		be.PutUint32(cd[0:], csMagicCodeDirectory)
+		be.PutUint32(cd[4:], uint32(len(cd)))
+		be.PutUint32(cd[8:], csCodeDirectoryVersion)
+		be.PutUint32(cd[12:], flags)
+		be.PutUint32(cd[16:], uint32(hashOffset))
+		be.PutUint32(cd[20:], uint32(identOffset))
+		be.PutUint32(cd[24:], uint32(nSpecial))
+		be.PutUint32(cd[28:], uint32(nCode))
+		be.PutUint32(cd[32:], uint32(codeLimit))
+		cd[36] = byte(hashSize)
+		cd[37] = hashType
+		cd[38] = primary.platform
+		cd[39] = pageShift
+		be.PutUint64(cd[64:], img.textOffset)
+		be.PutUint64(cd[72:], img.textSize)
+		be.PutUint64(cd[80:], execSegFlags)
+		copy(cd[identOffset:], identifier)
+
+		for slot := 1; slot <= nSpecial; slot++ {
+			dst := cd[hashOffset-slot*hashSize : hashOffset-(slot-1)*hashSize]
+			if blob := special[slot]; blob != nil {
+				copy(dst, sumCodeHash(hashType, blob))
+				continue
+			}
+			for _, old := range oldCDs {
+				if old.hashType == hashType && old.specialHash(slot) != nil {
+					copy(dst, old.specialHash(slot))
+				}
+			}
+		}
+
+		pageSize := 1 << pageShift
+		for i := 0; i < nCode; i++ {
+			start := i * pageSize
+			end := min(start+pageSize, int(codeLimit))
+			copy(cd[hashOffset+i*hashSize:], sumCodeHash(hashType, out[start:end]))
+		}
+		cds = append(cds, cd)
+		slice.HashTypes = append(slice.HashTypes, hashTypeName(hashType))
+	}
+
+	// Assemble the superblob
+	sig := make([]byte, 12+8*len(slots), sigSize)
+	binary.BigEndian.PutUint32(sig, csMagicEmbeddedSignature)
+	binary.BigEndian.PutUint32(sig[4:], uint32(sigSize))
+	binary.BigEndian.PutUint32(sig[8:], uint32(len(slots)))
+	for i, slot := range slots {
+		var blob []byte
+		switch {
+		case slot == csSlotCodeDirectory:
+			blob = cds[0]
+		case slot >= csSlotAlternateCodeDirs && slot < csSlotAlternateCodeDirMax:
+			blob = cds[slot-csSlotAlternateCodeDirs+1]
+		case slot == csSlotSignature:
+			blob = makeBlob(csMagicBlobWrapper, nil)
+		default:
+			blob = special[slot]
+		}
+		binary.BigEndian.PutUint32(sig[12+i*8:], uint32(slot))
+		binary.BigEndian.PutUint32(sig[16+i*8:], uint32(len(sig)))
+		sig = append(sig, blob...)
+	}
+
+	out = append(out, sig...)
+	out = append(out, make([]byte, sigStart+newSize-uint64(len(out)))...)
+	return out, slice, nil
+}
+
+// VerifyCodeSignature checks the page and special slot hashes of every
+// CodeDirectory in every slice of filePath
+func VerifyCodeSignature(filePath string) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if len(data) < 4 {
+		return fmt.Errorf("file too small")
+	}
+
+	switch binary.BigEndian.Uint32(data) {
+	case fatMagic, fatMagic64:
+		slices, _, err := parseFatSlices(data)
+		if err != nil {
+			return err
+		}
+		for _, s := range slices {
+			if err := verifyImageSignature(data[s.offset : s.offset+s.size]); err != nil {
+				return fmt.Errorf("slice %s: %v", s.arch(), err)
+			}
+		}
+		return nil
+	default:
+		return verifyImageSignature(data)
+	}
+}
+
+// verifyImageSignature checks the signature of a thin image
+func verifyImageSignature(data []byte) error {
+	img, err := parseMachOImage(data)
+	if err != nil {
+		return err
+	}
+	if img.signatureCmd < 0 {
+		return fmt.Errorf("not signed")
+	}
+	sigEnd := uint64(img.signatureOff) + uint64(img.signatureSize)
+	if sigEnd > uint64(len(data)) {
+		return fmt.Errorf("code signature out of range")
+	}
+	blobs, err := parseSuperBlob(data[img.signatureOff:sigEnd])
+	if err != nil {
+		return err
+	}
+	cds, err := codeDirectories(blobs)
+	if err != nil {
+		return err
+	}
+	if len(cds) == 0 {
+		return fmt.Errorf("signature has no CodeDirectory")
+	}
+
+	for _, cd := range cds {
+		if _, err := newCodeHash(cd.hashType); err != nil {
+			continue
+		}
+		if uint64(cd.codeLimit) > uint64(img.signatureOff) {
+			return fmt.Errorf("code limit 0x%x overlaps the signature", cd.codeLimit)
+		}
+		pageSize := 1 << cd.pageShift
+		for i := 0; i*cd.hashSize < len(cd.codeHashes); i++ {
+			start := i * pageSize
+			end := min(start+pageSize, int(cd.codeLimit))
+			if !bytesEqual(sumCodeHash(cd.hashType, data[start:end]), cd.codeHashes[i*cd.hashSize:(i+1)*cd.hashSize]) {
+				return fmt.Errorf("%s hash mismatch at page %d", hashTypeName(cd.hashType), i)
+			}
+		}
+		for _, slot := range []int{csSlotRequirements, csSlotEntitlements, csSlotEntitlementsDER} {
+			blob := blobs[uint32(slot)]
+			want := cd.specialHash(slot)
+			if blob == nil && want == nil {
+				continue
+			}
+			if blob == nil || want == nil || !bytesEqual(sumCodeHash(cd.hashType, blob), want) {
+				return fmt.Errorf("%s hash mismatch for special slot %d", hashTypeName(cd.hashType), slot)
+			}
+		}
+	}
+	return nil
+}
+
+// hasCodeSignature reports whether every image of file carries LC_CODE_SIGNATURE
+func hasCodeSignature(file interface{}) bool {
+	signed := func(f *macho.File) bool {
+		for _, load := range f.Loads {
+			raw := load.Raw()
+			if len(raw) >= 4 && f.ByteOrder.Uint32(raw) == machoLoadCodeSignature {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch f := file.(type) {
+	case *macho.File:
+		return signed(f)
+	case *macho.FatFile:
+		for _, arch := range f.Arches {
+			if !signed(arch.File) {
+				return false
+			}
+		}
+		return len(f.Arches) > 0
+	default:
+		return false
+	}
+}
+
+// alignUp rounds n up to a multiple of align (a power of two)
+func alignUp(n, align uint64) uint64 {
+	return (n + align - 1) &^ (align - 1)
+}
@@ -0,0 +1,726 @@
+package core
+
+import (
+	"archive/tar"
+	"bufio"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxInspectMachOSize caps the size of a Mach-O file read into memory for inspection
+const maxInspectMachOSize = 1 << 30
+
+// DebInspection describes the structure and content of a .deb package
+type DebInspection struct {
+	File         string            `json:"file"`
+	Size         int64             `json:"size"`
+	SHA256       string            `json:"sha256"`
+	Version      string            `json:"format_version"` // content of debian-binary
+	Members      []DebMember       `json:"members"`
+	Control      []DebControlField `json:"control"`
+	Scripts      []DebControlFile  `json:"scripts"`
+	ControlFiles []DebControlFile  `json:"control_files,omitempty"` // md5sums, conffiles, triggers and other control members
+	Files        []DebFileEntry    `json:"files"`
+	Layout       DebLayout         `json:"layout"`
+	Problems     []string          `json:"problems,omitempty"`
+}
+
+// DebMember is an ar member of a .deb
+type DebMember struct {
+	Name             string `json:"name"`
+	Size             int64  `json:"size"`
+	Compression      string `json:"compression,omitempty"`
+	UncompressedSize int64  `json:"uncompressed_size,omitempty"`
+	Entries          int    `json:"entries,omitempty"` // tar entries
+}
+
+// DebControlField is a field of DEBIAN/control, in file order
+type DebControlField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// DebControlFile is a member of control.tar other than control
+type DebControlFile struct {
+	Name        string `json:"name"`
+	Mode        string `json:"mode"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+	Interpreter string `json:"interpreter,omitempty"` // #! line of a script
+	Content     string `json:"content,omitempty"`     // text content, omitted for binary files
+}
+
+// DebFileEntry is an entry of data.tar
+type DebFileEntry struct {
+	Path   string       `json:"path"`
+	Type   string       `json:"type"` // file, dir, symlink, hardlink or other
+	Mode   string       `json:"mode"`
+	Owner  string       `json:"owner"` // user/group, names when present, ids otherwise
+	UID    int          `json:"uid"`
+	GID    int          `json:"gid"`
+	Size   int64        `json:"size"`
+	SHA256 string       `json:"sha256,omitempty"`
+	Link   string       `json:"link,omitempty"`
+	MachO  *MachOReport `json:"macho,omitempty"`
+}
+
+// MachOReport lists the slices of a Mach-O file
+type MachOReport struct {
+	Fat    bool         `json:"fat"`
+	Slices []MachOSlice `json:"slices"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// MachOSlice describes one image of a thin or fat Mach-O file
+type MachOSlice struct {
+	Arch      string          `json:"arch"`
+	FileType  string          `json:"file_type"`
+	Offset    int64           `json:"offset"`
+	Size      int64           `json:"size"`
+	Signature *MachOSignature `json:"signature,omitempty"` // nil when the image has no LC_CODE_SIGNATURE
+	Error     string          `json:"error,omitempty"`
+}
+
+// MachOSignature summarizes the embedded code signature of an image
+type MachOSignature struct {
+	Kind            string   `json:"kind"` // ad-hoc, linker-signed or certificate
+	Identifier      string   `json:"identifier"`
+	TeamID          string   `json:"team_id,omitempty"`
+	Flags           []string `json:"flags,omitempty"`
+	HashTypes       []string `json:"hash_types"`
+	CodeSlots       int      `json:"code_slots"`
+	Entitlements    []string `json:"entitlements,omitempty"` // keys of the XML entitlements
+	EntitlementsDER bool     `json:"entitlements_der"`
+	Valid           bool     `json:"valid"`
+	Error           string   `json:"error,omitempty"` // why the hashes do not verify
+}
+
+// DebLayout is the jailbreak layout detected from the data.tar paths
+type DebLayout struct {
+	Kind   string   `json:"kind"`             // rootful, rootless, mixed or empty
+	Prefix string   `json:"prefix,omitempty"` // /var/jb, or /var/re for packages rewritten by fridare
+	Notes  []string `json:"notes,omitempty"`
+}
+
+// InspectDeb reads a .deb as a stream and reports its ar members, control
+// fields, maintainer scripts, files and embedded Mach-O images. Structural
+// problems are reported in Problems; an error is returned only when the file
+// cannot be read as a .deb at all.
+func InspectDeb(debPath string) (*DebInspection, error) {
+	file, err := os.Open(debPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	counter := &countingReader{r: io.TeeReader(file, hasher)}
+	ar, err := newArReader(bufio.NewReaderSize(counter, 256<<10))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a deb (missing ar header)", debPath)
+	}
+
+	inspection := &DebInspection{File: debPath, Control: []DebControlField{}, Scripts: []DebControlFile{}, Files: []DebFileEntry{}}
+	for {
+		entry, err := ar.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			inspection.problem("reading ar member: %v", err)
+			break
+		}
+		member := DebMember{Name: entry.Name, Size: entry.Size}
+
+		switch {
+		case entry.Name == "debian-binary":
+			content, err := io.ReadAll(io.LimitReader(ar, 64))
+			if err != nil {
+				inspection.problem("reading %s: %v", entry.Name, err)
+			}
+			inspection.Version = strings.TrimSpace(string(content))
+			if !strings.HasPrefix(inspection.Version, "2.") {
+				inspection.problem("unsupported format version %q", inspection.Version)
+			}
+		case strings.HasPrefix(entry.Name, "control.tar"):
+			if err := inspection.readMember(&member, ar, inspection.addControlEntry); err != nil {
+				inspection.problem("%s: %v", entry.Name, err)
+			}
+		case strings.HasPrefix(entry.Name, "data.tar"):
+			if err := inspection.readMember(&member, ar, inspection.addDataEntry); err != nil {
+				inspection.problem("%s: %v", entry.Name, err)
+			}
+		default:
+			inspection.problem("unexpected ar member %s", entry.Name)
+		}
+		inspection.Members = append(inspection.Members, member)
+	}
+
+	// Drain the rest of the file so the hash covers all of it
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return nil, err
+	}
+	inspection.Size = counter.n
+	inspection.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+
+	var names []string
+	for _, m := range inspection.Members {
+		names = append(names, m.Name)
+	}
+	if len(names) < 3 || names[0] != "debian-binary" || !strings.HasPrefix(names[1], "control.tar") || !strings.HasPrefix(names[2], "data.tar") {
+		inspection.problem("ar members out of order: %s", strings.Join(names, ", "))
+	}
+	if len(inspection.Control) == 0 {
+		inspection.problem("control.tar has no control file")
+	}
+	inspection.detectLayout()
+	return inspection, nil
+}
+
+// problem records a structural problem
+func (d *DebInspection) problem(format string, args ...interface{}) {
+	d.Problems = append(d.Problems, fmt.Sprintf(format, args...))
+}
+
+// readMember decompresses a tar member and passes every entry to add
+func (d *DebInspection) readMember(member *DebMember, r io.Reader, add func(*tar.Header, io.Reader) error) error {
+	reader, compression, err := newDebDecompressor(r, member.Name)
+	if err != nil {
+		return err
+	}
+	member.Compression = compression
+	counter := &countingReader{r: reader}
+
+	tr := tar.NewReader(counter)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		member.Entries++
+		if err := add(header, tr); err != nil {
+			return fmt.Errorf("%s: %v", header.Name, err)
+		}
+	}
+	// Read past the end of archive marker so the compressed stream is checked too
+	if _, err := io.Copy(io.Discard, counter); err != nil {
+		return err
+	}
+	member.UncompressedSize = counter.n
+	return nil
+}
+
+// addControlEntry records a control.tar entry
+func (d *DebInspection) addControlEntry(header *tar.Header, r io.Reader) error {
+	name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+	if header.Typeflag != tar.TypeReg || name == "" {
+		return nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if name == "control" {
+		d.Control = parseDebControl(data)
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	file := DebControlFile{
+		Name:   name,
+		Mode:   fmt.Sprintf("%04o", header.Mode&0o7777),
+		Size:   header.Size,
+		SHA256: hex.EncodeToString(sum[:]),
+	}
+	if isTextData(data) {
+		file.Content = string(data)
+		if strings.HasPrefix(file.Content, "#!") {
+			file.Interpreter = strings.TrimSpace(strings.SplitN(file.Content[2:], "\n", 2)[0])
+		}
+	}
+	if debMaintainerScripts[name] {
+		d.Scripts = append(d.Scripts, file)
+	} else {
+		d.ControlFiles = append(d.ControlFiles, file)
+	}
+	return nil
+}
+
+// addDataEntry records a data.tar entry, hashing regular files and parsing Mach-O images
+func (d *DebInspection) addDataEntry(header *tar.Header, r io.Reader) error {
+	entry := DebFileEntry{
+		Path:  path.Clean("/" + header.Name),
+		Mode:  fmt.Sprintf("%04o", header.Mode&0o7777),
+		UID:   header.Uid,
+		GID:   header.Gid,
+		Size:  header.Size,
+		Owner: tarOwner(header),
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		entry.Type = "dir"
+		entry.Size = 0
+	case tar.TypeSymlink:
+		entry.Type = "symlink"
+		entry.Link = header.Linkname
+	case tar.TypeLink:
+		entry.Type = "hardlink"
+		entry.Link = path.Clean("/" + header.Linkname)
+	case tar.TypeReg:
+		entry.Type = "file"
+		br := bufio.NewReader(r)
+		magic, _ := br.Peek(4)
+		hasher := sha256.New()
+		if isMachOMagic(magic) && header.Size <= maxInspectMachOSize {
+			data, err := io.ReadAll(io.TeeReader(br, hasher))
+			if err != nil {
+				return err
+			}
+			entry.MachO = inspectMachO(data)
+		} else if _, err := io.Copy(hasher, br); err != nil {
+			return err
+		}
+		entry.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	default:
+		entry.Type = "other"
+	}
+	d.Files = append(d.Files, entry)
+	return nil
+}
+
+// detectLayout classifies the package as rootful or rootless from its paths
+func (d *DebInspection) detectLayout() {
+	prefixes := make(map[string]int)
+	rootful := 0
+	for _, f := range d.Files {
+		if f.Type == "dir" {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(f.Path, "/var/jb/"):
+			prefixes["/var/jb"]++
+		case strings.HasPrefix(f.Path, "/var/re/"):
+			prefixes["/var/re"]++
+		default:
+			rootful++
+		}
+	}
+
+	layout := &d.Layout
+	var found []string
+	for prefix := range prefixes {
+		found = append(found, prefix)
+	}
+	sort.Strings(found)
+	switch {
+	case len(found) == 0 && rootful == 0:
+		layout.Kind = "empty"
+	case len(found) == 0:
+		layout.Kind = "rootful"
+	case rootful == 0 && len(found) == 1:
+		layout.Kind = "rootless"
+		layout.Prefix = found[0]
+	default:
+		layout.Kind = "mixed"
+		layout.Notes = append(layout.Notes, fmt.Sprintf("%d file(s) outside the rootless prefix %s", rootful, strings.Join(found, ", ")))
+	}
+	if layout.Prefix == "/var/re" {
+		layout.Notes = append(layout.Notes, "rootless paths mapped from /var/jb to /var/re by fridare")
+	}
+
+	arch := d.ControlField("Architecture")
+	switch {
+	case layout.Kind == "rootless" && arch == "iphoneos-arm":
+		layout.Notes = append(layout.Notes, "rootless layout but Architecture is iphoneos-arm (rootless packages are iphoneos-arm64)")
+	case layout.Kind == "rootful" && arch == "iphoneos-arm64e":
+		layout.Notes = append(layout.Notes, "rootful layout but Architecture is iphoneos-arm64e (roothide)")
+	}
+}
+
+// ControlField returns the value of a control field, empty when missing
+func (d *DebInspection) ControlField(name string) string {
+	for _, field := range d.Control {
+		if strings.EqualFold(field.Name, name) {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// MachOFiles returns the files that hold Mach-O images
+func (d *DebInspection) MachOFiles() []DebFileEntry {
+	var files []DebFileEntry
+	for _, f := range d.Files {
+		if f.MachO != nil {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// parseDebControl splits a control file into fields, joining continuation lines
+func parseDebControl(data []byte) []DebControlField {
+	fields := []DebControlField{}
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			last := &fields[len(fields)-1]
+			last.Value += "\n" + strings.TrimSpace(line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		fields = append(fields, DebControlField{Name: strings.TrimSpace(name), Value: strings.TrimSpace(value)})
+	}
+	return fields
+}
+
+// tarOwner renders the owner of a tar entry as user/group
+func tarOwner(header *tar.Header) string {
+	user, group := header.Uname, header.Gname
+	if user == "" {
+		user = fmt.Sprint(header.Uid)
+	}
+	if group == "" {
+		group = fmt.Sprint(header.Gid)
+	}
+	return user + "/" + group
+}
+
+// isTextData reports whether data looks like text
+func isTextData(data []byte) bool {
+	for _, b := range data {
+		if b == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isMachOMagic reports whether a file header is a thin or fat Mach-O magic
+func isMachOMagic(magic []byte) bool {
+	if len(magic) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(magic) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	return isFatMachO(magic)
+}
+
+// inspectMachO describes the slices and signatures of a Mach-O file
+func inspectMachO(data []byte) *MachOReport {
+	report := &MachOReport{Fat: isFatMachO(data), Slices: []MachOSlice{}}
+	type image struct {
+		offset, size int64
+	}
+	images := []image{{0, int64(len(data))}}
+	if report.Fat {
+		slices, _, err := parseFatSlices(data)
+		if err != nil {
+			// Java class files share the fat magic
+			report.Error = err.Error()
+			return report
+		}
+		images = images[:0]
+		for _, s := range slices {
+			images = append(images, image{int64(s.offset), int64(s.size)})
+		}
+	}
+
+	for _, im := range images {
+		report.Slices = append(report.Slices, inspectMachOImage(data[im.offset:im.offset+im.size], im.offset))
+	}
+	return report
+}
+
+// inspectMachOImage describes a thin image at offset in its file
+func inspectMachOImage(data []byte, offset int64) MachOSlice {
+	slice := MachOSlice{Offset: offset, Size: int64(len(data))}
+	img, err := parseMachOImage(data)
+	if err != nil {
+		slice.Error = err.Error()
+		return slice
+	}
+	slice.Arch = machoArchName(macho.Cpu(img.cpu), img.subCpu)
+	slice.FileType = machoFileTypeName(img.fileType)
+	if img.signatureCmd < 0 {
+		return slice
+	}
+
+	sig := &MachOSignature{HashTypes: []string{}}
+	slice.Signature = sig
+	end := uint64(img.signatureOff) + uint64(img.signatureSize)
+	if end > uint64(len(data)) {
+		sig.Error = "code signature out of range"
+		return slice
+	}
+	blobs, err := parseSuperBlob(data[img.signatureOff:end])
+	if err != nil {
+		sig.Error = err.Error()
+		return slice
+	}
+	cds, err := codeDirectories(blobs)
+	if err != nil || len(cds) == 0 {
+		sig.Error = "signature has no valid CodeDirectory"
+		return slice
+	}
+
+	primary := cds[0]
+	sig.Identifier = primary.identifier
+	sig.TeamID = primary.teamID
+	sig.Flags = codeSignatureFlagNames(primary.flags)
+	sig.CodeSlots = len(primary.codeHashes) / max(primary.hashSize, 1)
+	for _, cd := range cds {
+		sig.HashTypes = append(sig.HashTypes, hashTypeName(cd.hashType))
+	}
+	switch {
+	case len(blobs[csSlotSignature]) > 8:
+		sig.Kind = "certificate"
+	case primary.flags&csLinkerSigned != 0:
+		sig.Kind = "linker-signed"
+	default:
+		sig.Kind = "ad-hoc"
+	}
+	if blob := blobs[csSlotEntitlements]; blob != nil {
+		if entitlements, err := ParseEntitlements(blob[8:]); err == nil {
+			sig.Entitlements = entitlements.Keys()
+		}
+	}
+	sig.EntitlementsDER = blobs[csSlotEntitlementsDER] != nil
+
+	if err := verifyImageSignature(data); err != nil {
+		sig.Error = err.Error()
+	} else {
+		sig.Valid = true
+	}
+	return slice
+}
+
+// machoFileTypeName returns a short name of a Mach-O file type
+func machoFileTypeName(fileType uint32) string {
+	switch macho.Type(fileType) {
+	case macho.TypeObj:
+		return "object"
+	case macho.TypeExec:
+		return "execute"
+	case macho.TypeDylib:
+		return "dylib"
+	case macho.TypeBundle:
+		return "bundle"
+	case 0x7:
+		return "dylinker"
+	}
+	return fmt.Sprintf("type-0x%x", fileType)
+}
+
+// codeSignatureFlagNames names the CodeDirectory flags, see xnu cs_blobs.h
+func codeSignatureFlagNames(flags uint32) []string {
+	names := []struct {
+		flag uint32
+		name string
+	}{
+		{0x1, "valid"},
+		{csAdhoc, "adhoc"},
+		{0x4, "get-task-allow"},
+		{0x100, "hard"},
+		{0x200, "kill"},
+		{0x800, "restrict"},
+		{0x1000, "enforcement"},
+		{0x2000, "library-validation"},
+		{0x10000, "runtime"},
+		{csLinkerSigned, "linker-signed"},
+	}
+	var result []string
+	for _, n := range names {
+		if flags&n.flag != 0 {
+			result = append(result, n.name)
+		}
+	}
+	return result
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteJSON writes the inspection as indented JSON
+func (d *DebInspection) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(d)
+}
+
+// WriteText writes the inspection in a human readable form
+func (d *DebInspection) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "File:    %s\n", d.File)
+	fmt.Fprintf(w, "Size:    %d bytes\n", d.Size)
+	fmt.Fprintf(w, "SHA256:  %s\n", d.SHA256)
+	fmt.Fprintf(w, "Format:  %s\n", d.Version)
+	fmt.Fprintf(w, "Layout:  %s", d.Layout.Kind)
+	if d.Layout.Prefix != "" {
+		fmt.Fprintf(w, " (%s)", d.Layout.Prefix)
+	}
+	fmt.Fprintln(w)
+	for _, note := range d.Layout.Notes {
+		fmt.Fprintf(w, "  - %s\n", note)
+	}
+
+	fmt.Fprintf(w, "\nMembers: %d\n", len(d.Members))
+	for _, m := range d.Members {
+		fmt.Fprintf(w, "  %-16s %10d", m.Name, m.Size)
+		if m.Compression != "" {
+			fmt.Fprintf(w, "  %-5s %10d uncompressed, %d entries", m.Compression, m.UncompressedSize, m.Entries)
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "\nControl:\n")
+	for _, field := range d.Control {
+		fmt.Fprintf(w, "  %s: %s\n", field.Name, strings.ReplaceAll(field.Value, "\n", "\n    "))
+	}
+
+	fmt.Fprintf(w, "\nScripts: %d\n", len(d.Scripts))
+	writeControlFilesText(w, d.Scripts)
+	if len(d.ControlFiles) > 0 {
+		fmt.Fprintf(w, "\nControl files: %d\n", len(d.ControlFiles))
+		writeControlFilesText(w, d.ControlFiles)
+	}
+
+	var totalSize int64
+	for _, f := range d.Files {
+		totalSize += f.Size
+	}
+	fmt.Fprintf(w, "\nFiles:   %d (%d bytes)\n", len(d.Files), totalSize)
+	for _, f := range d.Files {
+		name := f.Path
+		switch f.Type {
+		case "dir":
+			name = strings.TrimSuffix(name, "/") + "/"
+		case "symlink":
+			name += " -> " + f.Link
+		case "hardlink":
+			name += " link to " + f.Link
+		}
+		fmt.Fprintf(w, "  %s %s %-12s %10d  %s", debTypeChar(f.Type), f.Mode, f.Owner, f.Size, name)
+		if f.SHA256 != "" {
+			fmt.Fprintf(w, "  %s", f.SHA256)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if machoFiles := d.MachOFiles(); len(machoFiles) > 0 {
+		fmt.Fprintf(w, "\nMach-O:  %d file(s)\n", len(machoFiles))
+		for _, f := range machoFiles {
+			fmt.Fprintf(w, "  %s", f.Path)
+			if f.MachO.Fat {
+				fmt.Fprintf(w, " (fat, %d slices)", len(f.MachO.Slices))
+			}
+			if f.MachO.Error != "" {
+				fmt.Fprintf(w, ": %s", f.MachO.Error)
+			}
+			fmt.Fprintln(w)
+			for _, s := range f.MachO.Slices {
+				writeMachOSliceText(w, s)
+			}
+		}
+	}
+
+	if len(d.Problems) > 0 {
+		fmt.Fprintf(w, "\nProblems: %d\n", len(d.Problems))
+		for _, p := range d.Problems {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+	}
+	return nil
+}
+
+// writeControlFilesText writes one line per control member
+func writeControlFilesText(w io.Writer, files []DebControlFile) {
+	for _, f := range files {
+		fmt.Fprintf(w, "  %s %-12s %8d  %s", f.Mode, f.Name, f.Size, f.SHA256)
+		if f.Interpreter != "" {
+			fmt.Fprintf(w, "  #!%s", f.Interpreter)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// writeMachOSliceText writes one line per slice with its signature summary
+func writeMachOSliceText(w io.Writer, s MachOSlice) {
+	if s.Error != "" {
+		fmt.Fprintf(w, "    - offset 0x%x size 0x%x: %s\n", s.Offset, s.Size, s.Error)
+		return
+	}
+	fmt.Fprintf(w, "    - %-8s %-8s offset 0x%-8x size 0x%-8x ", s.Arch, s.FileType, s.Offset, s.Size)
+	sig := s.Signature
+	if sig == nil {
+		fmt.Fprintln(w, "unsigned")
+		return
+	}
+	status := "valid"
+	if !sig.Valid {
+		status = "invalid: " + sig.Error
+	}
+	fmt.Fprintf(w, "%s %s", sig.Kind, sig.Identifier)
+	if sig.TeamID != "" {
+		fmt.Fprintf(w, " team %s", sig.TeamID)
+	}
+	fmt.Fprintf(w, " (%s, %d pages, %d entitlement(s)", strings.Join(sig.HashTypes, "+"), sig.CodeSlots, len(sig.Entitlements))
+	if len(sig.Flags) > 0 {
+		fmt.Fprintf(w, ", flags %s", strings.Join(sig.Flags, ","))
+	}
+	fmt.Fprintf(w, ") %s\n", status)
+}
+
+// debTypeChar returns the ls style type character of a file entry
+func debTypeChar(fileType string) string {
+	switch fileType {
+	case "dir":
+		return "d"
+	case "symlink":
+		return "l"
+	case "hardlink":
+		return "h"
+	case "file":
+		return "-"
+	}
+	return "?"
+}
+
+// WriteDebInspection writes an inspection in the given format ("text" or "json")
+func WriteDebInspection(w io.Writer, d *DebInspection, format string) error {
+	switch format {
+	case "json":
+		return d.WriteJSON(w)
+	case "text", "":
+		return d.WriteText(w)
+	default:
+		return fmt.Errorf("unknown inspect format %q (expected text or json)", format)
+	}
+}
@@ -0,0 +1,667 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fridare-gui/internal/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed rules/deb-default.yaml
+var defaultDebRewriteData []byte
+
+// DEB 改写规则的文件内容变换方式
+const (
+	DebTransformHexPatch = "hexpatch"
+	DebTransformPlist    = "plist"
+	DebTransformScript   = "script"
+)
+
+// debFileTypes 变换规则 type 可用的文件类型
+var debFileTypes = map[string]bool{
+	"macho": true, "elf": true, "pe": true, "plist": true, "script": true, "text": true, "binary": true,
+}
+
+// DebPathRule 路径规则: 匹配 Match 的文件或目录移动到 Rename
+type DebPathRule struct {
+	Match  string `json:"match" yaml:"match"`   // 包内路径glob，支持 * ? ** {a,b}
+	Rename string `json:"rename" yaml:"rename"` // 新路径模板
+}
+
+// DebReplace 文本替换
+type DebReplace struct {
+	Old string `json:"old" yaml:"old"`
+	New string `json:"new" yaml:"new"` // 模板
+}
+
+// DebTransformRule 变换规则: 按路径和文件类型选择内容变换方式
+type DebTransformRule struct {
+	Match     string       `json:"match,omitempty" yaml:"match,omitempty"` // 包内路径glob (空表示所有文件)
+	Type      string       `json:"type,omitempty" yaml:"type,omitempty"`   // 文件类型 (空表示任意类型)
+	Transform string       `json:"transform" yaml:"transform"`             // hexpatch、plist 或 script
+	Port      bool         `json:"port,omitempty" yaml:"port,omitempty"`   // 同时处理端口
+	Replace   []DebReplace `json:"replace,omitempty" yaml:"replace,omitempty"`
+}
+
+// DebControlRule control 字段规则: Value 设置字段值，Old/New 替换字段中的文本
+type DebControlRule struct {
+	Field string `json:"field" yaml:"field"`
+	Value string `json:"value,omitempty" yaml:"value,omitempty"` // 模板，{value} 为原值
+	Old   string `json:"old,omitempty" yaml:"old,omitempty"`
+	New   string `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// DebRewriteRules DEB包改写规则集，描述修改frida DEB包时文件的重命名、内容变换和control字段
+type DebRewriteRules struct {
+	Name        string             `json:"name" yaml:"name"`
+	Description string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Paths       []DebPathRule      `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Transforms  []DebTransformRule `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+	Control     []DebControlRule   `json:"control,omitempty" yaml:"control,omitempty"`
+
+	pathGlobs      []*regexp.Regexp
+	transformGlobs []*regexp.Regexp
+	file           string // 规则文件路径，内置规则为空
+}
+
+// DefaultDebRewriteRules 返回内置的DEB改写规则 (官方frida DEB包的布局)
+func DefaultDebRewriteRules() *DebRewriteRules {
+	rules, err := ParseDebRewriteRules(defaultDebRewriteData, ".yaml")
+	if err != nil {
+		panic(fmt.Sprintf("内置DEB改写规则无效: %v", err))
+	}
+	return rules
+}
+
+// ParseDebRewriteRules 解析改写规则，ext 为 ".json" 时按 JSON 解析，否则按 YAML
+func ParseDebRewriteRules(data []byte, ext string) (*DebRewriteRules, error) {
+	var rules DebRewriteRules
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("解析JSON改写规则失败: %v", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &rules); err != nil {
+			return nil, fmt.Errorf("解析YAML改写规则失败: %v", err)
+		}
+	}
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// LoadDebRewriteRules 从 JSON 或 YAML 文件加载改写规则
+func LoadDebRewriteRules(path string) (*DebRewriteRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取改写规则文件失败: %v", err)
+	}
+	rules, err := ParseDebRewriteRules(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	if rules.Name == "" {
+		rules.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	rules.file = path
+	return rules, nil
+}
+
+// source 返回规则的名称和来源，用于日志和错误信息
+func (r *DebRewriteRules) source() string {
+	if r.file == "" {
+		return r.Name + " (内置)"
+	}
+	return fmt.Sprintf("%s (%s)", r.Name, r.file)
+}
+
+// Validate 检查规则是否完整，编译路径glob
+func (r *DebRewriteRules) Validate() error {
+	if len(r.Paths) == 0 && len(r.Transforms) == 0 && len(r.Control) == 0 {
+		return fmt.Errorf("改写规则为空")
+	}
+
+	r.pathGlobs = r.pathGlobs[:0]
+	for i, rule := range r.Paths {
+		if rule.Match == "" || rule.Rename == "" {
+			return fmt.Errorf("路径规则 %d: match 和 rename 不能为空", i+1)
+		}
+		glob, groups, err := compileDebGlob(rule.Match)
+		if err != nil {
+			return fmt.Errorf("路径规则 %d: %v", i+1, err)
+		}
+		if err := checkDebTemplate(rule.Rename, groups, false); err != nil {
+			return fmt.Errorf("路径规则 %d: %v", i+1, err)
+		}
+		r.pathGlobs = append(r.pathGlobs, glob)
+	}
+
+	r.transformGlobs = r.transformGlobs[:0]
+	for i, rule := range r.Transforms {
+		switch rule.Transform {
+		case DebTransformHexPatch, DebTransformPlist, DebTransformScript:
+		default:
+			return fmt.Errorf("变换规则 %d: 未知的变换方式 %q", i+1, rule.Transform)
+		}
+		if rule.Type != "" && !debFileTypes[rule.Type] {
+			return fmt.Errorf("变换规则 %d: 未知的文件类型 %q", i+1, rule.Type)
+		}
+		match := rule.Match
+		if match == "" {
+			match = "**"
+		}
+		glob, groups, err := compileDebGlob(match)
+		if err != nil {
+			return fmt.Errorf("变换规则 %d: %v", i+1, err)
+		}
+		for _, replace := range rule.Replace {
+			if replace.Old == "" {
+				return fmt.Errorf("变换规则 %d: replace 的 old 不能为空", i+1)
+			}
+			if err := checkDebTemplate(replace.New, groups, false); err != nil {
+				return fmt.Errorf("变换规则 %d: %v", i+1, err)
+			}
+		}
+		r.transformGlobs = append(r.transformGlobs, glob)
+	}
+
+	for i, rule := range r.Control {
+		if rule.Field == "" || strings.ContainsAny(rule.Field, ": \t\n") {
+			return fmt.Errorf("control规则 %d: 字段名无效 %q", i+1, rule.Field)
+		}
+		if rule.Value == "" && rule.Old == "" {
+			return fmt.Errorf("control规则 %d: 需要 value 或 old", i+1)
+		}
+		for _, template := range []string{rule.Value, rule.New} {
+			if err := checkDebTemplate(template, 0, true); err != nil {
+				return fmt.Errorf("control规则 %d: %v", i+1, err)
+			}
+		}
+	}
+	return nil
+}
+
+// compileDebGlob 将glob转换为正则表达式，返回捕获组数量。
+// * 和 ? 只匹配一级路径，** 匹配任意多级路径，{a,b} 匹配其中一项；每个通配符和可选项都是一个捕获组
+func compileDebGlob(glob string) (*regexp.Regexp, int, error) {
+	var b strings.Builder
+	groups := 0
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "/**"):
+			b.WriteString("(?:/(.*))?")
+			groups++
+			i += 2
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:(.*)/)?")
+			groups++
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString("(.*)")
+			groups++
+			i++
+		case c == '*':
+			b.WriteString("([^/]*)")
+			groups++
+		case c == '?':
+			b.WriteString("([^/])")
+			groups++
+		case c == '{':
+			end := strings.IndexByte(glob[i:], '}')
+			if end < 0 {
+				return nil, 0, fmt.Errorf("glob %q 中的 { 没有闭合", glob)
+			}
+			var alternatives []string
+			for _, alternative := range strings.Split(glob[i+1:i+end], ",") {
+				alternatives = append(alternatives, regexp.QuoteMeta(alternative))
+			}
+			b.WriteString("(" + strings.Join(alternatives, "|") + ")")
+			groups++
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return nil, 0, fmt.Errorf("glob %q 无效: %v", glob, err)
+	}
+	return re, groups, nil
+}
+
+// debTemplatePlaceholder 模板中的占位符
+var debTemplatePlaceholder = regexp.MustCompile(`\{([a-z0-9]*)\}`)
+
+// checkDebTemplate 检查模板只使用已知的占位符
+func checkDebTemplate(template string, groups int, control bool) error {
+	for _, m := range debTemplatePlaceholder.FindAllStringSubmatch(template, -1) {
+		switch key := m[1]; {
+		case key == "name", key == "name3", key == "port":
+		case key == "value" && control:
+		default:
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 1 || n > groups {
+				return fmt.Errorf("模板 %q 中有未知的占位符 {%s}", template, key)
+			}
+		}
+	}
+	rest := debTemplatePlaceholder.ReplaceAllString(template, "")
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("模板 %q 中有未闭合的占位符", template)
+	}
+	return nil
+}
+
+// debTemplateVars 展开模板使用的变量
+type debTemplateVars struct {
+	name     string
+	port     int
+	captures []string
+	value    string
+}
+
+func (v debTemplateVars) expand(template string) string {
+	return debTemplatePlaceholder.ReplaceAllStringFunc(template, func(m string) string {
+		switch key := m[1 : len(m)-1]; key {
+		case "name":
+			return v.name
+		case "name3":
+			if len(v.name) > 3 {
+				return v.name[:3]
+			}
+			return v.name
+		case "port":
+			return strconv.Itoa(v.port)
+		case "value":
+			return v.value
+		default:
+			if n, err := strconv.Atoi(key); err == nil && n >= 1 && n <= len(v.captures) {
+				return v.captures[n-1]
+			}
+		}
+		return m
+	})
+}
+
+// debRewriteEntry 包内的一个文件或目录及其改写计划
+type debRewriteEntry struct {
+	rel       string // 原路径 (相对包根目录，/ 分隔)
+	newRel    string // 新路径
+	info      os.FileInfo
+	transform int // 变换规则下标，-1 表示不变换
+	vars      debTemplateVars
+}
+
+// rewriteRules 返回使用的改写规则
+func (dm *DebModifier) rewriteRules() *DebRewriteRules {
+	if dm.RewriteRules != nil {
+		return dm.RewriteRules
+	}
+	return DefaultDebRewriteRules()
+}
+
+// planRewrite 遍历解压目录，按规则计算每个条目的新路径和变换方式
+func (dm *DebModifier) planRewrite(rules *DebRewriteRules) ([]*debRewriteEntry, error) {
+	var entries []*debRewriteEntry
+	renamed := make(map[string]string) // 已重命名的目录，未匹配规则的子条目随目录移动
+	err := filepath.Walk(dm.ExtractDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dm.ExtractDir, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		entry := &debRewriteEntry{rel: filepath.ToSlash(rel), info: info, transform: -1}
+		entry.newRel = entry.rel
+		entry.vars = debTemplateVars{name: dm.MagicName, port: dm.Port}
+
+		matched := false
+		for i, glob := range rules.pathGlobs {
+			if m := glob.FindStringSubmatch(entry.rel); m != nil {
+				vars := entry.vars
+				vars.captures = m[1:]
+				entry.newRel = path.Clean(vars.expand(rules.Paths[i].Rename))
+				matched = true
+				break
+			}
+		}
+		if parent, ok := renamed[path.Dir(entry.rel)]; ok && !matched {
+			entry.newRel = path.Join(parent, path.Base(entry.rel))
+		}
+		if info.IsDir() && entry.newRel != entry.rel {
+			renamed[entry.rel] = entry.newRel
+		}
+		if strings.HasPrefix(entry.newRel, "../") || entry.newRel == ".." || path.IsAbs(entry.newRel) || entry.newRel == "." {
+			return fmt.Errorf("%s 的新路径超出包目录: %s", entry.rel, entry.newRel)
+		}
+
+		if info.Mode().IsRegular() {
+			fileType := ""
+			for i, glob := range rules.transformGlobs {
+				m := glob.FindStringSubmatch(entry.rel)
+				if m == nil {
+					continue
+				}
+				if rule := rules.Transforms[i]; rule.Type != "" {
+					if fileType == "" {
+						fileType = detectDebFileType(p)
+					}
+					if fileType != rule.Type {
+						continue
+					}
+				}
+				entry.transform = i
+				entry.vars.captures = m[1:]
+				break
+			}
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查重命名冲突
+	targets := make(map[string]string)
+	for _, entry := range entries {
+		if other, ok := targets[entry.newRel]; ok && !entry.info.IsDir() {
+			return nil, fmt.Errorf("%s 和 %s 重命名到同一路径: %s", other, entry.rel, entry.newRel)
+		}
+		targets[entry.newRel] = entry.rel
+	}
+	return entries, nil
+}
+
+// hexPatchTargets 按规则顺序返回需要hex替换的条目
+func hexPatchTargets(rules *DebRewriteRules, entries []*debRewriteEntry) []*debRewriteEntry {
+	var targets []*debRewriteEntry
+	for i, rule := range rules.Transforms {
+		if rule.Transform != DebTransformHexPatch {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.transform == i {
+				targets = append(targets, entry)
+			}
+		}
+	}
+	return targets
+}
+
+// rewritePackage 按改写规则修改解压目录中的文件: 先执行内容变换 (按规则顺序)，再移动其余条目
+func (dm *DebModifier) rewritePackage(rules *DebRewriteRules, progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始按改写规则修改包内文件")
+
+	// 验证魔改名称 (1-5个字符总能替换，更长的名称由HexReplacer逐个字符串检查剩余空间)
+	if err := utils.ValidateMagicName(dm.MagicName); err != nil {
+		return fmt.Errorf("%v: %s", err, dm.MagicName)
+	}
+
+	log.Printf("INFO: 使用改写规则: %s", rules.source())
+	entries, err := dm.planRewrite(rules)
+	if err != nil {
+		return err
+	}
+	// 没有文件匹配 hexpatch 变换时输出的包与原包相同，不能当作成功
+	if len(hexPatchTargets(rules, entries)) == 0 {
+		return fmt.Errorf("DEB包中未找到需要修改的二进制文件，改写规则 %s 的 hexpatch 变换未匹配任何文件", rules.source())
+	}
+
+	// 1. 创建重命名后的目录
+	for _, entry := range entries {
+		if entry.info.IsDir() && entry.newRel != entry.rel {
+			newDir := dm.absPath(entry.newRel)
+			if err := os.MkdirAll(newDir, 0755); err != nil {
+				return fmt.Errorf("创建目录失败: %v", err)
+			}
+			if err := os.Chmod(newDir, entry.info.Mode().Perm()|0700); err != nil {
+				log.Printf("WARNING: 设置目录权限失败: %s, 错误: %v", newDir, err)
+			}
+		}
+	}
+
+	// 2. 内容变换，按规则顺序处理 (frida-server 的报告排在 agent 之前)
+	transformed := 0
+	for i := range rules.Transforms {
+		for _, entry := range entries {
+			if entry.transform != i {
+				continue
+			}
+			transformed++
+			if progressCallback != nil {
+				progressCallback(0.5+0.3*float64(transformed)/float64(len(entries)), fmt.Sprintf("修改 %s...", path.Base(entry.rel)))
+			}
+			if err := dm.applyTransform(&rules.Transforms[i], entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	// 3. 移动其余文件和符号链接
+	for _, entry := range entries {
+		if entry.info.IsDir() || entry.transform >= 0 || entry.newRel == entry.rel {
+			continue
+		}
+		newPath := dm.absPath(entry.newRel)
+		if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := os.Rename(dm.absPath(entry.rel), newPath); err != nil {
+			return fmt.Errorf("重命名失败 %s -> %s: %v", entry.rel, entry.newRel, err)
+		}
+		log.Printf("INFO: 重命名: %s -> %s", entry.rel, entry.newRel)
+	}
+
+	// 4. 删除已移空的原目录 (由深到浅)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].rel > entries[j].rel })
+	for _, entry := range entries {
+		if entry.info.IsDir() && entry.newRel != entry.rel {
+			if err := os.Remove(dm.absPath(entry.rel)); err == nil {
+				log.Printf("INFO: 重命名目录: %s -> %s", entry.rel, entry.newRel)
+			}
+		}
+	}
+	return nil
+}
+
+// applyTransform 对一个文件执行内容变换，结果写入新路径并删除原文件
+func (dm *DebModifier) applyTransform(rule *DebTransformRule, entry *debRewriteEntry) error {
+	oldPath, newPath := dm.absPath(entry.rel), dm.absPath(entry.newRel)
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	mode := entry.info.Mode().Perm()
+
+	switch rule.Transform {
+	case DebTransformHexPatch:
+		log.Printf("INFO: 开始修改二进制文件内容: %s", entry.rel)
+		hexReplacer := NewHexReplacer()
+		hexReplacer.Rules = dm.Rules
+		hexReplacer.FridaVersion = dm.fridaVersion
+		hexReplacer.Arches = dm.Arches
+		if rule.Port && dm.PatchPort {
+			hexReplacer.Port = dm.Port
+			log.Printf("INFO: 修补默认端口: %d -> %d", DefaultFridaPort, dm.Port)
+		}
+		progressCallback := func(progress float64, message string) {
+			log.Printf("DEBUG: HEX替换进度 %.1f%% - %s", progress*100, message)
+		}
+		report, err := hexReplacer.PatchFileWithReport(oldPath, dm.MagicName, newPath, progressCallback)
+		if err != nil {
+			log.Printf("ERROR: 二进制内容修改失败: %s, 错误: %v", entry.rel, err)
+			return fmt.Errorf("修改二进制文件内容失败 %s: %v", entry.rel, err)
+		}
+		report.File = entry.newRel
+		dm.Reports = append(dm.Reports, report)
+		log.Printf("INFO: 成功修改二进制文件内容: %s (替换 %d 处)", entry.rel, report.Count())
+
+	case DebTransformPlist, DebTransformScript:
+		content, err := os.ReadFile(oldPath)
+		if err != nil {
+			return err
+		}
+		if rule.Transform == DebTransformPlist {
+			content, err = dm.rewritePlist(rule, entry, content)
+			if err != nil {
+				return fmt.Errorf("修改plist文件失败 %s: %v", entry.rel, err)
+			}
+		} else {
+			content = []byte(entry.replaceText(rule, string(content)))
+			mode = 0755
+		}
+		if err := os.WriteFile(newPath, content, mode); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", entry.newRel, err)
+		}
+		log.Printf("INFO: 成功修改%s文件: %s", rule.Transform, entry.newRel)
+	}
+
+	if oldPath != newPath {
+		if err := os.Remove(oldPath); err != nil {
+			log.Printf("WARNING: 删除原文件失败: %s, 错误: %v", oldPath, err)
+		}
+	}
+	if err := os.Chmod(newPath, mode); err != nil {
+		log.Printf("WARNING: 设置文件权限失败: %s, 权限: %o, 错误: %v", newPath, mode, err)
+	}
+	if oldPath != newPath {
+		log.Printf("INFO: 重命名: %s -> %s", entry.rel, entry.newRel)
+	}
+	return nil
+}
+
+// replaceText 按规则的 replace 列表替换文本
+func (entry *debRewriteEntry) replaceText(rule *DebTransformRule, text string) string {
+	for _, replace := range rule.Replace {
+		text = strings.ReplaceAll(text, replace.Old, entry.vars.expand(replace.New))
+	}
+	return text
+}
+
+// rewritePlist 解析 LaunchDaemon plist (XML 或二进制)，对所有字符串值执行替换，
+// 需要时设置监听端口，再按原格式写回；无法解析的文件退回按文本替换
+func (dm *DebModifier) rewritePlist(rule *DebTransformRule, entry *debRewriteEntry, content []byte) ([]byte, error) {
+	daemon, format, err := ParseLaunchDaemon(content)
+	if err != nil {
+		log.Printf("WARNING: 无法解析plist %s (%v)，按文本替换", entry.rel, err)
+		return []byte(entry.replaceText(rule, string(content))), nil
+	}
+
+	daemon.ReplaceStrings(func(s string) string {
+		return entry.replaceText(rule, s)
+	})
+	if rule.Port {
+		daemon.SetListenPort(dm.Port)
+		if address, ok := daemon.ListenAddress(); ok {
+			log.Printf("DEBUG: 监听地址: %s", address)
+		} else {
+			log.Printf("DEBUG: 使用默认端口%d，无需添加启动参数", DefaultFridaPort)
+		}
+	}
+	log.Printf("DEBUG: plist格式: %s, 标签: %s", format, daemon.Label)
+	return daemon.Marshal(format)
+}
+
+// absPath 返回包内路径在解压目录中的绝对路径
+func (dm *DebModifier) absPath(rel string) string {
+	return filepath.Join(dm.ExtractDir, filepath.FromSlash(rel))
+}
+
+// detectDebFileType 按文件头识别变换规则使用的文件类型
+func detectDebFileType(p string) string {
+	file, err := os.Open(p)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, _ := file.Read(header)
+	header = header[:n]
+
+	switch {
+	case len(header) >= 4 && (bytes.Equal(header[:4], []byte{0xCF, 0xFA, 0xED, 0xFE}) ||
+		bytes.Equal(header[:4], []byte{0xCE, 0xFA, 0xED, 0xFE}) ||
+		bytes.Equal(header[:4], []byte{0xCA, 0xFE, 0xBA, 0xBE})):
+		return "macho"
+	case bytes.HasPrefix(header, []byte("\x7fELF")):
+		return "elf"
+	case bytes.HasPrefix(header, []byte("MZ")):
+		return "pe"
+	case bytes.HasPrefix(header, []byte("bplist00")),
+		bytes.HasPrefix(bytes.TrimSpace(header), []byte("<?xml")) && bytes.Contains(header, []byte("<plist")):
+		return "plist"
+	case bytes.HasPrefix(header, []byte("#!")):
+		return "script"
+	case bytes.IndexByte(header, 0) < 0:
+		return "text"
+	}
+	return "binary"
+}
+
+// applyControlRules 按改写规则修改 DEBIAN/control 的字段
+func (dm *DebModifier) applyControlRules(rules *DebRewriteRules) error {
+	if len(rules.Control) == 0 {
+		return nil
+	}
+	controlFile := filepath.Join(dm.ExtractDir, "DEBIAN", "control")
+	file, err := os.Open(controlFile)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	file.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, rule := range rules.Control {
+		vars := debTemplateVars{name: dm.MagicName, port: dm.Port}
+		found := false
+		for i, line := range lines {
+			key, value, ok := strings.Cut(line, ":")
+			if !ok || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || !strings.EqualFold(strings.TrimSpace(key), rule.Field) {
+				continue
+			}
+			found = true
+			vars.value = strings.TrimSpace(value)
+			newValue := vars.value
+			if rule.Value != "" {
+				newValue = vars.expand(rule.Value)
+			}
+			if rule.Old != "" {
+				newValue = strings.ReplaceAll(newValue, rule.Old, vars.expand(rule.New))
+			}
+			lines[i] = fmt.Sprintf("%s: %s", strings.TrimSpace(key), newValue)
+			log.Printf("DEBUG: control字段 %s: %q -> %q", rule.Field, vars.value, newValue)
+			break
+		}
+		if !found && rule.Value != "" && !strings.Contains(rule.Value, "{value}") {
+			lines = append(lines, fmt.Sprintf("%s: %s", rule.Field, vars.expand(rule.Value)))
+			log.Printf("DEBUG: 添加control字段 %s", rule.Field)
+		}
+	}
+	return dm.writeLinesToFile(controlFile, lines)
+}
@@ -3,25 +3,23 @@ package core
 import (
 	"archive/tar"
 	"bufio"
-	"bytes"
-	"compress/gzip"
 	"fmt"
+	"fridare-gui/internal/utils"
 	"io"
 	"log"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
-
-	"github.com/ulikunitz/xz"
 )
 
 // DebPackager DEB包构建器
 type DebPackager struct {
-	TempDir string
+	TempDir      string
+	Compression  string    // control.tar 和 data.tar 的压缩方式 (默认 xz)
+	Reproducible bool      // 可复现构建，相同输入生成逐字节相同的DEB
+	SourceDate   time.Time // 可复现构建的时间戳 (零值使用 SOURCE_DATE_EPOCH)
 }
 
 // PackageInfo 包信息
@@ -38,6 +36,8 @@ type PackageInfo struct {
 	Port         int
 	MagicName    string
 	IsRootless   bool // 是否为rootless结构
+
+	RuntimeOptions // frida-server 运行参数 (监听地址、TLS证书、认证令牌等)
 }
 
 // PathMapper 路径映射器，用于处理不同架构的路径转换
@@ -92,7 +92,22 @@ type DebModifier struct {
 	Port       int
 	TempDir    string
 	ExtractDir string
-	PathMapper *PathMapper // 路径映射器
+	PathMapper *PathMapper    // 路径映射器
+	Rules      *RuleSet       // 替换规则集 (nil 使用内置默认规则)
+	Reports    []*PatchReport // 二进制替换报告 (每个被修改的文件一份)
+	PatchPort  bool           // 同时修补frida-server二进制中的默认端口
+	Arches     []string       // fat Mach-O 仅保留的架构切片，如 arm64、arm64e (空表示保留全部)
+	// RewriteRules 包内文件的改写规则 (nil 使用内置的 deb-default 规则)
+	RewriteRules *DebRewriteRules
+	// Reproducible 可复现构建，SourceDate 为其时间戳 (零值使用 SOURCE_DATE_EPOCH)
+	Reproducible bool
+	SourceDate   time.Time
+	// Compression 输出成员的压缩方式 (空表示与输入包相同，lzma/bzip2 输入改用 xz)
+	Compression string
+
+	controlCompression string // 输入包 control.tar 的压缩方式
+	dataCompression    string // 输入包 data.tar 的压缩方式
+	fridaVersion       string // control 的 Version 字段，用于筛选按版本限定的替换规则
 }
 
 // NewDebPackager 创建新的DEB包构建器
@@ -145,6 +160,15 @@ func (dp *DebPackager) CreateDebPackage(fridaFile, outputPath string, info *Pack
 
 	progressCallback(0.6, "创建控制文件...")
 
+	// 安装TLS证书
+	if info.Certificate != "" {
+		for _, root := range dp.installRoots(tempDir, arch) {
+			if err := info.installCertificate(root, dp.certificatePath(info)); err != nil {
+				return fmt.Errorf("安装TLS证书失败: %v", err)
+			}
+		}
+	}
+
 	// 创建启动脚本
 	err = dp.createLaunchDaemon(tempDir, arch, info)
 	if err != nil {
@@ -265,6 +289,19 @@ func (dp *DebPackager) copyFridaFile(srcFile, tempDir, arch string, info *Packag
 	return nil
 }
 
+// installRoots 返回文件需要安装到的包目录 (arm64 同时安装到 var/re)
+func (dp *DebPackager) installRoots(tempDir, arch string) []string {
+	if strings.Contains(arch, "arm64") {
+		return []string{filepath.Join(tempDir, "var/re"), tempDir}
+	}
+	return []string{tempDir}
+}
+
+// certificatePath 返回TLS证书在设备上的路径
+func (dp *DebPackager) certificatePath(info *PackageInfo) string {
+	return path.Join("/usr/lib", info.MagicName, CertificateName(info.MagicName))
+}
+
 // copyFile 复制文件
 func (dp *DebPackager) copyFile(src, dst string) error {
 	srcFile, err := os.Open(src)
@@ -346,31 +383,17 @@ func (dp *DebPackager) createLaunchDaemon(tempDir, arch string, info *PackageInf
 	}
 
 	// plist内容
-	plistContent := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-<plist version="1.0">
-<dict>
-	<key>Label</key>
-	<string>re.%s.server</string>
-	<key>ProgramArguments</key>
-	<array>
-		<string>/usr/bin/%s</string>
-		<string>-l</string>
-		<string>0.0.0.0:%d</string>
-	</array>
-	<key>UserName</key>
-	<string>root</string>
-	<key>RunAtLoad</key>
-	<true/>
-	<key>KeepAlive</key>
-	<true/>
-</dict>
-</plist>
-`, info.MagicName, info.MagicName, info.Port)
+	daemon := NewLaunchDaemon(fmt.Sprintf("re.%s.server", info.MagicName), "/usr/bin/"+info.MagicName)
+	daemon.SetListenAddress(info.ListenAddress(info.Port))
+	info.applyToLaunchDaemon(daemon, info.Port, dp.certificatePath(info))
+	plistContent, err := daemon.Marshal(PlistXML)
+	if err != nil {
+		return err
+	}
 
 	// 写入所有plist文件
 	for _, plistPath := range plistPaths {
-		err := os.WriteFile(plistPath, []byte(plistContent), 0644)
+		err := os.WriteFile(plistPath, plistContent, 0644)
 		if err != nil {
 			return err
 		}
@@ -509,218 +532,17 @@ func (dp *DebPackager) calculateInstalledSize(dir string) (int, error) {
 	return sizeKB, nil
 }
 
-// buildDebPackage 构建DEB包
+// buildDebPackage 使用纯Go的DEB写入器构建DEB包
 func (dp *DebPackager) buildDebPackage(tempDir, outputPath string, info *PackageInfo) error {
-	// 检查是否有dpkg-deb命令
-	if _, err := exec.LookPath("dpkg-deb"); err == nil {
-		return dp.buildWithDpkgDeb(tempDir, outputPath)
-	}
-
-	// 如果没有dpkg-deb，使用内置方法
-	return dp.buildWithTar(tempDir, outputPath, info)
-}
-
-// buildWithDpkgDeb 使用dpkg-deb构建
-func (dp *DebPackager) buildWithDpkgDeb(tempDir, outputPath string) error {
-	cmd := exec.Command("dpkg-deb", "--build", tempDir, outputPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("dpkg-deb 执行失败: %v, 输出: %s", err, string(output))
-	}
-	return nil
-}
-
-// buildWithTar 使用tar构建（内置方法）
-func (dp *DebPackager) buildWithTar(tempDir, outputPath string, info *PackageInfo) error {
-	// 创建data.tar.gz
-	dataPath := filepath.Join(tempDir, "data.tar.gz")
-	err := dp.createDataTar(tempDir, dataPath)
-	if err != nil {
-		return err
-	}
-
-	// 创建control.tar.gz
-	controlPath := filepath.Join(tempDir, "control.tar.gz")
-	err = dp.createControlTar(tempDir, controlPath)
-	if err != nil {
-		return err
-	}
-
-	// 创建debian-binary文件
-	debianBinaryPath := filepath.Join(tempDir, "debian-binary")
-	err = os.WriteFile(debianBinaryPath, []byte("2.0\n"), 0644)
-	if err != nil {
-		return err
-	}
-
-	// 创建最终的.deb文件
-	return dp.createDebFile(tempDir, outputPath)
-}
-
-// createDataTar 创建data.tar.gz
-func (dp *DebPackager) createDataTar(tempDir, outputPath string) error {
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
-
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
-
-	// 遍历并添加非DEBIAN目录的所有文件
-	return filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, err := filepath.Rel(tempDir, path)
-		if err != nil {
-			return err
-		}
-
-		// 跳过DEBIAN目录和临时文件
-		if strings.HasPrefix(relPath, "DEBIAN") || strings.Contains(relPath, ".tar.gz") || relPath == "debian-binary" {
-			return nil
-		}
-
-		if relPath == "." {
-			return nil
-		}
-
-		// 创建tar头部
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-
-		header.Name = "./" + relPath
-
-		err = tarWriter.WriteHeader(header)
-		if err != nil {
-			return err
-		}
-
-		// 如果是文件，写入内容
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-
-			_, err = io.Copy(tarWriter, file)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-}
-
-// createControlTar 创建control.tar.gz
-func (dp *DebPackager) createControlTar(tempDir, outputPath string) error {
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	gzWriter := gzip.NewWriter(file)
-	defer gzWriter.Close()
-
-	tarWriter := tar.NewWriter(gzWriter)
-	defer tarWriter.Close()
-
-	debianDir := filepath.Join(tempDir, "DEBIAN")
-
-	// 遍历DEBIAN目录
-	return filepath.Walk(debianDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		relPath, err := filepath.Rel(debianDir, path)
-		if err != nil {
-			return err
-		}
-
-		if relPath == "." {
-			return nil
-		}
-
-		// 创建tar头部
-		header, err := tar.FileInfoHeader(info, "")
-		if err != nil {
-			return err
-		}
-
-		header.Name = "./" + relPath
-
-		err = tarWriter.WriteHeader(header)
-		if err != nil {
-			return err
-		}
-
-		// 如果是文件，写入内容
-		if !info.IsDir() {
-			file, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-
-			_, err = io.Copy(tarWriter, file)
-			if err != nil {
-				return err
-			}
-		}
-
-		return nil
-	})
-}
-
-// createDebFile 创建最终的.deb文件
-func (dp *DebPackager) createDebFile(tempDir, outputPath string) error {
-	debFile, err := os.Create(outputPath)
-	if err != nil {
-		return err
-	}
-	defer debFile.Close()
-
-	// 写入debian-binary
-	debianBinaryPath := filepath.Join(tempDir, "debian-binary")
-	err = dp.appendFile(debFile, debianBinaryPath)
-	if err != nil {
-		return err
-	}
-
-	// 写入control.tar.gz
-	controlPath := filepath.Join(tempDir, "control.tar.gz")
-	err = dp.appendFile(debFile, controlPath)
-	if err != nil {
-		return err
-	}
-
-	// 写入data.tar.gz
-	dataPath := filepath.Join(tempDir, "data.tar.gz")
-	return dp.appendFile(debFile, dataPath)
-}
-
-// appendFile 将文件内容追加到另一个文件
-func (dp *DebPackager) appendFile(dst *os.File, srcPath string) error {
-	src, err := os.Open(srcPath)
-	if err != nil {
-		return err
+	writer := NewDebWriter()
+	if dp.Compression != "" {
+		writer.ControlCompression = dp.Compression
+		writer.DataCompression = dp.Compression
 	}
-	defer src.Close()
-
-	_, err = io.Copy(dst, src)
-	return err
+	writer.FileMode = fridaDebFileMode(info.MagicName)
+	writer.Reproducible = dp.Reproducible
+	writer.ModTime = dp.SourceDate
+	return writer.Build(tempDir, outputPath)
 }
 
 // ValidatePackageInfo 验证包信息
@@ -737,13 +559,13 @@ func (dp *DebPackager) ValidatePackageInfo(info *PackageInfo) error {
 	if info.MagicName == "" {
 		return fmt.Errorf("魔改名称不能为空")
 	}
-	if len(info.MagicName) != 5 {
-		return fmt.Errorf("魔改名称必须为5个字符")
+	if err := utils.ValidateMagicName(info.MagicName); err != nil {
+		return err
 	}
 	if info.Port <= 0 || info.Port > 65535 {
 		return fmt.Errorf("端口号必须在1-65535之间")
 	}
-	return nil
+	return info.RuntimeOptions.Validate()
 }
 
 // GetDefaultPackageInfo 获取默认包信息
@@ -827,51 +649,34 @@ func (dm *DebModifier) ModifyDebPackage(progressCallback func(float64, string))
 		return fmt.Errorf("读取包信息失败: %v", err)
 	}
 	log.Printf("DEBUG: 包信息 - 名称: %s, 版本: %s, 架构: %s", packageInfo.Name, packageInfo.Version, packageInfo.Architecture)
+	dm.fridaVersion = packageInfo.Version
+
+	rules := dm.rewriteRules()
 
 	progressCallback(0.4, "修改包元数据...")
 
-	// 3. 修改包元数据
+	// 3. 按改写规则修改control字段
 	log.Printf("INFO: 步骤3 - 修改包元数据")
-	err = dm.modifyPackageMetadata(packageInfo)
+	err = dm.applyControlRules(rules)
 	if err != nil {
 		log.Printf("ERROR: 修改包元数据失败: %v", err)
 		return fmt.Errorf("修改包元数据失败: %v", err)
 	}
 
-	progressCallback(0.5, "修改二进制文件...")
-
-	// 4. 修改二进制文件名
-	log.Printf("INFO: 步骤4 - 修改二进制文件")
-	err = dm.modifyBinaryFiles()
-	if err != nil {
-		log.Printf("ERROR: 修改二进制文件失败: %v", err)
-		return fmt.Errorf("修改二进制文件失败: %v", err)
-	}
-
-	progressCallback(0.7, "修改启动守护进程...")
-
-	// 5. 修改启动守护进程配置
-	log.Printf("INFO: 步骤5 - 修改启动守护进程配置")
-	err = dm.modifyLaunchDaemon()
-	if err != nil {
-		log.Printf("ERROR: 修改启动守护进程失败: %v", err)
-		return fmt.Errorf("修改启动守护进程失败: %v", err)
-	}
-
-	progressCallback(0.8, "修改DEBIAN脚本...")
+	progressCallback(0.5, "修改包内文件...")
 
-	// 6. 修改DEBIAN目录中的脚本
-	log.Printf("INFO: 步骤6 - 修改DEBIAN脚本")
-	err = dm.modifyDebianScripts()
+	// 4. 按改写规则重命名和修改包内文件 (二进制、启动守护进程配置和DEBIAN脚本)
+	log.Printf("INFO: 步骤4 - 修改包内文件")
+	err = dm.rewritePackage(rules, progressCallback)
 	if err != nil {
-		log.Printf("ERROR: 修改DEBIAN脚本失败: %v", err)
-		return fmt.Errorf("修改DEBIAN脚本失败: %v", err)
+		log.Printf("ERROR: 修改包内文件失败: %v", err)
+		return fmt.Errorf("修改包内文件失败: %v", err)
 	}
 
 	progressCallback(0.9, "重新打包DEB...")
 
-	// 7. 重新打包
-	log.Printf("INFO: 步骤7 - 重新打包DEB文件")
+	// 5. 重新打包
+	log.Printf("INFO: 步骤5 - 重新打包DEB文件")
 	err = dm.repackageDebFile()
 	if err != nil {
 		log.Printf("ERROR: 重新打包失败: %v", err)
@@ -883,6 +688,10 @@ func (dm *DebModifier) ModifyDebPackage(progressCallback func(float64, string))
 		log.Printf("INFO: 输出DEB文件大小: %d 字节 (%.2f KB)", stat.Size(), float64(stat.Size())/1024)
 	}
 
+	// 6. 汇总残留特征
+	summary := logResidualFingerprints(dm.Reports)
+	progressCallback(0.95, fmt.Sprintf("残留特征: %s", summary))
+
 	progressCallback(1.0, "DEB包修改完成!")
 	log.Printf("SUCCESS: DEB包修改完成: %s", dm.OutputPath)
 	return nil
@@ -894,7 +703,8 @@ func (dm *DebModifier) extractDebPackage() error {
 	return dm.extractDebWithGoAr()
 }
 
-// extractDebWithGoAr 使用纯Go方式解析AR格式解压DEB文件
+// extractDebWithGoAr 使用纯Go方式解析AR格式解压DEB文件。
+// 成员以流的方式解压到磁盘，内存占用与包大小无关
 func (dm *DebModifier) extractDebWithGoAr() error {
 	log.Printf("INFO: 开始解压DEB文件: %s -> %s", dm.InputPath, dm.ExtractDir)
 
@@ -913,26 +723,27 @@ func (dm *DebModifier) extractDebWithGoAr() error {
 		log.Printf("INFO: DEB文件大小: %d 字节", stat.Size())
 	}
 
-	// 读取AR文件头部
-	header := make([]byte, 8)
-	_, err = file.Read(header)
+	return dm.extractDeb(bufio.NewReaderSize(file, 256<<10))
+}
+
+// extractDeb 从 r 流式读取DEB包，control.tar 解压到 DEBIAN 目录，data.tar 解压到解压目录
+func (dm *DebModifier) extractDeb(r io.Reader) error {
+	ar, err := newArReader(r)
 	if err != nil {
-		log.Printf("ERROR: 读取AR头部失败: %v", err)
-		return fmt.Errorf("读取AR头部失败: %v", err)
+		log.Printf("ERROR: %v", err)
+		return err
 	}
+	log.Printf("DEBUG: AR文件头部验证通过")
 
-	if string(header) != "!<arch>\n" {
-		log.Printf("ERROR: 不是有效的AR文件，头部: %q", string(header))
-		return fmt.Errorf("不是有效的AR文件")
+	controlDir := filepath.Join(dm.ExtractDir, "DEBIAN")
+	if err := os.MkdirAll(controlDir, 0755); err != nil {
+		log.Printf("ERROR: 创建DEBIAN目录失败: %v", err)
+		return err
 	}
-	log.Printf("DEBUG: AR文件头部验证通过")
 
-	var controlData, dataArchive []byte
 	entryCount := 0
-
-	// 解析AR文件条目
 	for {
-		entry, err := dm.readArEntry(file)
+		entry, err := ar.Next()
 		if err == io.EOF {
 			log.Printf("DEBUG: AR文件解析完成，共处理 %d 个条目", entryCount)
 			break
@@ -945,63 +756,31 @@ func (dm *DebModifier) extractDebWithGoAr() error {
 		entryCount++
 		log.Printf("DEBUG: 处理AR条目 %d: 名称=%s, 大小=%d 字节", entryCount, entry.Name, entry.Size)
 
-		// 读取文件内容
-		content := make([]byte, entry.Size)
-		_, err = io.ReadFull(file, content)
-		if err != nil {
-			log.Printf("ERROR: 读取AR文件内容失败: %s, 错误: %v", entry.Name, err)
-			return fmt.Errorf("读取AR文件内容失败: %v", err)
-		}
-
-		switch entry.Name {
-		case "control.tar.xz", "control.tar.gz":
-			controlData = content
-			log.Printf("INFO: 保存control档案: %s, 大小: %d 字节", entry.Name, len(content))
-		case "data.tar.xz", "data.tar.gz":
-			dataArchive = content
-			log.Printf("INFO: 保存data档案: %s, 大小: %d 字节", entry.Name, len(content))
-		case "debian-binary":
+		switch {
+		case strings.HasPrefix(entry.Name, "control.tar"):
+			log.Printf("INFO: 开始解压control档案到: %s", controlDir)
+			if dm.controlCompression, err = dm.extractTarArchive(entry.Name, ar, controlDir); err != nil {
+				log.Printf("ERROR: 解压control.tar失败: %v", err)
+				return fmt.Errorf("解压control.tar失败: %v", err)
+			}
+		case strings.HasPrefix(entry.Name, "data.tar"):
+			log.Printf("INFO: 开始解压data档案到: %s", dm.ExtractDir)
+			if dm.dataCompression, err = dm.extractTarArchive(entry.Name, ar, dm.ExtractDir); err != nil {
+				log.Printf("ERROR: 解压data.tar失败: %v", err)
+				return fmt.Errorf("解压data.tar失败: %v", err)
+			}
+		case entry.Name == "debian-binary":
+			content, _ := io.ReadAll(io.LimitReader(ar, 64))
 			log.Printf("INFO: debian-binary内容: %q", string(content))
-			continue
 		default:
 			log.Printf("INFO: 跳过未知条目: %s", entry.Name)
 		}
-
-		// AR文件要求偶数字节对齐
-		if entry.Size%2 == 1 {
-			file.Seek(1, 1)
-			log.Printf("DEBUG: 跳过对齐填充字节: %s", entry.Name)
-		}
-	}
-
-	// 解压control.tar.xz到DEBIAN目录
-	controlDir := filepath.Join(dm.ExtractDir, "DEBIAN")
-	err = os.MkdirAll(controlDir, 0755)
-	if err != nil {
-		log.Printf("ERROR: 创建DEBIAN目录失败: %v", err)
-		return err
 	}
 
-	if len(controlData) > 0 {
-		log.Printf("INFO: 开始解压control档案到: %s", controlDir)
-		err = dm.extractTarArchive(controlData, controlDir)
-		if err != nil {
-			log.Printf("ERROR: 解压control.tar失败: %v", err)
-			return fmt.Errorf("解压control.tar失败: %v", err)
-		}
-	} else {
+	if dm.controlCompression == "" {
 		log.Printf("WARNING: 未找到control档案数据")
 	}
-
-	// 解压data.tar.xz到根目录
-	if len(dataArchive) > 0 {
-		log.Printf("INFO: 开始解压data档案到: %s", dm.ExtractDir)
-		err = dm.extractTarArchive(dataArchive, dm.ExtractDir)
-		if err != nil {
-			log.Printf("ERROR: 解压data.tar失败: %v", err)
-			return fmt.Errorf("解压data.tar失败: %v", err)
-		}
-	} else {
+	if dm.dataCompression == "" {
 		log.Printf("WARNING: 未找到data档案数据")
 	}
 
@@ -1009,79 +788,15 @@ func (dm *DebModifier) extractDebWithGoAr() error {
 	return nil
 }
 
-// arEntry AR文件条目
-type arEntry struct {
-	Name string
-	Size int64
-}
-
-// readArEntry 读取AR文件条目头部
-func (dm *DebModifier) readArEntry(file *os.File) (*arEntry, error) {
-	header := make([]byte, 60)
-	n, err := file.Read(header)
-	if err != nil {
-		return nil, err
-	}
-	if n != 60 {
-		return nil, io.EOF
-	}
-
-	// 解析文件名（16字节）
-	nameBytes := header[0:16]
-	name := strings.TrimSpace(string(nameBytes))
+// extractTarArchive 从 r 流式解压tar档案（支持gzip、xz、zstd、lzma和bzip2压缩），返回识别出的压缩方式
+func (dm *DebModifier) extractTarArchive(name string, r io.Reader, targetDir string) (string, error) {
+	log.Printf("DEBUG: 开始解压tar档案 %s，目标目录: %s", name, targetDir)
 
-	// 解析文件大小（10字节，位置48-58）
-	sizeBytes := header[48:58]
-	sizeStr := strings.TrimSpace(string(sizeBytes))
-	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	reader, compressionType, err := newDebDecompressor(r, name)
 	if err != nil {
-		return nil, fmt.Errorf("解析文件大小失败: %v", err)
-	}
-
-	return &arEntry{
-		Name: name,
-		Size: size,
-	}, nil
-}
-
-// extractTarArchive 解压tar档案（支持gzip和xz压缩）
-func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
-	log.Printf("DEBUG: 开始解压tar档案，数据大小: %d 字节，目标目录: %s", len(data), targetDir)
-
-	var reader io.Reader = bytes.NewReader(data)
-	var compressionType string = "未压缩"
-
-	// 检查压缩格式
-	if len(data) >= 2 {
-		// 检查是否是gzip格式 (0x1f, 0x8b)
-		if data[0] == 0x1f && data[1] == 0x8b {
-			compressionType = "gzip"
-			log.Printf("DEBUG: 检测到gzip压缩格式")
-			gzReader, err := gzip.NewReader(reader)
-			if err != nil {
-				log.Printf("ERROR: 创建gzip读取器失败: %v", err)
-				return fmt.Errorf("创建gzip读取器失败: %v", err)
-			}
-			defer gzReader.Close()
-			reader = gzReader
-		} else if len(data) >= 6 {
-			// 检查是否是xz格式 (0xFD, '7', 'z', 'X', 'Z', 0x00)
-			xzHeader := []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
-			if bytes.Equal(data[:6], xzHeader) {
-				compressionType = "xz"
-				log.Printf("DEBUG: 检测到xz压缩格式")
-				xzReader, err := xz.NewReader(reader)
-				if err != nil {
-					log.Printf("ERROR: 创建xz读取器失败: %v", err)
-					return fmt.Errorf("创建xz读取器失败: %v", err)
-				}
-				reader = xzReader
-			} else {
-				log.Printf("DEBUG: 检测到未知压缩格式，头部字节: %x", data[:6])
-			}
-		}
+		log.Printf("ERROR: 识别压缩格式失败: %v", err)
+		return "", err
 	}
-
 	log.Printf("INFO: tar档案压缩类型: %s", compressionType)
 
 	// 解压tar档案
@@ -1097,7 +812,7 @@ func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
 		}
 		if err != nil {
 			log.Printf("ERROR: 读取tar头失败: %v", err)
-			return fmt.Errorf("读取tar头失败: %v", err)
+			return "", fmt.Errorf("读取tar头失败: %v", err)
 		}
 
 		// 构造目标路径，应用路径映射
@@ -1120,7 +835,7 @@ func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
 			err = os.MkdirAll(targetPath, os.FileMode(header.Mode))
 			if err != nil {
 				log.Printf("ERROR: 创建目录失败: %s, 错误: %v", targetPath, err)
-				return fmt.Errorf("创建目录失败: %v", err)
+				return "", fmt.Errorf("创建目录失败: %v", err)
 			}
 			log.Printf("DEBUG: 目录创建成功: %s", targetPath)
 			continue
@@ -1131,7 +846,7 @@ func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
 		err = os.MkdirAll(parentDir, 0755)
 		if err != nil {
 			log.Printf("ERROR: 创建父目录失败: %s, 错误: %v", parentDir, err)
-			return fmt.Errorf("创建父目录失败: %v", err)
+			return "", fmt.Errorf("创建父目录失败: %v", err)
 		}
 
 		// 创建文件
@@ -1143,14 +858,14 @@ func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
 			file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
 			if err != nil {
 				log.Printf("ERROR: 创建文件失败: %s, 错误: %v", targetPath, err)
-				return fmt.Errorf("创建文件失败: %v", err)
+				return "", fmt.Errorf("创建文件失败: %v", err)
 			}
 
 			written, err := io.Copy(file, tarReader)
 			file.Close()
 			if err != nil {
 				log.Printf("ERROR: 写入文件内容失败: %s, 错误: %v", targetPath, err)
-				return fmt.Errorf("写入文件内容失败: %v", err)
+				return "", fmt.Errorf("写入文件内容失败: %v", err)
 			}
 
 			if written != header.Size {
@@ -1173,7 +888,7 @@ func (dm *DebModifier) extractTarArchive(data []byte, targetDir string) error {
 	}
 
 	log.Printf("INFO: tar档案解压完成 - 目录数: %d, 文件数: %d, 总大小: %d 字节", dirCount, fileCount, totalSize)
-	return nil
+	return compressionType, nil
 }
 
 // readPackageInfo 读取包信息
@@ -1224,1115 +939,133 @@ func (dm *DebModifier) readPackageInfo() (*PackageInfo, error) {
 	return info, scanner.Err()
 }
 
-// modifyPackageMetadata 修改包元数据
-func (dm *DebModifier) modifyPackageMetadata(info *PackageInfo) error {
-	// 修改包名，添加魔改名称
-	if !strings.Contains(info.Name, dm.MagicName) {
-		info.Name = strings.Replace(info.Name, "frida", dm.MagicName, -1)
-	}
-
-	// 更新control文件
-	controlFile := filepath.Join(dm.ExtractDir, "DEBIAN", "control")
-	return dm.updateControlFile(controlFile, info)
-}
+// PlanDebPackage 预演DEB包修改 (dry-run)，返回每个二进制文件的替换报告，不生成输出文件
+func (dm *DebModifier) PlanDebPackage(progressCallback func(float64, string)) ([]*PatchReport, error) {
+	log.Printf("INFO: 开始预演DEB包修改 - 输入: %s, 魔改名: %s", dm.InputPath, dm.MagicName)
 
-// updateControlFile 更新control文件
-func (dm *DebModifier) updateControlFile(controlFile string, info *PackageInfo) error {
-	file, err := os.Open(controlFile)
+	tempDir, err := os.MkdirTemp("", "fridare_plan_*")
 	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, ":") {
-			parts := strings.SplitN(line, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-
-				switch key {
-				case "Package":
-					line = fmt.Sprintf("Package: %s", info.Name)
-				case "Version":
-					// 保持原版本或更新
-					line = fmt.Sprintf("Version: %s", info.Version)
-				case "Description":
-					line = fmt.Sprintf("Description: %s (Modified with %s)", strings.TrimSpace(parts[1]), dm.MagicName)
-				}
-			}
-		}
-		lines = append(lines, line)
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
 	}
+	dm.TempDir = tempDir
+	defer os.RemoveAll(tempDir)
 
-	if err := scanner.Err(); err != nil {
-		return err
+	dm.ExtractDir = filepath.Join(tempDir, "extracted")
+	if err := os.MkdirAll(dm.ExtractDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建解压目录失败: %v", err)
 	}
 
-	// 写回文件
-	return dm.writeLinesToFile(controlFile, lines)
-}
-
-// modifyBinaryFiles 修改二进制文件名和内容
-func (dm *DebModifier) modifyBinaryFiles() error {
-	log.Printf("INFO: 开始修改二进制文件名和内容")
-
-	// 验证魔改名称 (必须为5个字符，且符合命名规则)
-	if len(dm.MagicName) != 5 {
-		return fmt.Errorf("魔改名称必须是5个字符，当前: %s (%d字符)", dm.MagicName, len(dm.MagicName))
+	progressCallback(0.2, "解压DEB包...")
+	if err := dm.extractDebPackage(); err != nil {
+		return nil, fmt.Errorf("解压DEB包失败: %v", err)
 	}
-
-	// 验证字符规则：必须以字母开头，包含字母和数字
-	if !dm.isValidMagicName(dm.MagicName) {
-		return fmt.Errorf("魔改名称必须以字母开头，只能包含字母和数字: %s", dm.MagicName)
+	packageInfo, err := dm.readPackageInfo()
+	if err != nil {
+		return nil, fmt.Errorf("读取包信息失败: %v", err)
 	}
+	dm.fridaVersion = packageInfo.Version
 
-	// 创建HexReplacer实例
-	hexReplacer := NewHexReplacer()
-
-	// 查找frida-server文件
-	var fridaServerPaths []string
-
-	// 传统路径
-	traditionalPath := filepath.Join(dm.ExtractDir, "usr", "sbin", "frida-server")
-	if _, err := os.Stat(traditionalPath); err == nil {
-		fridaServerPaths = append(fridaServerPaths, traditionalPath)
-		log.Printf("DEBUG: 找到传统frida-server路径: %s", traditionalPath)
+	rules := dm.rewriteRules()
+	entries, err := dm.planRewrite(rules)
+	if err != nil {
+		return nil, err
 	}
 
-	// Rootless路径 (使用 /var/re 避免敏感词汇)
-	rootlessPath := filepath.Join(dm.ExtractDir, "var", "re", "usr", "sbin", "frida-server")
-	if _, err := os.Stat(rootlessPath); err == nil {
-		fridaServerPaths = append(fridaServerPaths, rootlessPath)
-		log.Printf("DEBUG: 找到rootless frida-server路径: %s", rootlessPath)
+	// 按规则顺序收集需要hex替换的文件
+	targets := hexPatchTargets(rules, entries)
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("DEB包中未找到需要修改的二进制文件，改写规则 %s 的 hexpatch 变换未匹配任何文件", rules.source())
 	}
 
-	// 对找到的frida-server文件执行hex替换和重命名
-	for _, oldPath := range fridaServerPaths {
-		// 1. 首先进行二进制内容修改
-		log.Printf("INFO: 开始修改二进制文件内容: %s", oldPath)
-
-		// 获取原文件权限
-		stat, err := os.Stat(oldPath)
-		if err != nil {
-			return fmt.Errorf("获取文件权限失败: %v", err)
-		}
-		originalMode := stat.Mode()
+	hexReplacer := NewHexReplacer()
+	hexReplacer.Rules = dm.Rules
+	hexReplacer.FridaVersion = dm.fridaVersion
+	hexReplacer.Arches = dm.Arches
 
-		// 创建最终目标文件路径
-		dir := filepath.Dir(oldPath)
-		newPath := filepath.Join(dir, dm.MagicName)
+	var reports []*PatchReport
+	for i, target := range targets {
+		progressCallback(0.3+0.6*float64(i)/float64(len(targets)), fmt.Sprintf("分析 %s...", filepath.Base(target.rel)))
 
-		// 进度回调函数
-		progressCallback := func(progress float64, message string) {
-			log.Printf("DEBUG: HEX替换进度 %.1f%% - %s", progress*100, message)
+		// 仅规则中标记了 port 的文件 (frida-server) 包含默认端口
+		hexReplacer.Port = 0
+		if dm.PatchPort && rules.Transforms[target.transform].Port {
+			hexReplacer.Port = dm.Port
 		}
 
-		// 执行hex替换 (直接输出到最终文件名)
-		err = hexReplacer.PatchFile(oldPath, dm.MagicName, newPath, progressCallback)
+		report, err := hexReplacer.DryRun(dm.absPath(target.rel), dm.MagicName)
 		if err != nil {
-			log.Printf("ERROR: 二进制内容修改失败: %s, 错误: %v", oldPath, err)
-			return fmt.Errorf("修改二进制文件内容失败 %s: %v", oldPath, err)
+			return nil, fmt.Errorf("分析二进制文件失败 %s: %v", target.rel, err)
 		}
-		log.Printf("INFO: 成功修改二进制文件内容: %s", oldPath)
+		report.File = target.rel
+		reports = append(reports, report)
+	}
 
-		// 2. 删除原文件
-		err = os.Remove(oldPath)
-		if err != nil {
-			log.Printf("WARNING: 删除原文件失败: %s, 错误: %v", oldPath, err)
-			// 不要因为删除失败而终止，继续执行
-		}
-
-		// 3. 设置新文件权限
-		err = os.Chmod(newPath, originalMode)
-		if err != nil {
-			log.Printf("WARNING: 设置文件权限失败: %s, 权限: %o, 错误: %v", newPath, originalMode, err)
-		}
-
-		log.Printf("INFO: 成功修改和重命名frida-server: %s -> %s", oldPath, newPath)
-	}
-
-	// 查找并重命名frida-agent.dylib文件
-	return dm.renameAgentLibraries()
-}
-
-// renameWithPermissions 保持权限的重命名函数
-func (dm *DebModifier) renameWithPermissions(oldPath, newPath string) error {
-	// 获取原文件权限
-	stat, err := os.Stat(oldPath)
-	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %v", err)
-	}
-
-	originalMode := stat.Mode()
-	log.Printf("DEBUG: 保持文件权限重命名: %s -> %s, 权限: %o", oldPath, newPath, originalMode.Perm())
-
-	// 执行重命名
-	err = os.Rename(oldPath, newPath)
-	if err != nil {
-		return err
-	}
-
-	// 重新设置权限
-	err = os.Chmod(newPath, originalMode)
-	if err != nil {
-		log.Printf("WARNING: 设置文件权限失败: %s, 权限: %o, 错误: %v", newPath, originalMode, err)
-		// 权限设置失败不算致命错误，继续执行
-	}
-
-	return nil
-}
-
-// renameAgentLibraries 重命名agent库文件
-func (dm *DebModifier) renameAgentLibraries() error {
-	log.Printf("INFO: 开始重命名agent库文件")
-
-	// 传统路径
-	traditionalDir := filepath.Join(dm.ExtractDir, "usr", "lib", "frida")
-	if _, err := os.Stat(traditionalDir); err == nil {
-		log.Printf("DEBUG: 找到传统库目录: %s", traditionalDir)
-		newDir := filepath.Join(dm.ExtractDir, "usr", "lib", dm.MagicName)
-
-		err = dm.renameWithPermissions(traditionalDir, newDir)
-		if err != nil {
-			log.Printf("ERROR: 重命名库目录失败: %s -> %s, 错误: %v", traditionalDir, newDir, err)
-			return fmt.Errorf("重命名库目录失败: %v", err)
-		}
-		log.Printf("INFO: 成功重命名库目录: %s -> %s", traditionalDir, newDir)
-
-		// 重命名dylib文件
-		err = dm.renameLibraryFiles(newDir)
-		if err != nil {
-			return err
-		}
-	}
-
-	// Rootless路径 (使用 /var/re 避免敏感词汇)
-	rootlessDir := filepath.Join(dm.ExtractDir, "var", "re", "usr", "lib", "frida")
-	if _, err := os.Stat(rootlessDir); err == nil {
-		log.Printf("DEBUG: 找到rootless库目录: %s", rootlessDir)
-		newDir := filepath.Join(dm.ExtractDir, "var", "re", "usr", "lib", dm.MagicName)
-
-		err = dm.renameWithPermissions(rootlessDir, newDir)
-		if err != nil {
-			log.Printf("ERROR: 重命名rootless库目录失败: %s -> %s, 错误: %v", rootlessDir, newDir, err)
-			return fmt.Errorf("重命名rootless库目录失败: %v", err)
-		}
-		log.Printf("INFO: 成功重命名rootless库目录: %s -> %s", rootlessDir, newDir)
-
-		// 重命名dylib文件
-		err = dm.renameLibraryFiles(newDir)
-		if err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
-// renameLibraryFiles 重命名并修改库文件内容
-func (dm *DebModifier) renameLibraryFiles(libDir string) error {
-	log.Printf("DEBUG: 开始重命名和修改库目录中的文件: %s", libDir)
-
-	// 创建HexReplacer实例
-	hexReplacer := NewHexReplacer()
-
-	entries, err := os.ReadDir(libDir)
-	if err != nil {
-		log.Printf("ERROR: 读取库目录失败: %s, 错误: %v", libDir, err)
-		return err
-	}
-
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		oldName := entry.Name()
-		if strings.Contains(oldName, "frida-agent") {
-			newName := strings.Replace(oldName, "frida-agent", dm.MagicName+"-agent", -1)
-			oldPath := filepath.Join(libDir, oldName)
-			newPath := filepath.Join(libDir, newName)
-
-			// 1. 首先进行二进制内容修改
-			log.Printf("INFO: 开始修改agent库文件内容: %s", oldPath)
-
-			// 获取原文件权限
-			stat, err := os.Stat(oldPath)
-			if err != nil {
-				return fmt.Errorf("获取agent文件权限失败: %v", err)
-			}
-			originalMode := stat.Mode()
-
-			// 进度回调函数
-			progressCallback := func(progress float64, message string) {
-				log.Printf("DEBUG: Agent HEX替换进度 %.1f%% - %s", progress*100, message)
-			}
-
-			// 执行hex替换 (直接输出到最终文件名)
-			err = hexReplacer.PatchFile(oldPath, dm.MagicName, newPath, progressCallback)
-			if err != nil {
-				log.Printf("ERROR: agent文件内容修改失败: %s, 错误: %v", oldPath, err)
-				return fmt.Errorf("修改agent文件内容失败 %s: %v", oldPath, err)
-			}
-			log.Printf("INFO: 成功修改agent文件内容: %s", oldPath)
-
-			// 2. 删除原文件
-			err = os.Remove(oldPath)
-			if err != nil {
-				log.Printf("WARNING: 删除原agent文件失败: %s, 错误: %v", oldPath, err)
-				// 不要因为删除失败而终止，继续执行
-			}
-
-			// 3. 设置新文件权限
-			err = os.Chmod(newPath, originalMode)
-			if err != nil {
-				log.Printf("WARNING: 设置agent文件权限失败: %s, 权限: %o, 错误: %v", newPath, originalMode, err)
-			}
-
-			log.Printf("INFO: 成功修改和重命名agent文件: %s -> %s", oldName, newName)
-		}
-	}
-
-	return nil
-}
-
-// modifyLaunchDaemon 修改启动守护进程配置
-func (dm *DebModifier) modifyLaunchDaemon() error {
-	log.Printf("DEBUG: 开始修改启动守护进程配置")
-
-	// 查找LaunchDaemons目录 (使用 /var/re 避免敏感词汇)
-	launchDirs := []string{
-		filepath.Join(dm.ExtractDir, "Library", "LaunchDaemons"),
-		filepath.Join(dm.ExtractDir, "var", "re", "Library", "LaunchDaemons"),
-	}
-
-	for _, launchDir := range launchDirs {
-		if _, err := os.Stat(launchDir); err != nil {
-			log.Printf("DEBUG: LaunchDaemons目录不存在: %s", launchDir)
-			continue
-		}
-
-		log.Printf("DEBUG: 处理LaunchDaemons目录: %s", launchDir)
-		entries, err := os.ReadDir(launchDir)
-		if err != nil {
-			log.Printf("WARNING: 读取LaunchDaemons目录失败: %s, 错误: %v", launchDir, err)
-			continue
-		}
-
-		for _, entry := range entries {
-			if entry.IsDir() {
-				continue
-			}
-
-			filename := entry.Name()
-			if strings.Contains(filename, "frida.server") || strings.Contains(filename, "re.frida.server") {
-				oldPath := filepath.Join(launchDir, filename)
-
-				// 生成新文件名
-				newFilename := strings.Replace(filename, "frida", dm.MagicName, -1)
-				newPath := filepath.Join(launchDir, newFilename)
-
-				log.Printf("DEBUG: 修改plist文件: %s -> %s", filename, newFilename)
-
-				// 修改plist内容
-				err = dm.modifyPlistContent(oldPath, newPath)
-				if err != nil {
-					log.Printf("ERROR: 修改plist文件失败: %s, 错误: %v", oldPath, err)
-					return fmt.Errorf("修改plist文件失败: %v", err)
-				}
-				log.Printf("INFO: 成功修改plist文件: %s", newFilename)
-			}
-		}
-	}
-
-	return nil
-}
-
-// modifyPlistContent 修改plist文件内容
-func (dm *DebModifier) modifyPlistContent(oldPath, newPath string) error {
-	log.Printf("DEBUG: 修改plist文件内容: %s -> %s", oldPath, newPath)
-
-	// 获取原文件权限
-	oldInfo, err := os.Stat(oldPath)
-	if err != nil {
-		log.Printf("ERROR: 获取plist文件信息失败: %s, 错误: %v", oldPath, err)
-		return err
-	}
-
-	log.Printf("DEBUG: 原plist文件权限: %s (%04o)", oldPath, oldInfo.Mode().Perm())
-
-	// 读取原文件
-	content, err := os.ReadFile(oldPath)
-	if err != nil {
-		log.Printf("ERROR: 读取plist文件失败: %s, 错误: %v", oldPath, err)
-		return err
-	}
-
-	// 修改内容
-	modifiedContent := string(content)
-
-	// 替换二进制路径 (使用 /var/re 避免敏感词汇)
-	modifiedContent = strings.ReplaceAll(modifiedContent, "/usr/sbin/frida-server", "/usr/sbin/"+dm.MagicName)
-	modifiedContent = strings.ReplaceAll(modifiedContent, "/var/jb/usr/sbin/frida-server", "/var/re/usr/sbin/"+dm.MagicName)
-	modifiedContent = strings.ReplaceAll(modifiedContent, "<string>/var/jb/", "<string>/var/re/")
-	// 替换标签
-	modifiedContent = strings.ReplaceAll(modifiedContent, "re.frida.server", "re."+dm.MagicName+".server")
-
-	// 替换端口（如果存在）
-	portRegex := regexp.MustCompile(`<string>27042</string>`)
-	modifiedContent = portRegex.ReplaceAllString(modifiedContent, fmt.Sprintf("<string>%d</string>", dm.Port))
-
-	// 添加端口启动参数 -l 0.0.0.0:端口 到 ProgramArguments
-	// 只有当端口不是默认端口27042时才添加
-	if dm.Port != 27042 {
-		log.Printf("DEBUG: 添加端口启动参数: -l 0.0.0.0:%d", dm.Port)
-
-		// 查找 </array> 标签，在其前面添加 -l 和端口参数（确保无多余空行）
-		arrayCloseRegex := regexp.MustCompile(`(\s*)</array>`)
-		modifiedContent = arrayCloseRegex.ReplaceAllString(modifiedContent,
-			fmt.Sprintf("$1\t<string>-l</string>\n$1\t<string>0.0.0.0:%d</string>\n$1</array>", dm.Port))
-
-		log.Printf("DEBUG: 端口启动参数添加完成")
-	} else {
-		log.Printf("DEBUG: 使用默认端口27042，无需添加启动参数")
-	}
-
-	// 写入新文件（保持原权限）
-	err = os.WriteFile(newPath, []byte(modifiedContent), oldInfo.Mode().Perm())
-	if err != nil {
-		log.Printf("ERROR: 写入新plist文件失败: %s, 错误: %v", newPath, err)
-		return err
-	}
-
-	// 验证新文件权限
-	newInfo, err := os.Stat(newPath)
-	if err == nil {
-		log.Printf("DEBUG: 新plist文件权限: %s (%04o)", newPath, newInfo.Mode().Perm())
-	}
-
-	// 删除旧文件
-	if oldPath != newPath {
-		err = os.Remove(oldPath)
-		if err != nil {
-			log.Printf("WARNING: 删除旧plist文件失败: %s, 错误: %v", oldPath, err)
-		} else {
-			log.Printf("DEBUG: 删除旧plist文件: %s", oldPath)
-		}
-	}
-
-	return nil
-}
-
-// modifyDebianScripts 修改DEBIAN目录中的脚本
-func (dm *DebModifier) modifyDebianScripts() error {
-	debianDir := filepath.Join(dm.ExtractDir, "DEBIAN")
-
-	// 修改extrainst_文件
-	extrainstFile := filepath.Join(debianDir, "extrainst_")
-	if _, err := os.Stat(extrainstFile); err == nil {
-		err = dm.modifyScriptFile(extrainstFile)
-		if err != nil {
-			return fmt.Errorf("修改extrainst_失败: %v", err)
-		}
-	}
-
-	// 修改prerm文件
-	prermFile := filepath.Join(debianDir, "prerm")
-	if _, err := os.Stat(prermFile); err == nil {
-		err = dm.modifyScriptFile(prermFile)
-		if err != nil {
-			return fmt.Errorf("修改prerm失败: %v", err)
-		}
-	}
-
-	return nil
-}
-
-// modifyScriptFile 修改脚本文件
-func (dm *DebModifier) modifyScriptFile(scriptFile string) error {
-	content, err := os.ReadFile(scriptFile)
-	if err != nil {
-		return err
-	}
-
-	modifiedContent := string(content)
-
-	// 替换plist路径
-	modifiedContent = strings.ReplaceAll(modifiedContent,
-		"re.frida.server.plist",
-		"re."+dm.MagicName+".server.plist")
-
-	// 替换launchctl命令中的plist路径 (使用 /var/re 避免敏感词汇)
-	modifiedContent = strings.ReplaceAll(modifiedContent,
-		"/Library/LaunchDaemons/re.frida.server.plist",
-		"/Library/LaunchDaemons/re."+dm.MagicName+".server.plist")
-
-	modifiedContent = strings.ReplaceAll(modifiedContent,
-		"/var/jb/Library/LaunchDaemons/re.frida.server.plist",
-		"/var/re/Library/LaunchDaemons/re."+dm.MagicName+".server.plist")
-
-	return os.WriteFile(scriptFile, []byte(modifiedContent), 0755)
-}
+	progressCallback(1.0, "预演完成")
+	return reports, nil
+}
 
 // repackageDebFile 重新打包DEB文件（纯Go实现）
 func (dm *DebModifier) repackageDebFile() error {
 	return dm.repackageWithGoAr()
 }
 
-// repackageWithGoAr 使用纯Go方式重新打包DEB文件
+// repackageWithGoAr 使用纯Go的DEB写入器重新打包DEB文件
 func (dm *DebModifier) repackageWithGoAr() error {
 	log.Printf("INFO: 开始重新打包DEB文件: %s -> %s", dm.InputPath, dm.OutputPath)
 
-	// 创建输出文件
-	outputFile, err := os.Create(dm.OutputPath)
-	if err != nil {
-		log.Printf("ERROR: 创建输出文件失败: %v", err)
-		return fmt.Errorf("创建输出文件失败: %v", err)
-	}
-	defer outputFile.Close()
-
-	// 写入AR文件头部 "!<arch>\n"
-	arHeaderWritten, err := outputFile.Write([]byte("!<arch>\n"))
-	if err != nil {
-		log.Printf("ERROR: 写入AR头部失败: %v", err)
-		return fmt.Errorf("写入AR头部失败: %v", err)
-	}
-	log.Printf("DEBUG: AR文件头部写入完成: %d 字节", arHeaderWritten)
-
-	// 创建AR写入器
-	arWriter := &arWriter{w: outputFile}
-
-	// 1. 写入debian-binary文件
-	debianBinary := []byte("2.0\n")
-	log.Printf("DEBUG: 准备写入debian-binary: %d 字节", len(debianBinary))
-	err = arWriter.writeFile("debian-binary", debianBinary)
-	if err != nil {
-		log.Printf("ERROR: 写入debian-binary失败: %v", err)
-		return fmt.Errorf("写入debian-binary失败: %v", err)
-	}
-
-	// 2. 创建并写入control.tar.xz
-	log.Printf("INFO: 开始创建control.tar.xz")
-	controlData, err := dm.createControlTarData()
-	if err != nil {
-		log.Printf("ERROR: 创建control.tar数据失败: %v", err)
-		return fmt.Errorf("创建control.tar数据失败: %v", err)
-	}
-
-	compressedControl, err := dm.compressWithXz(controlData)
-	if err != nil {
-		log.Printf("ERROR: 压缩control.tar失败: %v", err)
-		return fmt.Errorf("压缩control.tar失败: %v", err)
-	}
-
-	err = arWriter.writeFile("control.tar.xz", compressedControl)
-	if err != nil {
-		log.Printf("ERROR: 写入control.tar.xz失败: %v", err)
-		return fmt.Errorf("写入control.tar.xz失败: %v", err)
-	}
-
-	// 3. 创建并写入data.tar.xz
-	log.Printf("INFO: 开始创建data.tar.xz")
-	dataArchive, err := dm.createDataTarData()
-	if err != nil {
-		log.Printf("ERROR: 创建data.tar数据失败: %v", err)
-		return fmt.Errorf("创建data.tar数据失败: %v", err)
-	}
-
-	compressedData, err := dm.compressWithXz(dataArchive)
-	if err != nil {
-		log.Printf("ERROR: 压缩data.tar失败: %v", err)
-		return fmt.Errorf("压缩data.tar失败: %v", err)
-	}
-
-	err = arWriter.writeFile("data.tar.xz", compressedData)
-	if err != nil {
-		log.Printf("ERROR: 写入data.tar.xz失败: %v", err)
-		return fmt.Errorf("写入data.tar.xz失败: %v", err)
-	}
-
-	// 获取输出文件大小
-	stat, err := outputFile.Stat()
-	if err != nil {
-		log.Printf("WARNING: 获取输出文件大小失败: %v", err)
-	} else {
-		log.Printf("INFO: DEB文件重新打包完成，总大小: %d 字节", stat.Size())
+	writer := NewDebWriter()
+	writer.ControlCompression, writer.DataCompression = dm.outputCompression()
+	writer.FileMode = fridaDebFileMode(dm.MagicName)
+	writer.Reproducible = dm.Reproducible
+	writer.ModTime = dm.SourceDate
+	if err := writer.Build(dm.ExtractDir, dm.OutputPath); err != nil {
+		log.Printf("ERROR: DEB文件重新打包失败: %v", err)
+		return err
 	}
 
 	log.Printf("SUCCESS: DEB文件重新打包成功: %s", dm.OutputPath)
-
-	// 可选：验证生成的DEB文件
-	err = dm.validateGeneratedDeb()
-	if err != nil {
-		log.Printf("WARNING: DEB文件验证失败: %v", err)
-	}
-
 	return nil
 }
 
-// validateGeneratedDeb 验证生成的DEB文件
-func (dm *DebModifier) validateGeneratedDeb() error {
-	log.Printf("INFO: 开始验证生成的DEB文件: %s", dm.OutputPath)
-
-	// 尝试解析生成的DEB文件
-	file, err := os.Open(dm.OutputPath)
-	if err != nil {
-		return fmt.Errorf("打开DEB文件失败: %v", err)
+// outputCompression 返回重新打包时 control.tar 和 data.tar 的压缩方式:
+// 指定了 Compression 时使用指定值，否则与输入包相同
+func (dm *DebModifier) outputCompression() (string, string) {
+	if dm.Compression != "" {
+		return dm.Compression, dm.Compression
 	}
-	defer file.Close()
-
-	// 验证AR文件头部
-	header := make([]byte, 8)
-	_, err = file.Read(header)
-	if err != nil {
-		return fmt.Errorf("读取AR头部失败: %v", err)
+	control, data := DebCompressionXz, DebCompressionXz
+	if dm.controlCompression != "" {
+		control = writableDebCompression(dm.controlCompression)
 	}
-
-	if string(header) != "!<arch>\n" {
-		return fmt.Errorf("AR文件头部无效: %q", string(header))
+	if dm.dataCompression != "" {
+		data = writableDebCompression(dm.dataCompression)
 	}
-	log.Printf("DEBUG: AR文件头部验证通过")
-
-	entryCount := 0
-	var dataSize int64
-
-	// 验证AR条目
-	for {
-		entry, err := dm.readArEntry(file)
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("读取AR条目失败: %v", err)
-		}
-
-		entryCount++
-		log.Printf("DEBUG: 验证AR条目 %d: %s (%d 字节)", entryCount, entry.Name, entry.Size)
-
-		if entry.Name == "data.tar.xz" {
-			dataSize = entry.Size
-			log.Printf("INFO: 找到data.tar.xz，大小: %d 字节", dataSize)
-
-			// 读取data.tar.xz内容进行验证
-			dataContent := make([]byte, entry.Size)
-			_, err = io.ReadFull(file, dataContent)
-			if err != nil {
-				return fmt.Errorf("读取data.tar.xz内容失败: %v", err)
-			}
-
-			// 验证XZ压缩格式
-			if len(dataContent) >= 6 {
-				xzHeader := []byte{0xFD, '7', 'z', 'X', 'Z', 0x00}
-				if bytes.Equal(dataContent[:6], xzHeader) {
-					log.Printf("DEBUG: data.tar.xz XZ格式验证通过")
-				} else {
-					log.Printf("WARNING: data.tar.xz XZ头部不匹配: %x", dataContent[:6])
-				}
-			}
-
-			// 尝试解压验证
-			err = dm.validateTarXzContent(dataContent)
-			if err != nil {
-				return fmt.Errorf("data.tar.xz内容验证失败: %v", err)
-			}
-		} else {
-			// 跳过其他条目
-			_, err = file.Seek(entry.Size, 1)
-			if err != nil {
-				return fmt.Errorf("跳过条目失败: %v", err)
-			}
-		}
-
-		// AR对齐
-		if entry.Size%2 == 1 {
-			file.Seek(1, 1)
-		}
+	if data != dm.dataCompression && dm.dataCompression != "" {
+		log.Printf("INFO: 输入包使用 %s 压缩 (仅支持读取)，重新打包改用 %s", dm.dataCompression, data)
 	}
-
-	log.Printf("INFO: DEB文件验证完成 - 条目数: %d, data.tar.xz大小: %d 字节", entryCount, dataSize)
-	return nil
+	return control, data
 }
 
-// validateTarXzContent 验证tar.xz内容
-func (dm *DebModifier) validateTarXzContent(data []byte) error {
-	log.Printf("DEBUG: 开始验证tar.xz内容，大小: %d 字节", len(data))
-
-	reader := bytes.NewReader(data)
-
-	// 解压XZ
-	xzReader, err := xz.NewReader(reader)
-	if err != nil {
-		return fmt.Errorf("创建XZ读取器失败: %v", err)
-	}
-
-	// 读取TAR内容
-	tarReader := tar.NewReader(xzReader)
-
-	var fileCount, dirCount int
-	var totalSize int64
-
-	for {
-		header, err := tarReader.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("读取tar头失败: %v", err)
-		}
-
-		if header.Typeflag == tar.TypeDir {
-			dirCount++
-		} else if header.Typeflag == tar.TypeReg {
-			fileCount++
-			totalSize += header.Size
-		}
-
-		log.Printf("DEBUG: TAR条目: %s, 类型: %d, 大小: %d", header.Name, header.Typeflag, header.Size)
-	}
-
-	log.Printf("INFO: TAR内容验证完成 - 目录数: %d, 文件数: %d, 总大小: %d 字节", dirCount, fileCount, totalSize)
-	return nil
-} // arWriter AR格式写入器
-type arWriter struct {
-	w io.Writer
-}
-
-// writeFile 写入AR文件条目
-func (aw *arWriter) writeFile(name string, data []byte) error {
-	log.Printf("DEBUG: 写入AR文件条目: %s, 大小: %d 字节", name, len(data))
-
-	// AR文件头格式: 名称(16字节) + 修改时间(12字节) + 用户ID(6字节) + 组ID(6字节) + 文件模式(8字节) + 文件大小(10字节) + 结束标记(2字节)
-	header := make([]byte, 60)
-
-	// 文件名（最多16字符，不足的用空格填充）
-	copy(header[0:16], []byte(fmt.Sprintf("%-16s", name)))
-
-	// 修改时间（Unix时间戳）
-	copy(header[16:28], []byte(fmt.Sprintf("%-12d", 0)))
-
-	// 用户ID
-	copy(header[28:34], []byte("0     "))
-
-	// 组ID
-	copy(header[34:40], []byte("0     "))
-
-	// 文件模式
-	copy(header[40:48], []byte("100644  "))
-
-	// 文件大小
-	copy(header[48:58], []byte(fmt.Sprintf("%-10d", len(data))))
-
-	// 结束标记
-	copy(header[58:60], []byte("`\n"))
-
-	// 写入头部
-	headerWritten, err := aw.w.Write(header)
-	if err != nil {
-		log.Printf("ERROR: 写入AR头部失败: %s, 错误: %v", name, err)
-		return err
-	}
-
-	if headerWritten != 60 {
-		log.Printf("WARNING: AR头部写入字节数不匹配: %s, 期望: 60, 实际: %d", name, headerWritten)
-	}
-
-	// 写入数据
-	dataWritten, err := aw.w.Write(data)
-	if err != nil {
-		log.Printf("ERROR: 写入AR数据失败: %s, 错误: %v", name, err)
-		return err
-	}
-
-	if dataWritten != len(data) {
-		log.Printf("WARNING: AR数据写入字节数不匹配: %s, 期望: %d, 实际: %d", name, len(data), dataWritten)
-	}
-
-	// AR文件要求每个条目都是偶数字节对齐
-	if len(data)%2 == 1 {
-		padWritten, err := aw.w.Write([]byte{'\n'})
-		if err != nil {
-			log.Printf("ERROR: 写入AR对齐填充失败: %s, 错误: %v", name, err)
-			return err
-		}
-		log.Printf("DEBUG: AR文件 %s 添加对齐填充: %d 字节", name, padWritten)
-	}
-
-	log.Printf("INFO: AR条目写入完成: %s, 头部: %d 字节, 数据: %d 字节", name, headerWritten, dataWritten)
-	return nil
-}
-
-// createControlTarData 创建control.tar数据
-func (dm *DebModifier) createControlTarData() ([]byte, error) {
-	debianDir := filepath.Join(dm.ExtractDir, "DEBIAN")
-	log.Printf("DEBUG: 开始创建control.tar数据，DEBIAN目录: %s", debianDir)
-
-	var buf bytes.Buffer
-	tarWriter := tar.NewWriter(&buf)
-	defer tarWriter.Close()
-
-	var fileCount, dirCount int
-	var totalSize int64
-
-	err := filepath.Walk(debianDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("ERROR: 遍历DEBIAN目录失败: %s, 错误: %v", path, err)
-			return err
-		}
-
-		// 跳过目录本身
-		if path == debianDir {
-			log.Printf("DEBUG: 跳过DEBIAN根目录: %s", path)
-			return nil
-		}
-
-		// 获取相对路径
-		relPath, err := filepath.Rel(debianDir, path)
-		if err != nil {
-			log.Printf("ERROR: 计算DEBIAN相对路径失败: %s, 错误: %v", path, err)
-			return err
-		}
-
-		// 使用Unix路径分隔符
-		originalRelPath := relPath
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-		if originalRelPath != relPath {
-			log.Printf("DEBUG: DEBIAN路径分隔符转换: %s -> %s", originalRelPath, relPath)
-		}
-
-		if info.IsDir() {
-			dirCount++
-			log.Printf("DEBUG: 添加DEBIAN目录: %s/, 权限: %o", relPath, info.Mode().Perm())
-			header := &tar.Header{
-				Name:     relPath + "/",
-				Mode:     int64(info.Mode().Perm()),
-				Typeflag: tar.TypeDir,
-				ModTime:  info.ModTime(),
-				Format:   tar.FormatGNU, // 使用GNU格式匹配原始文件
-			}
-			err := tarWriter.WriteHeader(header)
-			if err != nil {
-				log.Printf("ERROR: 写入DEBIAN目录头部失败: %s, 错误: %v", relPath, err)
-			}
-			return err
-		} else {
-			fileCount++
-			totalSize += info.Size()
-
-			// 根据文件类型设置正确的权限（符合DEB包规范）
-			var perm os.FileMode
-			switch relPath {
-			case "control":
-				perm = 0644 // control文件标准权限
-			case "postinst", "prerm", "postrm", "preinst":
-				perm = 0755 // 脚本文件需要可执行权限
-			case "extrainst_":
-				perm = 0755 // extrainst_文件需要可执行权限
-			default:
-				perm = 0644 // 其他文件默认权限
-			}
-
-			log.Printf("DEBUG: 添加DEBIAN文件: %s, 大小: %d 字节, 权限: %o", relPath, info.Size(), perm)
-
-			file, err := os.Open(path)
-			if err != nil {
-				log.Printf("ERROR: 打开DEBIAN文件失败: %s, 错误: %v", path, err)
-				return err
-			}
-			defer file.Close()
-
-			header := &tar.Header{
-				Name:     relPath,
-				Mode:     int64(perm),
-				Size:     info.Size(),
-				Typeflag: tar.TypeReg,
-				ModTime:  info.ModTime(),
-				Uid:      0, // root
-				Gid:      0, // root
-				Uname:    "root",
-				Gname:    "root",
-				Format:   tar.FormatGNU, // 使用GNU格式匹配原始文件
-			}
-
-			err = tarWriter.WriteHeader(header)
-			if err != nil {
-				log.Printf("ERROR: 写入DEBIAN文件头部失败: %s, 错误: %v", relPath, err)
-				return err
-			}
-
-			written, err := io.Copy(tarWriter, file)
-			if err != nil {
-				log.Printf("ERROR: 复制DEBIAN文件内容失败: %s, 错误: %v", relPath, err)
-				return err
-			}
-
-			if written != info.Size() {
-				log.Printf("WARNING: DEBIAN文件大小不匹配: %s, 期望: %d, 实际写入: %d", relPath, info.Size(), written)
-			}
-
-			return nil
-		}
-	})
-
-	if err != nil {
-		log.Printf("ERROR: 遍历DEBIAN目录失败: %v", err)
-		return nil, err
-	}
-
-	err = tarWriter.Close()
-	if err != nil {
-		log.Printf("ERROR: 关闭control.tar写入器失败: %v", err)
-		return nil, err
-	}
-
-	tarData := buf.Bytes()
-	log.Printf("INFO: control.tar创建完成 - 目录数: %d, 文件数: %d, 总文件大小: %d 字节, tar数据大小: %d 字节",
-		dirCount, fileCount, totalSize, len(tarData))
-
-	return tarData, nil
-}
-
-// createDataTarData 创建data.tar数据
-func (dm *DebModifier) createDataTarData() ([]byte, error) {
-	log.Printf("DEBUG: 开始创建data.tar数据，提取目录: %s", dm.ExtractDir)
-
-	var buf bytes.Buffer
-	tarWriter := tar.NewWriter(&buf)
-	defer tarWriter.Close()
-
-	var fileCount, dirCount int
-	var totalSize int64
-
-	// 检测是否为rootless结构
-	isRootless := false
-	if _, err := os.Stat(filepath.Join(dm.ExtractDir, "var", "re")); err == nil {
-		isRootless = true
-		log.Printf("DEBUG: 检测到rootless结构")
-	}
-
-	// 所有结构都需要添加根目录 "." 条目，rootless也是从./var开始
-	log.Printf("DEBUG: 添加TAR根目录条目 './'")
-	rootHeader := &tar.Header{
-		Name:     "./",
-		Mode:     int64(0755), // drwxr-xr-x
-		Typeflag: tar.TypeDir,
-		ModTime:  time.Now(),
-		Uid:      0, // root
-		Gid:      0, // root
-		Uname:    "root",
-		Gname:    "root",
-		Format:   tar.FormatGNU, // 使用GNU格式匹配原始文件
-	}
-	err := tarWriter.WriteHeader(rootHeader)
-	if err != nil {
-		log.Printf("ERROR: 写入根目录头部失败: %v", err)
-		return nil, err
-	}
-	dirCount++
-
-	err = filepath.Walk(dm.ExtractDir, func(path string, info os.FileInfo, walkErr error) error {
-		if walkErr != nil {
-			log.Printf("ERROR: 遍历路径 %s 时出错: %v", path, walkErr)
-			return walkErr
-		}
-
-		// 跳过根目录和DEBIAN目录
-		if path == dm.ExtractDir {
-			log.Printf("DEBUG: 跳过根目录: %s", path)
-			return nil
-		}
-
-		relPath, err := filepath.Rel(dm.ExtractDir, path)
-		if err != nil {
-			log.Printf("ERROR: 计算相对路径失败，路径: %s, 错误: %v", path, err)
-			return err
-		}
-
-		// 跳过DEBIAN目录
-		if strings.HasPrefix(relPath, "DEBIAN") {
-			log.Printf("DEBUG: 跳过DEBIAN目录: %s", relPath)
-			if info.IsDir() {
-				return filepath.SkipDir
-			}
-			return nil
-		}
-
-		// 使用Unix路径分隔符
-		originalRelPath := relPath
-		relPath = strings.ReplaceAll(relPath, "\\", "/")
-		if originalRelPath != relPath {
-			log.Printf("DEBUG: 路径分隔符转换: %s -> %s", originalRelPath, relPath)
-		}
-
-		// 根据路径类型决定TAR路径格式
-		var tarPath string
-		if isRootless && strings.HasPrefix(relPath, "var") {
-			// rootless结构中的var路径使用"./"前缀: ./var/re/...
-			tarPath = "./" + relPath
-			log.Printf("DEBUG: TAR路径处理(rootless): %s -> %s", relPath, tarPath)
-		} else if !isRootless {
-			// 传统结构添加"./"前缀
-			tarPath = "./" + relPath
-			log.Printf("DEBUG: TAR路径处理(传统): %s -> %s", relPath, tarPath)
-		} else {
-			// rootless结构中的其他路径（如果有的话）
-			tarPath = "./" + relPath
-			log.Printf("DEBUG: TAR路径处理(其他): %s -> %s", relPath, tarPath)
+// fridaDebFileMode 返回frida DEB包中文件的权限规则:
+// frida-server、魔改后的服务器和agent库需要可执行权限，plist 使用标准权限，TLS证书仅所有者可读，其他文件保持原权限
+func fridaDebFileMode(magicName string) func(string, os.FileMode) os.FileMode {
+	return func(name string, mode os.FileMode) os.FileMode {
+		switch {
+		case strings.HasSuffix(name, "/frida-server") || (magicName != "" && strings.HasSuffix(name, "/"+magicName)):
+			return 0755
+		case strings.Contains(name, "frida-agent") || (magicName != "" && strings.Contains(name, magicName+"-agent")):
+			return 0755
+		case strings.HasSuffix(name, ".plist"):
+			return 0644
+		case magicName != "" && strings.HasSuffix(name, "/"+CertificateName(magicName)):
+			// TLS证书包含私钥，仅 root 可读
+			return 0600
 		}
-
-		if info.IsDir() {
-			dirCount++
-			// 目录应该使用755权限 (drwxr-xr-x)
-			dirMode := os.FileMode(0755)
-			log.Printf("DEBUG: 添加目录: %s/, 权限: %04o (修正为755)", tarPath, dirMode)
-			header := &tar.Header{
-				Name:     tarPath + "/",
-				Mode:     int64(dirMode),
-				Typeflag: tar.TypeDir,
-				ModTime:  info.ModTime(),
-				Uid:      0, // root
-				Gid:      0, // root
-				Uname:    "root",
-				Gname:    "root",
-				Format:   tar.FormatGNU, // 使用GNU格式匹配原始文件
-			}
-			err := tarWriter.WriteHeader(header)
-			if err != nil {
-				log.Printf("ERROR: 写入目录头部失败: %s, 错误: %v", relPath, err)
-			}
-			return err
-		} else {
-			fileCount++
-			totalSize += info.Size()
-
-			// 根据文件类型设置正确的权限
-			var perm os.FileMode
-			switch {
-			case strings.HasSuffix(tarPath, "/frida-server") || strings.HasSuffix(tarPath, "/"+dm.MagicName):
-				// frida-server 和重命名后的服务器需要可执行权限
-				perm = 0755
-				log.Printf("DEBUG: 设置服务器可执行权限: %s -> 755", tarPath)
-			case strings.Contains(tarPath, "frida-agent") || strings.Contains(tarPath, dm.MagicName+"-agent"):
-				// agent 库文件需要可执行权限
-				perm = 0755
-				log.Printf("DEBUG: 设置agent可执行权限: %s -> 755", tarPath)
-			case strings.HasSuffix(tarPath, ".plist"):
-				// plist 文件使用标准权限
-				perm = 0644
-				log.Printf("DEBUG: 设置plist权限: %s -> 644", tarPath)
-			default:
-				// 其他文件保持当前权限
-				perm = info.Mode().Perm()
-				log.Printf("DEBUG: 保持原权限: %s -> %04o", tarPath, perm)
-			}
-
-			log.Printf("DEBUG: 添加文件: %s, 大小: %d 字节, 权限: %04o", tarPath, info.Size(), perm)
-
-			file, err := os.Open(path)
-			if err != nil {
-				log.Printf("ERROR: 打开文件失败: %s, 错误: %v", path, err)
-				return err
-			}
-			defer file.Close()
-
-			header := &tar.Header{
-				Name:     tarPath,
-				Mode:     int64(perm),
-				Size:     info.Size(),
-				Typeflag: tar.TypeReg,
-				ModTime:  info.ModTime(),
-				Uid:      0, // root
-				Gid:      0, // root
-				Uname:    "root",
-				Gname:    "root",
-				Format:   tar.FormatGNU, // 使用GNU格式匹配原始文件
-			}
-
-			err = tarWriter.WriteHeader(header)
-			if err != nil {
-				log.Printf("ERROR: 写入文件头部失败: %s, 错误: %v", relPath, err)
-				return err
-			}
-
-			written, err := io.Copy(tarWriter, file)
-			if err != nil {
-				log.Printf("ERROR: 复制文件内容失败: %s, 错误: %v", relPath, err)
-				return err
-			}
-
-			if written != info.Size() {
-				log.Printf("WARNING: 文件大小不匹配: %s, 期望: %d, 实际写入: %d", relPath, info.Size(), written)
-			}
-
-			return nil
-		}
-	})
-
-	if err != nil {
-		log.Printf("ERROR: 遍历目录失败: %v", err)
-		return nil, err
-	}
-
-	err = tarWriter.Close()
-	if err != nil {
-		log.Printf("ERROR: 关闭tar写入器失败: %v", err)
-		return nil, err
+		return mode
 	}
-
-	tarData := buf.Bytes()
-	log.Printf("INFO: data.tar创建完成 - 目录数: %d, 文件数: %d, 总文件大小: %d 字节, tar数据大小: %d 字节",
-		dirCount, fileCount, totalSize, len(tarData))
-
-	return tarData, nil
 }
 
-// compressWithXz 使用XZ压缩数据
-func (dm *DebModifier) compressWithXz(data []byte) ([]byte, error) {
-	log.Printf("DEBUG: 开始XZ压缩，原始数据大小: %d 字节", len(data))
-
-	var buf bytes.Buffer
-
-	// 创建与原始DEB文件匹配的XZ配置
-	// 算法: LZMA2:23 CRC64, 数据流1, 字块3, 簇大小25165824
-	config := xz.WriterConfig{
-		DictCap:   16 << 20, // 16MB字典，匹配LZMA2:23级别
-		BlockSize: 25165824, // 25MB块大小，匹配原始簇大小
-		CheckSum:  xz.CRC64, // 使用CRC64匹配原始算法
-	}
-
-	writer, err := config.NewWriter(&buf)
-	if err != nil {
-		log.Printf("ERROR: 创建XZ写入器失败: %v", err)
-		return nil, err
-	}
-
-	written, err := writer.Write(data)
-	if err != nil {
-		writer.Close()
-		log.Printf("ERROR: XZ压缩写入失败: %v", err)
-		return nil, err
-	}
-
-	if written != len(data) {
-		log.Printf("WARNING: XZ压缩写入字节数不匹配，期望: %d, 实际: %d", len(data), written)
-	}
-
-	err = writer.Close()
-	if err != nil {
-		log.Printf("ERROR: 关闭XZ写入器失败: %v", err)
-		return nil, err
-	}
-
-	compressed := buf.Bytes()
-	compressionRatio := float64(len(compressed)) / float64(len(data)) * 100
-	log.Printf("INFO: XZ压缩完成 - 原始: %d 字节, 压缩后: %d 字节, 压缩率: %.2f%%",
-		len(data), len(compressed), compressionRatio)
-
-	return compressed, nil
-} // writeLinesToFile 写入行到文件
+// writeLinesToFile 写入行到文件
 func (dm *DebModifier) writeLinesToFile(filename string, lines []string) error {
 	file, err := os.Create(filename)
 	if err != nil {
@@ -2351,35 +1084,54 @@ func (dm *DebModifier) writeLinesToFile(filename string, lines []string) error {
 	return writer.Flush()
 }
 
-// isValidMagicName 验证魔改名称格式
-func (dm *DebModifier) isValidMagicName(s string) bool {
-	// 必须以字母开头
-	if len(s) == 0 {
-		return false
-	}
-
-	first := s[0]
-	if !((first >= 'A' && first <= 'Z') || (first >= 'a' && first <= 'z')) {
-		return false
-	}
-
-	// 检查其余字符必须是字母或数字
-	for _, c := range s {
-		if !((c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
-			return false
+// logResidualFingerprints 记录每个已修改二进制文件的重新签名结果和残留的frida特征，返回残留汇总
+func logResidualFingerprints(reports []*PatchReport) FingerprintSummary {
+	var all []FingerprintHit
+	for _, report := range reports {
+		for _, slice := range report.Signature {
+			log.Printf("INFO: 已重新签名 (ad-hoc): %s %s %s, 权限: %s", report.File, slice.Arch, slice.Identifier, slice.Entitlements)
+		}
+		if report.Dynamic != nil {
+			for _, name := range report.Dynamic.Names {
+				log.Printf("INFO: 动态符号重命名: %s [%s] %s -> %s", report.File, name.Kind, name.Original, name.Replacement)
+			}
+		}
+		summary := SummarizeFingerprints(report.Residual)
+		if summary.Total == 0 {
+			log.Printf("INFO: 残留特征扫描: %s 未发现残留特征", report.File)
+			continue
 		}
+		log.Printf("WARNING: 残留特征扫描: %s 残留 %s", report.File, summary)
+		logged := 0
+		for _, hit := range report.Residual {
+			if hit.Severity == SeverityHigh && logged < 20 {
+				logged++
+				log.Printf("WARNING:   [%s] %s %s+0x%X %q (规则可覆盖: %v)", hit.Severity, hit.Arch, hit.Section, hit.FileOffset, hit.Context, hit.Covered)
+			}
+		}
+		all = append(all, report.Residual...)
 	}
-
-	return true
+	return SummarizeFingerprints(all)
 }
 
 // CreateFridaDeb 创建新的Frida DEB包
 type CreateFridaDeb struct {
-	FridaServerPath string       // frida-server 文件路径
-	FridaAgentPath  string       // frida-agent.dylib 文件路径 (可选)
-	OutputPath      string       // 输出DEB文件路径
-	PackageInfo     *PackageInfo // 包信息
-	TempDir         string       // 临时目录
+	FridaServerPath string         // frida-server 文件路径
+	FridaAgentPath  string         // frida-agent.dylib 文件路径 (可选)
+	OutputPath      string         // 输出DEB文件路径
+	PackageInfo     *PackageInfo   // 包信息
+	TempDir         string         // 临时目录
+	Rules           *RuleSet       // 替换规则集 (nil 使用内置默认规则)
+	Reports         []*PatchReport // 二进制替换报告
+	PatchPort       bool           // 同时修补frida-server二进制中的默认端口
+	Arches          []string       // fat Mach-O 仅保留的架构切片 (空表示保留全部)
+	// Entitlements 写入frida-server代码签名的权限，默认与原有权限合并 (nil 保留原有权限)
+	Entitlements Entitlements
+	// ReplaceEntitlements 使用 Entitlements 替换原有权限而不是合并
+	ReplaceEntitlements bool
+	Compression         string    // control.tar 和 data.tar 的压缩方式 (默认 xz)
+	Reproducible        bool      // 可复现构建，相同输入生成逐字节相同的DEB
+	SourceDate          time.Time // 可复现构建的时间戳 (零值使用 SOURCE_DATE_EPOCH)
 }
 
 // NewCreateFridaDeb 创建新的Frida DEB构建器
@@ -2402,6 +1154,9 @@ func (cfd *CreateFridaDeb) CreateDebPackage() error {
 		cfd.PackageInfo.MagicName, cfd.PackageInfo.Port)
 	log.Printf("INFO: 结构类型: %s",
 		map[bool]string{true: "Rootless", false: "Root"}[cfd.PackageInfo.IsRootless])
+	if err := cfd.PackageInfo.RuntimeOptions.Validate(); err != nil {
+		return err
+	}
 
 	// 1. 创建临时目录
 	tempDir, err := os.MkdirTemp("", "fridare-create-*")
@@ -2455,6 +1210,9 @@ func (cfd *CreateFridaDeb) CreateDebPackage() error {
 		return fmt.Errorf("构建DEB包失败: %v", err)
 	}
 
+	// 6. 汇总残留特征
+	logResidualFingerprints(cfd.Reports)
+
 	log.Printf("SUCCESS: Frida DEB包创建成功: %s", cfd.OutputPath)
 	return nil
 }
@@ -2513,6 +1271,19 @@ func (cfd *CreateFridaDeb) copyAndPatchFridaServer() error {
 
 		// 创建HexReplacer实例
 		hexReplacer := NewHexReplacer()
+		hexReplacer.Rules = cfd.Rules
+		hexReplacer.FridaVersion = cfd.PackageInfo.Version
+		hexReplacer.Arches = cfd.Arches
+		if cfd.PatchPort {
+			hexReplacer.Port = cfd.PackageInfo.Port
+		}
+		if cfd.Entitlements != nil {
+			signer, err := cfd.serverSigner()
+			if err != nil {
+				return err
+			}
+			hexReplacer.Signer = signer
+		}
 
 		// 进度回调
 		progressFunc := func(progress float64, message string) {
@@ -2520,10 +1291,12 @@ func (cfd *CreateFridaDeb) copyAndPatchFridaServer() error {
 		}
 
 		// 执行hex替换
-		err := hexReplacer.PatchFile(cfd.FridaServerPath, cfd.PackageInfo.MagicName, targetPath, progressFunc)
+		report, err := hexReplacer.PatchFileWithReport(cfd.FridaServerPath, cfd.PackageInfo.MagicName, targetPath, progressFunc)
 		if err != nil {
 			return fmt.Errorf("HEX替换frida-server失败: %v", err)
 		}
+		report.File = filepath.Base(targetPath)
+		cfd.Reports = append(cfd.Reports, report)
 
 		// 设置可执行权限
 		err = os.Chmod(targetPath, 0755)
@@ -2538,12 +1311,47 @@ func (cfd *CreateFridaDeb) copyAndPatchFridaServer() error {
 		if err != nil {
 			return fmt.Errorf("复制frida-server失败: %v", err)
 		}
+
+		// 未修改二进制时仍需重新签名以写入权限
+		if cfd.Entitlements != nil {
+			signer, err := cfd.serverSigner()
+			if err != nil {
+				return err
+			}
+			if _, err := signer.SignFile(targetPath); err != nil {
+				return fmt.Errorf("frida-server重新签名失败: %v", err)
+			}
+		}
 	}
 
 	log.Printf("INFO: frida-server文件处理完成: %s", targetPath)
 	return nil
 }
 
+// serverSigner 创建写入自定义权限的签名器，权限与frida-server原有权限合并或直接替换
+func (cfd *CreateFridaDeb) serverSigner() (*CodeSigner, error) {
+	if !isCodeSigned(cfd.FridaServerPath) {
+		return nil, fmt.Errorf("frida-server 不是带代码签名的Mach-O文件，无法写入权限")
+	}
+
+	entitlements := cfd.Entitlements.Clone()
+	if !cfd.ReplaceEntitlements {
+		existing, err := ReadEntitlements(cfd.FridaServerPath)
+		if err != nil {
+			return nil, fmt.Errorf("读取frida-server原有权限失败: %v", err)
+		}
+		existing.Merge(cfd.Entitlements)
+		entitlements = existing
+	}
+	log.Printf("INFO: frida-server权限 (%d 项): %s", len(entitlements), strings.Join(entitlements.Keys(), ", "))
+
+	signer := NewCodeSigner()
+	if err := signer.SetEntitlements(entitlements); err != nil {
+		return nil, fmt.Errorf("编码权限失败: %v", err)
+	}
+	return signer, nil
+}
+
 // copyAndPatchFridaAgent 复制并修改frida-agent文件
 func (cfd *CreateFridaDeb) copyAndPatchFridaAgent() error {
 	log.Printf("INFO: 开始复制和修改frida-agent文件")
@@ -2567,6 +1375,9 @@ func (cfd *CreateFridaDeb) copyAndPatchFridaAgent() error {
 
 		// 创建HexReplacer实例
 		hexReplacer := NewHexReplacer()
+		hexReplacer.Rules = cfd.Rules
+		hexReplacer.FridaVersion = cfd.PackageInfo.Version
+		hexReplacer.Arches = cfd.Arches
 
 		// 进度回调
 		progressFunc := func(progress float64, message string) {
@@ -2574,10 +1385,12 @@ func (cfd *CreateFridaDeb) copyAndPatchFridaAgent() error {
 		}
 
 		// 执行hex替换
-		err := hexReplacer.PatchFile(cfd.FridaAgentPath, cfd.PackageInfo.MagicName, targetPath, progressFunc)
+		report, err := hexReplacer.PatchFileWithReport(cfd.FridaAgentPath, cfd.PackageInfo.MagicName, targetPath, progressFunc)
 		if err != nil {
 			return fmt.Errorf("HEX替换frida-agent失败: %v", err)
 		}
+		report.File = filepath.Base(targetPath)
+		cfd.Reports = append(cfd.Reports, report)
 
 		// 设置可执行权限
 		err = os.Chmod(targetPath, 0755)
@@ -2616,76 +1429,35 @@ func (cfd *CreateFridaDeb) createLaunchDaemonConfig() error {
 		programPath = fmt.Sprintf("/usr/sbin/%s", cfd.PackageInfo.MagicName)
 	}
 
+	// TLS证书随包安装到agent目录
+	certPath := path.Join(path.Dir(path.Dir(programPath)), "lib", cfd.PackageInfo.MagicName, CertificateName(cfd.PackageInfo.MagicName))
+	if cfd.PackageInfo.Certificate != "" {
+		if err := cfd.PackageInfo.installCertificate(cfd.TempDir, certPath); err != nil {
+			return fmt.Errorf("安装TLS证书失败: %v", err)
+		}
+		log.Printf("INFO: TLS证书安装到: %s", certPath)
+	}
+
 	// 创建plist内容
-	plistContent := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-<plist version="1.0">
-<dict>
-	<key>Label</key>
-	<string>re.%s.server</string>
-	<key>Program</key>
-	<string>%s</string>
-	<key>ProgramArguments</key>
-	<array>
-		<string>%s</string>`,
-		cfd.PackageInfo.MagicName, programPath, programPath)
-
-	// 如果端口不是默认端口，添加端口参数
-	if cfd.PackageInfo.Port != 27042 {
-		plistContent += fmt.Sprintf(`
-		<string>-l</string>
-		<string>0.0.0.0:%d</string>`, cfd.PackageInfo.Port)
-	}
-
-	// 根据结构类型添加不同的配置
-	if cfd.PackageInfo.IsRootless {
-		// Rootless结构 - 简化配置
-		plistContent += `
-	</array>
-	<key>UserName</key>
-	<string>root</string>
-	<key>POSIXSpawnType</key>
-	<string>Interactive</string>
-	<key>RunAtLoad</key>
-	<true/>
-	<key>KeepAlive</key>
-	<true/>
-	<key>ThrottleInterval</key>
-	<integer>5</integer>
-	<key>ExecuteAllowed</key>
-	<true/>
-</dict>
-</plist>
-`
-	} else {
+	daemon := NewLaunchDaemon(fmt.Sprintf("re.%s.server", cfd.PackageInfo.MagicName), programPath)
+	daemon.Program = programPath
+	// 端口或监听地址不是默认值时添加监听参数，并加入TLS证书、认证令牌等参数
+	cfd.PackageInfo.applyToLaunchDaemon(daemon, cfd.PackageInfo.Port, certPath)
+	daemon.POSIXSpawnType = "Interactive"
+	daemon.ThrottleInterval = 5
+	daemon.ExecuteAllowed = true
+	if !cfd.PackageInfo.IsRootless {
 		// Root结构 - 包含环境变量和系统级限制
-		plistContent += `
-	</array>
-	<key>EnvironmentVariables</key>
-	<dict>
-		<key>_MSSafeMode</key>
-		<string>1</string>
-	</dict>
-	<key>UserName</key>
-	<string>root</string>
-	<key>POSIXSpawnType</key>
-	<string>Interactive</string>
-	<key>RunAtLoad</key>
-	<true/>
-	<key>LimitLoadToSessionType</key>
-	<string>System</string>
-	<key>KeepAlive</key>
-	<true/>
-	<key>ThrottleInterval</key>
-	<integer>5</integer>
-	<key>ExecuteAllowed</key>
-	<true/>
-</dict>
-</plist>
-`
-	}
-
-	err := os.WriteFile(plistPath, []byte(plistContent), 0644)
+		daemon.EnvironmentVariables = map[string]string{"_MSSafeMode": "1"}
+		daemon.LimitLoadToSessionType = []string{"System"}
+	}
+
+	plistContent, err := daemon.Marshal(PlistXML)
+	if err != nil {
+		return fmt.Errorf("生成plist失败: %v", err)
+	}
+
+	err = os.WriteFile(plistPath, plistContent, 0644)
 	if err != nil {
 		return fmt.Errorf("写入plist文件失败: %v", err)
 	}
@@ -2901,18 +1673,19 @@ func (cfd *CreateFridaDeb) calculateInstalledSize() (int, error) {
 	return sizeKB, nil
 }
 
-// buildDebPackage 构建DEB包
+// buildDebPackage 使用纯Go的DEB写入器构建DEB包
 func (cfd *CreateFridaDeb) buildDebPackage() error {
 	log.Printf("INFO: 开始构建DEB包")
 
-	// 使用内置的纯Go方式构建
-	modifier := &DebModifier{
-		OutputPath: cfd.OutputPath,
-		ExtractDir: cfd.TempDir,
-		MagicName:  cfd.PackageInfo.MagicName, // 传递魔改名称
+	writer := NewDebWriter()
+	if cfd.Compression != "" {
+		writer.ControlCompression = cfd.Compression
+		writer.DataCompression = cfd.Compression
 	}
-
-	return modifier.repackageWithGoAr()
+	writer.FileMode = fridaDebFileMode(cfd.PackageInfo.MagicName)
+	writer.Reproducible = cfd.Reproducible
+	writer.ModTime = cfd.SourceDate
+	return writer.Build(cfd.TempDir, cfd.OutputPath)
 }
 
 // copyFileWithPermissions 复制文件并设置权限
@@ -0,0 +1,407 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// DEX map item types, see https://source.android.com/docs/core/runtime/dex-format
+const (
+	dexTypeHeader     = 0x0000
+	dexTypeStringID   = 0x0001
+	dexTypeTypeID     = 0x0002
+	dexTypeProtoID    = 0x0003
+	dexTypeMethodID   = 0x0005
+	dexTypeClassDef   = 0x0006
+	dexTypeMapList    = 0x1000
+	dexTypeTypeList   = 0x1001
+	dexTypeClassData  = 0x2000
+	dexTypeCodeItem   = 0x2001
+	dexTypeStringData = 0x2002
+
+	dexHeaderSize = 0x70
+	dexEndianTag  = 0x12345678
+
+	dexAccPublic      = 0x1
+	dexAccStatic      = 0x8
+	dexAccFinal       = 0x10
+	dexAccConstructor = 0x10000
+)
+
+// dexMethod identifies a method by class, name and signature descriptors
+type dexMethod struct {
+	class  string
+	name   string
+	ret    string
+	params []string
+}
+
+// buildLoaderDex builds a DEX file with a single public class extending
+// superClass whose static initializer loads library with
+// System.loadLibrary. Class names use the dotted Java form.
+func buildLoaderDex(className, superClass, library string) []byte {
+	class, super := dexDescriptor(className), dexDescriptor(superClass)
+	clinit := dexMethod{class: class, name: "<clinit>", ret: "V"}
+	init := dexMethod{class: class, name: "<init>", ret: "V"}
+	superInit := dexMethod{class: super, name: "<init>", ret: "V"}
+	loadLibrary := dexMethod{class: "Ljava/lang/System;", name: "loadLibrary", ret: "V", params: []string{"Ljava/lang/String;"}}
+	methods := []dexMethod{clinit, init, superInit, loadLibrary}
+
+	// Collect and sort the ids the format requires to be sorted
+	stringSet := map[string]bool{library: true}
+	typeSet := map[string]bool{}
+	for _, m := range methods {
+		stringSet[m.name] = true
+		stringSet[dexShorty(m)] = true
+		for _, t := range append([]string{m.class, m.ret}, m.params...) {
+			stringSet[t] = true
+			typeSet[t] = true
+		}
+	}
+	stringList := sortedKeys(stringSet, dexStringLess)
+	stringIndex := indexOf(stringList)
+	typeList := sortedKeys(typeSet, dexStringLess)
+	typeIndex := indexOf(typeList)
+
+	type proto struct {
+		shorty string
+		ret    string
+		params []string
+	}
+	protoSet := map[string]proto{}
+	for _, m := range methods {
+		protoSet[dexShorty(m)+"|"+strings.Join(m.params, ",")] = proto{dexShorty(m), m.ret, m.params}
+	}
+	var protos []proto
+	for _, p := range protoSet {
+		protos = append(protos, p)
+	}
+	sort.Slice(protos, func(i, j int) bool {
+		if protos[i].ret != protos[j].ret {
+			return typeIndex[protos[i].ret] < typeIndex[protos[j].ret]
+		}
+		a, b := protos[i].params, protos[j].params
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return typeIndex[a[k]] < typeIndex[b[k]]
+			}
+		}
+		return len(a) < len(b)
+	})
+	protoIndex := func(m dexMethod) int {
+		for i, p := range protos {
+			if p.ret == m.ret && strings.Join(p.params, ",") == strings.Join(m.params, ",") {
+				return i
+			}
+		}
+		return -1
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		a, b := methods[i], methods[j]
+		if a.class != b.class {
+			return typeIndex[a.class] < typeIndex[b.class]
+		}
+		if a.name != b.name {
+			return stringIndex[a.name] < stringIndex[b.name]
+		}
+		return protoIndex(a) < protoIndex(b)
+	})
+	methodIndex := func(m dexMethod) uint16 {
+		for i, v := range methods {
+			if v.class == m.class && v.name == m.name && protoIndex(v) == protoIndex(m) {
+				return uint16(i)
+			}
+		}
+		return 0
+	}
+
+	// Lay out the index sections after the header
+	le := binary.LittleEndian
+	stringIDsOff := dexHeaderSize
+	typeIDsOff := stringIDsOff + 4*len(stringList)
+	protoIDsOff := typeIDsOff + 4*len(typeList)
+	methodIDsOff := protoIDsOff + 12*len(protos)
+	classDefsOff := methodIDsOff + 8*len(methods)
+	dataOff := classDefsOff + 32
+
+	// Data section: code items, type lists, string data, class data, map
+	data := &bytes.Buffer{}
+	offset := func() int { return dataOff + data.Len() }
+	align := func() {
+		for offset()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	// static <clinit>()V: const-string v0, library; invoke-static {v0}, System.loadLibrary; return-void
+	align()
+	clinitOff := offset()
+	writeDexCode(data, 1, 0, 1, []uint16{
+		0x001a, uint16(stringIndex[library]),
+		0x1071, methodIndex(loadLibrary), 0x0000,
+		0x000e,
+	})
+	// public <init>()V: invoke-direct {p0}, super.<init>; return-void
+	align()
+	initOff := offset()
+	writeDexCode(data, 1, 1, 1, []uint16{
+		0x1070, methodIndex(superInit), 0x0000,
+		0x000e,
+	})
+
+	align()
+	typeListsOff := offset()
+	paramsOff := map[string]int{}
+	typeLists := 0
+	for _, p := range protos {
+		key := strings.Join(p.params, ",")
+		if len(p.params) == 0 || paramsOff[key] != 0 {
+			continue
+		}
+		align()
+		paramsOff[key] = offset()
+		binary.Write(data, le, uint32(len(p.params)))
+		for _, t := range p.params {
+			binary.Write(data, le, uint16(typeIndex[t]))
+		}
+		typeLists++
+	}
+
+	stringDataOff := offset()
+	stringOffsets := make([]int, len(stringList))
+	for i, s := range stringList {
+		stringOffsets[i] = offset()
+		data.Write(appendULEB(nil, uint64(len(utf16.Encode([]rune(s))))))
+		data.Write(mutf8(s))
+		data.WriteByte(0)
+	}
+
+	classDataOff := offset()
+	methodDiff := uint64(0)
+	classData := appendULEB(nil, 0) // static fields
+	classData = appendULEB(classData, 0)
+	classData = appendULEB(classData, 2) // direct methods
+	classData = appendULEB(classData, 0)
+	direct := []struct {
+		method dexMethod
+		flags  uint64
+		code   int
+	}{
+		{clinit, dexAccStatic | dexAccConstructor, clinitOff},
+		{init, dexAccPublic | dexAccConstructor, initOff},
+	}
+	sort.Slice(direct, func(i, j int) bool { return methodIndex(direct[i].method) < methodIndex(direct[j].method) })
+	for _, m := range direct {
+		idx := uint64(methodIndex(m.method))
+		classData = appendULEB(classData, idx-methodDiff)
+		classData = appendULEB(classData, m.flags)
+		classData = appendULEB(classData, uint64(m.code))
+		methodDiff = idx
+	}
+	data.Write(classData)
+
+	align()
+	mapOff := offset()
+	mapItems := [][3]int{
+		{dexTypeHeader, 1, 0},
+		{dexTypeStringID, len(stringList), stringIDsOff},
+		{dexTypeTypeID, len(typeList), typeIDsOff},
+		{dexTypeProtoID, len(protos), protoIDsOff},
+		{dexTypeMethodID, len(methods), methodIDsOff},
+		{dexTypeClassDef, 1, classDefsOff},
+		{dexTypeCodeItem, 2, clinitOff},
+		{dexTypeTypeList, typeLists, typeListsOff},
+		{dexTypeStringData, len(stringList), stringDataOff},
+		{dexTypeClassData, 1, classDataOff},
+		{dexTypeMapList, 1, mapOff},
+	}
+	binary.Write(data, le, uint32(len(mapItems)))
+	for _, item := range mapItems {
+		binary.Write(data, le, uint16(item[0]))
+		binary.Write(data, le, uint16(0))
+		binary.Write(data, le, uint32(item[1]))
+		binary.Write(data, le, uint32(item[2]))
+	}
+
+	// Index sections
+	ids := &bytes.Buffer{}
+	for _, off := range stringOffsets {
+		binary.Write(ids, le, uint32(off))
+	}
+	for _, t := range typeList {
+		binary.Write(ids, le, uint32(stringIndex[t]))
+	}
+	for _, p := range protos {
+		binary.Write(ids, le, uint32(stringIndex[p.shorty]))
+		binary.Write(ids, le, uint32(typeIndex[p.ret]))
+		binary.Write(ids, le, uint32(paramsOff[strings.Join(p.params, ",")]))
+	}
+	for _, m := range methods {
+		binary.Write(ids, le, uint16(typeIndex[m.class]))
+		binary.Write(ids, le, uint16(protoIndex(m)))
+		binary.Write(ids, le, uint32(stringIndex[m.name]))
+	}
+	for _, v := range []uint32{
+		uint32(typeIndex[class]), dexAccPublic, uint32(typeIndex[super]), 0,
+		axmlNoIndex, 0, uint32(classDataOff), 0,
+	} {
+		binary.Write(ids, le, v)
+	}
+
+	fileSize := dataOff + data.Len()
+	header := make([]byte, dexHeaderSize)
+	copy(header, "dex\n035\x00")
+	for i, v := range []int{
+		fileSize, dexHeaderSize, dexEndianTag, 0, 0, mapOff,
+		len(stringList), stringIDsOff, len(typeList), typeIDsOff,
+		len(protos), protoIDsOff, 0, 0, len(methods), methodIDsOff,
+		1, classDefsOff, fileSize - dataOff, dataOff,
+	} {
+		le.PutUint32(header[32+4*i:], uint32(v))
+	}
+
+	out := append(append(header, ids.Bytes()...), data.Bytes()...)
+	signature := sha1.Sum(out[32:])
+	copy(out[12:32], signature[:])
+	le.PutUint32(out[8:], adler32.Checksum(out[12:]))
+	return out
+}
+
+// dexClassFlags returns the access flags of the class defined in a DEX file
+// under the dotted Java name className; found is false when the file does
+// not define the class
+func dexClassFlags(data []byte, className string) (flags uint32, found bool, err error) {
+	if len(data) < dexHeaderSize || !bytes.HasPrefix(data, []byte("dex\n")) {
+		return 0, false, fmt.Errorf("not a DEX file")
+	}
+	le := binary.LittleEndian
+	u32 := func(off int) (uint32, error) {
+		if off < 0 || off+4 > len(data) {
+			return 0, fmt.Errorf("offset %#x out of bounds", off)
+		}
+		return le.Uint32(data[off:]), nil
+	}
+
+	want := append(mutf8(dexDescriptor(className)), 0)
+	stringIDsSize, stringIDsOff := le.Uint32(data[0x38:]), le.Uint32(data[0x3c:])
+	typeIDsSize, typeIDsOff := le.Uint32(data[0x40:]), le.Uint32(data[0x44:])
+	classDefsSize, classDefsOff := le.Uint32(data[0x60:]), le.Uint32(data[0x64:])
+	for i := 0; i < int(classDefsSize); i++ {
+		def := int(classDefsOff) + 32*i
+		typeIdx, err := u32(def)
+		if err != nil {
+			return 0, false, err
+		}
+		if typeIdx >= typeIDsSize {
+			return 0, false, fmt.Errorf("class_def %d has invalid type index %d", i, typeIdx)
+		}
+		stringIdx, err := u32(int(typeIDsOff) + 4*int(typeIdx))
+		if err != nil {
+			return 0, false, err
+		}
+		if stringIdx >= stringIDsSize {
+			return 0, false, fmt.Errorf("type %d has invalid string index %d", typeIdx, stringIdx)
+		}
+		stringOff, err := u32(int(stringIDsOff) + 4*int(stringIdx))
+		if err != nil {
+			return 0, false, err
+		}
+		// string_data_item: ULEB128 UTF-16 length, then NUL-terminated MUTF-8
+		off := int(stringOff)
+		for off < len(data) && data[off]&0x80 != 0 {
+			off++
+		}
+		off++
+		if off > len(data) || !bytes.HasPrefix(data[off:], want) {
+			continue
+		}
+		if flags, err = u32(def + 4); err != nil {
+			return 0, false, err
+		}
+		return flags, true, nil
+	}
+	return 0, false, nil
+}
+
+// writeDexCode writes a code_item without tries or debug info
+func writeDexCode(buf *bytes.Buffer, registers, ins, outs uint16, insns []uint16) {
+	for _, v := range []uint16{registers, ins, outs, 0} {
+		binary.Write(buf, binary.LittleEndian, v)
+	}
+	binary.Write(buf, binary.LittleEndian, uint32(0))
+	binary.Write(buf, binary.LittleEndian, uint32(len(insns)))
+	binary.Write(buf, binary.LittleEndian, insns)
+}
+
+// dexDescriptor converts a dotted Java class name to a type descriptor
+func dexDescriptor(className string) string {
+	return "L" + strings.ReplaceAll(className, ".", "/") + ";"
+}
+
+// dexShorty returns the short-form descriptor of a method prototype
+func dexShorty(m dexMethod) string {
+	short := func(t string) string {
+		if t[0] == 'L' || t[0] == '[' {
+			return "L"
+		}
+		return t[:1]
+	}
+	s := short(m.ret)
+	for _, p := range m.params {
+		s += short(p)
+	}
+	return s
+}
+
+// dexStringLess orders strings by UTF-16 code units as the format requires
+func dexStringLess(a, b string) bool {
+	ua, ub := utf16.Encode([]rune(a)), utf16.Encode([]rune(b))
+	for i := 0; i < len(ua) && i < len(ub); i++ {
+		if ua[i] != ub[i] {
+			return ua[i] < ub[i]
+		}
+	}
+	return len(ua) < len(ub)
+}
+
+// mutf8 encodes s in the modified UTF-8 of DEX string data
+func mutf8(s string) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		switch {
+		case unit != 0 && unit < 0x80:
+			out = append(out, byte(unit))
+		case unit < 0x800:
+			out = append(out, 0xc0|byte(unit>>6), 0x80|byte(unit&0x3f))
+		default:
+			out = append(out, 0xe0|byte(unit>>12), 0x80|byte(unit>>6&0x3f), 0x80|byte(unit&0x3f))
+		}
+	}
+	return out
+}
+
+// sortedKeys returns the keys of set in the given order
+func sortedKeys(set map[string]bool, less func(a, b string) bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+	return keys
+}
+
+// indexOf maps each string of list to its index
+func indexOf(list []string) map[string]int {
+	index := make(map[string]int, len(list))
+	for i, s := range list {
+		index[s] = i
+	}
+	return index
+}
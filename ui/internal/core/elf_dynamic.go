@@ -0,0 +1,685 @@
+package core
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Section types of Android packed relocations, which debug/elf does not name
+const (
+	shtAndroidRel  = elf.SectionType(0x60000001)
+	shtAndroidRela = elf.SectionType(0x60000002)
+)
+
+// elfDynamic holds editable copies of the dynamic linking sections of an ELF file
+type elfDynamic struct {
+	file     *elf.File
+	order    binary.ByteOrder
+	is64     bool
+	dynsym   *elf.Section
+	dynstr   *elf.Section
+	data     map[*elf.Section][]byte
+	modified map[*elf.Section]bool
+}
+
+// newELFDynamic locates the dynamic symbol and string tables; it returns nil
+// for files without dynamic symbols
+func newELFDynamic(file *elf.File) (*elfDynamic, error) {
+	d := &elfDynamic{
+		file:     file,
+		order:    file.ByteOrder,
+		is64:     file.Class == elf.ELFCLASS64,
+		data:     make(map[*elf.Section][]byte),
+		modified: make(map[*elf.Section]bool),
+	}
+	d.dynsym = d.sectionOfType(elf.SHT_DYNSYM)
+	if d.dynsym == nil {
+		return nil, nil
+	}
+	if int(d.dynsym.Link) >= len(file.Sections) || file.Sections[d.dynsym.Link].Type != elf.SHT_STRTAB {
+		return nil, fmt.Errorf("%s does not link to a string table", d.dynsym.Name)
+	}
+	d.dynstr = file.Sections[d.dynsym.Link]
+	return d, nil
+}
+
+// sectionOfType returns the first section of type typ
+func (d *elfDynamic) sectionOfType(typ elf.SectionType) *elf.Section {
+	for _, s := range d.file.Sections {
+		if s.Type == typ {
+			return s
+		}
+	}
+	return nil
+}
+
+// sectionIndex returns the index of s in the section header table
+func (d *elfDynamic) sectionIndex(s *elf.Section) uint32 {
+	for i, section := range d.file.Sections {
+		if section == s {
+			return uint32(i)
+		}
+	}
+	return 0
+}
+
+// load returns the editable copy of a section's content
+func (d *elfDynamic) load(s *elf.Section) ([]byte, error) {
+	if data, ok := d.data[s]; ok {
+		return data, nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", s.Name, err)
+	}
+	d.data[s] = data
+	return data, nil
+}
+
+// symbolSize returns the size of a .dynsym entry
+func (d *elfDynamic) symbolSize() int {
+	if d.is64 {
+		return 24
+	}
+	return 16
+}
+
+// symbolNames returns the name of every dynamic symbol, indexed like .dynsym
+func (d *elfDynamic) symbolNames() ([]string, error) {
+	symtab, err := d.load(d.dynsym)
+	if err != nil {
+		return nil, err
+	}
+	strtab, err := d.load(d.dynstr)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(symtab)/d.symbolSize())
+	for i := range names {
+		offset := d.order.Uint32(symtab[i*d.symbolSize():])
+		if int(offset) >= len(strtab) {
+			return nil, fmt.Errorf("symbol %d has an invalid name offset 0x%x", i, offset)
+		}
+		names[i] = cString(strtab, offset)
+	}
+	return names, nil
+}
+
+// symbolDefined reports whether dynamic symbol i is defined in the file
+func (d *elfDynamic) symbolDefined(i int) bool {
+	symtab := d.data[d.dynsym]
+	shndx := 14
+	if d.is64 {
+		shndx = 6
+	}
+	return d.order.Uint16(symtab[i*d.symbolSize()+shndx:]) != uint16(elf.SHN_UNDEF)
+}
+
+// stringRefs lists every reference to the dynamic string table: the string
+// entries of .dynamic, the symbol names and the version names
+func (d *elfDynamic) stringRefs() ([]stringRef, error) {
+	var refs []stringRef
+
+	if dynamic := d.sectionOfType(elf.SHT_DYNAMIC); dynamic != nil {
+		data, err := d.load(dynamic)
+		if err != nil {
+			return nil, err
+		}
+		entrySize := 8
+		if d.is64 {
+			entrySize = 16
+		}
+		for off := 0; off+entrySize <= len(data); off += entrySize {
+			var tag elf.DynTag
+			var val uint64
+			if d.is64 {
+				tag = elf.DynTag(d.order.Uint64(data[off:]))
+				val = d.order.Uint64(data[off+8:])
+			} else {
+				tag = elf.DynTag(int32(d.order.Uint32(data[off:])))
+				val = uint64(d.order.Uint32(data[off+4:]))
+			}
+			if tag == elf.DT_NULL {
+				break
+			}
+			var kind string
+			switch tag {
+			case elf.DT_NEEDED:
+				kind = "needed"
+			case elf.DT_SONAME:
+				kind = "soname"
+			case elf.DT_RPATH:
+				kind = "rpath"
+			case elf.DT_RUNPATH:
+				kind = "runpath"
+			case elf.DT_AUXILIARY, elf.DT_FILTER:
+				kind = "filter"
+			default:
+				continue
+			}
+			refs = append(refs, stringRef{offset: uint32(val), kind: kind})
+		}
+	}
+
+	symtab, err := d.load(d.dynsym)
+	if err != nil {
+		return nil, err
+	}
+	for off := d.symbolSize(); off+d.symbolSize() <= len(symtab); off += d.symbolSize() {
+		if name := d.order.Uint32(symtab[off:]); name != 0 {
+			refs = append(refs, stringRef{offset: name, kind: "symbol"})
+		}
+	}
+
+	err = d.walkVersions(func(s *elf.Section, name uint32, kind string, hashAt int) {
+		refs = append(refs, stringRef{offset: name, kind: kind})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	strtab, err := d.load(d.dynstr)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if int(ref.offset) >= len(strtab) {
+			return nil, fmt.Errorf("%s name offset 0x%x is outside %s", ref.kind, ref.offset, d.dynstr.Name)
+		}
+	}
+	return refs, nil
+}
+
+// walkVersions calls visit for every name of the version definition and
+// requirement sections, with the offset of the ELF hash stored for the name
+// inside section s, or -1 for names without one
+func (d *elfDynamic) walkVersions(visit func(s *elf.Section, name uint32, kind string, hashAt int)) error {
+	if verdef := d.sectionOfType(elf.SHT_GNU_VERDEF); verdef != nil {
+		data, err := d.load(verdef)
+		if err != nil {
+			return err
+		}
+		for off, n := 0, 0; ; n++ {
+			if off+20 > len(data) || n > len(data)/20 {
+				return fmt.Errorf("malformed %s", verdef.Name)
+			}
+			count := int(d.order.Uint16(data[off+6:]))
+			aux := off + int(d.order.Uint32(data[off+12:]))
+			for i := 0; i < count; i++ {
+				if aux+8 > len(data) {
+					return fmt.Errorf("malformed %s", verdef.Name)
+				}
+				// The first auxiliary entry names the version whose hash is vd_hash
+				hashAt := -1
+				if i == 0 {
+					hashAt = off + 8
+				}
+				visit(verdef, d.order.Uint32(data[aux:]), "version", hashAt)
+				aux += int(d.order.Uint32(data[aux+4:]))
+			}
+			next := int(d.order.Uint32(data[off+16:]))
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+
+	if verneed := d.sectionOfType(elf.SHT_GNU_VERNEED); verneed != nil {
+		data, err := d.load(verneed)
+		if err != nil {
+			return err
+		}
+		for off, n := 0, 0; ; n++ {
+			if off+16 > len(data) || n > len(data)/16 {
+				return fmt.Errorf("malformed %s", verneed.Name)
+			}
+			count := int(d.order.Uint16(data[off+2:]))
+			visit(verneed, d.order.Uint32(data[off+4:]), "needed", -1)
+			aux := off + int(d.order.Uint32(data[off+8:]))
+			for i := 0; i < count; i++ {
+				if aux+16 > len(data) {
+					return fmt.Errorf("malformed %s", verneed.Name)
+				}
+				visit(verneed, d.order.Uint32(data[aux+8:]), "version", aux)
+				aux += int(d.order.Uint32(data[aux+12:]))
+			}
+			next := int(d.order.Uint32(data[off+12:]))
+			if next == 0 {
+				break
+			}
+			off += next
+		}
+	}
+	return nil
+}
+
+// planELFDynamic renames the strings of the dynamic string table that match
+// items and rebuilds every table derived from them: the symbol hashes of
+// .gnu.hash and .hash and the version name hashes. Renamed symbols that move
+// to another .gnu.hash bucket are reordered in .dynsym together with
+// .gnu.version and the symbol indices of dynamic relocations. Strings are
+// rewritten in place, so every string offset and DT_STRSZ stay valid.
+func planELFDynamic(file *elf.File, items []*Replacement, arch string, report *PatchReport) ([]sectionPatch, error) {
+	d, err := newELFDynamic(file)
+	if err != nil || d == nil {
+		return nil, err
+	}
+	refs, err := d.stringRefs()
+	if err != nil {
+		return nil, err
+	}
+	strtab, err := d.load(d.dynstr)
+	if err != nil {
+		return nil, err
+	}
+	names, matches, problems := renameStringTable(strtab, refs, items)
+	if len(names) == 0 && len(problems) == 0 {
+		return nil, nil
+	}
+	report.addSection(arch, d.dynstr.Name, int64(d.dynstr.Offset), d.dynstr.Addr, matches, problems)
+	if len(problems) > 0 {
+		return nil, nil
+	}
+	d.modified[d.dynstr] = true
+
+	for i := range names {
+		names[i].Arch = arch
+	}
+	summary := &DynamicRename{Names: names}
+
+	if err := d.rebuildVersionHashes(); err != nil {
+		return nil, err
+	}
+	if summary.Reordered, err = d.rebuildSymbolHashes(); err != nil {
+		return nil, err
+	}
+
+	var patches []sectionPatch
+	for _, s := range file.Sections {
+		if !d.modified[s] {
+			continue
+		}
+		if s != d.dynstr {
+			summary.Tables = append(summary.Tables, s.Name)
+		}
+		patches = append(patches, sectionPatch{Section: s.Name, Offset: int64(s.Offset), Data: d.data[s]})
+	}
+	report.addDynamic(summary)
+	return patches, nil
+}
+
+// rebuildVersionHashes updates the hashes of renamed version names
+func (d *elfDynamic) rebuildVersionHashes() error {
+	strtab := d.data[d.dynstr]
+	return d.walkVersions(func(s *elf.Section, name uint32, kind string, hashAt int) {
+		data := d.data[s]
+		hash := elfHash(cString(strtab, name))
+		if hashAt >= 0 && d.order.Uint32(data[hashAt:]) != hash {
+			d.order.PutUint32(data[hashAt:], hash)
+			d.modified[s] = true
+		}
+	})
+}
+
+// rebuildSymbolHashes rebuilds .gnu.hash and .hash for the current symbol
+// names and returns the number of symbols moved between buckets
+func (d *elfDynamic) rebuildSymbolHashes() (int, error) {
+	names, err := d.symbolNames()
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	if gnu := d.sectionOfType(elf.SHT_GNU_HASH); gnu != nil {
+		data, err := d.load(gnu)
+		if err != nil {
+			return 0, err
+		}
+		if len(data) < 16 {
+			return 0, fmt.Errorf("malformed %s", gnu.Name)
+		}
+		nbuckets, symoffset := d.order.Uint32(data), int(d.order.Uint32(data[4:]))
+		if nbuckets == 0 || symoffset > len(names) {
+			return 0, fmt.Errorf("malformed %s", gnu.Name)
+		}
+
+		// GNU hash chains require the exported symbols sorted by bucket
+		order := make([]int, len(names))
+		for i := range order {
+			order[i] = i
+		}
+		hashed := order[symoffset:]
+		sort.SliceStable(hashed, func(i, j int) bool {
+			return gnuHash(names[hashed[i]])%nbuckets < gnuHash(names[hashed[j]])%nbuckets
+		})
+		for i, old := range order {
+			if i != old {
+				moved++
+			}
+		}
+		if moved > 0 {
+			if err := d.reorderSymbols(order); err != nil {
+				return 0, err
+			}
+			if names, err = d.symbolNames(); err != nil {
+				return 0, err
+			}
+		}
+		if err := d.writeGNUHash(gnu, names); err != nil {
+			return 0, err
+		}
+	}
+
+	if hash := d.sectionOfType(elf.SHT_HASH); hash != nil {
+		if err := d.writeSysVHash(hash, names); err != nil {
+			return 0, err
+		}
+	}
+	return moved, nil
+}
+
+// reorderSymbols moves dynamic symbol order[i] to index i and remaps every
+// table indexed by symbol
+func (d *elfDynamic) reorderSymbols(order []int) error {
+	if d.file.Machine == elf.EM_MIPS {
+		return fmt.Errorf("reordering MIPS dynamic symbols is not supported")
+	}
+	newIndex := make([]uint64, len(order))
+	for i, old := range order {
+		newIndex[old] = uint64(i)
+	}
+
+	symtab := d.data[d.dynsym]
+	size := d.symbolSize()
+	reordered := make([]byte, len(symtab))
+	copy(reordered, symtab)
+	for i, old := range order {
+		copy(reordered[i*size:(i+1)*size], symtab[old*size:(old+1)*size])
+	}
+	copy(symtab, reordered)
+	d.modified[d.dynsym] = true
+
+	if versym := d.sectionOfType(elf.SHT_GNU_VERSYM); versym != nil {
+		data, err := d.load(versym)
+		if err != nil {
+			return err
+		}
+		if len(data) < len(order)*2 {
+			return fmt.Errorf("%s is shorter than %s", versym.Name, d.dynsym.Name)
+		}
+		versions := append([]byte(nil), data...)
+		for i, old := range order {
+			copy(data[i*2:i*2+2], versions[old*2:old*2+2])
+		}
+		d.modified[versym] = true
+	}
+
+	dynsymIndex := d.sectionIndex(d.dynsym)
+	for _, s := range d.file.Sections {
+		if s.Link != dynsymIndex {
+			continue
+		}
+		switch s.Type {
+		case elf.SHT_REL, elf.SHT_RELA:
+			if err := d.remapRelocations(s, newIndex); err != nil {
+				return err
+			}
+		case shtAndroidRel, shtAndroidRela:
+			return fmt.Errorf("packed relocations in %s reference dynamic symbols by index", s.Name)
+		}
+	}
+	return nil
+}
+
+// remapRelocations rewrites the symbol indices of a relocation section
+func (d *elfDynamic) remapRelocations(s *elf.Section, newIndex []uint64) error {
+	data, err := d.load(s)
+	if err != nil {
+		return err
+	}
+	entrySize := int(s.Entsize)
+	if entrySize == 0 {
+		switch {
+		case d.is64 && s.Type == elf.SHT_RELA:
+			entrySize = 24
+		case d.is64:
+			entrySize = 16
+		case s.Type == elf.SHT_RELA:
+			entrySize = 12
+		default:
+			entrySize = 8
+		}
+	}
+
+	for off := 0; off+entrySize <= len(data); off += entrySize {
+		var sym uint64
+		if d.is64 {
+			sym = d.order.Uint64(data[off+8:]) >> 32
+		} else {
+			sym = uint64(d.order.Uint32(data[off+4:]) >> 8)
+		}
+		if sym >= uint64(len(newIndex)) {
+			return fmt.Errorf("relocation in %s references symbol %d of %d", s.Name, sym, len(newIndex))
+		}
+		if newIndex[sym] == sym {
+			continue
+		}
+		if d.is64 {
+			info := d.order.Uint64(data[off+8:])
+			d.order.PutUint64(data[off+8:], newIndex[sym]<<32|info&0xffffffff)
+		} else {
+			info := d.order.Uint32(data[off+4:])
+			d.order.PutUint32(data[off+4:], uint32(newIndex[sym])<<8|info&0xff)
+		}
+		d.modified[s] = true
+	}
+	return nil
+}
+
+// writeGNUHash rebuilds the bloom filter, buckets and chains of a .gnu.hash
+// section, keeping its bucket count, symbol offset and bloom parameters
+func (d *elfDynamic) writeGNUHash(s *elf.Section, names []string) error {
+	data := d.data[s]
+	nbuckets := d.order.Uint32(data)
+	symoffset := int(d.order.Uint32(data[4:]))
+	bloomSize := d.order.Uint32(data[8:])
+	shift := d.order.Uint32(data[12:])
+	wordSize := 4
+	if d.is64 {
+		wordSize = 8
+	}
+	bucketsAt := 16 + int(bloomSize)*wordSize
+	chainAt := bucketsAt + int(nbuckets)*4
+	end := chainAt + (len(names)-symoffset)*4
+	if bloomSize == 0 || end > len(data) {
+		return fmt.Errorf("malformed %s", s.Name)
+	}
+
+	original := append([]byte(nil), data...)
+	clear(data[16:end])
+	bits := uint32(wordSize * 8)
+	for i := symoffset; i < len(names); i++ {
+		h := gnuHash(names[i])
+
+		word := 16 + int((h/bits)%bloomSize)*wordSize
+		mask := uint64(1)<<(h%bits) | uint64(1)<<((h>>shift)%bits)
+		if d.is64 {
+			d.order.PutUint64(data[word:], d.order.Uint64(data[word:])|mask)
+		} else {
+			d.order.PutUint32(data[word:], d.order.Uint32(data[word:])|uint32(mask))
+		}
+
+		bucket := bucketsAt + int(h%nbuckets)*4
+		if d.order.Uint32(data[bucket:]) == 0 {
+			d.order.PutUint32(data[bucket:], uint32(i))
+		}
+		chain := h &^ 1
+		if i == len(names)-1 || gnuHash(names[i+1])%nbuckets != h%nbuckets {
+			chain |= 1 // last symbol of the bucket
+		}
+		d.order.PutUint32(data[chainAt+(i-symoffset)*4:], chain)
+	}
+	if !bytes.Equal(data, original) {
+		d.modified[s] = true
+	}
+	return nil
+}
+
+// writeSysVHash rebuilds the buckets and chains of a .hash section
+func (d *elfDynamic) writeSysVHash(s *elf.Section, names []string) error {
+	data, err := d.load(s)
+	if err != nil {
+		return err
+	}
+	if s.Entsize == 8 {
+		return fmt.Errorf("%s with 8-byte entries is not supported", s.Name)
+	}
+	if len(data) < 8 {
+		return fmt.Errorf("malformed %s", s.Name)
+	}
+	nbucket := d.order.Uint32(data)
+	nchain := int(d.order.Uint32(data[4:]))
+	if nbucket == 0 || nchain != len(names) || 8+(int(nbucket)+nchain)*4 > len(data) {
+		return fmt.Errorf("malformed %s", s.Name)
+	}
+
+	chainAt := 8 + int(nbucket)*4
+	original := append([]byte(nil), data...)
+	clear(data[8 : chainAt+nchain*4])
+	for i := 1; i < len(names); i++ {
+		bucket := 8 + int(elfHash(names[i])%nbucket)*4
+		d.order.PutUint32(data[chainAt+i*4:], d.order.Uint32(data[bucket:]))
+		d.order.PutUint32(data[bucket:], uint32(i))
+	}
+	if !bytes.Equal(data, original) {
+		d.modified[s] = true
+	}
+	return nil
+}
+
+// verifyELFDynamic checks that every exported dynamic symbol of an ELF file
+// is found through its .gnu.hash and .hash tables
+func verifyELFDynamic(file *elf.File) error {
+	d, err := newELFDynamic(file)
+	if err != nil || d == nil {
+		return err
+	}
+	names, err := d.symbolNames()
+	if err != nil {
+		return err
+	}
+
+	if gnu := d.sectionOfType(elf.SHT_GNU_HASH); gnu != nil {
+		data, err := d.load(gnu)
+		if err != nil {
+			return err
+		}
+		symoffset := int(d.order.Uint32(data[4:]))
+		for i := symoffset; i < len(names); i++ {
+			if j := d.gnuLookup(data, names, names[i]); j < 0 || names[j] != names[i] {
+				return fmt.Errorf("symbol %q is not found through %s", names[i], gnu.Name)
+			}
+		}
+	}
+
+	if hash := d.sectionOfType(elf.SHT_HASH); hash != nil {
+		data, err := d.load(hash)
+		if err != nil {
+			return err
+		}
+		for i := 1; i < len(names); i++ {
+			if names[i] == "" || !d.symbolDefined(i) {
+				continue
+			}
+			if j := d.sysvLookup(data, names, names[i]); j < 0 {
+				return fmt.Errorf("symbol %q is not found through %s", names[i], hash.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// gnuLookup finds a symbol the way the dynamic linker does with .gnu.hash;
+// it returns -1 when the bloom filter or the chain rejects the name
+func (d *elfDynamic) gnuLookup(data []byte, names []string, name string) int {
+	nbuckets := d.order.Uint32(data)
+	symoffset := int(d.order.Uint32(data[4:]))
+	bloomSize := d.order.Uint32(data[8:])
+	shift := d.order.Uint32(data[12:])
+	wordSize := 4
+	if d.is64 {
+		wordSize = 8
+	}
+	bits := uint32(wordSize * 8)
+	bucketsAt := 16 + int(bloomSize)*wordSize
+	chainAt := bucketsAt + int(nbuckets)*4
+
+	h := gnuHash(name)
+	word := 16 + int((h/bits)%bloomSize)*wordSize
+	var bloom uint64
+	if d.is64 {
+		bloom = d.order.Uint64(data[word:])
+	} else {
+		bloom = uint64(d.order.Uint32(data[word:]))
+	}
+	mask := uint64(1)<<(h%bits) | uint64(1)<<((h>>shift)%bits)
+	if bloom&mask != mask {
+		return -1
+	}
+
+	i := int(d.order.Uint32(data[bucketsAt+int(h%nbuckets)*4:]))
+	if i == 0 {
+		return -1
+	}
+	for ; i >= symoffset && i < len(names); i++ {
+		chain := d.order.Uint32(data[chainAt+(i-symoffset)*4:])
+		if chain|1 == h|1 && names[i] == name {
+			return i
+		}
+		if chain&1 != 0 {
+			break
+		}
+	}
+	return -1
+}
+
+// sysvLookup finds a symbol through a .hash section
+func (d *elfDynamic) sysvLookup(data []byte, names []string, name string) int {
+	nbucket := d.order.Uint32(data)
+	chainAt := 8 + int(nbucket)*4
+	i := int(d.order.Uint32(data[8+int(elfHash(name)%nbucket)*4:]))
+	for n := 0; i != 0 && i < len(names) && n < len(names); n++ {
+		if names[i] == name {
+			return i
+		}
+		i = int(d.order.Uint32(data[chainAt+i*4:]))
+	}
+	return -1
+}
+
+// gnuHash is the DJB hash used by .gnu.hash
+func gnuHash(name string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(name); i++ {
+		h = h*33 + uint32(name[i])
+	}
+	return h
+}
+
+// elfHash is the System V ELF hash used by .hash and symbol versioning
+func elfHash(name string) uint32 {
+	var h uint32
+	for i := 0; i < len(name); i++ {
+		h = h<<4 + uint32(name[i])
+		g := h & 0xf0000000
+		if g != 0 {
+			h ^= g >> 24
+		}
+		h &^= g
+	}
+	return h
+}
@@ -0,0 +1,215 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Entitlements is the entitlements dictionary of a code signature. Values are
+// bool, string, int64, float64, []byte, time.Time, []interface{} or
+// map[string]interface{} as decoded from the plist.
+type Entitlements map[string]interface{}
+
+// FridaServerEntitlements returns the entitlements frida-server needs to attach
+// to other processes on a jailbroken iOS device
+func FridaServerEntitlements() Entitlements {
+	return Entitlements{
+		"platform-application":                      true,
+		"task_for_pid-allow":                        true,
+		"get-task-allow":                            true,
+		"run-unsigned-code":                         true,
+		"com.apple.private.security.no-container":   true,
+		"com.apple.private.skip-library-validation": true,
+		"com.apple.private.cs.debugger":             true,
+		"com.apple.security.cs.debugger":            true,
+		"com.apple.system-task-ports":               true,
+		"com.apple.springboard.debugapplications":   true,
+		"com.apple.backboardd.launchapplications":   true,
+	}
+}
+
+// ParseEntitlements parses an XML or binary plist whose root is a dictionary
+func ParseEntitlements(data []byte) (Entitlements, error) {
+	value, _, err := ParsePlist(data)
+	if err != nil {
+		return nil, err
+	}
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("entitlements plist root must be a dict, got %s", plistTypeName(value))
+	}
+	return Entitlements(dict), nil
+}
+
+// LoadEntitlementsFile reads an entitlements plist file
+func LoadEntitlementsFile(filePath string) (Entitlements, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseEntitlements(data)
+}
+
+// ReadEntitlements extracts the entitlements from the code signature of a Mach-O
+// file. For fat files the first slice carrying entitlements is used; an
+// unsigned or unentitled binary yields an empty dictionary.
+func ReadEntitlements(binaryPath string) (Entitlements, error) {
+	data, err := os.ReadFile(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	return entitlementsFromData(data)
+}
+
+// entitlementsFromData extracts the entitlements of a Mach-O file in memory
+func entitlementsFromData(data []byte) (Entitlements, error) {
+	images, err := machoImages(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range images {
+		img, err := parseMachOImage(image)
+		if err != nil {
+			return nil, err
+		}
+		if img.signatureCmd < 0 {
+			continue
+		}
+		end := uint64(img.signatureOff) + uint64(img.signatureSize)
+		if end > uint64(len(image)) {
+			return nil, fmt.Errorf("code signature out of range")
+		}
+		blobs, err := parseSuperBlob(image[img.signatureOff:end])
+		if err != nil {
+			return nil, err
+		}
+		if blob := blobs[csSlotEntitlements]; blob != nil {
+			return ParseEntitlements(blob[8:])
+		}
+	}
+	return Entitlements{}, nil
+}
+
+// Merge copies every key of other into e, replacing existing values
+func (e Entitlements) Merge(other Entitlements) {
+	for key, value := range other {
+		e[key] = value
+	}
+}
+
+// Clone returns a shallow copy of e
+func (e Entitlements) Clone() Entitlements {
+	clone := make(Entitlements, len(e))
+	clone.Merge(e)
+	return clone
+}
+
+// Keys returns the keys of e in sorted order
+func (e Entitlements) Keys() []string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Plist encodes e as an XML plist
+func (e Entitlements) Plist() ([]byte, error) {
+	return MarshalPlist(map[string]interface{}(e), PlistXML)
+}
+
+// DER encodes e in the DER form embedded in signatures since iOS 15
+func (e Entitlements) DER() ([]byte, error) {
+	dict, err := derValue(map[string]interface{}(e))
+	if err != nil {
+		return nil, err
+	}
+	// [APPLICATION 16] { INTEGER 1, [CONTEXT 16] dict }
+	return derTLV(0x70, append(derTLV(0x02, derInteger(1)), dict...)), nil
+}
+
+// SetEntitlements replaces the entitlements written by the signer with e, in
+// both the XML and the DER form
+func (cs *CodeSigner) SetEntitlements(e Entitlements) error {
+	xmlData, err := e.Plist()
+	if err != nil {
+		return err
+	}
+	derData, err := e.DER()
+	if err != nil {
+		return err
+	}
+	cs.Entitlements = xmlData
+	cs.EntitlementsDER = derData
+	return nil
+}
+
+// derValue encodes an entitlements value; dictionaries are sets of
+// (key, value) sequences sorted by key
+func derValue(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case bool:
+		if v {
+			return derTLV(0x01, []byte{0xff}), nil
+		}
+		return derTLV(0x01, []byte{0x00}), nil
+	case int64:
+		return derTLV(0x02, derInteger(v)), nil
+	case int:
+		return derTLV(0x02, derInteger(int64(v))), nil
+	case string:
+		return derTLV(0x0c, []byte(v)), nil
+	case []interface{}:
+		var content []byte
+		for _, elem := range v {
+			encoded, err := derValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, encoded...)
+		}
+		return derTLV(0x30, content), nil
+	case map[string]interface{}:
+		var content []byte
+		for _, key := range Entitlements(v).Keys() {
+			encoded, err := derValue(v[key])
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", key, err)
+			}
+			content = append(content, derTLV(0x30, append(derTLV(0x0c, []byte(key)), encoded...))...)
+		}
+		return derTLV(0xb0, content), nil
+	case Entitlements:
+		return derValue(map[string]interface{}(v))
+	default:
+		return nil, fmt.Errorf("value of type %T cannot be encoded as DER entitlements", v)
+	}
+}
+
+// derTLV encodes a tag, definite length and content
+func derTLV(tag byte, content []byte) []byte {
+	out := []byte{tag}
+	if n := len(content); n < 0x80 {
+		out = append(out, byte(n))
+	} else {
+		var length []byte
+		for ; n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, content...)
+}
+
+// derInteger returns the minimal two's complement encoding of n
+func derInteger(n int64) []byte {
+	b := []byte{byte(n)}
+	for n >= 0x80 || n < -0x80 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return b
+}
@@ -0,0 +1,359 @@
+package core
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Severity ranks how likely a residual string is used to detect Frida
+type Severity string
+
+const (
+	SeverityHigh   Severity = "high"
+	SeverityMedium Severity = "medium"
+	SeverityLow    Severity = "low"
+)
+
+// Signature is a well-known Frida detection string
+type Signature struct {
+	Pattern    string   `json:"pattern"`
+	Severity   Severity `json:"severity"`
+	IgnoreCase bool     `json:"ignore_case,omitempty"`
+}
+
+// DefaultSignatures returns the strings commonly checked by Frida detectors
+func DefaultSignatures() []Signature {
+	return []Signature{
+		{Pattern: "frida", Severity: SeverityHigh, IgnoreCase: true},
+		{Pattern: "gum-js-loop", Severity: SeverityHigh},
+		{Pattern: "linjector", Severity: SeverityHigh},
+		{Pattern: "gmain", Severity: SeverityMedium},
+		{Pattern: "gdbus", Severity: SeverityMedium},
+		{Pattern: "GumJS", Severity: SeverityLow},
+	}
+}
+
+// FingerprintHit is one residual signature found in a binary
+type FingerprintHit struct {
+	Arch           string   `json:"arch,omitempty"`
+	Section        string   `json:"section"`
+	FileOffset     int64    `json:"file_offset"`
+	VirtualAddress uint64   `json:"virtual_address"`
+	Signature      string   `json:"signature"`
+	Severity       Severity `json:"severity"`
+	Context        string   `json:"context"`           // printable string surrounding the hit
+	Covered        bool     `json:"covered,omitempty"` // a rule of the rule set would rewrite this hit
+}
+
+// FingerprintReport lists the residual signatures of a binary
+type FingerprintReport struct {
+	File   string           `json:"file"`
+	Format string           `json:"format"`
+	Hits   []FingerprintHit `json:"hits"`
+}
+
+// FingerprintScanner searches binaries for residual Frida signatures
+type FingerprintScanner struct {
+	Signatures []Signature
+	// Rules decides whether a hit could have been covered; nil selects the default profile
+	Rules *RuleSet
+}
+
+// NewFingerprintScanner creates a scanner with the default signatures
+func NewFingerprintScanner(rules *RuleSet) *FingerprintScanner {
+	return &FingerprintScanner{
+		Signatures: DefaultSignatures(),
+		Rules:      rules,
+	}
+}
+
+// scanRegion is a block of file data scanned as one unit
+type scanRegion struct {
+	Arch       string
+	Name       string
+	FileOffset int64
+	Addr       uint64
+	Data       []byte
+	Exec       bool // region holds code
+}
+
+// Scan reports the residual signatures of every section of filePath,
+// including each slice of a fat Mach-O
+func (fs *FingerprintScanner) Scan(filePath string) (*FingerprintReport, error) {
+	file, format, err := detectAndOpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	var regions []scanRegion
+	switch f := file.(type) {
+	case *macho.File:
+		regions, err = machoRegions(f, machoArchName(f.Cpu, f.SubCpu), 0)
+	case *macho.FatFile:
+		for _, arch := range f.Arches {
+			archRegions, archErr := machoRegions(arch.File, machoArchName(arch.Cpu, arch.SubCpu), int64(arch.Offset))
+			if archErr != nil {
+				err = archErr
+				break
+			}
+			regions = append(regions, archRegions...)
+		}
+	case *elf.File:
+		regions, err = elfRegions(f)
+	case *pe.File:
+		regions, err = peRegions(f)
+	default:
+		return nil, fmt.Errorf("unsupported file type")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rules := fs.Rules
+	if rules == nil {
+		rules = DefaultRuleSet()
+	}
+
+	report := &FingerprintReport{File: filePath, Format: formatToString(format)}
+	for _, region := range regions {
+		oldStrings := rules.sectionOldStrings(format, region.Arch, region.Name)
+		for _, hit := range fs.scanData(region.Data) {
+			start := int(hit.FileOffset)
+			hit.Covered = coveredByRules(region.Data, start, start+len(hit.Signature), oldStrings)
+			hit.Arch = region.Arch
+			hit.Section = region.Name
+			hit.FileOffset += region.FileOffset
+			hit.VirtualAddress = region.Addr + uint64(start)
+			report.Hits = append(report.Hits, hit)
+		}
+	}
+	return report, nil
+}
+
+// scanData finds the signatures in data; offsets are relative to data and
+// hits contained in a longer hit are dropped
+func (fs *FingerprintScanner) scanData(data []byte) []FingerprintHit {
+	var lower []byte
+	var hits []FingerprintHit
+	for _, sig := range fs.Signatures {
+		pattern := []byte(sig.Pattern)
+		haystack := data
+		if sig.IgnoreCase {
+			if lower == nil {
+				lower = bytes.ToLower(data)
+			}
+			haystack = lower
+			pattern = bytes.ToLower(pattern)
+		}
+		if len(pattern) == 0 {
+			continue
+		}
+
+		for i := 0; ; {
+			j := bytes.Index(haystack[i:], pattern)
+			if j < 0 {
+				break
+			}
+			offset := i + j
+			hits = append(hits, FingerprintHit{
+				FileOffset: int64(offset),
+				Signature:  string(data[offset : offset+len(pattern)]),
+				Severity:   sig.Severity,
+				Context:    hitContext(data, offset, len(pattern)),
+			})
+			i = offset + len(pattern)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].FileOffset != hits[j].FileOffset {
+			return hits[i].FileOffset < hits[j].FileOffset
+		}
+		return len(hits[i].Signature) > len(hits[j].Signature)
+	})
+	var result []FingerprintHit
+	var end int64
+	for _, hit := range hits {
+		hitEnd := hit.FileOffset + int64(len(hit.Signature))
+		if len(result) > 0 && hitEnd <= end {
+			continue
+		}
+		result = append(result, hit)
+		end = hitEnd
+	}
+	return result
+}
+
+// hitContext returns the printable string around a hit, limited to 32 bytes
+// on each side
+func hitContext(data []byte, offset, length int) string {
+	start := offset
+	for start > 0 && offset-start < 32 && isPrintableCString(data[start-1:start]) && data[start-1] != 0 {
+		start--
+	}
+	end := offset + length
+	for end < len(data) && end-offset-length < 32 && isPrintableCString(data[end:end+1]) && data[end] != 0 {
+		end++
+	}
+	return string(data[start:end])
+}
+
+// coveredByRules reports whether one of oldStrings occurs in data overlapping [start, end)
+func coveredByRules(data []byte, start, end int, oldStrings [][]byte) bool {
+	for _, old := range oldStrings {
+		from := max(start-len(old)+1, 0)
+		to := min(end, len(data)-len(old)+1)
+		for i := from; i < to; i++ {
+			if bytesEqual(data[i:i+len(old)], old) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sectionOldStrings returns the original strings the rule set replaces in a section
+func (rs *RuleSet) sectionOldStrings(format ExecutableFormat, arch, section string) [][]byte {
+	var result [][]byte
+	for _, rule := range rs.Rules {
+		ruleFormat, _ := parseFormat(rule.Format)
+		if ruleFormat == format && rule.Section == section && rule.matchesArch(arch) {
+			result = append(result, []byte(rule.Old))
+		}
+	}
+	return result
+}
+
+// machoRegions returns the sections of a Mach-O image plus its __LINKEDIT
+// segment, which holds the symbol and string tables
+func machoRegions(file *macho.File, arch string, base int64) ([]scanRegion, error) {
+	var regions []scanRegion
+	for _, section := range file.Sections {
+		switch section.Flags & 0xff {
+		case 0x1, 0xc, 0x12: // S_ZEROFILL, S_GB_ZEROFILL, S_THREAD_LOCAL_ZEROFILL
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section data for %s: %v", section.Name, err)
+		}
+		exec := section.Flags&(0x80000000|0x400) != 0 // S_ATTR_PURE_INSTRUCTIONS, S_ATTR_SOME_INSTRUCTIONS
+		regions = append(regions, scanRegion{Arch: arch, Name: section.Name, FileOffset: base + int64(section.Offset), Addr: section.Addr, Data: data, Exec: exec})
+	}
+
+	if segment := file.Segment("__LINKEDIT"); segment != nil {
+		data, err := segment.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading segment data for __LINKEDIT: %v", err)
+		}
+		regions = append(regions, scanRegion{Arch: arch, Name: "__LINKEDIT", FileOffset: base + int64(segment.Offset), Addr: segment.Addr, Data: data})
+	}
+	return regions, nil
+}
+
+// elfRegions returns the sections of an ELF file that occupy file space
+func elfRegions(file *elf.File) ([]scanRegion, error) {
+	arch := elfArchName(file.Machine)
+	var regions []scanRegion
+	for _, section := range file.Sections {
+		if section.Type == elf.SHT_NULL || section.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section data for %s: %v", section.Name, err)
+		}
+		exec := section.Flags&elf.SHF_EXECINSTR != 0
+		regions = append(regions, scanRegion{Arch: arch, Name: section.Name, FileOffset: int64(section.Offset), Addr: section.Addr, Data: data, Exec: exec})
+	}
+	return regions, nil
+}
+
+// peRegions returns the sections of a PE file that occupy file space
+func peRegions(file *pe.File) ([]scanRegion, error) {
+	arch := peArchName(file.Machine)
+	imageBase := peImageBase(file)
+	var regions []scanRegion
+	for _, section := range file.Sections {
+		if section.Size == 0 {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section data for %s: %v", section.Name, err)
+		}
+		exec := section.Characteristics&(pe.IMAGE_SCN_CNT_CODE|pe.IMAGE_SCN_MEM_EXECUTE) != 0
+		regions = append(regions, scanRegion{Arch: arch, Name: section.Name, FileOffset: int64(section.Offset), Addr: imageBase + uint64(section.VirtualAddress), Data: data, Exec: exec})
+	}
+	return regions, nil
+}
+
+// FingerprintSummary counts hits by severity and by rule coverage
+type FingerprintSummary struct {
+	Total   int
+	High    int
+	Medium  int
+	Low     int
+	Covered int
+}
+
+// SummarizeFingerprints counts the given hits
+func SummarizeFingerprints(hits []FingerprintHit) FingerprintSummary {
+	var s FingerprintSummary
+	for _, hit := range hits {
+		s.Total++
+		switch hit.Severity {
+		case SeverityHigh:
+			s.High++
+		case SeverityMedium:
+			s.Medium++
+		default:
+			s.Low++
+		}
+		if hit.Covered {
+			s.Covered++
+		}
+	}
+	return s
+}
+
+func (s FingerprintSummary) String() string {
+	return fmt.Sprintf("%d (high %d, medium %d, low %d, covered by rules %d)", s.Total, s.High, s.Medium, s.Low, s.Covered)
+}
+
+// WriteText writes the residual hits as a table, listing at most limit hits (0 lists all)
+func (r *FingerprintReport) WriteText(w io.Writer, limit int) error {
+	fmt.Fprintf(w, "File:     %s\n", r.File)
+	fmt.Fprintf(w, "Format:   %s\n", r.Format)
+	return writeFingerprintHits(w, r.Hits, limit)
+}
+
+// writeFingerprintHits writes the summary and table of residual hits
+func writeFingerprintHits(w io.Writer, hits []FingerprintHit, limit int) error {
+	fmt.Fprintf(w, "Residual: %s\n", SummarizeFingerprints(hits))
+	if len(hits) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(w, "%-8s %-8s %-14s %-12s %-12s %-7s %s\n", "SEVERITY", "ARCH", "SECTION", "OFFSET", "SIGNATURE", "COVERED", "CONTEXT")
+	for i, hit := range hits {
+		if limit > 0 && i >= limit {
+			fmt.Fprintf(w, "... %d more\n", len(hits)-limit)
+			break
+		}
+		covered := "no"
+		if hit.Covered {
+			covered = "yes"
+		}
+		fmt.Fprintf(w, "%-8s %-8s %-14s 0x%-10x %-12s %-7s %q\n", hit.Severity, hit.Arch, hit.Section, hit.FileOffset, hit.Signature, covered, hit.Context)
+	}
+	return nil
+}
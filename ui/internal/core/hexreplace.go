@@ -8,6 +8,7 @@ import (
 	"fridare-gui/internal/utils"
 	"io"
 	"os"
+	"strings"
 )
 
 // ExecutableFormat represents the type of executable file
@@ -32,69 +33,330 @@ type Replacements struct {
 	Items            []*Replacement
 }
 
+// FitProblem explains why a replacement could not be written into one string
+type FitProblem struct {
+	Section     string `json:"section"`
+	Arch        string `json:"arch,omitempty"`
+	Offset      int    `json:"offset"` // offset of the match inside the section
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+	Reason      string `json:"reason"`
+}
+
+// NameFitError is returned when the new name does not fit into every string
+// it has to replace
+type NameFitError struct {
+	Name     string
+	Problems []FitProblem
+}
+
+func (e *NameFitError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "name %q does not fit into %d string(s):", e.Name, len(e.Problems))
+	for _, p := range e.Problems {
+		location := p.Section
+		if p.Arch != "" {
+			location = p.Arch + " " + location
+		}
+		fmt.Fprintf(&sb, "\n  - %s+0x%x %q -> %q: %s", location, p.Offset, p.Original, p.Replacement, p.Reason)
+	}
+	return sb.String()
+}
+
+// withSection fills in the location of problems found in a section
+func withSection(problems []FitProblem, section, arch string) []FitProblem {
+	for i := range problems {
+		problems[i].Section = section
+		problems[i].Arch = arch
+	}
+	return problems
+}
+
 // HexReplacer handles binary file patching operations
-type HexReplacer struct{}
+type HexReplacer struct {
+	// Rules is the replacement rule set; nil selects the embedded default profile
+	Rules *RuleSet
+	// FridaVersion filters version-constrained rules; empty applies all rules
+	FridaVersion string
+	// Port replaces frida-server's built-in default listen port; 0 leaves it untouched
+	Port int
+	// Signer re-signs patched Mach-O files that carry a code signature; nil leaves
+	// the now invalid signature as is
+	Signer *CodeSigner
+	// Arches thins fat Mach-O files down to these slices (e.g. arm64, arm64e);
+	// empty keeps every slice
+	Arches []string
+}
 
 // NewHexReplacer creates a new hex replacer instance
 func NewHexReplacer() *HexReplacer {
-	return &HexReplacer{}
+	return &HexReplacer{Signer: NewCodeSigner()}
 }
 
 // PatchFile patches a binary file with the given frida new name
 func (hr *HexReplacer) PatchFile(inputFilePath, fridaNewName, outputFilePath string, progressCallback func(float64, string)) error {
-	// Validate frida new name (must be exactly 5 characters, all lowercase)
-	if len(fridaNewName) != 5 || !utils.IsFridaNewName(fridaNewName) {
-		return fmt.Errorf("frida new name must be exactly 5 lowercase alphabetic characters")
+	_, err := hr.PatchFileWithReport(inputFilePath, fridaNewName, outputFilePath, progressCallback)
+	return err
+}
+
+// PatchFileWithReport patches a binary file and returns the report of every replacement made
+func (hr *HexReplacer) PatchFileWithReport(inputFilePath, fridaNewName, outputFilePath string, progressCallback func(float64, string)) (*PatchReport, error) {
+	if progressCallback != nil {
+		progressCallback(0.1, "正在检测文件格式...")
+	}
+
+	sourcePath, removed, cleanup, err := hr.thinInput(inputFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	// Plan every section patch first so nothing is written if the name does not fit
+	report, patches, err := hr.plan(sourcePath, fridaNewName, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	report.Removed = removed
+	if len(report.Problems) > 0 {
+		return report, &NameFitError{Name: fridaNewName, Problems: report.Problems}
 	}
 
 	if progressCallback != nil {
-		progressCallback(0.1, "正在复制文件...")
+		progressCallback(0.8, "正在写入文件...")
+	}
+
+	// Stage the patched copy next to the output and rename it into place only
+	// after it has been synced and verified; on any error the output path
+	// (which may be the input itself) is left untouched
+	staged, err := utils.CreateAtomic(outputFilePath, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+	defer staged.Abort()
+
+	if err := copyInto(staged.File, sourcePath); err != nil {
+		return nil, fmt.Errorf("error copying file: %v", err)
+	}
+	for _, patch := range patches {
+		if _, err := staged.WriteAt(patch.Data, patch.Offset); err != nil {
+			return nil, fmt.Errorf("error writing modified data for %s: %v", patch.Section, err)
+		}
+	}
+	if err := verifyPatches(staged.TempPath(), patches); err != nil {
+		return nil, fmt.Errorf("error verifying patched file: %v", err)
+	}
+	if report.Dynamic != nil {
+		if err := verifyDynamicNames(staged.TempPath()); err != nil {
+			return nil, fmt.Errorf("error verifying renamed symbols: %v", err)
+		}
+	}
+
+	// Patching invalidates the optional header checksum of a PE file
+	if report.Format == "PE" && len(patches) > 0 {
+		report.Checksum, err = updatePEChecksum(staged.TempPath(), staged)
+		if err != nil {
+			return nil, fmt.Errorf("error updating PE checksum: %v", err)
+		}
+	}
+
+	// Patching invalidates the page hashes of a Mach-O code signature
+	resign := hr.Signer != nil && report.Format == "MachO" && isCodeSigned(staged.TempPath())
+	if resign {
+		if progressCallback != nil {
+			progressCallback(0.85, "正在重新签名...")
+		}
+		report.Signature, err = hr.resignStaged(staged)
+		if err != nil {
+			return nil, fmt.Errorf("error re-signing file: %v", err)
+		}
+	}
+
+	if err := staged.Commit(func(tempPath string) error {
+		if resign {
+			return VerifyCodeSignature(tempPath)
+		}
+		if report.Checksum != nil {
+			if err := verifyPEChecksum(tempPath); err != nil {
+				return err
+			}
+		}
+		return verifyPatches(tempPath, patches)
+	}); err != nil {
+		return nil, err
 	}
 
-	// Copy input file to output file
-	if err := copyFile(inputFilePath, outputFilePath); err != nil {
-		return fmt.Errorf("error copying file: %v", err)
+	report.File = outputFilePath
+	if progressCallback != nil {
+		progressCallback(0.9, fmt.Sprintf("已替换 %d 处字符串", report.Count()))
 	}
 
+	// Scan the output for signatures the rules left behind
+	fingerprints, err := NewFingerprintScanner(hr.ruleSet()).Scan(outputFilePath)
+	if err != nil {
+		if progressCallback != nil {
+			progressCallback(0.95, fmt.Sprintf("残留特征扫描失败: %v", err))
+		}
+		return report, nil
+	}
+	report.Residual = fingerprints.Hits
 	if progressCallback != nil {
-		progressCallback(0.3, "正在检测文件格式...")
+		progressCallback(0.95, fmt.Sprintf("残留特征: %s", SummarizeFingerprints(report.Residual)))
+	}
+	return report, nil
+}
+
+// DryRun reports what PatchFile would change without writing any file
+func (hr *HexReplacer) DryRun(inputFilePath, fridaNewName string) (*PatchReport, error) {
+	sourcePath, removed, cleanup, err := hr.thinInput(inputFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	report, _, err := hr.plan(sourcePath, fridaNewName, nil)
+	if err != nil {
+		return nil, err
+	}
+	report.File = inputFilePath
+	report.Removed = removed
+	report.DryRun = true
+	return report, nil
+}
+
+// thinInput writes the slices selected by Arches to a temporary file and
+// returns its path with the removed slices; the input is used as is when
+// Arches is empty or it is not a Mach-O file
+func (hr *HexReplacer) thinInput(inputFilePath string) (string, []string, func(), error) {
+	noop := func() {}
+	if len(hr.Arches) == 0 {
+		return inputFilePath, nil, noop, nil
+	}
+	file, format, err := detectAndOpenFile(inputFilePath)
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("error opening file: %v", err)
+	}
+	if closer, ok := file.(io.Closer); ok {
+		closer.Close()
+	}
+	if format != MachO {
+		return inputFilePath, nil, noop, nil
+	}
+
+	data, err := os.ReadFile(inputFilePath)
+	if err != nil {
+		return "", nil, noop, err
+	}
+	thinned, removed, err := ThinMachO(data, hr.Arches)
+	if err != nil {
+		return "", nil, noop, fmt.Errorf("error thinning file: %v", err)
+	}
+	if len(removed) == 0 {
+		return inputFilePath, nil, noop, nil
+	}
+
+	temp, err := os.CreateTemp("", "fridare-thin-*")
+	if err != nil {
+		return "", nil, noop, err
+	}
+	cleanup := func() { os.Remove(temp.Name()) }
+	_, err = temp.Write(thinned)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, noop, err
+	}
+	return temp.Name(), removed, cleanup, nil
+}
+
+// plan validates the inputs and computes the patched content of every section
+func (hr *HexReplacer) plan(filePath, fridaNewName string, progressCallback func(float64, string)) (*PatchReport, []sectionPatch, error) {
+	// Names up to MaxSafeMagicNameLen never need more room than the original:
+	// matches their shorter replacement cannot be written into are skipped,
+	// not failed. Longer names are checked per string.
+	if err := utils.ValidateMagicName(fridaNewName); err != nil {
+		return nil, nil, fmt.Errorf("invalid frida new name: %v", err)
+	}
+	rules := hr.ruleSet()
+	if err := rules.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid rule set %s: %v", rules.Name, err)
 	}
 
 	// Detect and open file
-	file, format, err := detectAndOpenFile(outputFilePath)
+	file, format, err := detectAndOpenFile(filePath)
 	if err != nil {
-		return fmt.Errorf("error opening file: %v", err)
+		return nil, nil, fmt.Errorf("error opening file: %v", err)
+	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	report := &PatchReport{
+		File:   filePath,
+		Name:   fridaNewName,
+		Format: formatToString(format),
+		Rules:  rules.Name,
 	}
 
 	if progressCallback != nil {
-		progressCallback(0.5, fmt.Sprintf("正在处理 %s 格式文件...", formatToString(format)))
+		progressCallback(0.3, fmt.Sprintf("正在处理 %s 格式文件...", report.Format))
 	}
 
-	// Process based on file format
+	var patches []sectionPatch
 	switch f := file.(type) {
 	case *macho.File:
 		if progressCallback != nil {
-			progressCallback(0.7, "正在修改 MachO 单架构文件...")
+			progressCallback(0.5, "正在修改 MachO 单架构文件...")
 		}
-		return hr.handleSingleArchitecture(f, outputFilePath, fridaNewName, format)
+		patches, err = hr.handleSingleArchitecture(f, fridaNewName, format, report)
 	case *macho.FatFile:
 		if progressCallback != nil {
-			progressCallback(0.7, "正在修改 MachO 多架构文件...")
+			progressCallback(0.5, "正在修改 MachO 多架构文件...")
 		}
-		return hr.handleMultipleArchitectures(f, outputFilePath, fridaNewName, format)
+		patches, err = hr.handleMultipleArchitectures(f, fridaNewName, format, report)
 	case *elf.File:
 		if progressCallback != nil {
-			progressCallback(0.7, "正在修改 ELF 文件...")
+			progressCallback(0.5, "正在修改 ELF 文件...")
 		}
-		return hr.handleELFFile(f, outputFilePath, fridaNewName, format)
+		patches, err = hr.handleELFFile(f, fridaNewName, format, report)
 	case *pe.File:
 		if progressCallback != nil {
-			progressCallback(0.7, "正在修改 PE 文件...")
+			progressCallback(0.5, "正在修改 PE 文件...")
 		}
-		return hr.handlePEFile(f, outputFilePath, fridaNewName, format)
+		patches, err = hr.handlePEFile(f, fridaNewName, format, report)
 	default:
-		return fmt.Errorf("unsupported file type")
+		return nil, nil, fmt.Errorf("unsupported file type")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Optionally rewrite the default port constant in code
+	if hr.Port != 0 && hr.Port != DefaultFridaPort {
+		if progressCallback != nil {
+			progressCallback(0.6, "正在定位默认端口...")
+		}
+		portPlan, err := locatePortInFile(file, hr.Port)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error patching default port: %v", err)
+		}
+		report.Port = portPlan
+		for _, site := range portPlan.Sites {
+			report.Entries = append(report.Entries, PatchEntry{
+				Format:         report.Format,
+				Arch:           site.Arch,
+				Section:        site.Section,
+				Rule:           fmt.Sprintf("port:%s", site.Kind),
+				FileOffset:     site.FileOffset,
+				VirtualAddress: site.VirtualAddress,
+				Original:       site.Original,
+				Replacement:    site.Replacement,
+			})
+			patches = append(patches, sectionPatch{Section: site.Section, Offset: site.FileOffset, Data: site.Replacement})
+		}
 	}
+	return report, patches, nil
 }
 
 // DescribeFile returns a description of the file format and architecture
@@ -127,33 +389,156 @@ func detectAndOpenFile(filePath string) (interface{}, ExecutableFormat, error) {
 	return nil, 0, fmt.Errorf("unsupported file format")
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
+// copyInto copies the content of src into dst
+func copyInto(dst io.Writer, src string) error {
 	sourceFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
+	_, err = io.Copy(dst, sourceFile)
+	return err
+}
+
+// verifyPatches checks that every patch reads back from filePath and that the
+// file still parses as an executable
+func verifyPatches(filePath string, patches []sectionPatch) error {
+	f, err := os.Open(filePath)
 	if err != nil {
 		return err
 	}
-	defer destFile.Close()
+	defer f.Close()
+
+	for _, patch := range patches {
+		data := make([]byte, len(patch.Data))
+		if _, err := f.ReadAt(data, patch.Offset); err != nil {
+			return fmt.Errorf("error reading back %s: %v", patch.Section, err)
+		}
+		if !bytesEqual(data, patch.Data) {
+			return fmt.Errorf("%s does not match the written data", patch.Section)
+		}
+	}
 
-	_, err = io.Copy(destFile, sourceFile)
+	file, _, err := detectAndOpenFile(filePath)
+	if err != nil {
+		return fmt.Errorf("patched file is no longer a valid executable: %v", err)
+	}
+	if closer, ok := file.(io.Closer); ok {
+		closer.Close()
+	}
+	return nil
+}
+
+// verifyDynamicNames checks that the symbol tables rebuilt for renamed
+// names still resolve every exported symbol
+func verifyDynamicNames(filePath string) error {
+	file, _, err := detectAndOpenFile(filePath)
 	if err != nil {
 		return err
 	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	switch f := file.(type) {
+	case *elf.File:
+		return verifyELFDynamic(f)
+	case *pe.File:
+		return verifyPEExports(f)
+	case *macho.File:
+		return verifyMachONames(f)
+	case *macho.FatFile:
+		for _, arch := range f.Arches {
+			if err := verifyMachONames(arch.File); err != nil {
+				return fmt.Errorf("%s: %v", machoArchName(arch.Cpu, arch.SubCpu), err)
+			}
+		}
+	}
+	return nil
+}
 
-	// Set executable permissions
-	return os.Chmod(dst, 0755)
+// resignStaged replaces the content of a staged Mach-O file with its re-signed copy
+func (hr *HexReplacer) resignStaged(staged *utils.AtomicFile) ([]SignedSlice, error) {
+	data, err := os.ReadFile(staged.TempPath())
+	if err != nil {
+		return nil, err
+	}
+	signed, slices, err := hr.Signer.Sign(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := staged.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err := staged.WriteAt(signed, 0); err != nil {
+		return nil, err
+	}
+	return slices, nil
+}
+
+// isCodeSigned reports whether every image of a Mach-O file carries a code signature
+func isCodeSigned(filePath string) bool {
+	file, _, err := detectAndOpenFile(filePath)
+	if err != nil {
+		return false
+	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return hasCodeSignature(file)
+}
+
+// sectionPatch is the modified content of a section and its file offset
+type sectionPatch struct {
+	Section string
+	Offset  int64
+	Data    []byte
+}
+
+// addPatches appends patches that may overlap earlier ones, copying their
+// data into the overlapped patches so every patch reads back as written
+func addPatches(patches, added []sectionPatch) []sectionPatch {
+	for _, patch := range added {
+		for _, earlier := range patches {
+			copyOverlap(earlier.Data, earlier.Offset, patch.Data, patch.Offset)
+		}
+		patches = append(patches, patch)
+	}
+	return patches
+}
+
+// copyOverlap copies the part of src (at file offset srcOffset) that
+// overlaps dst (at file offset dstOffset) into dst
+func copyOverlap(dst []byte, dstOffset int64, src []byte, srcOffset int64) {
+	start := max(dstOffset, srcOffset)
+	end := min(dstOffset+int64(len(dst)), srcOffset+int64(len(src)))
+	if start < end {
+		copy(dst[start-dstOffset:end-dstOffset], src[start-srcOffset:end-srcOffset])
+	}
 }
 
 // handlePEFile handles PE format files
-func (hr *HexReplacer) handlePEFile(file *pe.File, outputFilePath, fridaNewName string, format ExecutableFormat) error {
-	replacementsList := buildReplacements(fridaNewName, format)
+func (hr *HexReplacer) handlePEFile(file *pe.File, fridaNewName string, format ExecutableFormat, report *PatchReport) ([]sectionPatch, error) {
+	arch := peArchName(file.Machine)
+	replacementsList, err := hr.buildReplacements(fridaNewName, format, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	imageBase := peImageBase(file)
+	var patches []sectionPatch
+	var exportItems, resourceItems []*Replacement
 	for _, replacements := range replacementsList {
+		switch replacements.SectionName {
+		case ".edata":
+			exportItems = replacements.Items
+			continue
+		case ".rsrc":
+			resourceItems = replacements.Items
+			continue
+		}
+
 		section := file.Section(replacements.SectionName)
 		if section == nil {
 			continue // Skip missing sections
@@ -161,21 +546,59 @@ func (hr *HexReplacer) handlePEFile(file *pe.File, outputFilePath, fridaNewName
 
 		data, err := section.Data()
 		if err != nil {
-			return fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
+			return nil, fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
 		}
 
-		modifiedData := replaceInSection(data, replacements.Items)
-		if err := writeModifiedSection(outputFilePath, int64(section.Offset), modifiedData); err != nil {
-			return fmt.Errorf("error writing modified data for %s: %v", replacements.SectionName, err)
-		}
+		modifiedData, matches, problems, skipped := replaceInSection(data, replacements.Items, nil, false)
+		report.addSection(arch, replacements.SectionName, int64(section.Offset), imageBase+uint64(section.VirtualAddress), matches, problems)
+		report.addSkipped(arch, replacements.SectionName, skipped)
+		patches = append(patches, sectionPatch{Section: replacements.SectionName, Offset: int64(section.Offset), Data: modifiedData})
 	}
-	return nil
+
+	// The export directory and resources are rewritten structurally on top
+	// of the section replacements; the export stage also runs without rules
+	// because section rules may have renamed export names out of order
+	exportPatches, err := planPEExports(file, exportItems, arch, report, patches)
+	if err != nil {
+		return nil, fmt.Errorf("error renaming exports: %v", err)
+	}
+	patches = addPatches(patches, exportPatches)
+	resourcePatches, err := planPEResources(file, resourceItems, arch, report, patches)
+	if err != nil {
+		return nil, fmt.Errorf("error renaming resources: %v", err)
+	}
+	return addPatches(patches, resourcePatches), nil
 }
 
 // handleELFFile handles ELF format files
-func (hr *HexReplacer) handleELFFile(file *elf.File, outputFilePath, fridaNewName string, format ExecutableFormat) error {
-	replacementsList := buildReplacements(fridaNewName, format)
+func (hr *HexReplacer) handleELFFile(file *elf.File, fridaNewName string, format ExecutableFormat, report *PatchReport) ([]sectionPatch, error) {
+	arch := elfArchName(file.Machine)
+	replacementsList, err := hr.buildReplacements(fridaNewName, format, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	// Linkers merge ELF strings into the tails of longer ones, so rewrites
+	// that shift a string need to know which offsets are referenced. Where
+	// code references are not decoded only same-length replacements are safe.
+	refs, err := elfReferences(file)
+	if err != nil {
+		return nil, err
+	}
+	fixedLength := !elfReferencesComplete(file.Machine)
+
+	var patches []sectionPatch
 	for _, replacements := range replacementsList {
+		// Dynamic strings are renamed structurally so symbol lookups keep working
+		if replacements.SectionName == ".dynstr" {
+			dynamicPatches, err := planELFDynamic(file, replacements.Items, arch, report)
+			if err != nil {
+				return nil, fmt.Errorf("error renaming dynamic strings: %v", err)
+			}
+			patches = append(patches, dynamicPatches...)
+			continue
+		}
+
 		section := file.Section(replacements.SectionName)
 		if section == nil {
 			continue // Skip missing sections
@@ -183,21 +606,37 @@ func (hr *HexReplacer) handleELFFile(file *elf.File, outputFilePath, fridaNewNam
 
 		data, err := section.Data()
 		if err != nil {
-			return fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
+			return nil, fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
 		}
 
-		modifiedData := replaceInSection(data, replacements.Items)
-		if err := writeModifiedSection(outputFilePath, int64(section.Offset), modifiedData); err != nil {
-			return fmt.Errorf("error writing modified data for %s: %v", replacements.SectionName, err)
-		}
+		modifiedData, matches, problems, skipped := replaceInSection(data, replacements.Items, refs.offsets(section.Addr, section.Size), fixedLength)
+		report.addSection(arch, replacements.SectionName, int64(section.Offset), section.Addr, matches, problems)
+		report.addSkipped(arch, replacements.SectionName, skipped)
+		patches = append(patches, sectionPatch{Section: replacements.SectionName, Offset: int64(section.Offset), Data: modifiedData})
 	}
-	return nil
+	return patches, nil
 }
 
 // handleSingleArchitecture handles single architecture MachO files
-func (hr *HexReplacer) handleSingleArchitecture(file *macho.File, outputFilePath, fridaNewName string, format ExecutableFormat) error {
-	replacementsList := buildReplacements(fridaNewName, format)
+func (hr *HexReplacer) handleSingleArchitecture(file *macho.File, fridaNewName string, format ExecutableFormat, report *PatchReport) ([]sectionPatch, error) {
+	arch := machoArchName(file.Cpu, file.SubCpu)
+	replacementsList, err := hr.buildReplacements(fridaNewName, format, arch)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []sectionPatch
 	for _, replacements := range replacementsList {
+		// Linked names are renamed structurally so dyld keeps binding
+		if replacements.SectionName == "__LINKEDIT" {
+			namePatches, err := planMachONames(file, 0, replacements.Items, arch, report)
+			if err != nil {
+				return nil, fmt.Errorf("error renaming linked names: %v", err)
+			}
+			patches = append(patches, namePatches...)
+			continue
+		}
+
 		section := file.Section(replacements.SectionName)
 		if section == nil {
 			continue // Skip missing sections
@@ -205,31 +644,51 @@ func (hr *HexReplacer) handleSingleArchitecture(file *macho.File, outputFilePath
 
 		data, err := section.Data()
 		if err != nil {
-			return fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
+			return nil, fmt.Errorf("error reading section data for %s: %v", replacements.SectionName, err)
 		}
 
-		modifiedData := replaceInSection(data, replacements.Items)
-		if err := writeModifiedSection(outputFilePath, int64(section.Offset), modifiedData); err != nil {
-			return fmt.Errorf("error writing modified data for %s: %v", replacements.SectionName, err)
-		}
+		modifiedData, matches, problems, skipped := replaceInSection(data, replacements.Items, nil, false)
+		report.addSection(arch, replacements.SectionName, int64(section.Offset), section.Addr, matches, problems)
+		report.addSkipped(arch, replacements.SectionName, skipped)
+		patches = append(patches, sectionPatch{Section: replacements.SectionName, Offset: int64(section.Offset), Data: modifiedData})
 	}
-	return nil
+	return patches, nil
 }
 
 // handleMultipleArchitectures handles fat MachO files with multiple architectures
-func (hr *HexReplacer) handleMultipleArchitectures(fatFile *macho.FatFile, filePath, fridaNewName string, format ExecutableFormat) error {
+func (hr *HexReplacer) handleMultipleArchitectures(fatFile *macho.FatFile, fridaNewName string, format ExecutableFormat, report *PatchReport) ([]sectionPatch, error) {
+	var patches []sectionPatch
 	for _, arch := range fatFile.Arches {
-		if err := hr.patchArchitecture(arch, filePath, fridaNewName, format); err != nil {
-			return err
+		entries, problems := len(report.Entries), len(report.Problems)
+		archPatches, err := hr.patchArchitecture(arch, fridaNewName, format, report)
+		if err != nil {
+			return nil, err
 		}
+		report.addSlice(machoArchName(arch.Cpu, arch.SubCpu), int64(arch.Offset), int64(arch.Size), entries, problems)
+		patches = append(patches, archPatches...)
 	}
-	return nil
+	return patches, nil
 }
 
 // patchArchitecture patches a specific architecture in a fat binary
-func (hr *HexReplacer) patchArchitecture(arch macho.FatArch, filePath, fridaNewName string, format ExecutableFormat) error {
-	replacementsList := buildReplacements(fridaNewName, format)
+func (hr *HexReplacer) patchArchitecture(arch macho.FatArch, fridaNewName string, format ExecutableFormat, report *PatchReport) ([]sectionPatch, error) {
+	archName := machoArchName(arch.Cpu, arch.SubCpu)
+	replacementsList, err := hr.buildReplacements(fridaNewName, format, archName)
+	if err != nil {
+		return nil, err
+	}
+
+	var patches []sectionPatch
 	for _, replacements := range replacementsList {
+		if replacements.SectionName == "__LINKEDIT" {
+			namePatches, err := planMachONames(arch.File, int64(arch.Offset), replacements.Items, archName, report)
+			if err != nil {
+				return nil, fmt.Errorf("error renaming linked names in architecture %s: %v", archName, err)
+			}
+			patches = append(patches, namePatches...)
+			continue
+		}
+
 		section := arch.Section(replacements.SectionName)
 		if section == nil {
 			continue // Skip missing sections
@@ -237,113 +696,248 @@ func (hr *HexReplacer) patchArchitecture(arch macho.FatArch, filePath, fridaNewN
 
 		data, err := section.Data()
 		if err != nil {
-			return fmt.Errorf("error reading section data for %s in architecture %s: %v", replacements.SectionName, arch.Cpu.String(), err)
+			return nil, fmt.Errorf("error reading section data for %s in architecture %s: %v", replacements.SectionName, arch.Cpu.String(), err)
 		}
 
-		modifiedData := replaceInSection(data, replacements.Items)
-		if err := writeModifiedSection(filePath, int64(arch.Offset+section.Offset), modifiedData); err != nil {
-			return fmt.Errorf("error writing modified data for %s in architecture %s: %v", replacements.SectionName, arch.Cpu.String(), err)
-		}
+		modifiedData, matches, problems, skipped := replaceInSection(data, replacements.Items, nil, false)
+		report.addSection(archName, replacements.SectionName, int64(arch.Offset+section.Offset), section.Addr, matches, problems)
+		report.addSkipped(archName, replacements.SectionName, skipped)
+		patches = append(patches, sectionPatch{Section: replacements.SectionName, Offset: int64(arch.Offset + section.Offset), Data: modifiedData})
 	}
-	return nil
+	return patches, nil
 }
 
-// buildReplacements builds replacement rules based on file format
-func buildReplacements(fridaNewName string, format ExecutableFormat) []Replacements {
-	switch format {
-	case MachO:
-		return []Replacements{
-			{
-				ExecutableFormat: format,
-				SectionName:      "__cstring",
-				Items: []*Replacement{
-					{Old: []byte("frida_server_"), New: []byte(fridaNewName + "_server_")},
-					{Old: []byte("frida-server-main-loop"), New: []byte(fridaNewName + "-server-main-loop")},
-					{Old: []byte("frida-main-loop"), New: []byte(fridaNewName + "-main-loop")},
-					{Old: []byte("frida:rpc"), New: []byte(fridaNewName + ":rpc")},
-					{Old: []byte("frida-agent.dylib"), New: []byte(fridaNewName + "-agent.dylib")},
-					{Old: []byte("/usr/lib/frida/"), New: []byte("/usr/lib/" + fridaNewName + "/")},
-					{Old: []byte("gum-"), New: []byte(fridaNewName[:3] + "-")},
-				},
-			},
-			{
-				ExecutableFormat: format,
-				SectionName:      "__const",
-				Items: []*Replacement{
-					{Old: []byte("frida:rpc"), New: []byte(fridaNewName + ":rpc")},
-				},
-			},
-		}
-	case ELF:
-		return []Replacements{
-			{
-				ExecutableFormat: format,
-				SectionName:      ".rodata",
-				Items: []*Replacement{
-					{Old: []byte("frida_server_"), New: []byte(fridaNewName + "_server_")},
-					{Old: []byte("frida-main-loop"), New: []byte(fridaNewName + "-main-loop")},
-					{Old: []byte("frida:rpc"), New: []byte(fridaNewName + ":rpc")},
-					{Old: []byte("frida-agent-<arch>.so"), New: []byte(fridaNewName + "-agent-<arch>.so")},
-					{Old: []byte("frida-agent-arm.so"), New: []byte(fridaNewName + "-agent-arm.so")},
-					{Old: []byte("frida-agent-arm64.so"), New: []byte(fridaNewName + "-agent-arm64.so")},
-					{Old: []byte("frida-agent-32.so"), New: []byte(fridaNewName + "-agent-32.so")},
-					{Old: []byte("frida-agent-64.so"), New: []byte(fridaNewName + "-agent-64.so")},
-					{Old: []byte("gum-"), New: []byte(fridaNewName[:3] + "-")},
-				},
-			},
-			{
-				ExecutableFormat: format,
-				SectionName:      ".text",
-				Items: []*Replacement{
-					{Old: []byte("frida:rpc"), New: []byte(fridaNewName + ":rpc")},
-					{Old: []byte("gum-"), New: []byte(fridaNewName[:3] + "-")},
-				},
-			},
-		}
-	case PE:
-		return []Replacements{
-			{
-				ExecutableFormat: format,
-				SectionName:      ".rdata",
-				Items: []*Replacement{
-					{Old: []byte("frida-"), New: []byte(fridaNewName + "-")},
-					{Old: []byte("frida_"), New: []byte(fridaNewName + "_")},
-					{Old: []byte("frida_server_"), New: []byte(fridaNewName + "_server_")},
-					{Old: []byte("frida-main-loop"), New: []byte(fridaNewName + "-main-loop")},
-					{Old: []byte("gum-"), New: []byte(fridaNewName[:3] + "-")},
-					{Old: []byte("frida-thread"), New: []byte(fridaNewName + "-thread")},
-					{Old: []byte("frida:rpc"), New: []byte(fridaNewName + ":rpc")},
-					{Old: []byte("frida-agent"), New: []byte(fridaNewName + "-agent")},
-				},
-			},
-		}
+// peImageBase returns the preferred load address of a PE file
+func peImageBase(file *pe.File) uint64 {
+	switch oh := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
 	}
-	return nil
+	return 0
 }
 
-// replaceInSection performs replacements in a section's data
-func replaceInSection(data []byte, replacements []*Replacement) []byte {
+// ruleSet returns the active rule set
+func (hr *HexReplacer) ruleSet() *RuleSet {
+	if hr.Rules == nil {
+		return DefaultRuleSet()
+	}
+	return hr.Rules
+}
+
+// buildReplacements resolves the active rule set for the given format and architecture
+func (hr *HexReplacer) buildReplacements(fridaNewName string, format ExecutableFormat, arch string) ([]Replacements, error) {
+	return hr.ruleSet().buildReplacements(fridaNewName, format, arch, hr.FridaVersion)
+}
+
+// sectionMatch records one replacement made inside a section
+type sectionMatch struct {
+	Offset      int // offset inside the section
+	Rule        string
+	Original    []byte
+	Replacement []byte
+}
+
+// replaceInSection performs replacements in a section's data. Same-length
+// replacements are written in place; any other length rewrites the whole
+// NUL-terminated string containing the match, padding shorter strings with
+// NUL and using trailing NUL slack for longer ones. refs holds the section
+// offsets the file is known to reference (nil when unknown); strings
+// referenced from inside a rewritten string must keep reading the same.
+// Longer matches that cannot be rewritten safely are returned as problems.
+// Shorter ones are returned as skipped and left untouched: a short name never
+// needs more room than the original, so it must not fail the patch. With
+// fixedLength set the references are not known well enough to shift a string
+// and every match that changes its length is skipped.
+func replaceInSection(data []byte, replacements []*Replacement, refs map[int]bool, fixedLength bool) ([]byte, []sectionMatch, []FitProblem, []FitProblem) {
 	modifiedData := make([]byte, len(data))
 	copy(modifiedData, data)
 
+	var matches []sectionMatch
+	var problems, skipped []FitProblem
 	for _, replacement := range replacements {
 		oldBytes := replacement.Old
 		newBytes := replacement.New
 
 		for i := 0; i <= len(modifiedData)-len(oldBytes); i++ {
-			if bytesEqual(modifiedData[i:i+len(oldBytes)], oldBytes) {
-				replacementBytes := make([]byte, len(oldBytes))
-				copy(replacementBytes, newBytes)
-				// Pad with zeros if new bytes are shorter
-				for j := len(newBytes); j < len(oldBytes); j++ {
-					replacementBytes[j] = 0
+			if !bytesEqual(modifiedData[i:i+len(oldBytes)], oldBytes) {
+				continue
+			}
+
+			if len(newBytes) == len(oldBytes) {
+				copy(modifiedData[i:i+len(oldBytes)], newBytes)
+				matches = append(matches, sectionMatch{
+					Offset:      i,
+					Rule:        string(oldBytes),
+					Original:    append([]byte(nil), oldBytes...),
+					Replacement: append([]byte(nil), newBytes...),
+				})
+				i += len(oldBytes) - 1
+				continue
+			}
+
+			if fixedLength {
+				skipped = append(skipped, FitProblem{
+					Offset:      i,
+					Original:    string(oldBytes),
+					Replacement: string(newBytes),
+					Reason:      "string references in the code of this architecture are not decoded, only same-length replacements are applied",
+				})
+				i += len(oldBytes) - 1
+				continue
+			}
+
+			match, problem := rewriteCString(modifiedData, i, oldBytes, newBytes, refs)
+			if problem != nil {
+				if len(newBytes) < len(oldBytes) {
+					skipped = append(skipped, *problem)
+				} else {
+					problems = append(problems, *problem)
 				}
-				copy(modifiedData[i:i+len(oldBytes)], replacementBytes)
+				i += len(oldBytes) - 1
+				continue
 			}
+			matches = append(matches, *match)
+			i += len(newBytes) - 1
 		}
 	}
 
-	return modifiedData
+	return modifiedData, matches, problems, skipped
+}
+
+// rewriteCString replaces the match of oldBytes at offset inside the C string
+// containing it, shifting the rest of the string and keeping it NUL-terminated
+func rewriteCString(data []byte, offset int, oldBytes, newBytes []byte, refs map[int]bool) (*sectionMatch, *FitProblem) {
+	start := offset
+	for start > 0 && data[start-1] != 0 {
+		start--
+	}
+	end := offset + len(oldBytes)
+	for end < len(data) && data[end] != 0 {
+		end++
+	}
+
+	problem := &FitProblem{
+		Offset:      offset,
+		Original:    string(data[start:min(end, len(data))]),
+		Replacement: string(newBytes),
+	}
+	if end >= len(data) {
+		problem.Reason = "string is not NUL-terminated inside the section"
+		return nil, problem
+	}
+	if !isPrintableCString(data[start:end]) {
+		problem.Reason = "match is not inside a printable C string"
+		return nil, problem
+	}
+
+	rewritten := make([]byte, 0, end-start+len(newBytes))
+	rewritten = append(rewritten, data[start:offset]...)
+	rewritten = append(rewritten, newBytes...)
+	rewritten = append(rewritten, data[offset+len(oldBytes):end]...)
+	problem.Replacement = string(rewritten)
+
+	if !equalFormatDirectives(data[start:end], rewritten) {
+		problem.Reason = "replacement changes the format directives of the string"
+		return nil, problem
+	}
+
+	// Bytes available for the string and its terminator: the original string,
+	// its terminator and the NUL run that follows it. A lone NUL after the
+	// terminator is usually the deduplicated "" literal, so the last NUL of a
+	// run that does not reach the end of the section is never used, nor is
+	// any NUL the file references.
+	available := end - start + 1
+	slack := 0
+	j := end + 1
+	for ; j < len(data) && data[j] == 0 && !refs[j]; j++ {
+		slack++
+	}
+	if j < len(data) && data[j] != 0 && slack > 0 {
+		slack--
+	}
+	available += slack
+	if len(rewritten)+1 > available {
+		problem.Reason = fmt.Sprintf("needs %d bytes but only %d are available (string, terminator and trailing NUL padding)", len(rewritten)+1, available)
+		return nil, problem
+	}
+
+	region := data[start : start+max(len(rewritten)+1, end-start+1)]
+	updated := make([]byte, len(region))
+	copy(updated, rewritten)
+
+	// Strings referenced from inside the rewritten one (merged into its tail
+	// by the linker) must still read back the same; those starting before
+	// the match are renamed along with it
+	starts := map[uint32]bool{0: true}
+	renamed := map[uint32]string{0: string(rewritten)}
+	for p := range region {
+		if refs[start+p] {
+			starts[uint32(p)] = true
+			if p <= offset-start {
+				renamed[uint32(p)] = string(rewritten[p:])
+			}
+		}
+	}
+	if shared := sharedStringProblems(region, updated, starts, renamed); len(shared) > 0 {
+		problem.Reason = fmt.Sprintf("string shares its bytes with a string referenced %d byte(s) into it", shared[0].Offset)
+		return nil, problem
+	}
+
+	match := &sectionMatch{
+		Offset:      start,
+		Rule:        string(oldBytes),
+		Original:    append([]byte(nil), region...),
+		Replacement: updated,
+	}
+	copy(region, updated)
+	return match, nil
+}
+
+// isPrintableCString reports whether b looks like text rather than code or data
+func isPrintableCString(b []byte) bool {
+	for _, c := range b {
+		if (c < 0x20 || c > 0x7e) && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// equalFormatDirectives reports whether a and b contain the same printf
+// directives in the same order, so prefixes like "gum-" used in format
+// strings keep their arguments intact
+func equalFormatDirectives(a, b []byte) bool {
+	da, db := formatDirectives(a), formatDirectives(b)
+	if len(da) != len(db) {
+		return false
+	}
+	for i := range da {
+		if da[i] != db[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDirectives extracts the printf conversion directives of s
+func formatDirectives(s []byte) []string {
+	var directives []string
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		j := i + 1
+		for j < len(s) && strings.IndexByte("#0- +'.123456789*hlLqjzt", s[j]) >= 0 {
+			j++
+		}
+		if j < len(s) {
+			directives = append(directives, string(s[i:j+1]))
+		}
+		i = j
+	}
+	return directives
 }
 
 // bytesEqual compares two byte slices for equality
@@ -359,18 +953,6 @@ func bytesEqual(a, b []byte) bool {
 	return true
 }
 
-// writeModifiedSection writes modified data to a specific offset in the file
-func writeModifiedSection(filePath string, offset int64, data []byte) error {
-	f, err := os.OpenFile(filePath, os.O_RDWR, 0)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	_, err = f.WriteAt(data, offset)
-	return err
-}
-
 // formatToString converts ExecutableFormat to string
 func formatToString(format ExecutableFormat) string {
 	switch format {
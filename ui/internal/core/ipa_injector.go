@@ -0,0 +1,495 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/macho"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"fridare-gui/internal/utils"
+)
+
+// IPA 重新签名方式
+const (
+	IPASigningAdhoc = "adhoc" // ad-hoc 签名 gadget 和主程序并重建资源封印
+	IPASigningNone  = "none"  // 不签名，输出外部签名清单
+)
+
+// IPAInjector 向IPA注入frida-gadget: 将gadget改名后放入 Frameworks/，
+// 在主程序的每个架构切片添加 LC_LOAD_WEAK_DYLIB，写入gadget配置并重新打包
+//
+// 加载命令写在头部填充区中，文件中其余偏移不变；ad-hoc 签名的IPA只能在越狱或
+// TrollStore 等环境运行，正常设备需使用外部签名工具按清单重新签名
+type IPAInjector struct {
+	InputPath   string
+	OutputPath  string
+	MagicName   string
+	GadgetPath  string // frida-gadget dylib (FridaGadget.dylib)
+	PatchGadget bool   // 使用 HexReplacer 魔改gadget，已魔改的gadget不需要
+	GadgetName  string // 注入的dylib名 (不含.dylib后缀)，默认 <魔改名>Gadget
+	Config      GadgetConfig
+	Signing     string // IPASigningAdhoc (默认) 或 IPASigningNone
+	Result      *IPAInjectResult
+}
+
+// IPAInjectResult 注入结果
+type IPAInjectResult struct {
+	Bundle       string        // Payload/<名称>.app
+	BundleID     string        // CFBundleIdentifier
+	Executable   string        // 主程序在IPA中的路径
+	DylibPath    string        // 加载命令中的gadget路径
+	Slices       []DylibSlice  // 添加了加载命令的主程序切片
+	Files        []string      // 写入的gadget、配置和脚本
+	GadgetReport *PatchReport  // PatchGadget 时gadget的魔改报告
+	Signed       []SignedSlice // ad-hoc 签名的主程序切片
+	Manifest     string        // IPASigningNone 时写出的外部签名清单
+	Warnings     []string
+}
+
+// IPASigningManifest 外部签名清单，按顺序签名 SignOrder 中的文件
+type IPASigningManifest struct {
+	IPA          string   `json:"ipa"`
+	Bundle       string   `json:"bundle"`
+	BundleID     string   `json:"bundle_id"`
+	Executable   string   `json:"executable"`
+	SignOrder    []string `json:"sign_order"`
+	Entitlements string   `json:"entitlements,omitempty"` // 主程序原有权限plist
+}
+
+// NewIPAInjector 创建IPA注入器，默认以 listen 模式监听 127.0.0.1:27042 并 ad-hoc 签名
+func NewIPAInjector(inputPath, outputPath, magicName string) *IPAInjector {
+	return &IPAInjector{
+		InputPath:   inputPath,
+		OutputPath:  outputPath,
+		MagicName:   magicName,
+		PatchGadget: true,
+		Config: GadgetConfig{
+			Mode:    "listen",
+			Address: "127.0.0.1",
+			Port:    27042,
+			OnLoad:  "wait",
+		},
+		Signing: IPASigningAdhoc,
+	}
+}
+
+// gadgetName 返回注入的dylib名
+func (ii *IPAInjector) gadgetName() string {
+	if ii.GadgetName != "" {
+		return ii.GadgetName
+	}
+	return ii.MagicName + "Gadget"
+}
+
+// Inject 执行注入
+func (ii *IPAInjector) Inject(progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始注入IPA - 输入: %s, 输出: %s, 魔改名: %s", ii.InputPath, ii.OutputPath, ii.MagicName)
+	if ii.MagicName == "" {
+		return fmt.Errorf("未指定魔改名称")
+	}
+	if ii.GadgetPath == "" {
+		return fmt.Errorf("未指定frida-gadget库")
+	}
+	if ii.Signing == "" {
+		ii.Signing = IPASigningAdhoc
+	}
+	if ii.Signing != IPASigningAdhoc && ii.Signing != IPASigningNone {
+		return fmt.Errorf("不支持的签名方式: %s", ii.Signing)
+	}
+
+	progressCallback(0.1, "读取IPA...")
+	reader, err := zip.OpenReader(ii.InputPath)
+	if err != nil {
+		return fmt.Errorf("打开IPA失败: %v", err)
+	}
+	defer reader.Close()
+
+	result := &IPAInjectResult{}
+	ii.Result = result
+	for _, f := range reader.File {
+		if parts := strings.Split(f.Name, "/"); len(parts) > 2 && parts[0] == "Payload" && strings.HasSuffix(parts[1], ".app") {
+			result.Bundle = "Payload/" + parts[1]
+			break
+		}
+	}
+	if result.Bundle == "" {
+		return fmt.Errorf("IPA中没有 Payload/*.app")
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		if rel, ok := strings.CutPrefix(f.Name, result.Bundle+"/"); ok && rel != "" && !strings.HasSuffix(rel, "/") {
+			files[rel] = f
+		}
+	}
+
+	// 1. 读取Info.plist确定主程序
+	infoFile := files["Info.plist"]
+	if infoFile == nil {
+		return fmt.Errorf("%s 中没有Info.plist", result.Bundle)
+	}
+	infoPlist, err := readZipFile(infoFile)
+	if err != nil {
+		return fmt.Errorf("读取Info.plist失败: %v", err)
+	}
+	executable := strings.TrimSuffix(path.Base(result.Bundle), ".app")
+	if info, err := ParseEntitlements(infoPlist); err == nil {
+		if name, ok := info["CFBundleExecutable"].(string); ok && name != "" {
+			executable = name
+		}
+		result.BundleID, _ = info["CFBundleIdentifier"].(string)
+	} else {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("无法解析Info.plist (%v)，按包名假定主程序为 %s", err, executable))
+	}
+	executableFile := files[executable]
+	if executableFile == nil {
+		return fmt.Errorf("%s 中没有主程序 %s", result.Bundle, executable)
+	}
+	result.Executable = executableFile.Name
+	log.Printf("INFO: 应用: %s (%s), 主程序: %s", result.Bundle, result.BundleID, result.Executable)
+
+	// 2. 在主程序中添加加载gadget的命令
+	progressCallback(0.2, "添加LC_LOAD_WEAK_DYLIB...")
+	name := ii.gadgetName()
+	result.DylibPath = "@executable_path/Frameworks/" + name + ".dylib"
+	executableData, err := readZipFile(executableFile)
+	if err != nil {
+		return fmt.Errorf("读取主程序失败: %v", err)
+	}
+	executableData, result.Slices, err = insertLoadDylib(executableData, result.DylibPath, true)
+	if err != nil {
+		return fmt.Errorf("添加加载命令失败: %v", err)
+	}
+	var executableArches []string
+	for _, slice := range result.Slices {
+		executableArches = append(executableArches, slice.Arch)
+		if slice.Encrypted {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("主程序 %s 切片已加密 (App Store)，需先解密才能在重新签名后运行", slice.Arch))
+		}
+	}
+	log.Printf("INFO: 已添加 %s (%s)", result.DylibPath, strings.Join(executableArches, ", "))
+
+	// 3. 准备gadget
+	progressCallback(0.3, "准备frida-gadget...")
+	tempDir, err := os.MkdirTemp("", "fridare-ipa-")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	gadgetPath := filepath.Join(tempDir, name+".dylib")
+	if ii.PatchGadget {
+		result.GadgetReport, err = NewHexReplacer().PatchFileWithReport(ii.GadgetPath, ii.MagicName, gadgetPath, nil)
+		if err != nil {
+			return fmt.Errorf("魔改gadget失败: %v", err)
+		}
+		log.Printf("INFO: gadget已魔改，替换 %d 处字符串", result.GadgetReport.Count())
+	} else if err := utils.CopyFile(ii.GadgetPath, gadgetPath); err != nil {
+		return fmt.Errorf("复制gadget失败: %v", err)
+	}
+	gadgetArches, err := machoDylibArches(gadgetPath)
+	if err != nil {
+		return fmt.Errorf("检查gadget失败: %v", err)
+	}
+	for _, arch := range executableArches {
+		if !slices.Contains(gadgetArches, arch) {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("gadget缺少主程序的 %s 架构 (gadget: %s)", arch, strings.Join(gadgetArches, ", ")))
+		}
+	}
+
+	// 4. gadget配置和脚本，gadget按自身路径查找同名的 .config
+	added := make(map[string]*zipEntry)
+	var scriptName string
+	if ii.Config.Mode == "script" && ii.Config.ScriptFile != "" {
+		scriptData, err := os.ReadFile(ii.Config.ScriptFile)
+		if err != nil {
+			return fmt.Errorf("读取脚本失败: %v", err)
+		}
+		scriptName = name + ".js"
+		added["Frameworks/"+scriptName] = &zipEntry{data: scriptData, mode: 0644}
+	}
+	config, err := ii.Config.configJSON(scriptName)
+	if err != nil {
+		return err
+	}
+	added["Frameworks/"+name+".config"] = &zipEntry{data: config, mode: 0644}
+
+	// 5. 签名
+	progressCallback(0.5, "签名...")
+	var manifest *IPASigningManifest
+	switch ii.Signing {
+	case IPASigningAdhoc:
+		if err := ii.signAdhoc(result, gadgetPath, &executableData, infoPlist, files, added); err != nil {
+			return err
+		}
+	case IPASigningNone:
+		manifest = &IPASigningManifest{
+			IPA:        ii.OutputPath,
+			Bundle:     result.Bundle,
+			BundleID:   result.BundleID,
+			Executable: result.Executable,
+			SignOrder:  []string{result.Bundle + "/Frameworks/" + name + ".dylib", result.Bundle},
+		}
+		if entitlements, err := entitlementsFromData(executableData); err == nil && len(entitlements) > 0 {
+			if plist, err := entitlements.Plist(); err == nil {
+				manifest.Entitlements = string(plist)
+			}
+		}
+	}
+	gadgetData, err := os.ReadFile(gadgetPath)
+	if err != nil {
+		return err
+	}
+	added["Frameworks/"+name+".dylib"] = &zipEntry{data: gadgetData, mode: 0755}
+
+	// 6. 重新打包
+	progressCallback(0.7, "重新打包IPA...")
+	var entries []*zipEntry
+	for _, f := range reader.File {
+		rel := strings.TrimPrefix(f.Name, result.Bundle+"/")
+		switch {
+		case f == executableFile:
+			entries = append(entries, &zipEntry{name: f.Name, data: executableData, mode: f.Mode()})
+		case strings.HasPrefix(f.Name, result.Bundle+"/") && added[rel] != nil:
+			if rel != "_CodeSignature/CodeResources" {
+				log.Printf("WARNING: 替换IPA中已有的 %s", f.Name)
+			}
+		default:
+			entries = append(entries, &zipEntry{name: f.Name, file: f})
+		}
+	}
+	names := make([]string, 0, len(added))
+	for rel := range added {
+		names = append(names, rel)
+	}
+	sort.Strings(names)
+	for _, rel := range names {
+		entry := added[rel]
+		entry.name = result.Bundle + "/" + rel
+		entries = append(entries, entry)
+		if strings.HasPrefix(rel, "Frameworks/") {
+			result.Files = append(result.Files, entry.name)
+		}
+	}
+
+	staged, err := utils.CreateAtomic(ii.OutputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer staged.Abort()
+	if err := writeAlignedZip(staged.File, entries); err != nil {
+		return fmt.Errorf("写入IPA失败: %v", err)
+	}
+	progressCallback(0.9, "校验输出IPA...")
+	if err := staged.Commit(func(tempPath string) error {
+		return verifyInjectedIPA(tempPath, result)
+	}); err != nil {
+		return err
+	}
+
+	if manifest != nil {
+		result.Manifest = strings.TrimSuffix(ii.OutputPath, filepath.Ext(ii.OutputPath)) + ".signing.json"
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := utils.WriteFileAtomic(result.Manifest, data, 0644); err != nil {
+			return fmt.Errorf("写入签名清单失败: %v", err)
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("IPA未签名，请按 %s 使用外部工具重新签名", result.Manifest))
+	}
+	for _, warning := range result.Warnings {
+		log.Printf("WARNING: %s", warning)
+	}
+
+	progressCallback(1.0, "IPA注入完成!")
+	log.Printf("SUCCESS: IPA注入完成: %s", ii.OutputPath)
+	return nil
+}
+
+// signAdhoc ad-hoc 签名gadget，重建资源封印后签名主程序
+func (ii *IPAInjector) signAdhoc(result *IPAInjectResult, gadgetPath string, executableData *[]byte, infoPlist []byte, files map[string]*zip.File, added map[string]*zipEntry) error {
+	name := ii.gadgetName()
+	if isCodeSigned(gadgetPath) {
+		// 使用新的标识符，原标识符含有 FridaGadget 特征
+		signer := NewCodeSigner()
+		signer.Identifier = name
+		if _, err := signer.SignFile(gadgetPath); err != nil {
+			return fmt.Errorf("签名gadget失败: %v", err)
+		}
+	} else {
+		result.Warnings = append(result.Warnings, "gadget没有代码签名，无法ad-hoc签名")
+	}
+
+	if !imagesSigned(*executableData) {
+		result.Warnings = append(result.Warnings, "主程序 (或其部分架构) 没有代码签名，未重新签名")
+		return nil
+	}
+
+	// 资源封印覆盖主程序和 _CodeSignature 以外的所有文件
+	var sealed []sealedFile
+	seal := func(rel string, r io.Reader) error {
+		file, err := sealFile(rel, r)
+		if err != nil {
+			return fmt.Errorf("读取 %s 失败: %v", rel, err)
+		}
+		sealed = append(sealed, file)
+		return nil
+	}
+	executable := strings.TrimPrefix(result.Executable, result.Bundle+"/")
+	for rel, f := range files {
+		if rel == executable || strings.HasPrefix(rel, "_CodeSignature/") || added[rel] != nil {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			target, err := io.ReadAll(r)
+			r.Close()
+			if err != nil {
+				return err
+			}
+			sealed = append(sealed, sealedFile{Path: rel, Symlink: string(target)})
+			continue
+		}
+		err = seal(rel, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	for rel, entry := range added {
+		if err := seal(rel, bytes.NewReader(entry.data)); err != nil {
+			return err
+		}
+	}
+	gadget, err := os.Open(gadgetPath)
+	if err != nil {
+		return err
+	}
+	err = seal("Frameworks/"+name+".dylib", gadget)
+	gadget.Close()
+	if err != nil {
+		return err
+	}
+	sort.Slice(sealed, func(i, j int) bool { return sealed[i].Path < sealed[j].Path })
+	resources, err := buildCodeResources(sealed)
+	if err != nil {
+		return fmt.Errorf("生成CodeResources失败: %v", err)
+	}
+
+	signer := NewCodeSigner()
+	signer.InfoPlist = infoPlist
+	signer.Resources = resources
+	signed, signedSlices, err := signer.Sign(*executableData)
+	if err != nil {
+		return fmt.Errorf("签名主程序失败: %v", err)
+	}
+	*executableData = signed
+	result.Signed = signedSlices
+	added["_CodeSignature/CodeResources"] = &zipEntry{data: resources, mode: 0644}
+	log.Printf("INFO: 已ad-hoc签名gadget和主程序，资源封印包含 %d 个文件", len(sealed))
+	return nil
+}
+
+// verifyInjectedIPA 重新读取输出IPA，确认加载命令、gadget和签名
+func verifyInjectedIPA(ipaPath string, result *IPAInjectResult) error {
+	reader, err := zip.OpenReader(ipaPath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	found := make(map[string]*zip.File)
+	for _, f := range reader.File {
+		found[f.Name] = f
+	}
+	for _, name := range result.Files {
+		if found[name] == nil {
+			return fmt.Errorf("缺少 %s", name)
+		}
+	}
+	executableFile := found[result.Executable]
+	if executableFile == nil {
+		return fmt.Errorf("缺少主程序 %s", result.Executable)
+	}
+	data, err := readZipFile(executableFile)
+	if err != nil {
+		return err
+	}
+	images, err := machoImages(data)
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		file, err := macho.NewFile(bytes.NewReader(image))
+		if err != nil {
+			return err
+		}
+		if !loadsDylib(file, result.DylibPath) {
+			return fmt.Errorf("主程序 %s 切片没有加载 %s", machoArchName(file.Cpu, file.SubCpu), result.DylibPath)
+		}
+		if result.Signed != nil {
+			if err := verifyImageSignature(image); err != nil {
+				return fmt.Errorf("主程序签名无效: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// machoDylibArches 检查文件是Mach-O动态库并返回其架构
+func machoDylibArches(filePath string) ([]string, error) {
+	file, format, err := detectAndOpenFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+	if format != MachO {
+		return nil, fmt.Errorf("不是Mach-O文件 (%s)", formatToString(format))
+	}
+
+	var images []*macho.File
+	switch f := file.(type) {
+	case *macho.File:
+		images = []*macho.File{f}
+	case *macho.FatFile:
+		for _, arch := range f.Arches {
+			images = append(images, arch.File)
+		}
+	}
+	var arches []string
+	for _, image := range images {
+		if image.Type != macho.TypeDylib {
+			return nil, fmt.Errorf("不是动态库")
+		}
+		arches = append(arches, machoArchName(image.Cpu, image.SubCpu))
+	}
+	return arches, nil
+}
+
+// imagesSigned 判断Mach-O的每个切片是否都有代码签名
+func imagesSigned(data []byte) bool {
+	images, err := machoImages(data)
+	if err != nil {
+		return false
+	}
+	for _, image := range images {
+		img, err := parseMachOImage(image)
+		if err != nil || img.signatureCmd < 0 {
+			return false
+		}
+	}
+	return true
+}
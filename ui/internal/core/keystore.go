@@ -0,0 +1,850 @@
+package core
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+	"strings"
+	"unicode/utf16"
+)
+
+// SigningKey is a private key with its certificate chain, the signer's
+// certificate first
+type SigningKey struct {
+	Alias        string
+	PrivateKey   crypto.Signer
+	Certificates []*x509.Certificate
+}
+
+// Certificate returns the signer's certificate
+func (k *SigningKey) Certificate() *x509.Certificate {
+	return k.Certificates[0]
+}
+
+var (
+	oidPKCS7Data          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS7EncryptedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+
+	oidKeyBag           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 1}
+	oidShroudedKeyBag   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidPBEWithSHA3DES   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBEWithSHARC2128 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 5}
+	oidPBEWithSHARC240  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 6}
+	oidPBES2            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1     = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC       = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidSHA1             = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA512           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidJKSKeyProtector  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 42, 2, 17, 1, 1}
+
+	errKeystorePassword = errors.New("wrong keystore password or corrupted keystore")
+	errKeystoreNoKey    = errors.New("keystore contains no private key")
+
+	// jksWhitener is mixed into the JKS integrity digest
+	jksWhitener = []byte("Mighty Aphrodite")
+)
+
+const (
+	jksMagic   = 0xfeedfeed
+	jceksMagic = 0xcececece
+
+	// PKCS#12 KDF purpose IDs
+	pkcs12CipherKeyID = 1
+	pkcs12CipherIVID  = 2
+	pkcs12MacKeyID    = 3
+)
+
+// LoadSigningKey loads a private key and its certificate chain from a JKS or
+// PKCS#12 keystore, or from a PEM file holding both. alias selects the key
+// entry (empty picks the first one) and keyPassword defaults to the store
+// password.
+func LoadSigningKey(path, storePassword, alias, keyPassword string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if keyPassword == "" {
+		keyPassword = storePassword
+	}
+
+	var key *SigningKey
+	switch {
+	case len(data) >= 4 && binary.BigEndian.Uint32(data) == jksMagic:
+		key, err = parseJKS(data, storePassword, alias, keyPassword)
+	case len(data) >= 4 && binary.BigEndian.Uint32(data) == jceksMagic:
+		return nil, fmt.Errorf("JCEKS keystores are not supported, convert %s to PKCS#12 with keytool -importkeystore", path)
+	case bytes.Contains(data, []byte("-----BEGIN")):
+		key, err = parsePEMKeyPair(data, keyPassword)
+	default:
+		key, err = parsePKCS12(data, storePassword, alias)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading %s: %v", path, err)
+	}
+	return key, nil
+}
+
+// LoadPEMSigningKey loads a PEM private key and a separate PEM certificate
+// chain
+func LoadPEMSigningKey(keyPath, certPath, keyPassword string) (*SigningKey, error) {
+	keyData, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	certData, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, err
+	}
+	return parsePEMKeyPair(append(append(keyData, '\n'), certData...), keyPassword)
+}
+
+// newSigningKey orders the certificates so the one matching the private key
+// comes first
+func newSigningKey(alias string, privateKey interface{}, certs []*x509.Certificate) (*SigningKey, error) {
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", privateKey)
+	}
+	switch signer.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, APK signing needs an RSA or EC key", signer)
+	}
+
+	type publicKey interface{ Equal(crypto.PublicKey) bool }
+	for i, cert := range certs {
+		if pub, ok := cert.PublicKey.(publicKey); ok && pub.Equal(signer.Public()) {
+			ordered := append([]*x509.Certificate{cert}, certs[:i]...)
+			return &SigningKey{Alias: alias, PrivateKey: signer, Certificates: append(ordered, certs[i+1:]...)}, nil
+		}
+	}
+	return nil, fmt.Errorf("no certificate matches the private key of %q", alias)
+}
+
+// parseJKS reads a Java KeyStore, verifying its integrity digest
+func parseJKS(data []byte, storePassword, alias, keyPassword string) (*SigningKey, error) {
+	if len(data) < 12+sha1.Size {
+		return nil, errors.New("truncated JKS keystore")
+	}
+	body, digest := data[:len(data)-sha1.Size], data[len(data)-sha1.Size:]
+	h := sha1.New()
+	h.Write(utf16BE(storePassword))
+	h.Write(jksWhitener)
+	h.Write(body)
+	if !hmac.Equal(h.Sum(nil), digest) {
+		return nil, errKeystorePassword
+	}
+
+	r := &jksReader{data: body, pos: 4}
+	version := r.uint32()
+	if version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported JKS version %d", version)
+	}
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		entryAlias := r.utf()
+		r.bytes(8) // creation date
+		switch tag {
+		case 1:
+			protected := r.bytes(int(r.uint32()))
+			certs := make([]*x509.Certificate, r.uint32())
+			for j := range certs {
+				if version == 2 {
+					r.utf()
+				}
+				der := r.bytes(int(r.uint32()))
+				if r.err != nil {
+					break
+				}
+				cert, err := x509.ParseCertificate(der)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing certificate of %q: %v", entryAlias, err)
+				}
+				certs[j] = cert
+			}
+			if r.err != nil || (alias != "" && !strings.EqualFold(alias, entryAlias)) {
+				continue
+			}
+			der, err := jksRecoverKey(protected, keyPassword)
+			if err != nil {
+				return nil, fmt.Errorf("error recovering key %q: %v", entryAlias, err)
+			}
+			privateKey, err := x509.ParsePKCS8PrivateKey(der)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing key %q: %v", entryAlias, err)
+			}
+			return newSigningKey(entryAlias, privateKey, certs)
+		case 2:
+			if version == 2 {
+				r.utf()
+			}
+			r.bytes(int(r.uint32()))
+		default:
+			return nil, fmt.Errorf("unknown JKS entry tag %d", tag)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if alias != "" {
+		return nil, fmt.Errorf("keystore has no private key %q", alias)
+	}
+	return nil, errKeystoreNoKey
+}
+
+// jksRecoverKey decrypts a key protected with Sun's proprietary key
+// protector: a SHA-1 keystream seeded by a salt, followed by a check digest
+func jksRecoverKey(protected []byte, password string) ([]byte, error) {
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Data      []byte
+	}
+	if _, err := asn1.Unmarshal(protected, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidJKSKeyProtector) {
+		return nil, fmt.Errorf("unsupported key protection algorithm %v", info.Algorithm.Algorithm)
+	}
+	if len(info.Data) < 2*sha1.Size {
+		return nil, errors.New("truncated protected key")
+	}
+	salt := info.Data[:sha1.Size]
+	encrypted := info.Data[sha1.Size : len(info.Data)-sha1.Size]
+	check := info.Data[len(info.Data)-sha1.Size:]
+
+	pass := utf16BE(password)
+	key := make([]byte, len(encrypted))
+	digest := salt
+	for i := 0; i < len(encrypted); i += sha1.Size {
+		sum := sha1.Sum(append(append([]byte(nil), pass...), digest...))
+		digest = sum[:]
+		for j := 0; j < sha1.Size && i+j < len(encrypted); j++ {
+			key[i+j] = encrypted[i+j] ^ digest[j]
+		}
+	}
+	sum := sha1.Sum(append(pass, key...))
+	if !hmac.Equal(sum[:], check) {
+		return nil, errors.New("wrong key password")
+	}
+	return key, nil
+}
+
+// jksReader reads the big-endian fields of a JKS keystore, remembering the
+// first overrun
+type jksReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *jksReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.data) {
+		if r.err == nil {
+			r.err = errors.New("truncated JKS keystore")
+		}
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *jksReader) utf() string {
+	b := r.bytes(2)
+	if b == nil {
+		return ""
+	}
+	return string(r.bytes(int(binary.BigEndian.Uint16(b))))
+}
+
+// PKCS#12 structures, see RFC 7292
+type pfxPdu struct {
+	Version  int
+	AuthSafe pkcs7ContentInfo
+	MacData  pkcs12MacData `asn1:"optional"`
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type pkcs7EncryptedData struct {
+	Version              int
+	EncryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0,optional"`
+	}
+}
+
+type pkcs12MacData struct {
+	Mac struct {
+		Algorithm pkix.AlgorithmIdentifier
+		Digest    []byte
+	}
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue `asn1:"tag:0,explicit"`
+	Attributes []struct {
+		ID    asn1.ObjectIdentifier
+		Value asn1.RawValue `asn1:"set"`
+	} `asn1:"set,optional"`
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// parsePKCS12 reads a PKCS#12 keystore as written by keytool and openssl,
+// verifying its MAC
+func parsePKCS12(data []byte, password, alias string) (*SigningKey, error) {
+	var pfx pfxPdu
+	if rest, err := asn1.Unmarshal(data, &pfx); err != nil {
+		return nil, fmt.Errorf("not a JKS, PKCS#12 or PEM keystore: %v", err)
+	} else if len(rest) != 0 {
+		return nil, errors.New("trailing data after PKCS#12 keystore")
+	}
+	if pfx.Version != 3 {
+		return nil, fmt.Errorf("unsupported PKCS#12 version %d", pfx.Version)
+	}
+	if !pfx.AuthSafe.ContentType.Equal(oidPKCS7Data) {
+		return nil, errors.New("only password integrity PKCS#12 keystores are supported")
+	}
+	var authSafe []byte
+	if _, err := asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe); err != nil {
+		return nil, err
+	}
+	if len(pfx.MacData.Mac.Digest) > 0 {
+		if err := verifyPKCS12Mac(&pfx.MacData, authSafe, password); err != nil {
+			return nil, err
+		}
+	}
+
+	var contents []pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(authSafe, &contents); err != nil {
+		return nil, err
+	}
+	type keyEntry struct {
+		alias string
+		key   interface{}
+	}
+	var keys []keyEntry
+	var certs []*x509.Certificate
+	for _, content := range contents {
+		var bags []byte
+		switch {
+		case content.ContentType.Equal(oidPKCS7Data):
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &bags); err != nil {
+				return nil, err
+			}
+		case content.ContentType.Equal(oidPKCS7EncryptedData):
+			var encrypted pkcs7EncryptedData
+			if _, err := asn1.Unmarshal(content.Content.Bytes, &encrypted); err != nil {
+				return nil, err
+			}
+			info := encrypted.EncryptedContentInfo
+			decrypted, err := pbeDecrypt(info.ContentEncryptionAlgorithm, info.EncryptedContent, password)
+			if err != nil {
+				return nil, err
+			}
+			bags = decrypted
+		default:
+			continue
+		}
+
+		var safeBags []pkcs12SafeBag
+		if _, err := asn1.Unmarshal(bags, &safeBags); err != nil {
+			return nil, err
+		}
+		for _, bag := range safeBags {
+			name := ""
+			for _, attr := range bag.Attributes {
+				if attr.ID.Equal(oidFriendlyName) {
+					var bmp asn1.RawValue
+					if _, err := asn1.Unmarshal(attr.Value.Bytes, &bmp); err == nil {
+						name = decodeUTF16BE(bmp.Bytes)
+					}
+				}
+			}
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var cb pkcs12CertBag
+				if _, err := asn1.Unmarshal(bag.Value.Bytes, &cb); err != nil {
+					return nil, err
+				}
+				if !cb.ID.Equal(oidX509Certificate) {
+					continue
+				}
+				cert, err := x509.ParseCertificate(cb.Data)
+				if err != nil {
+					return nil, err
+				}
+				certs = append(certs, cert)
+			case bag.ID.Equal(oidKeyBag), bag.ID.Equal(oidShroudedKeyBag):
+				der := bag.Value.Bytes
+				if bag.ID.Equal(oidShroudedKeyBag) {
+					var info encryptedPrivateKeyInfo
+					if _, err := asn1.Unmarshal(der, &info); err != nil {
+						return nil, err
+					}
+					decrypted, err := pbeDecrypt(info.Algorithm, info.Data, password)
+					if err != nil {
+						return nil, err
+					}
+					der = decrypted
+				}
+				key, err := x509.ParsePKCS8PrivateKey(der)
+				if err != nil {
+					return nil, err
+				}
+				keys = append(keys, keyEntry{alias: name, key: key})
+			}
+		}
+	}
+
+	for _, entry := range keys {
+		if alias == "" || strings.EqualFold(alias, entry.alias) {
+			return newSigningKey(entry.alias, entry.key, certs)
+		}
+	}
+	if alias != "" {
+		return nil, fmt.Errorf("keystore has no private key %q", alias)
+	}
+	return nil, errKeystoreNoKey
+}
+
+// verifyPKCS12Mac checks the HMAC keyed with the PKCS#12 KDF over the
+// authenticated safe
+func verifyPKCS12Mac(mac *pkcs12MacData, content []byte, password string) error {
+	newHash, err := digestHash(mac.Mac.Algorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	iterations := mac.Iterations
+	if iterations == 0 {
+		iterations = 1
+	}
+	key := pkcs12KDF(newHash, bmpPassword(password), mac.MacSalt, pkcs12MacKeyID, iterations, newHash().Size())
+	h := hmac.New(newHash, key)
+	h.Write(content)
+	if !hmac.Equal(h.Sum(nil), mac.Mac.Digest) {
+		return errKeystorePassword
+	}
+	return nil
+}
+
+// pbeDecrypt decrypts PKCS#12 PBE and PBES2 encrypted content
+func pbeDecrypt(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	var block cipher.Block
+	var iv []byte
+	switch {
+	case algorithm.Algorithm.Equal(oidPBEWithSHA3DES),
+		algorithm.Algorithm.Equal(oidPBEWithSHARC2128),
+		algorithm.Algorithm.Equal(oidPBEWithSHARC240):
+		var params pbeParams
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		pass := bmpPassword(password)
+		keyLen := map[bool]int{true: 24, false: 16}[algorithm.Algorithm.Equal(oidPBEWithSHA3DES)]
+		if algorithm.Algorithm.Equal(oidPBEWithSHARC240) {
+			keyLen = 5
+		}
+		key := pkcs12KDF(sha1.New, pass, params.Salt, pkcs12CipherKeyID, params.Iterations, keyLen)
+		iv = pkcs12KDF(sha1.New, pass, params.Salt, pkcs12CipherIVID, params.Iterations, 8)
+		var err error
+		if keyLen == 24 {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block, err = newRC2Cipher(key, keyLen*8)
+		}
+		if err != nil {
+			return nil, err
+		}
+	case algorithm.Algorithm.Equal(oidPBES2):
+		var params pbes2Params
+		if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+			return nil, fmt.Errorf("unsupported PBES2 key derivation %v", params.KeyDerivationFunc.Algorithm)
+		}
+		var kdf pbkdf2Params
+		if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+			return nil, err
+		}
+		prf := sha1.New
+		switch {
+		case kdf.PRF.Algorithm == nil, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF %v", kdf.PRF.Algorithm)
+		}
+
+		scheme := params.EncryptionScheme.Algorithm
+		keyLen := map[string]int{oidAES128CBC.String(): 16, oidAES192CBC.String(): 24, oidAES256CBC.String(): 32, oidDESEDE3CBC.String(): 24}[scheme.String()]
+		if keyLen == 0 {
+			return nil, fmt.Errorf("unsupported PBES2 cipher %v", scheme)
+		}
+		if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+			return nil, err
+		}
+		key := pbkdf2Key(prf, []byte(password), kdf.Salt, kdf.Iterations, keyLen)
+		var err error
+		if scheme.Equal(oidDESEDE3CBC) {
+			block, err = des.NewTripleDESCipher(key)
+		} else {
+			block, err = aes.NewCipher(key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %v", algorithm.Algorithm)
+	}
+
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted content")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errKeystorePassword
+	}
+	return plain[:len(plain)-pad], nil
+}
+
+// parsePEMKeyPair reads a private key and certificates from PEM blocks
+func parsePEMKeyPair(data []byte, password string) (*SigningKey, error) {
+	var privateKey interface{}
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		var err error
+		switch block.Type {
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				certs = append(certs, cert)
+			}
+		case "PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+		case "ENCRYPTED PRIVATE KEY":
+			var info encryptedPrivateKeyInfo
+			if _, err = asn1.Unmarshal(block.Bytes, &info); err == nil {
+				var der []byte
+				if der, err = pbeDecrypt(info.Algorithm, info.Data, password); err == nil {
+					privateKey, err = x509.ParsePKCS8PrivateKey(der)
+				}
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing PEM %s: %v", block.Type, err)
+		}
+	}
+	if privateKey == nil {
+		return nil, errKeystoreNoKey
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate found next to the private key")
+	}
+	return newSigningKey("", privateKey, certs)
+}
+
+// pkcs12KDF derives key material from a password as described in RFC 7292
+// appendix B.2
+func pkcs12KDF(newHash func() hash.Hash, password, salt []byte, id byte, iterations, size int) []byte {
+	h := newHash()
+	u, v := h.Size(), h.BlockSize()
+
+	fill := func(src []byte) []byte {
+		if len(src) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(src)+v-1)/v))
+		for i := range out {
+			out[i] = src[i%len(src)]
+		}
+		return out
+	}
+	i := append(fill(salt), fill(password)...)
+	d := bytes.Repeat([]byte{id}, v)
+
+	var out []byte
+	for len(out) < size {
+		h.Reset()
+		h.Write(d)
+		h.Write(i)
+		a := h.Sum(nil)
+		for n := 1; n < iterations; n++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		out = append(out, a...)
+
+		// I_j = (I_j + B + 1) mod 2^(8v) for every block of I
+		b := make([]byte, v)
+		for n := range b {
+			b[n] = a[n%u]
+		}
+		for j := 0; j < len(i); j += v {
+			carry := 1
+			for n := v - 1; n >= 0; n-- {
+				sum := int(i[j+n]) + int(b[n]) + carry
+				i[j+n] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return out[:size]
+}
+
+// pbkdf2Key derives a key with PBKDF2 (RFC 8018)
+func pbkdf2Key(newHash func() hash.Hash, password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(newHash, password)
+	var out []byte
+	for block := uint32(1); len(out) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(binary.BigEndian.AppendUint32(nil, block))
+		u := prf.Sum(nil)
+		t := append([]byte(nil), u...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:size]
+}
+
+// digestHash maps a digest algorithm OID to its hash constructor
+func digestHash(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidSHA512):
+		return sha512.New, nil
+	}
+	return nil, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
+
+// bmpPassword encodes a password as the NUL-terminated BMPString PKCS#12
+// derives keys from
+func bmpPassword(password string) []byte {
+	if password == "" {
+		return nil
+	}
+	return append(utf16BE(password), 0, 0)
+}
+
+// utf16BE encodes s as big-endian UTF-16
+func utf16BE(s string) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		out = binary.BigEndian.AppendUint16(out, unit)
+	}
+	return out
+}
+
+// decodeUTF16BE decodes big-endian UTF-16
+func decodeUTF16BE(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// rc2Cipher implements RC2 (RFC 2268), still used by older keytool and
+// openssl releases to encrypt the certificates of a PKCS#12 keystore
+type rc2Cipher struct {
+	k [64]uint16
+}
+
+var rc2PiTable = [256]byte{
+	0xd9, 0x78, 0xf9, 0xc4, 0x19, 0xdd, 0xb5, 0xed, 0x28, 0xe9, 0xfd, 0x79, 0x4a, 0xa0, 0xd8, 0x9d,
+	0xc6, 0x7e, 0x37, 0x83, 0x2b, 0x76, 0x53, 0x8e, 0x62, 0x4c, 0x64, 0x88, 0x44, 0x8b, 0xfb, 0xa2,
+	0x17, 0x9a, 0x59, 0xf5, 0x87, 0xb3, 0x4f, 0x13, 0x61, 0x45, 0x6d, 0x8d, 0x09, 0x81, 0x7d, 0x32,
+	0xbd, 0x8f, 0x40, 0xeb, 0x86, 0xb7, 0x7b, 0x0b, 0xf0, 0x95, 0x21, 0x22, 0x5c, 0x6b, 0x4e, 0x82,
+	0x54, 0xd6, 0x65, 0x93, 0xce, 0x60, 0xb2, 0x1c, 0x73, 0x56, 0xc0, 0x14, 0xa7, 0x8c, 0xf1, 0xdc,
+	0x12, 0x75, 0xca, 0x1f, 0x3b, 0xbe, 0xe4, 0xd1, 0x42, 0x3d, 0xd4, 0x30, 0xa3, 0x3c, 0xb6, 0x26,
+	0x6f, 0xbf, 0x0e, 0xda, 0x46, 0x69, 0x07, 0x57, 0x27, 0xf2, 0x1d, 0x9b, 0xbc, 0x94, 0x43, 0x03,
+	0xf8, 0x11, 0xc7, 0xf6, 0x90, 0xef, 0x3e, 0xe7, 0x06, 0xc3, 0xd5, 0x2f, 0xc8, 0x66, 0x1e, 0xd7,
+	0x08, 0xe8, 0xea, 0xde, 0x80, 0x52, 0xee, 0xf7, 0x84, 0xaa, 0x72, 0xac, 0x35, 0x4d, 0x6a, 0x2a,
+	0x96, 0x1a, 0xd2, 0x71, 0x5a, 0x15, 0x49, 0x74, 0x4b, 0x9f, 0xd0, 0x5e, 0x04, 0x18, 0xa4, 0xec,
+	0xc2, 0xe0, 0x41, 0x6e, 0x0f, 0x51, 0xcb, 0xcc, 0x24, 0x91, 0xaf, 0x50, 0xa1, 0xf4, 0x70, 0x39,
+	0x99, 0x7c, 0x3a, 0x85, 0x23, 0xb8, 0xb4, 0x7a, 0xfc, 0x02, 0x36, 0x5b, 0x25, 0x55, 0x97, 0x31,
+	0x2d, 0x5d, 0xfa, 0x98, 0xe3, 0x8a, 0x92, 0xae, 0x05, 0xdf, 0x29, 0x10, 0x67, 0x6c, 0xba, 0xc9,
+	0xd3, 0x00, 0xe6, 0xcf, 0xe1, 0x9e, 0xa8, 0x2c, 0x63, 0x16, 0x01, 0x3f, 0x58, 0xe2, 0x89, 0xa9,
+	0x0d, 0x38, 0x34, 0x1b, 0xab, 0x33, 0xff, 0xb0, 0xbb, 0x48, 0x0c, 0x5f, 0xb9, 0xb1, 0xcd, 0x2e,
+	0xc5, 0xf3, 0xdb, 0x47, 0xe5, 0xa5, 0x9c, 0x77, 0x0a, 0xa6, 0x20, 0x68, 0xfe, 0x7f, 0xc1, 0xad,
+}
+
+// newRC2Cipher expands key with the given effective key length in bits
+func newRC2Cipher(key []byte, effectiveBits int) (cipher.Block, error) {
+	if len(key) == 0 || len(key) > 128 {
+		return nil, fmt.Errorf("invalid RC2 key size %d", len(key))
+	}
+	var l [128]byte
+	copy(l[:], key)
+	t := len(key)
+	for i := t; i < 128; i++ {
+		l[i] = rc2PiTable[l[i-1]+l[i-t]]
+	}
+	t8 := (effectiveBits + 7) / 8
+	tm := byte(0xff >> uint(8*t8-effectiveBits))
+	l[128-t8] = rc2PiTable[l[128-t8]&tm]
+	for i := 127 - t8; i >= 0; i-- {
+		l[i] = rc2PiTable[l[i+1]^l[i+t8]]
+	}
+
+	c := &rc2Cipher{}
+	for i := range c.k {
+		c.k[i] = uint16(l[2*i]) | uint16(l[2*i+1])<<8
+	}
+	return c, nil
+}
+
+func (c *rc2Cipher) BlockSize() int { return 8 }
+
+func (c *rc2Cipher) Encrypt(dst, src []byte) {
+	var r [4]uint16
+	for i := range r {
+		r[i] = binary.LittleEndian.Uint16(src[2*i:])
+	}
+	j := 0
+	mix := func() {
+		for i, s := range [4]uint{1, 2, 3, 5} {
+			r[i] += c.k[j] + (r[(i+3)%4] & r[(i+2)%4]) + (^r[(i+3)%4] & r[(i+1)%4])
+			r[i] = r[i]<<s | r[i]>>(16-s)
+			j++
+		}
+	}
+	mash := func() {
+		for i := range r {
+			r[i] += c.k[r[(i+3)%4]&63]
+		}
+	}
+	for round := 0; round < 16; round++ {
+		mix()
+		if round == 4 || round == 10 {
+			mash()
+		}
+	}
+	for i := range r {
+		binary.LittleEndian.PutUint16(dst[2*i:], r[i])
+	}
+}
+
+func (c *rc2Cipher) Decrypt(dst, src []byte) {
+	var r [4]uint16
+	for i := range r {
+		r[i] = binary.LittleEndian.Uint16(src[2*i:])
+	}
+	j := 63
+	unmix := func() {
+		for i := 3; i >= 0; i-- {
+			s := [4]uint{1, 2, 3, 5}[i]
+			r[i] = r[i]>>s | r[i]<<(16-s)
+			r[i] -= c.k[j] + (r[(i+3)%4] & r[(i+2)%4]) + (^r[(i+3)%4] & r[(i+1)%4])
+			j--
+		}
+	}
+	unmash := func() {
+		for i := 3; i >= 0; i-- {
+			r[i] -= c.k[r[(i+3)%4]&63]
+		}
+	}
+	for round := 0; round < 16; round++ {
+		unmix()
+		if round == 4 || round == 10 {
+			unmash()
+		}
+	}
+	for i := range r {
+		binary.LittleEndian.PutUint16(dst[2*i:], r[i])
+	}
+}
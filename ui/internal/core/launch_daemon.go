@@ -0,0 +1,444 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LaunchDaemon is a launchd job definition as found in
+// /Library/LaunchDaemons. Keys the model does not cover, and covered keys
+// whose value has an unexpected type (such as a KeepAlive dictionary), are
+// kept in Extra and written back unchanged.
+type LaunchDaemon struct {
+	Label                  string
+	Program                string
+	ProgramArguments       []string
+	EnvironmentVariables   map[string]string
+	UserName               string
+	GroupName              string
+	WorkingDirectory       string
+	StandardOutPath        string
+	StandardErrorPath      string
+	POSIXSpawnType         string
+	RunAtLoad              bool
+	LimitLoadToSessionType []string
+	KeepAlive              bool
+	ThrottleInterval       int64
+	ExecuteAllowed         bool
+	Extra                  map[string]interface{}
+
+	// order is the key order of the parsed plist, kept so edits produce
+	// small diffs; keys added later follow in launchDaemonKeys order
+	order []string
+}
+
+// launchDaemonKeys are the keys covered by LaunchDaemon, in the order they
+// are written
+var launchDaemonKeys = []string{
+	"Label", "Program", "ProgramArguments", "EnvironmentVariables", "UserName",
+	"GroupName", "WorkingDirectory", "StandardOutPath", "StandardErrorPath",
+	"POSIXSpawnType", "RunAtLoad", "LimitLoadToSessionType", "KeepAlive",
+	"ThrottleInterval", "ExecuteAllowed",
+}
+
+// NewLaunchDaemon returns a job that runs program with args as root, starts
+// at load and is restarted when it exits
+func NewLaunchDaemon(label, program string, args ...string) *LaunchDaemon {
+	return &LaunchDaemon{
+		Label:            label,
+		ProgramArguments: append([]string{program}, args...),
+		UserName:         "root",
+		RunAtLoad:        true,
+		KeepAlive:        true,
+	}
+}
+
+// ParseLaunchDaemon decodes an XML or binary launchd plist and reports its
+// format, so the job can be written back the same way
+func ParseLaunchDaemon(data []byte) (*LaunchDaemon, PlistFormat, error) {
+	value, format, err := ParsePlist(data)
+	if err != nil {
+		return nil, format, err
+	}
+	dict, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, format, fmt.Errorf("launchd plist root must be a dict, got %s", plistTypeName(value))
+	}
+
+	ld := &LaunchDaemon{Extra: map[string]interface{}{}}
+	ld.order = plistRootKeys(data, format)
+	if len(ld.order) != len(dict) {
+		ld.order = sortedPlistKeys(dict)
+	}
+
+	for key, value := range dict {
+		if !ld.setKey(key, value) {
+			ld.Extra[key] = value
+		}
+	}
+	return ld, format, nil
+}
+
+// LoadLaunchDaemon reads a launchd plist file
+func LoadLaunchDaemon(path string) (*LaunchDaemon, PlistFormat, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, PlistXML, err
+	}
+	return ParseLaunchDaemon(data)
+}
+
+// setKey stores a covered key, reporting false when the key is not covered or
+// its value has another type
+func (ld *LaunchDaemon) setKey(key string, value interface{}) bool {
+	switch key {
+	case "Label", "Program", "UserName", "GroupName", "WorkingDirectory",
+		"StandardOutPath", "StandardErrorPath", "POSIXSpawnType":
+		s, ok := value.(string)
+		if ok {
+			*ld.stringField(key) = s
+		}
+		return ok
+	case "RunAtLoad", "KeepAlive", "ExecuteAllowed":
+		b, ok := value.(bool)
+		if ok {
+			*ld.boolField(key) = b
+		}
+		return ok
+	case "ThrottleInterval":
+		n, ok := value.(int64)
+		if ok {
+			ld.ThrottleInterval = n
+		}
+		return ok
+	case "ProgramArguments":
+		args, ok := plistStrings(value)
+		if ok {
+			ld.ProgramArguments = args
+		}
+		return ok
+	case "LimitLoadToSessionType":
+		if s, ok := value.(string); ok {
+			ld.LimitLoadToSessionType = []string{s}
+			return true
+		}
+		sessions, ok := plistStrings(value)
+		if ok {
+			ld.LimitLoadToSessionType = sessions
+		}
+		return ok
+	case "EnvironmentVariables":
+		dict, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		env := make(map[string]string, len(dict))
+		for name, value := range dict {
+			s, ok := value.(string)
+			if !ok {
+				return false
+			}
+			env[name] = s
+		}
+		ld.EnvironmentVariables = env
+		return true
+	}
+	return false
+}
+
+// plistStrings converts an array of strings
+func plistStrings(value interface{}) ([]string, bool) {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	strs := make([]string, len(array))
+	for i, elem := range array {
+		if strs[i], ok = elem.(string); !ok {
+			return nil, false
+		}
+	}
+	return strs, true
+}
+
+func (ld *LaunchDaemon) stringField(key string) *string {
+	switch key {
+	case "Label":
+		return &ld.Label
+	case "Program":
+		return &ld.Program
+	case "UserName":
+		return &ld.UserName
+	case "GroupName":
+		return &ld.GroupName
+	case "WorkingDirectory":
+		return &ld.WorkingDirectory
+	case "StandardOutPath":
+		return &ld.StandardOutPath
+	case "StandardErrorPath":
+		return &ld.StandardErrorPath
+	case "POSIXSpawnType":
+		return &ld.POSIXSpawnType
+	}
+	return nil
+}
+
+func (ld *LaunchDaemon) boolField(key string) *bool {
+	switch key {
+	case "RunAtLoad":
+		return &ld.RunAtLoad
+	case "KeepAlive":
+		return &ld.KeepAlive
+	case "ExecuteAllowed":
+		return &ld.ExecuteAllowed
+	}
+	return nil
+}
+
+// value returns the plist value of a covered key and whether it is written.
+// Empty strings, false and zero are omitted unless the parsed plist had the
+// key.
+func (ld *LaunchDaemon) value(key string) (interface{}, bool) {
+	parsed := false
+	for _, k := range ld.order {
+		if k == key {
+			parsed = true
+			break
+		}
+	}
+	switch key {
+	case "ProgramArguments":
+		if len(ld.ProgramArguments) == 0 && !parsed {
+			return nil, false
+		}
+		return stringsToPlist(ld.ProgramArguments), true
+	case "LimitLoadToSessionType":
+		if len(ld.LimitLoadToSessionType) == 1 {
+			return ld.LimitLoadToSessionType[0], true
+		}
+		return stringsToPlist(ld.LimitLoadToSessionType), len(ld.LimitLoadToSessionType) > 0 || parsed
+	case "EnvironmentVariables":
+		env := make(map[string]interface{}, len(ld.EnvironmentVariables))
+		for name, value := range ld.EnvironmentVariables {
+			env[name] = value
+		}
+		return env, len(env) > 0 || parsed
+	case "ThrottleInterval":
+		return ld.ThrottleInterval, ld.ThrottleInterval != 0 || parsed
+	}
+	if s := ld.stringField(key); s != nil {
+		return *s, *s != "" || parsed
+	}
+	if b := ld.boolField(key); b != nil {
+		return *b, *b || parsed
+	}
+	return nil, false
+}
+
+func stringsToPlist(strs []string) []interface{} {
+	array := make([]interface{}, len(strs))
+	for i, s := range strs {
+		array[i] = s
+	}
+	return array
+}
+
+// dict returns the job as a plist dictionary in write order
+func (ld *LaunchDaemon) dict() orderedPlistDict {
+	dict := orderedPlistDict{values: map[string]interface{}{}}
+	add := func(key string) {
+		if _, done := dict.values[key]; done {
+			return
+		}
+		if value, ok := ld.Extra[key]; ok {
+			dict.values[key] = value
+		} else if value, ok := ld.value(key); ok {
+			dict.values[key] = value
+		} else {
+			return
+		}
+		dict.keys = append(dict.keys, key)
+	}
+
+	for _, key := range ld.order {
+		add(key)
+	}
+	for _, key := range launchDaemonKeys {
+		add(key)
+	}
+	extra := make([]string, 0, len(ld.Extra))
+	for key := range ld.Extra {
+		extra = append(extra, key)
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		add(key)
+	}
+	return dict
+}
+
+// Marshal encodes the job as an XML or binary plist
+func (ld *LaunchDaemon) Marshal(format PlistFormat) ([]byte, error) {
+	return MarshalPlist(ld.dict(), format)
+}
+
+// argumentIndex finds an option in ProgramArguments at or after from,
+// written as "name value" or "name=value" under any of names. It returns the
+// index of the option and of its value (the same index for "name=value", -1
+// when the value is missing), or -1 when the option is absent.
+func (ld *LaunchDaemon) argumentIndex(names []string, from int) (int, int) {
+	if from < 1 {
+		from = 1 // ProgramArguments[0] is the executable
+	}
+	for i := from; i < len(ld.ProgramArguments); i++ {
+		arg := ld.ProgramArguments[i]
+		for _, name := range names {
+			switch {
+			case arg == name:
+				if i+1 < len(ld.ProgramArguments) {
+					return i, i + 1
+				}
+				return i, -1
+			case strings.HasPrefix(name, "--") && strings.HasPrefix(arg, name+"="):
+				return i, i
+			}
+		}
+	}
+	return -1, -1
+}
+
+// removeArguments removes every occurrence of an option at or after from
+func (ld *LaunchDaemon) removeArguments(names []string, from int) {
+	for {
+		i, v := ld.argumentIndex(names, from)
+		if i < 0 {
+			return
+		}
+		end := i + 1
+		if v > i {
+			end = v + 1
+		}
+		ld.ProgramArguments = append(ld.ProgramArguments[:i], ld.ProgramArguments[end:]...)
+	}
+}
+
+// Argument returns the value of an option in ProgramArguments, looked up
+// under name and its aliases
+func (ld *LaunchDaemon) Argument(name string, aliases ...string) (string, bool) {
+	i, v := ld.argumentIndex(append([]string{name}, aliases...), 1)
+	switch {
+	case i < 0 || v < 0:
+		return "", false
+	case v == i:
+		arg := ld.ProgramArguments[i]
+		return arg[strings.IndexByte(arg, '=')+1:], true
+	}
+	return ld.ProgramArguments[v], true
+}
+
+// SetArgument sets an option in ProgramArguments. The first occurrence under
+// name or an alias is updated in place and later ones are removed; otherwise
+// the option is appended as "name value", or as "name=value" for long
+// options.
+func (ld *LaunchDaemon) SetArgument(name, value string, aliases ...string) {
+	names := append([]string{name}, aliases...)
+	i, v := ld.argumentIndex(names, 1)
+	switch {
+	case i < 0:
+		if len(ld.ProgramArguments) == 0 {
+			ld.ProgramArguments = []string{ld.Program}
+		}
+		if strings.HasPrefix(name, "--") {
+			ld.ProgramArguments = append(ld.ProgramArguments, name+"="+value)
+		} else {
+			ld.ProgramArguments = append(ld.ProgramArguments, name, value)
+		}
+		return
+	case v == i:
+		arg := ld.ProgramArguments[i]
+		ld.ProgramArguments[i] = arg[:strings.IndexByte(arg, '=')+1] + value
+	case v < 0:
+		ld.ProgramArguments = append(ld.ProgramArguments, value)
+		v = i + 1
+	default:
+		ld.ProgramArguments[v] = value
+	}
+	ld.removeArguments(names, v+1)
+}
+
+// RemoveArgument removes every occurrence of an option and its value from
+// ProgramArguments
+func (ld *LaunchDaemon) RemoveArgument(name string, aliases ...string) {
+	ld.removeArguments(append([]string{name}, aliases...), 1)
+}
+
+// ListenAddress returns frida-server's -l/--listen address, if set
+func (ld *LaunchDaemon) ListenAddress() (string, bool) {
+	return ld.Argument("-l", "--listen")
+}
+
+// SetListenAddress sets frida-server's -l/--listen address
+func (ld *LaunchDaemon) SetListenAddress(address string) {
+	ld.SetArgument("-l", address, "--listen")
+}
+
+// SetListenPort changes the port frida-server listens on. An existing listen
+// address keeps its host; without one, a non-default port adds
+// -l 0.0.0.0:port.
+func (ld *LaunchDaemon) SetListenPort(port int) {
+	if address, ok := ld.ListenAddress(); ok {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			host = address
+		}
+		ld.SetListenAddress(net.JoinHostPort(host, strconv.Itoa(port)))
+		return
+	}
+	if port != DefaultFridaPort {
+		ld.SetListenAddress(fmt.Sprintf("0.0.0.0:%d", port))
+	}
+}
+
+// ReplaceStrings passes every string value of the job through replace,
+// including environment variables and values kept in Extra. Keys are left
+// unchanged.
+func (ld *LaunchDaemon) ReplaceStrings(replace func(string) string) {
+	for _, key := range launchDaemonKeys {
+		if s := ld.stringField(key); s != nil {
+			*s = replace(*s)
+		}
+	}
+	for i, arg := range ld.ProgramArguments {
+		ld.ProgramArguments[i] = replace(arg)
+	}
+	for i, session := range ld.LimitLoadToSessionType {
+		ld.LimitLoadToSessionType[i] = replace(session)
+	}
+	for name, value := range ld.EnvironmentVariables {
+		ld.EnvironmentVariables[name] = replace(value)
+	}
+	for key, value := range ld.Extra {
+		ld.Extra[key] = replacePlistStrings(value, replace)
+	}
+}
+
+// replacePlistStrings returns v with replace applied to every string in it
+func replacePlistStrings(v interface{}, replace func(string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return replace(v)
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = replacePlistStrings(elem, replace)
+		}
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = replacePlistStrings(value, replace)
+		}
+	}
+	return v
+}
@@ -0,0 +1,519 @@
+package core
+
+import (
+	"debug/elf"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"fridare-gui/internal/utils"
+)
+
+// Linux 包格式
+const (
+	LinuxPackageDeb = "deb"
+	LinuxPackageRPM = "rpm"
+)
+
+// Linux 服务管理方式
+const (
+	LinuxInitSystemd  = "systemd"
+	LinuxInitOpenRC   = "openrc"
+	LinuxInitSysVinit = "sysvinit"
+)
+
+// linuxArchNames ELF机器类型对应的 Debian 和 RPM 架构名
+var linuxArchNames = map[elf.Machine][2]string{
+	elf.EM_X86_64:  {"amd64", "x86_64"},
+	elf.EM_AARCH64: {"arm64", "aarch64"},
+	elf.EM_ARM:     {"armhf", "armv7hl"},
+	elf.EM_386:     {"i386", "i686"},
+}
+
+// linuxPackageName Debian 和 RPM 都接受的包名
+var linuxPackageName = regexp.MustCompile(`^[a-z0-9][a-z0-9.+-]+$`)
+
+// LinuxServicePackager Linux frida-server 服务包构建器: 将魔改后的frida-server
+// 安装到 <前缀>/sbin/<魔改名>，并生成 systemd 单元 (或 OpenRC / SysVinit 脚本)
+// 在指定地址和端口启动，打包为 Debian .deb 或 RPM
+type LinuxServicePackager struct {
+	ServerPath  string // Linux frida-server 路径
+	OutputPath  string
+	Format      string // LinuxPackageDeb 或 LinuxPackageRPM
+	InitSystem  string // LinuxInitSystemd (默认)、LinuxInitOpenRC 或 LinuxInitSysVinit
+	MagicName   string
+	Port        int
+	Prefix      string // 安装前缀，默认 /usr
+	PackageName string // 包名，默认 <魔改名>-server
+	Version     string // 版本，默认 17.2.17，同时用于筛选按版本限定的替换规则
+	Maintainer  string
+	Description string         // 包描述 (可选, 自动生成)
+	Homepage    string         // 主页
+	Rules       *RuleSet       // 替换规则集 (nil 使用内置默认规则)
+	PatchPort   bool           // 同时修补frida-server二进制中的默认端口
+	Reports     []*PatchReport // 二进制替换报告
+	Arch        string         // 按frida-server识别出的包架构
+	Compression string         // .deb 成员的压缩方式 (默认 xz)
+	// Reproducible 可复现构建，SourceDate 为其时间戳 (零值使用 SOURCE_DATE_EPOCH)
+	Reproducible bool
+	SourceDate   time.Time
+
+	RuntimeOptions // 监听地址、TLS证书、认证令牌等运行参数
+}
+
+// NewLinuxServicePackager 创建Linux服务包构建器，默认以 systemd 管理
+func NewLinuxServicePackager(serverPath, outputPath, format, magicName string, port int) *LinuxServicePackager {
+	return &LinuxServicePackager{
+		ServerPath:     serverPath,
+		OutputPath:     outputPath,
+		Format:         format,
+		InitSystem:     LinuxInitSystemd,
+		MagicName:      magicName,
+		Port:           port,
+		RuntimeOptions: RuntimeOptions{Address: "0.0.0.0"},
+		Prefix:         "/usr",
+		Version:        "17.2.17",
+		Maintainer:     "Fridare Team <support@fridare.com>",
+		Homepage:       "https://frida.re/",
+	}
+}
+
+// packageName 返回包名
+func (lp *LinuxServicePackager) packageName() string {
+	if lp.PackageName != "" {
+		return lp.PackageName
+	}
+	return strings.ToLower(lp.MagicName) + "-server"
+}
+
+// description 返回包描述
+func (lp *LinuxServicePackager) description() string {
+	if lp.Description != "" {
+		return lp.Description
+	}
+	return fmt.Sprintf("Dynamic instrumentation toolkit server, listening on %s (Modified: %s)", lp.ListenAddress(lp.Port), lp.MagicName)
+}
+
+// serverInstallPath 返回frida-server的安装路径
+func (lp *LinuxServicePackager) serverInstallPath() string {
+	return path.Join(lp.Prefix, "sbin", lp.MagicName)
+}
+
+// certificateInstallPath 返回TLS证书的安装路径
+func (lp *LinuxServicePackager) certificateInstallPath() string {
+	return path.Join("/etc", lp.MagicName, CertificateName(lp.MagicName))
+}
+
+// listenArgs 返回frida-server的启动参数
+func (lp *LinuxServicePackager) listenArgs() string {
+	return strings.Join(lp.Args(lp.Port, lp.certificateInstallPath()), " ")
+}
+
+// CreatePackage 创建服务包
+func (lp *LinuxServicePackager) CreatePackage(progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始创建Linux服务包 - 格式: %s, 服务: %s, 输入: %s, 输出: %s", lp.Format, lp.InitSystem, lp.ServerPath, lp.OutputPath)
+	if progressCallback == nil {
+		progressCallback = func(float64, string) {}
+	}
+	if err := lp.validate(); err != nil {
+		return err
+	}
+
+	// 1. 识别架构
+	progressCallback(0.1, "识别frida-server架构...")
+	f, err := elf.Open(lp.ServerPath)
+	if err != nil {
+		return fmt.Errorf("frida-server不是有效的ELF文件: %v", err)
+	}
+	names, ok := linuxArchNames[f.Machine]
+	f.Close()
+	if !ok {
+		return fmt.Errorf("不支持的架构: %v", f.Machine)
+	}
+	if lp.Format == LinuxPackageDeb {
+		lp.Arch = names[0]
+	} else {
+		lp.Arch = names[1]
+	}
+	log.Printf("INFO: frida-server架构: %v -> %s", f.Machine, lp.Arch)
+
+	// 2. 魔改frida-server
+	progressCallback(0.2, "魔改frida-server...")
+	tempDir, err := os.MkdirTemp("", "fridare-linux-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hexReplacer := NewHexReplacer()
+	hexReplacer.Rules = lp.Rules
+	hexReplacer.FridaVersion = lp.Version
+	if lp.PatchPort {
+		hexReplacer.Port = lp.Port
+	}
+	patchedPath := filepath.Join(tempDir, lp.MagicName)
+	report, err := hexReplacer.PatchFileWithReport(lp.ServerPath, lp.MagicName, patchedPath, nil)
+	if err != nil {
+		return fmt.Errorf("HEX替换frida-server失败: %v", err)
+	}
+	report.File = lp.serverInstallPath()
+	lp.Reports = []*PatchReport{report}
+	server, err := os.ReadFile(patchedPath)
+	if err != nil {
+		return err
+	}
+
+	// 3. 服务文件
+	serviceFile := lp.serviceFile()
+	files := []rpmFile{
+		{Path: lp.serverInstallPath(), Data: server, Mode: 0755},
+		serviceFile,
+	}
+	if lp.Certificate != "" {
+		cert, err := lp.certificateData()
+		if err != nil {
+			return err
+		}
+		files = append(files, rpmFile{Path: lp.certificateInstallPath(), Data: cert, Mode: 0600, Config: true})
+		log.Printf("INFO: TLS证书安装到: %s", lp.certificateInstallPath())
+	}
+
+	// 4. 打包
+	progressCallback(0.6, "打包...")
+	switch lp.Format {
+	case LinuxPackageDeb:
+		err = lp.buildDeb(tempDir, files)
+	case LinuxPackageRPM:
+		err = lp.buildRPM(files)
+	}
+	if err != nil {
+		return err
+	}
+
+	logResidualFingerprints(lp.Reports)
+	progressCallback(1.0, "Linux服务包创建完成!")
+	log.Printf("SUCCESS: Linux服务包创建成功: %s", lp.OutputPath)
+	return nil
+}
+
+// validate 检查配置
+func (lp *LinuxServicePackager) validate() error {
+	if lp.MagicName == "" {
+		return fmt.Errorf("未指定魔改名称")
+	}
+	if lp.Format != LinuxPackageDeb && lp.Format != LinuxPackageRPM {
+		return fmt.Errorf("不支持的包格式: %s", lp.Format)
+	}
+	switch lp.InitSystem {
+	case "":
+		lp.InitSystem = LinuxInitSystemd
+	case LinuxInitSystemd, LinuxInitOpenRC, LinuxInitSysVinit:
+	default:
+		return fmt.Errorf("不支持的服务管理方式: %s", lp.InitSystem)
+	}
+	if lp.Port < 1 || lp.Port > 65535 {
+		return fmt.Errorf("端口必须在1-65535范围内")
+	}
+	if lp.Address == "" {
+		lp.Address = "0.0.0.0"
+	}
+	if err := lp.RuntimeOptions.Validate(); err != nil {
+		return err
+	}
+	if lp.Prefix == "" {
+		lp.Prefix = "/usr"
+	}
+	if !path.IsAbs(lp.Prefix) || strings.ContainsAny(lp.Prefix, " \"'`$\\\n") {
+		return fmt.Errorf("安装前缀必须是绝对路径: %s", lp.Prefix)
+	}
+	lp.Prefix = path.Clean(lp.Prefix)
+	if !linuxPackageName.MatchString(lp.packageName()) {
+		return fmt.Errorf("包名格式错误: %s", lp.packageName())
+	}
+	return nil
+}
+
+// serviceFile 生成启动frida-server的服务文件
+func (lp *LinuxServicePackager) serviceFile() rpmFile {
+	name := lp.MagicName
+	switch lp.InitSystem {
+	case LinuxInitOpenRC:
+		return rpmFile{Path: "/etc/init.d/" + name, Mode: 0755, Config: true, Data: []byte(fmt.Sprintf(`#!/sbin/openrc-run
+
+description="%[1]s server"
+command="%[2]s"
+command_args="%[3]s"
+command_background=true
+pidfile="/run/${RC_SVCNAME}.pid"
+
+depend() {
+	need net
+}
+`, name, lp.serverInstallPath(), lp.listenArgs()))}
+
+	case LinuxInitSysVinit:
+		return rpmFile{Path: "/etc/init.d/" + name, Mode: 0755, Config: true, Data: []byte(fmt.Sprintf(`#!/bin/sh
+### BEGIN INIT INFO
+# Provides:          %[1]s
+# Required-Start:    $network $remote_fs
+# Required-Stop:     $network $remote_fs
+# Default-Start:     2 3 4 5
+# Default-Stop:      0 1 6
+# Short-Description: %[1]s server
+### END INIT INFO
+
+DAEMON="%[2]s"
+DAEMON_ARGS="%[3]s"
+PIDFILE="/var/run/%[1]s.pid"
+
+running() {
+	[ -f "$PIDFILE" ] && kill -0 "$(cat "$PIDFILE")" 2>/dev/null
+}
+
+case "$1" in
+	start)
+		running && exit 0
+		echo "Starting %[1]s"
+		"$DAEMON" $DAEMON_ARGS >/dev/null 2>&1 &
+		echo $! > "$PIDFILE"
+		;;
+	stop)
+		echo "Stopping %[1]s"
+		running && kill "$(cat "$PIDFILE")"
+		rm -f "$PIDFILE"
+		;;
+	restart|force-reload)
+		"$0" stop
+		sleep 1
+		"$0" start
+		;;
+	status)
+		if running; then
+			echo "%[1]s is running"
+		else
+			echo "%[1]s is not running"
+			exit 3
+		fi
+		;;
+	*)
+		echo "Usage: $0 {start|stop|restart|status}"
+		exit 1
+		;;
+esac
+exit 0
+`, name, lp.serverInstallPath(), lp.listenArgs()))}
+	}
+
+	return rpmFile{Path: "/usr/lib/systemd/system/" + name + ".service", Mode: 0644, Data: []byte(fmt.Sprintf(`[Unit]
+Description=%[1]s server
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=%[2]s %[3]s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`, name, lp.serverInstallPath(), lp.listenArgs()))}
+}
+
+// startCommands 安装后启用并启动服务的脚本片段
+func (lp *LinuxServicePackager) startCommands() string {
+	name := lp.MagicName
+	switch lp.InitSystem {
+	case LinuxInitOpenRC:
+		return fmt.Sprintf(`if command -v rc-update >/dev/null 2>&1; then
+    rc-update add %[1]s default >/dev/null 2>&1 || true
+    rc-service %[1]s restart || true
+fi
+`, name)
+	case LinuxInitSysVinit:
+		return fmt.Sprintf(`if command -v update-rc.d >/dev/null 2>&1; then
+    update-rc.d %[1]s defaults >/dev/null 2>&1 || true
+elif command -v chkconfig >/dev/null 2>&1; then
+    chkconfig --add %[1]s >/dev/null 2>&1 || true
+fi
+/etc/init.d/%[1]s restart || true
+`, name)
+	}
+	return fmt.Sprintf(`if [ -d /run/systemd/system ]; then
+    systemctl daemon-reload >/dev/null 2>&1 || true
+    systemctl enable %[1]s.service >/dev/null 2>&1 || true
+    systemctl restart %[1]s.service || true
+fi
+`, name)
+}
+
+// stopCommands 卸载前停止并禁用服务的脚本片段
+func (lp *LinuxServicePackager) stopCommands() string {
+	name := lp.MagicName
+	switch lp.InitSystem {
+	case LinuxInitOpenRC:
+		return fmt.Sprintf(`if command -v rc-service >/dev/null 2>&1; then
+    rc-service %[1]s stop >/dev/null 2>&1 || true
+    rc-update del %[1]s default >/dev/null 2>&1 || true
+fi
+`, name)
+	case LinuxInitSysVinit:
+		return fmt.Sprintf(`/etc/init.d/%[1]s stop >/dev/null 2>&1 || true
+if command -v update-rc.d >/dev/null 2>&1; then
+    update-rc.d -f %[1]s remove >/dev/null 2>&1 || true
+elif command -v chkconfig >/dev/null 2>&1; then
+    chkconfig --del %[1]s >/dev/null 2>&1 || true
+fi
+`, name)
+	}
+	return fmt.Sprintf(`if [ -d /run/systemd/system ]; then
+    systemctl stop %[1]s.service >/dev/null 2>&1 || true
+    systemctl disable %[1]s.service >/dev/null 2>&1 || true
+fi
+`, name)
+}
+
+// cleanupCommands 卸载后的清理脚本片段 (仅 systemd 需要重新加载单元)
+func (lp *LinuxServicePackager) cleanupCommands() string {
+	if lp.InitSystem != LinuxInitSystemd {
+		return ""
+	}
+	return `if [ -d /run/systemd/system ]; then
+    systemctl daemon-reload >/dev/null 2>&1 || true
+fi
+`
+}
+
+// buildDeb 生成包目录并使用纯Go的ar/tar/xz打包为 .deb
+func (lp *LinuxServicePackager) buildDeb(tempDir string, files []rpmFile) error {
+	root := filepath.Join(tempDir, "root")
+	var installedSize int64
+	var conffiles []string
+	for _, file := range files {
+		target := filepath.Join(root, filepath.FromSlash(file.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := os.WriteFile(target, file.Data, file.Mode); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", file.Path, err)
+		}
+		if err := os.Chmod(target, file.Mode); err != nil {
+			return fmt.Errorf("设置 %s 权限失败: %v", file.Path, err)
+		}
+		installedSize += int64(len(file.Data))
+		if file.Config {
+			conffiles = append(conffiles, file.Path)
+		}
+	}
+
+	debianDir := filepath.Join(root, "DEBIAN")
+	if err := os.MkdirAll(debianDir, 0755); err != nil {
+		return fmt.Errorf("创建DEBIAN目录失败: %v", err)
+	}
+	control := fmt.Sprintf(`Package: %s
+Version: %s
+Architecture: %s
+Maintainer: %s
+Installed-Size: %d
+Section: devel
+Priority: optional
+Homepage: %s
+Description: %s
+ %s
+`, lp.packageName(), lp.Version, lp.Arch, lp.Maintainer, (installedSize+1023)/1024, lp.Homepage, lp.description(),
+		"frida-server renamed and patched by Fridare, run as a "+lp.InitSystem+" service.")
+	scripts := map[string]string{
+		"control":  control,
+		"postinst": "#!/bin/sh\nset -e\n\nif [ \"$1\" = \"configure\" ]; then\n" + indentScript(lp.startCommands()) + "fi\n",
+		"prerm":    "#!/bin/sh\nset -e\n\nif [ \"$1\" = \"remove\" ] || [ \"$1\" = \"deconfigure\" ]; then\n" + indentScript(lp.stopCommands()) + "fi\n",
+	}
+	if cleanup := lp.cleanupCommands(); cleanup != "" {
+		scripts["postrm"] = "#!/bin/sh\nset -e\n\n" + cleanup
+	}
+	if len(conffiles) > 0 {
+		scripts["conffiles"] = strings.Join(conffiles, "\n") + "\n"
+	}
+	for name, content := range scripts {
+		perm := os.FileMode(0755)
+		if name == "control" || name == "conffiles" {
+			perm = 0644
+		}
+		if err := os.WriteFile(filepath.Join(debianDir, name), []byte(content), perm); err != nil {
+			return fmt.Errorf("写入 %s 失败: %v", name, err)
+		}
+	}
+
+	// 使用文件列表中的权限，不依赖宿主文件系统 (Windows 上没有可执行位)
+	modes := make(map[string]os.FileMode, len(files))
+	for _, file := range files {
+		modes["."+file.Path] = file.Mode
+	}
+	writer := NewDebWriter()
+	writer.Group = "root"
+	if lp.Compression != "" {
+		writer.ControlCompression = lp.Compression
+		writer.DataCompression = lp.Compression
+	}
+	writer.FileMode = func(name string, mode os.FileMode) os.FileMode {
+		if m, ok := modes[name]; ok {
+			return m
+		}
+		return mode
+	}
+	writer.Reproducible = lp.Reproducible
+	writer.ModTime = lp.SourceDate
+	return writer.Build(root, lp.OutputPath)
+}
+
+// buildRPM 打包为 RPM
+func (lp *LinuxServicePackager) buildRPM(files []rpmFile) error {
+	buildTime := time.Now()
+	if lp.Reproducible {
+		buildTime = lp.SourceDate
+		if buildTime.IsZero() {
+			epoch, err := SourceDateEpoch()
+			if err != nil {
+				return err
+			}
+			buildTime = epoch
+		}
+	}
+	pkg := &rpmPackage{
+		Name:        lp.packageName(),
+		Version:     lp.Version,
+		Release:     "1",
+		Arch:        lp.Arch,
+		Summary:     lp.description(),
+		Description: "frida-server renamed and patched by Fridare, run as a " + lp.InitSystem + " service.",
+		License:     "wxWindows",
+		Group:       "Development/Tools",
+		URL:         lp.Homepage,
+		Packager:    lp.Maintainer,
+		BuildTime:   buildTime,
+		Files:       files,
+		PostIn:      lp.startCommands(),
+		PreUn:       "if [ \"$1\" -eq 0 ]; then\n" + indentScript(lp.stopCommands()) + "fi\n",
+		PostUn:      lp.cleanupCommands(),
+	}
+	data, err := buildRPM(pkg)
+	if err != nil {
+		return fmt.Errorf("生成RPM失败: %v", err)
+	}
+	return utils.WriteFileAtomic(lp.OutputPath, data, 0644)
+}
+
+// indentScript 将脚本片段缩进一级
+func indentScript(script string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(script, "\n") {
+		if strings.TrimSpace(line) != "" {
+			b.WriteString("    ")
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
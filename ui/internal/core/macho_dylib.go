@@ -0,0 +1,149 @@
+package core
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	machoLoadEncryptionInfo   = 0x21
+	machoLoadEncryptionInfo64 = 0x2c
+
+	machoSectionTypeMask = 0xff
+	machoZerofill        = 0x1
+	machoGBZerofill      = 0xc
+	machoThreadZerofill  = 0x12
+
+	dylibCommandHeader = 24
+)
+
+// DylibSlice describes the load command added to one Mach-O image
+type DylibSlice struct {
+	Arch      string `json:"arch"`
+	FreeSpace int    `json:"free_space"` // header padding left before the first section
+	Encrypted bool   `json:"encrypted"`  // FairPlay encrypted, needs decrypting before it can run re-signed
+}
+
+// insertLoadDylib adds a LC_LOAD_DYLIB (LC_LOAD_WEAK_DYLIB when weak) for
+// dylibPath to every image of a thin or fat Mach-O file. The command is
+// written into the padding between the load commands and the first section,
+// so no offset in the file moves; an image without enough padding is an error.
+func insertLoadDylib(data []byte, dylibPath string, weak bool) ([]byte, []DylibSlice, error) {
+	out := append([]byte(nil), data...)
+	if !isFatMachO(data) {
+		slice, err := insertImageLoadDylib(out, dylibPath, weak)
+		if err != nil {
+			return nil, nil, err
+		}
+		return out, []DylibSlice{slice}, nil
+	}
+
+	slices, _, err := parseFatSlices(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var result []DylibSlice
+	for _, s := range slices {
+		slice, err := insertImageLoadDylib(out[s.offset:s.offset+s.size], dylibPath, weak)
+		if err != nil {
+			return nil, nil, fmt.Errorf("slice %s: %v", s.arch(), err)
+		}
+		result = append(result, slice)
+	}
+	return out, result, nil
+}
+
+// insertImageLoadDylib appends the dylib command to the load commands of a
+// thin image in place
+func insertImageLoadDylib(image []byte, dylibPath string, weak bool) (DylibSlice, error) {
+	var slice DylibSlice
+	file, err := macho.NewFile(bytes.NewReader(image))
+	if err != nil {
+		return slice, err
+	}
+	defer file.Close()
+	slice.Arch = machoArchName(file.Cpu, file.SubCpu)
+	if file.ByteOrder != binary.LittleEndian {
+		return slice, fmt.Errorf("big-endian Mach-O images are not supported")
+	}
+
+	headerSize, align := 28, 4
+	if file.Magic == macho.Magic64 {
+		headerSize, align = 32, 8
+	}
+	if loadsDylib(file, dylibPath) {
+		return slice, fmt.Errorf("%s is already loaded", dylibPath)
+	}
+	order := file.ByteOrder
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		switch order.Uint32(raw) {
+		case machoLoadEncryptionInfo, machoLoadEncryptionInfo64:
+			if len(raw) >= 20 && order.Uint32(raw[16:]) != 0 {
+				slice.Encrypted = true
+			}
+		}
+	}
+
+	// The first section with file content bounds the space for load commands
+	commandsEnd := headerSize + int(file.Cmdsz)
+	firstData := len(image)
+	for _, section := range file.Sections {
+		switch section.Flags & machoSectionTypeMask {
+		case machoZerofill, machoGBZerofill, machoThreadZerofill:
+			continue
+		}
+		if section.Offset != 0 && section.Size != 0 && int(section.Offset) < firstData {
+			firstData = int(section.Offset)
+		}
+	}
+	for _, load := range file.Loads {
+		if segment, ok := load.(*macho.Segment); ok && segment.Offset != 0 && segment.Filesz != 0 && int(segment.Offset) < firstData {
+			firstData = int(segment.Offset)
+		}
+	}
+
+	size := int(alignUp(uint64(dylibCommandHeader+len(dylibPath)+1), uint64(align)))
+	slice.FreeSpace = firstData - commandsEnd - size
+	if slice.FreeSpace < 0 {
+		return slice, fmt.Errorf("not enough header padding: need %d bytes, %d available", size, firstData-commandsEnd)
+	}
+	for _, b := range image[commandsEnd : commandsEnd+size] {
+		if b != 0 {
+			return slice, fmt.Errorf("header padding is not empty")
+		}
+	}
+
+	cmd := uint32(machoLoadDylib)
+	if weak {
+		cmd = machoLoadWeakDylib
+	}
+	command := image[commandsEnd : commandsEnd+size]
+	order.PutUint32(command, cmd)
+	order.PutUint32(command[4:], uint32(size))
+	order.PutUint32(command[8:], dylibCommandHeader)
+	order.PutUint32(command[12:], 2)       // timestamp
+	order.PutUint32(command[16:], 0x10000) // current version 1.0.0
+	order.PutUint32(command[20:], 0x10000) // compatibility version 1.0.0
+	copy(command[dylibCommandHeader:], dylibPath)
+
+	order.PutUint32(image[16:], file.Ncmd+1)
+	order.PutUint32(image[20:], file.Cmdsz+uint32(size))
+	return slice, nil
+}
+
+// loadsDylib reports whether an image has a dylib load command for dylibPath
+func loadsDylib(file *macho.File, dylibPath string) bool {
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		switch file.ByteOrder.Uint32(raw) {
+		case machoLoadDylib, machoLoadWeakDylib, machoLoadLazyDylib, machoLoadUpwardDylib, machoLoadReexportDylib:
+			if len(raw) > 12 && int(file.ByteOrder.Uint32(raw[8:])) < len(raw) && cString(raw, file.ByteOrder.Uint32(raw[8:])) == dylibPath {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,222 @@
+package core
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	fatMagic   = 0xcafebabe
+	fatMagic64 = 0xcafebabf
+
+	cpuSubtypeMask   = 0x00ffffff
+	cpuSubtypeArm64E = 2
+	fatArchHeader32  = 20
+	fatArchHeader64  = 32
+	fatHeaderSize    = 8
+)
+
+// fatSlice is an architecture entry of a fat header
+type fatSlice struct {
+	cpu    uint32
+	subCpu uint32
+	offset uint64
+	size   uint64
+	align  uint32
+}
+
+// arch returns the rule arch name of the slice
+func (s fatSlice) arch() string {
+	return machoArchName(macho.Cpu(s.cpu), s.subCpu)
+}
+
+// parseFatSlices reads the architecture entries of a fat header
+func parseFatSlices(data []byte) ([]fatSlice, bool, error) {
+	if len(data) < fatHeaderSize {
+		return nil, false, fmt.Errorf("truncated fat header")
+	}
+	is64 := binary.BigEndian.Uint32(data) == fatMagic64
+	count := int(binary.BigEndian.Uint32(data[4:]))
+	entrySize := fatArchHeader32
+	if is64 {
+		entrySize = fatArchHeader64
+	}
+	if fatHeaderSize+count*entrySize > len(data) {
+		return nil, false, fmt.Errorf("truncated fat header")
+	}
+
+	slices := make([]fatSlice, count)
+	for i := range slices {
+		entry := data[fatHeaderSize+i*entrySize:]
+		s := fatSlice{
+			cpu:    binary.BigEndian.Uint32(entry),
+			subCpu: binary.BigEndian.Uint32(entry[4:]),
+		}
+		if is64 {
+			s.offset = binary.BigEndian.Uint64(entry[8:])
+			s.size = binary.BigEndian.Uint64(entry[16:])
+			s.align = binary.BigEndian.Uint32(entry[24:])
+		} else {
+			s.offset = uint64(binary.BigEndian.Uint32(entry[8:]))
+			s.size = uint64(binary.BigEndian.Uint32(entry[12:]))
+			s.align = binary.BigEndian.Uint32(entry[16:])
+		}
+		if s.offset+s.size > uint64(len(data)) || s.align > 30 {
+			return nil, false, fmt.Errorf("invalid fat slice %d", i)
+		}
+		slices[i] = s
+	}
+	return slices, is64, nil
+}
+
+// writeFat builds a fat file holding images, described by slices in header
+// order. Images are laid out in the order of their original offsets, each
+// aligned to its slice alignment; keepOffsets keeps an image at its original
+// offset when it still fits there.
+func writeFat(slices []fatSlice, images [][]byte, is64, keepOffsets bool) ([]byte, error) {
+	entrySize := fatArchHeader32
+	magic := uint32(fatMagic)
+	if is64 {
+		entrySize = fatArchHeader64
+		magic = fatMagic64
+	}
+
+	out := make([]byte, fatHeaderSize+len(slices)*entrySize)
+	binary.BigEndian.PutUint32(out, magic)
+	binary.BigEndian.PutUint32(out[4:], uint32(len(slices)))
+
+	order := make([]int, len(slices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return slices[order[a]].offset < slices[order[b]].offset })
+
+	for _, i := range order {
+		s := slices[i]
+		offset := alignUp(uint64(len(out)), uint64(1)<<s.align)
+		if keepOffsets && s.offset > offset {
+			offset = s.offset
+		}
+		size := uint64(len(images[i]))
+		if !is64 && offset+size > 0xffffffff {
+			return nil, fmt.Errorf("fat file exceeds 4 GiB")
+		}
+		out = append(out, make([]byte, offset-uint64(len(out)))...)
+		out = append(out, images[i]...)
+
+		entry := out[fatHeaderSize+i*entrySize:]
+		binary.BigEndian.PutUint32(entry, s.cpu)
+		binary.BigEndian.PutUint32(entry[4:], s.subCpu)
+		if is64 {
+			binary.BigEndian.PutUint64(entry[8:], offset)
+			binary.BigEndian.PutUint64(entry[16:], size)
+			binary.BigEndian.PutUint32(entry[24:], s.align)
+		} else {
+			binary.BigEndian.PutUint32(entry[8:], uint32(offset))
+			binary.BigEndian.PutUint32(entry[12:], uint32(size))
+			binary.BigEndian.PutUint32(entry[16:], s.align)
+		}
+	}
+	return out, nil
+}
+
+// machoImages returns the thin images of a thin or fat Mach-O file
+func machoImages(data []byte) ([][]byte, error) {
+	if len(data) < 4 {
+		return nil, fmt.Errorf("file too small")
+	}
+	if !isFatMachO(data) {
+		return [][]byte{data}, nil
+	}
+	slices, _, err := parseFatSlices(data)
+	if err != nil {
+		return nil, err
+	}
+	images := make([][]byte, len(slices))
+	for i, s := range slices {
+		images[i] = data[s.offset : s.offset+s.size]
+	}
+	return images, nil
+}
+
+// isFatMachO reports whether data starts with a fat header
+func isFatMachO(data []byte) bool {
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case fatMagic, fatMagic64:
+		return true
+	}
+	return false
+}
+
+// ThinMachO keeps the slices of a fat Mach-O whose arch is listed in arches
+// and returns the rebuilt file with the names of the removed slices. A single
+// remaining slice is returned as a thin image. A thin input must match one
+// of arches and is returned unchanged.
+func ThinMachO(data []byte, arches []string) ([]byte, []string, error) {
+	keep := make(map[string]bool)
+	for _, arch := range arches {
+		keep[strings.ToLower(strings.TrimSpace(arch))] = true
+	}
+
+	if !isFatMachO(data) {
+		img, err := parseMachOImage(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		arch := machoArchName(macho.Cpu(img.cpu), img.subCpu)
+		if !keep[arch] {
+			return nil, nil, fmt.Errorf("thin Mach-O is %s, not one of %s", arch, strings.Join(arches, ","))
+		}
+		return data, nil, nil
+	}
+
+	slices, is64, err := parseFatSlices(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var kept []fatSlice
+	var images [][]byte
+	var removed []string
+	for _, s := range slices {
+		if keep[s.arch()] {
+			kept = append(kept, s)
+			images = append(images, data[s.offset:s.offset+s.size])
+		} else {
+			removed = append(removed, s.arch())
+		}
+	}
+
+	switch len(kept) {
+	case 0:
+		var present []string
+		for _, s := range slices {
+			present = append(present, s.arch())
+		}
+		return nil, nil, fmt.Errorf("no slice matches %s (file has %s)", strings.Join(arches, ","), strings.Join(present, ","))
+	case 1:
+		return images[0], removed, nil
+	}
+
+	out, err := writeFat(kept, images, is64, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, removed, nil
+}
+
+// ParseArchList splits a comma separated list of arch names, e.g. "arm64,arm64e"
+func ParseArchList(s string) []string {
+	var arches []string
+	for _, arch := range strings.Split(s, ",") {
+		if arch = strings.ToLower(strings.TrimSpace(arch)); arch != "" {
+			arches = append(arches, arch)
+		}
+	}
+	return arches
+}
@@ -0,0 +1,694 @@
+package core
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Mach-O load commands that carry linked names or __LINKEDIT tables
+const (
+	machoLoadSymtab        = 0x2
+	machoLoadDylib         = 0xc
+	machoLoadIDDylib       = 0xd
+	machoLoadLazyDylib     = 0x20
+	machoLoadDyldInfo      = 0x22
+	machoLoadWeakDylib     = 0x80000018
+	machoLoadRpath         = 0x8000001c
+	machoLoadReexportDylib = 0x8000001f
+	machoLoadDyldInfoOnly  = 0x80000022
+	machoLoadUpwardDylib   = 0x80000023
+	machoLoadExportsTrie   = 0x80000033
+	machoLoadChainedFixups = 0x80000034
+)
+
+// Export trie symbol flags
+const (
+	exportSymbolReexport        = 0x08
+	exportSymbolStubAndResolver = 0x10
+)
+
+// machoNameCommands names the load commands whose string is renamed, with
+// the kind reported for the renamed name
+var machoNameCommands = map[uint32]struct{ name, kind string }{
+	machoLoadIDDylib:       {"LC_ID_DYLIB", "install-name"},
+	machoLoadDylib:         {"LC_LOAD_DYLIB", "dylib"},
+	machoLoadWeakDylib:     {"LC_LOAD_WEAK_DYLIB", "dylib"},
+	machoLoadReexportDylib: {"LC_REEXPORT_DYLIB", "dylib"},
+	machoLoadLazyDylib:     {"LC_LAZY_LOAD_DYLIB", "dylib"},
+	machoLoadUpwardDylib:   {"LC_LOAD_UPWARD_DYLIB", "dylib"},
+	machoLoadRpath:         {"LC_RPATH", "rpath"},
+}
+
+// machoExport is one symbol of an export trie
+type machoExport struct {
+	name       string
+	flags      uint64
+	address    uint64 // dylib ordinal of a re-export
+	resolver   uint64 // stub resolver of a stub-and-resolver export
+	importName string // name in the re-exported dylib, empty for the same name
+}
+
+// linkeditTable is a table inside __LINKEDIT, as a range of the segment data
+type linkeditTable struct {
+	name       string
+	start, end int
+}
+
+// machoNames renames the linked names of one Mach-O image
+type machoNames struct {
+	file     *macho.File
+	base     int64 // offset of the image inside the file
+	arch     string
+	items    []*Replacement
+	report   *PatchReport
+	linkedit *macho.Segment
+	data     []byte // editable copy of __LINKEDIT
+	modified []linkeditTable
+	names    []DynamicName
+	problems int
+}
+
+// planMachONames renames the names a Mach-O image is linked by: the install
+// names and rpaths of its load commands, the symbol string table, the export
+// trie, the symbol names of bind opcodes and the chained fixups imports.
+// Strings are rewritten in place and the export trie is rebuilt inside its
+// original space, so no load command geometry changes and dyld keeps
+// binding; a code signature is refreshed by the re-signing step.
+func planMachONames(file *macho.File, base int64, items []*Replacement, arch string, report *PatchReport) ([]sectionPatch, error) {
+	linkedit := file.Segment("__LINKEDIT")
+	if linkedit == nil {
+		return nil, nil
+	}
+	data, err := linkedit.Data()
+	if err != nil {
+		return nil, fmt.Errorf("error reading __LINKEDIT: %v", err)
+	}
+	m := &machoNames{
+		file:     file,
+		base:     base,
+		arch:     arch,
+		items:    items,
+		report:   report,
+		linkedit: linkedit,
+		data:     data,
+	}
+	problems := len(report.Problems)
+
+	patches, err := m.renameLoadCommands()
+	if err != nil {
+		return nil, err
+	}
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		var err error
+		switch file.ByteOrder.Uint32(raw) {
+		case machoLoadSymtab:
+			err = m.renameSymbols(raw)
+		case machoLoadDyldInfo, machoLoadDyldInfoOnly:
+			for i, name := range []string{"bind", "weak bind", "lazy bind"} {
+				off, size := file.ByteOrder.Uint32(raw[16+i*8:]), file.ByteOrder.Uint32(raw[20+i*8:])
+				if err = m.renameBindNames(name, off, size); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = m.rebuildExportTrie(file.ByteOrder.Uint32(raw[40:]), file.ByteOrder.Uint32(raw[44:]))
+			}
+		case machoLoadExportsTrie:
+			err = m.rebuildExportTrie(file.ByteOrder.Uint32(raw[8:]), file.ByteOrder.Uint32(raw[12:]))
+		case machoLoadChainedFixups:
+			err = m.renameChainedImports(file.ByteOrder.Uint32(raw[8:]), file.ByteOrder.Uint32(raw[12:]))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(report.Problems) > problems || len(m.names) == 0 {
+		return nil, nil
+	}
+
+	rename := &DynamicRename{Names: m.names}
+	for _, table := range m.modified {
+		if table.name == "export trie" {
+			rename.Tables = append(rename.Tables, arch+" export trie")
+		}
+		patches = append(patches, sectionPatch{
+			Section: "__LINKEDIT " + table.name,
+			Offset:  base + int64(linkedit.Offset) + int64(table.start),
+			Data:    m.data[table.start:table.end],
+		})
+	}
+	report.addDynamic(rename)
+	return patches, nil
+}
+
+// addName records a renamed name once per image
+func (m *machoNames) addName(kind, original, replacement string) {
+	for _, name := range m.names {
+		if name.Original == original {
+			return
+		}
+	}
+	m.names = append(m.names, DynamicName{Arch: m.arch, Kind: kind, Original: original, Replacement: replacement})
+}
+
+// table returns the __LINKEDIT data of a table given by file offset and size
+func (m *machoNames) table(name string, off, size uint32) (linkeditTable, error) {
+	start := int64(off) - int64(m.linkedit.Offset)
+	end := start + int64(size)
+	if start < 0 || end > int64(len(m.data)) {
+		return linkeditTable{}, fmt.Errorf("%s at 0x%x+0x%x is outside __LINKEDIT", name, off, size)
+	}
+	return linkeditTable{name: name, start: int(start), end: int(end)}, nil
+}
+
+// addSection records matches and problems found inside a __LINKEDIT table
+func (m *machoNames) addSection(table linkeditTable, matches []sectionMatch, problems []FitProblem) {
+	m.report.addSection(m.arch, "__LINKEDIT", m.base+int64(m.linkedit.Offset)+int64(table.start),
+		m.linkedit.Addr+uint64(table.start), matches, problems)
+	if len(matches) > 0 && len(problems) == 0 {
+		m.modified = append(m.modified, table)
+	}
+}
+
+// renameLoadCommands rewrites the install names, dylib paths and rpaths
+// inside the space of their load commands
+func (m *machoNames) renameLoadCommands() ([]sectionPatch, error) {
+	order := m.file.ByteOrder
+	off := 28
+	if m.file.Magic == macho.Magic64 {
+		off = 32
+	}
+	var textAddr uint64
+	if text := m.file.Segment("__TEXT"); text != nil {
+		textAddr = text.Addr
+	}
+
+	var patches []sectionPatch
+	for _, load := range m.file.Loads {
+		raw := load.Raw()
+		cmdOff := off
+		off += len(raw)
+
+		command, ok := machoNameCommands[order.Uint32(raw)]
+		if !ok {
+			continue
+		}
+		if len(raw) < 12 || int(order.Uint32(raw[8:])) >= len(raw) {
+			return nil, fmt.Errorf("malformed %s", command.name)
+		}
+		nameOff := int(order.Uint32(raw[8:]))
+		name := cString(raw, uint32(nameOff))
+		newName, rule := renameString(name, m.items)
+		if newName == name {
+			continue
+		}
+
+		if len(newName)+1 > len(raw)-nameOff {
+			m.report.addSection(m.arch, command.name, m.base+int64(cmdOff), textAddr+uint64(cmdOff), nil, []FitProblem{{
+				Offset:      nameOff,
+				Original:    name,
+				Replacement: newName,
+				Reason:      fmt.Sprintf("%s needs %d bytes but the load command has %d", command.kind, len(newName)+1, len(raw)-nameOff),
+			}})
+			continue
+		}
+
+		rewritten := append([]byte(nil), raw...)
+		copy(rewritten[nameOff:], newName)
+		clear(rewritten[nameOff+len(newName):])
+		m.report.addSection(m.arch, command.name, m.base+int64(cmdOff), textAddr+uint64(cmdOff), []sectionMatch{{
+			Offset:      nameOff,
+			Rule:        rule,
+			Original:    append([]byte(nil), raw[nameOff:]...),
+			Replacement: rewritten[nameOff:],
+		}}, nil)
+		m.addName(command.kind, name, newName)
+		patches = append(patches, sectionPatch{Section: command.name, Offset: m.base + int64(cmdOff), Data: rewritten})
+	}
+	return patches, nil
+}
+
+// renameSymbols renames the symbol string table referenced by the nlist entries
+func (m *machoNames) renameSymbols(raw []byte) error {
+	order := m.file.ByteOrder
+	symoff, nsyms := order.Uint32(raw[8:]), order.Uint32(raw[12:])
+	stroff, strsize := order.Uint32(raw[16:]), order.Uint32(raw[20:])
+	entrySize := uint32(12)
+	if m.file.Magic == macho.Magic64 {
+		entrySize = 16
+	}
+	symbols, err := m.table("symbol table", symoff, nsyms*entrySize)
+	if err != nil {
+		return err
+	}
+	strtab, err := m.table("string table", stroff, strsize)
+	if err != nil {
+		return err
+	}
+
+	var refs []stringRef
+	for i := symbols.start; i < symbols.end; i += int(entrySize) {
+		if strx := order.Uint32(m.data[i:]); strx != 0 && strx < strsize {
+			refs = append(refs, stringRef{offset: strx, kind: "symbol"})
+		}
+	}
+	names, matches, problems := renameStringTable(m.data[strtab.start:strtab.end], refs, m.items)
+	m.addSection(strtab, matches, problems)
+	for _, name := range names {
+		m.addName(name.Kind, name.Original, name.Replacement)
+	}
+	return nil
+}
+
+// renameBindNames renames the symbol names inside a bind opcode stream. The
+// lazy binding stubs refer to offsets inside the stream, so names must keep
+// their length.
+func (m *machoNames) renameBindNames(name string, off, size uint32) error {
+	if size == 0 {
+		return nil
+	}
+	table, err := m.table(name+" info", off, size)
+	if err != nil {
+		return err
+	}
+	stream := m.data[table.start:table.end]
+
+	var matches []sectionMatch
+	var problems []FitProblem
+	err = walkBindNames(stream, func(pos int, symbol string) {
+		newSymbol, rule := renameString(symbol, m.items)
+		if newSymbol == symbol {
+			return
+		}
+		if len(newSymbol) != len(symbol) {
+			problems = append(problems, FitProblem{
+				Offset:      pos,
+				Original:    symbol,
+				Replacement: newSymbol,
+				Reason:      "names in bind opcodes must keep their length",
+			})
+			return
+		}
+		matches = append(matches, sectionMatch{Offset: pos, Rule: rule, Original: []byte(symbol), Replacement: []byte(newSymbol)})
+		copy(stream[pos:], newSymbol)
+		m.addName("bind", symbol, newSymbol)
+	})
+	if err != nil {
+		return fmt.Errorf("error parsing %s info: %v", name, err)
+	}
+	m.addSection(table, matches, problems)
+	return nil
+}
+
+// renameChainedImports renames the symbol pool of the chained fixups imports
+func (m *machoNames) renameChainedImports(off, size uint32) error {
+	table, err := m.table("chained fixups", off, size)
+	if err != nil {
+		return err
+	}
+	fixups := m.data[table.start:table.end]
+	if len(fixups) < 28 {
+		return fmt.Errorf("truncated chained fixups header")
+	}
+	importsOff := binary.LittleEndian.Uint32(fixups[8:])
+	symbolsOff := binary.LittleEndian.Uint32(fixups[12:])
+	count := binary.LittleEndian.Uint32(fixups[16:])
+	format := binary.LittleEndian.Uint32(fixups[20:])
+	if binary.LittleEndian.Uint32(fixups[24:]) != 0 {
+		return fmt.Errorf("compressed chained fixups symbols are not supported")
+	}
+
+	entrySize := map[uint32]uint32{1: 4, 2: 8, 3: 16}[format]
+	if entrySize == 0 {
+		return fmt.Errorf("unknown chained fixups import format %d", format)
+	}
+	if uint64(importsOff)+uint64(count)*uint64(entrySize) > uint64(len(fixups)) || symbolsOff > uint32(len(fixups)) {
+		return fmt.Errorf("malformed chained fixups imports")
+	}
+
+	pool := linkeditTable{name: "chained fixups symbols", start: table.start + int(symbolsOff), end: table.end}
+	var refs []stringRef
+	for i := uint32(0); i < count; i++ {
+		entry := fixups[importsOff+i*entrySize:]
+		nameOff := binary.LittleEndian.Uint32(entry) >> 9
+		if format == 3 {
+			nameOff = uint32(binary.LittleEndian.Uint64(entry) >> 32)
+		}
+		if int(nameOff) >= pool.end-pool.start {
+			return fmt.Errorf("chained fixups import %d has an invalid name offset", i)
+		}
+		refs = append(refs, stringRef{offset: nameOff, kind: "bind"})
+	}
+	names, matches, problems := renameStringTable(m.data[pool.start:pool.end], refs, m.items)
+	m.addSection(pool, matches, problems)
+	for _, name := range names {
+		m.addName(name.Kind, name.Original, name.Replacement)
+	}
+	return nil
+}
+
+// rebuildExportTrie renames the exported symbols and rebuilds the trie in
+// its original space
+func (m *machoNames) rebuildExportTrie(off, size uint32) error {
+	if size == 0 {
+		return nil
+	}
+	table, err := m.table("export trie", off, size)
+	if err != nil {
+		return err
+	}
+	trie := m.data[table.start:table.end]
+	exports, err := parseExportTrie(trie)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i := range exports {
+		e := &exports[i]
+		if name, _ := renameString(e.name, m.items); name != e.name {
+			m.addName("export", e.name, name)
+			e.name, changed = name, true
+		}
+		if e.importName != "" {
+			if name, _ := renameString(e.importName, m.items); name != e.importName {
+				m.addName("export", e.importName, name)
+				e.importName, changed = name, true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	rebuilt := buildExportTrie(exports)
+	if len(rebuilt) > len(trie) {
+		m.addSection(table, nil, []FitProblem{{
+			Original:    fmt.Sprintf("%d exports", len(exports)),
+			Replacement: fmt.Sprintf("%d bytes", len(rebuilt)),
+			Reason:      fmt.Sprintf("rebuilt export trie needs %d bytes but only %d are available", len(rebuilt), len(trie)),
+		}})
+		return nil
+	}
+	copy(trie, rebuilt)
+	clear(trie[len(rebuilt):])
+	m.modified = append(m.modified, table)
+	return nil
+}
+
+// walkBindNames calls visit with the position and name of every symbol set
+// by a bind opcode stream
+func walkBindNames(stream []byte, visit func(pos int, name string)) error {
+	r := &linkeditReader{data: stream}
+	for r.err == nil && r.pos < len(stream) {
+		b := stream[r.pos]
+		r.pos++
+		switch opcode, imm := b&0xf0, b&0x0f; opcode {
+		case 0x00, 0x10, 0x30, 0x50, 0x90, 0xb0:
+			// DONE, SET_DYLIB_ORDINAL_IMM, SET_DYLIB_SPECIAL_IMM, SET_TYPE_IMM,
+			// DO_BIND and DO_BIND_ADD_ADDR_IMM_SCALED carry no operand
+		case 0x20, 0x60, 0x70, 0x80, 0xa0:
+			// SET_DYLIB_ORDINAL_ULEB, SET_ADDEND_SLEB, SET_SEGMENT_AND_OFFSET_ULEB,
+			// ADD_ADDR_ULEB and DO_BIND_ADD_ADDR_ULEB carry one LEB128
+			r.uleb()
+		case 0xc0:
+			// DO_BIND_ULEB_TIMES_SKIPPING_ULEB
+			r.uleb()
+			r.uleb()
+		case 0xd0:
+			// THREADED: SET_BIND_ORDINAL_TABLE_SIZE_ULEB or APPLY
+			if imm == 0 {
+				r.uleb()
+			}
+		case 0x40:
+			// SET_SYMBOL_TRAILING_FLAGS_IMM
+			pos := r.pos
+			visit(pos, r.cstring())
+		default:
+			return fmt.Errorf("unknown bind opcode 0x%02x at 0x%x", b, r.pos-1)
+		}
+	}
+	return r.err
+}
+
+// parseExportTrie lists the exports of a trie
+func parseExportTrie(trie []byte) ([]machoExport, error) {
+	var exports []machoExport
+	visited := make(map[int]bool)
+
+	var walk func(off int, prefix string) error
+	walk = func(off int, prefix string) error {
+		if off >= len(trie) || visited[off] {
+			return fmt.Errorf("malformed export trie node at 0x%x", off)
+		}
+		visited[off] = true
+
+		r := &linkeditReader{data: trie, pos: off}
+		if size := int(r.uleb()); size > 0 {
+			end := r.pos + size
+			e := machoExport{name: prefix, flags: r.uleb()}
+			e.address = r.uleb()
+			if e.flags&exportSymbolReexport != 0 {
+				e.importName = r.cstring()
+			} else if e.flags&exportSymbolStubAndResolver != 0 {
+				e.resolver = r.uleb()
+			}
+			if r.pos > end {
+				return fmt.Errorf("malformed export of %s", prefix)
+			}
+			exports = append(exports, e)
+			r.pos = end
+		}
+		count := int(r.byte())
+		for i := 0; i < count && r.err == nil; i++ {
+			label := r.cstring()
+			child := int(r.uleb())
+			if r.err != nil {
+				break
+			}
+			if err := walk(child, prefix+label); err != nil {
+				return err
+			}
+		}
+		return r.err
+	}
+
+	if err := walk(0, ""); err != nil {
+		return nil, err
+	}
+	return exports, nil
+}
+
+// trieNode is a node of an export trie being built
+type trieNode struct {
+	terminal []byte
+	edges    []*trieEdge
+	offset   int
+}
+
+// trieEdge links a node to a child by a label
+type trieEdge struct {
+	label string
+	child *trieNode
+}
+
+// insert adds the terminal information of a symbol below node
+func (n *trieNode) insert(name string, terminal []byte) {
+	for _, e := range n.edges {
+		common := 0
+		for common < len(e.label) && common < len(name) && e.label[common] == name[common] {
+			common++
+		}
+		if common == 0 {
+			continue
+		}
+		if common < len(e.label) {
+			// Split the edge at the end of the common prefix
+			split := &trieNode{edges: []*trieEdge{{label: e.label[common:], child: e.child}}}
+			e.label, e.child = e.label[:common], split
+		}
+		e.child.insert(name[common:], terminal)
+		return
+	}
+	if name == "" {
+		n.terminal = terminal
+		return
+	}
+	n.edges = append(n.edges, &trieEdge{label: name, child: &trieNode{terminal: terminal}})
+}
+
+// size returns the encoded size of the node with the current child offsets
+func (n *trieNode) size() int {
+	size := ulebSize(uint64(len(n.terminal))) + len(n.terminal) + 1
+	for _, e := range n.edges {
+		size += len(e.label) + 1 + ulebSize(uint64(e.child.offset))
+	}
+	return size
+}
+
+// buildExportTrie encodes exports as a trie the way ld64 lays it out: nodes
+// in pre-order, with offsets recomputed until their LEB128 sizes settle
+func buildExportTrie(exports []machoExport) []byte {
+	sorted := append([]machoExport(nil), exports...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+
+	root := &trieNode{}
+	for _, e := range sorted {
+		terminal := appendULEB(nil, e.flags)
+		terminal = appendULEB(terminal, e.address)
+		if e.flags&exportSymbolReexport != 0 {
+			terminal = append(append(terminal, e.importName...), 0)
+		} else if e.flags&exportSymbolStubAndResolver != 0 {
+			terminal = appendULEB(terminal, e.resolver)
+		}
+		root.insert(e.name, terminal)
+	}
+
+	var nodes []*trieNode
+	var collect func(n *trieNode)
+	collect = func(n *trieNode) {
+		nodes = append(nodes, n)
+		for _, e := range n.edges {
+			collect(e.child)
+		}
+	}
+	collect(root)
+
+	for changed := true; changed; {
+		changed = false
+		offset := 0
+		for _, n := range nodes {
+			if n.offset != offset {
+				n.offset, changed = offset, true
+			}
+			offset += n.size()
+		}
+	}
+
+	var out []byte
+	for _, n := range nodes {
+		out = appendULEB(out, uint64(len(n.terminal)))
+		out = append(out, n.terminal...)
+		out = append(out, byte(len(n.edges)))
+		for _, e := range n.edges {
+			out = append(append(out, e.label...), 0)
+			out = appendULEB(out, uint64(e.child.offset))
+		}
+	}
+	return out
+}
+
+// verifyMachONames checks that the export trie of a Mach-O image still parses
+func verifyMachONames(file *macho.File) error {
+	linkedit := file.Segment("__LINKEDIT")
+	if linkedit == nil {
+		return nil
+	}
+	data, err := linkedit.Data()
+	if err != nil {
+		return err
+	}
+	m := &machoNames{file: file, linkedit: linkedit, data: data}
+	for _, load := range file.Loads {
+		raw := load.Raw()
+		var off, size uint32
+		switch file.ByteOrder.Uint32(raw) {
+		case machoLoadDyldInfo, machoLoadDyldInfoOnly:
+			off, size = file.ByteOrder.Uint32(raw[40:]), file.ByteOrder.Uint32(raw[44:])
+		case machoLoadExportsTrie:
+			off, size = file.ByteOrder.Uint32(raw[8:]), file.ByteOrder.Uint32(raw[12:])
+		default:
+			continue
+		}
+		if size == 0 {
+			continue
+		}
+		table, err := m.table("export trie", off, size)
+		if err != nil {
+			return err
+		}
+		if _, err := parseExportTrie(data[table.start:table.end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkeditReader decodes the LEB128 numbers and strings of __LINKEDIT tables
+type linkeditReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// byte reads one byte
+func (r *linkeditReader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.fail()
+		return 0
+	}
+	r.pos++
+	return r.data[r.pos-1]
+}
+
+// uleb reads an unsigned LEB128 number; signed numbers are skipped the same way
+func (r *linkeditReader) uleb() uint64 {
+	var v uint64
+	for shift := uint(0); r.err == nil; shift += 7 {
+		b := r.byte()
+		if shift < 64 {
+			v |= uint64(b&0x7f) << shift
+		}
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	return v
+}
+
+// cstring reads a NUL-terminated string
+func (r *linkeditReader) cstring() string {
+	start := r.pos
+	for r.pos < len(r.data) && r.data[r.pos] != 0 {
+		r.pos++
+	}
+	if r.pos >= len(r.data) {
+		r.fail()
+		return ""
+	}
+	r.pos++
+	return string(r.data[start : r.pos-1])
+}
+
+// fail records a read past the end of the data
+func (r *linkeditReader) fail() {
+	if r.err == nil {
+		r.err = fmt.Errorf("truncated data at 0x%x", r.pos)
+	}
+}
+
+// appendULEB appends v as an unsigned LEB128 number
+func appendULEB(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b = append(b, c|0x80)
+			continue
+		}
+		return append(b, c)
+	}
+}
+
+// ulebSize returns the encoded size of v as an unsigned LEB128 number
+func ulebSize(v uint64) int {
+	size := 1
+	for v >= 0x80 {
+		v >>= 7
+		size++
+	}
+	return size
+}
@@ -0,0 +1,374 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"fridare-gui/internal/utils"
+)
+
+// Magisk 安装时 $ARCH 对应的ABI，按优先顺序回退 (64位设备可运行32位frida-server)
+var magiskArchABIs = []struct {
+	arch string
+	abis []string
+}{
+	{"arm64", []string{"arm64-v8a", "armeabi-v7a"}},
+	{"arm", []string{"armeabi-v7a"}},
+	{"x64", []string{"x86_64", "x86"}},
+	{"x86", []string{"x86"}},
+}
+
+// magiskModuleID 模块ID的格式要求
+var magiskModuleID = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9._-]+$`)
+
+// magiskUpdateBinary 标准的Magisk模块安装脚本，KernelSU 忽略此文件自行安装
+const magiskUpdateBinary = `#!/sbin/sh
+
+#################
+# Initialization
+#################
+
+umask 022
+
+# echo before loading util_functions
+ui_print() { echo "$1"; }
+
+require_new_magisk() {
+  ui_print "*******************************"
+  ui_print " Please install Magisk v20.4+! "
+  ui_print "*******************************"
+  exit 1
+}
+
+#########################
+# Load util_functions.sh
+#########################
+
+OUTFD=$2
+ZIPFILE=$3
+
+mount /data 2>/dev/null
+
+[ -f /data/adb/magisk/util_functions.sh ] || require_new_magisk
+. /data/adb/magisk/util_functions.sh
+[ $MAGISK_VER_CODE -lt 20400 ] && require_new_magisk
+
+install_module
+exit 0
+`
+
+// MagiskModulePackager Magisk/KernelSU 模块构建器: 将魔改后的各ABI frida-server
+// 打包为可刷入的模块zip，安装时按设备架构选择二进制，开机后由 service.sh 以自定义端口启动
+type MagiskModulePackager struct {
+	Servers        map[string]string // ABI -> frida-server 路径
+	OutputPath     string
+	MagicName      string
+	Port           int
+	SELinuxContext string         // 启动frida-server使用的SELinux上下文 (如 u:r:magisk:s0)，空表示不切换
+	ModuleID       string         // 模块ID，默认 <魔改名>_server
+	Version        string         // 模块版本，默认 frida-server 版本 17.2.17，同时用于筛选按版本限定的替换规则
+	Author         string         // 作者
+	Description    string         // 模块描述 (可选, 自动生成)
+	Rules          *RuleSet       // 替换规则集 (nil 使用内置默认规则)
+	PatchPort      bool           // 同时修补frida-server二进制中的默认端口
+	Reports        []*PatchReport // 二进制替换报告
+
+	RuntimeOptions // 监听地址、TLS证书、认证令牌等运行参数
+}
+
+// NewMagiskModulePackager 创建Magisk模块构建器
+func NewMagiskModulePackager(outputPath, magicName string, port int) *MagiskModulePackager {
+	return &MagiskModulePackager{
+		Servers:    make(map[string]string),
+		OutputPath: outputPath,
+		MagicName:  magicName,
+		Port:       port,
+		Version:    "17.2.17",
+		Author:     "Fridare Team",
+
+		RuntimeOptions: RuntimeOptions{Address: "0.0.0.0"},
+	}
+}
+
+// moduleID 返回模块ID
+func (mp *MagiskModulePackager) moduleID() string {
+	if mp.ModuleID != "" {
+		return mp.ModuleID
+	}
+	return mp.MagicName + "_server"
+}
+
+// versionCode 由版本号生成递增的整数版本 (17.2.17 -> 170217)
+func (mp *MagiskModulePackager) versionCode() int {
+	code := 0
+	parts := strings.SplitN(strings.TrimPrefix(mp.Version, "v"), ".", 3)
+	for i := 0; i < 3; i++ {
+		code *= 100
+		if i < len(parts) {
+			n, _ := strconv.Atoi(strings.TrimFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' }))
+			code += n % 100
+		}
+	}
+	if code == 0 {
+		code = 1
+	}
+	return code
+}
+
+// CreateModule 创建模块zip
+func (mp *MagiskModulePackager) CreateModule(progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始创建Magisk模块 - 输出: %s, 魔改名: %s, 端口: %d", mp.OutputPath, mp.MagicName, mp.Port)
+	if progressCallback == nil {
+		progressCallback = func(float64, string) {}
+	}
+	if mp.MagicName == "" {
+		return fmt.Errorf("未指定魔改名称")
+	}
+	if len(mp.Servers) == 0 {
+		return fmt.Errorf("未指定frida-server")
+	}
+	if mp.Port < 1 || mp.Port > 65535 {
+		return fmt.Errorf("端口必须在1-65535范围内")
+	}
+	if !magiskModuleID.MatchString(mp.moduleID()) {
+		return fmt.Errorf("模块ID格式错误: %s", mp.moduleID())
+	}
+	if strings.ContainsAny(mp.SELinuxContext, "\"'`$\\ \n") {
+		return fmt.Errorf("SELinux上下文格式错误: %s", mp.SELinuxContext)
+	}
+	if err := mp.RuntimeOptions.Validate(); err != nil {
+		return err
+	}
+
+	tempDir, err := os.MkdirTemp("", "fridare-magisk-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 1. 按ABI魔改frida-server
+	abis := make([]string, 0, len(mp.Servers))
+	for abi := range mp.Servers {
+		abis = append(abis, abi)
+	}
+	sort.Strings(abis)
+
+	var entries []*zipEntry
+	mp.Reports = nil
+	for i, abi := range abis {
+		serverPath := mp.Servers[abi]
+		progressCallback(0.1+0.6*float64(i)/float64(len(abis)), fmt.Sprintf("魔改 %s frida-server...", abi))
+
+		detected, err := DetectAndroidABI(serverPath)
+		if err != nil {
+			return fmt.Errorf("%s: %v", serverPath, err)
+		}
+		if detected != abi {
+			return fmt.Errorf("%s 的架构为 %s，与指定的ABI %s 不符", serverPath, detected, abi)
+		}
+
+		hexReplacer := NewHexReplacer()
+		hexReplacer.Rules = mp.Rules
+		hexReplacer.FridaVersion = mp.Version
+		if mp.PatchPort {
+			hexReplacer.Port = mp.Port
+		}
+		targetPath := filepath.Join(tempDir, abi, mp.MagicName)
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		report, err := hexReplacer.PatchFileWithReport(serverPath, mp.MagicName, targetPath, nil)
+		if err != nil {
+			return fmt.Errorf("HEX替换 %s frida-server失败: %v", abi, err)
+		}
+		name := "bin/" + abi + "/" + mp.MagicName
+		report.File = name
+		mp.Reports = append(mp.Reports, report)
+
+		data, err := os.ReadFile(targetPath)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &zipEntry{name: name, data: data, mode: 0755})
+		log.Printf("INFO: %s frida-server 魔改完成，替换 %d 处", abi, report.Count())
+	}
+
+	// 2. 模块脚本和描述
+	progressCallback(0.75, "生成模块脚本...")
+	scripts := []*zipEntry{
+		{name: "META-INF/com/google/android/update-binary", data: []byte(magiskUpdateBinary), mode: 0755},
+		{name: "META-INF/com/google/android/updater-script", data: []byte("#MAGISK\n"), mode: 0644},
+		{name: "module.prop", data: mp.modulePropContent(), mode: 0644},
+		{name: "customize.sh", data: mp.customizeScript(abis), mode: 0755},
+		{name: "service.sh", data: mp.serviceScript(), mode: 0755},
+		{name: "uninstall.sh", data: mp.uninstallScript(), mode: 0755},
+	}
+	if mp.Certificate != "" {
+		cert, err := mp.certificateData()
+		if err != nil {
+			return err
+		}
+		scripts = append(scripts, &zipEntry{name: mp.certificateName(), data: cert, mode: 0600})
+	}
+	entries = append(scripts, entries...)
+
+	// 3. 写出zip
+	progressCallback(0.85, "打包模块...")
+	staged, err := utils.CreateAtomic(mp.OutputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer staged.Abort()
+	if err := writeAlignedZip(staged.File, entries); err != nil {
+		return fmt.Errorf("写入模块失败: %v", err)
+	}
+	if err := staged.Commit(mp.verifyModule); err != nil {
+		return err
+	}
+
+	logResidualFingerprints(mp.Reports)
+	progressCallback(1.0, "Magisk模块创建完成!")
+	log.Printf("SUCCESS: Magisk模块创建成功: %s (%s)", mp.OutputPath, strings.Join(abis, ", "))
+	return nil
+}
+
+// modulePropContent 生成 module.prop
+func (mp *MagiskModulePackager) modulePropContent() []byte {
+	description := mp.Description
+	if description == "" {
+		description = fmt.Sprintf("Dynamic instrumentation toolkit server, listening on %s (Modified: %s)", mp.ListenAddress(mp.Port), mp.MagicName)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id=%s\n", mp.moduleID())
+	fmt.Fprintf(&buf, "name=%s server\n", mp.MagicName)
+	fmt.Fprintf(&buf, "version=%s\n", mp.Version)
+	fmt.Fprintf(&buf, "versionCode=%d\n", mp.versionCode())
+	fmt.Fprintf(&buf, "author=%s\n", strings.ReplaceAll(mp.Author, "\n", " "))
+	fmt.Fprintf(&buf, "description=%s\n", strings.ReplaceAll(description, "\n", " "))
+	return buf.Bytes()
+}
+
+// certificateName 返回模块内TLS证书的文件名
+func (mp *MagiskModulePackager) certificateName() string {
+	return CertificateName(mp.MagicName)
+}
+
+// customizeScript 生成 customize.sh，按设备架构保留一个frida-server
+func (mp *MagiskModulePackager) customizeScript(abis []string) []byte {
+	var cases strings.Builder
+	for _, entry := range magiskArchABIs {
+		var candidates []string
+		for _, abi := range entry.abis {
+			for _, included := range abis {
+				if abi == included {
+					candidates = append(candidates, abi)
+				}
+			}
+		}
+		if len(candidates) > 0 {
+			fmt.Fprintf(&cases, "  %s) ABIS=\"%s\" ;;\n", entry.arch, strings.Join(candidates, " "))
+		}
+	}
+
+	certPerm := ""
+	if mp.Certificate != "" {
+		// 证书包含私钥，仅 root 可读
+		certPerm = fmt.Sprintf("set_perm \"$MODPATH/%s\" 0 0 0600\n", mp.certificateName())
+	}
+
+	return []byte(fmt.Sprintf(`# Magisk/KernelSU 安装脚本，按设备架构选择frida-server
+
+case "$ARCH" in
+%s  *) abort "! 模块不包含 $ARCH 架构的frida-server" ;;
+esac
+
+for ABI in $ABIS; do
+  [ -f "$MODPATH/bin/$ABI/%[2]s" ] && break
+done
+ui_print "- 设备架构: $ARCH, 安装 $ABI frida-server"
+
+mv "$MODPATH/bin/$ABI/%[2]s" "$MODPATH/%[2]s"
+rm -rf "$MODPATH/bin"
+
+set_perm_recursive "$MODPATH" 0 0 0755 0644
+set_perm "$MODPATH/%[2]s" 0 0 0755
+set_perm "$MODPATH/service.sh" 0 0 0755
+set_perm "$MODPATH/uninstall.sh" 0 0 0755
+%[4]s
+ui_print "- 开机后监听 %[3]s"
+`, cases.String(), mp.MagicName, mp.ListenAddress(mp.Port), certPerm))
+}
+
+// serviceScript 生成 service.sh，系统启动完成后运行frida-server
+func (mp *MagiskModulePackager) serviceScript() []byte {
+	listen := fmt.Sprintf("LISTEN=\"%s\"", mp.ListenAddress(mp.Port))
+	command := `"$SERVER" -D -l "$LISTEN"`
+	if extra := mp.extraArgs("$MODDIR/" + mp.certificateName()); len(extra) > 0 {
+		listen += fmt.Sprintf("\nARGS=\"%s\"", strings.Join(extra, " "))
+		command += " $ARGS"
+	}
+	launch := command
+	if mp.SELinuxContext != "" {
+		launch = fmt.Sprintf(`if command -v runcon >/dev/null 2>&1; then
+  runcon %s %s
+else
+  %s
+fi`, mp.SELinuxContext, command, command)
+	}
+
+	return []byte(fmt.Sprintf(`#!/system/bin/sh
+MODDIR=${0%%/*}
+SERVER="$MODDIR/%s"
+%s
+
+# 等待系统启动完成
+until [ "$(getprop sys.boot_completed)" = "1" ]; do
+  sleep 1
+done
+
+[ -x "$SERVER" ] || exit 0
+%s
+`, mp.MagicName, listen, launch))
+}
+
+// uninstallScript 生成 uninstall.sh，移除模块时停止frida-server
+func (mp *MagiskModulePackager) uninstallScript() []byte {
+	return []byte(fmt.Sprintf(`#!/system/bin/sh
+MODDIR=${0%%/*}
+
+pkill -f "$MODDIR/%s" 2>/dev/null
+`, mp.MagicName))
+}
+
+// verifyModule 校验生成的模块zip
+func (mp *MagiskModulePackager) verifyModule(tempPath string) error {
+	reader, err := zip.OpenReader(tempPath)
+	if err != nil {
+		return fmt.Errorf("模块zip无效: %v", err)
+	}
+	defer reader.Close()
+
+	required := map[string]bool{"module.prop": false, "customize.sh": false, "service.sh": false, "META-INF/com/google/android/update-binary": false}
+	for abi := range mp.Servers {
+		required["bin/"+abi+"/"+mp.MagicName] = false
+	}
+	for _, f := range reader.File {
+		if _, ok := required[f.Name]; ok {
+			required[f.Name] = true
+		}
+	}
+	for name, found := range required {
+		if !found {
+			return fmt.Errorf("模块缺少 %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// HexBytes is a byte slice that is rendered as a hex string in JSON reports
+type HexBytes []byte
+
+// MarshalJSON encodes the bytes as a hex string
+func (b HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a hex string
+func (b *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// PatchEntry describes a single replacement the patcher made or would make
+type PatchEntry struct {
+	Format         string   `json:"format"`
+	Arch           string   `json:"arch,omitempty"` // architecture slice of a fat Mach-O or the file's CPU
+	Section        string   `json:"section"`
+	Rule           string   `json:"rule"` // original string of the rule that matched
+	FileOffset     int64    `json:"file_offset"`
+	VirtualAddress uint64   `json:"virtual_address"`
+	Original       HexBytes `json:"original"`
+	Replacement    HexBytes `json:"replacement"`
+}
+
+// PatchReport lists every replacement of a patch run
+type PatchReport struct {
+	File     string       `json:"file"`
+	Name     string       `json:"name"`
+	Format   string       `json:"format"`
+	Rules    string       `json:"rules"`
+	DryRun   bool         `json:"dry_run"`
+	Entries  []PatchEntry `json:"entries"`
+	Problems []FitProblem `json:"problems,omitempty"`
+	// Skipped lists the matches left unpatched because their shorter
+	// replacement could not be written safely; they remain as residual
+	Skipped []FitProblem `json:"skipped,omitempty"`
+	// Port is the default port plan when port patching was requested
+	Port *PortPlan `json:"port,omitempty"`
+	// Residual lists the Frida signatures still present in the patched output
+	Residual []FingerprintHit `json:"residual,omitempty"`
+	// Signature lists the re-signed slices of a Mach-O output
+	Signature []SignedSlice `json:"signature,omitempty"`
+	// Slices summarizes the matches of each slice of a fat Mach-O
+	Slices []SliceReport `json:"slices,omitempty"`
+	// Removed lists the slices dropped by thinning
+	Removed []string `json:"removed_arches,omitempty"`
+	// Dynamic lists the renamed symbol and library names and the rebuilt tables
+	Dynamic *DynamicRename `json:"dynamic,omitempty"`
+	// Checksum is the recomputed optional header checksum of a PE output
+	Checksum *PEChecksum `json:"checksum,omitempty"`
+}
+
+// SliceReport summarizes the matches of one slice of a fat Mach-O
+type SliceReport struct {
+	Arch     string   `json:"arch"`
+	Offset   int64    `json:"offset"`
+	Size     int64    `json:"size"`
+	Matches  int      `json:"matches"`
+	Problems int      `json:"problems"`
+	Rules    []string `json:"rules,omitempty"` // distinct rules that matched, in match order
+}
+
+// addSlice summarizes the entries and problems recorded for a slice since
+// the given counts
+func (r *PatchReport) addSlice(arch string, offset, size int64, entries, problems int) {
+	slice := SliceReport{
+		Arch:     arch,
+		Offset:   offset,
+		Size:     size,
+		Matches:  len(r.Entries) - entries,
+		Problems: len(r.Problems) - problems,
+	}
+	seen := make(map[string]bool)
+	for _, e := range r.Entries[entries:] {
+		if !seen[e.Rule] {
+			seen[e.Rule] = true
+			slice.Rules = append(slice.Rules, e.Rule)
+		}
+	}
+	r.Slices = append(r.Slices, slice)
+}
+
+// addDynamic merges the renamed names and rebuilt tables of one image
+func (r *PatchReport) addDynamic(rename *DynamicRename) {
+	if r.Dynamic == nil {
+		r.Dynamic = &DynamicRename{}
+	}
+	r.Dynamic.Names = append(r.Dynamic.Names, rename.Names...)
+	r.Dynamic.Tables = append(r.Dynamic.Tables, rename.Tables...)
+	r.Dynamic.Reordered += rename.Reordered
+}
+
+// Count returns the number of replacements in the report
+func (r *PatchReport) Count() int {
+	return len(r.Entries)
+}
+
+// addSection records the matches and problems found in one section
+func (r *PatchReport) addSection(arch, section string, fileOffset int64, vaddr uint64, matches []sectionMatch, problems []FitProblem) {
+	for _, m := range matches {
+		r.Entries = append(r.Entries, PatchEntry{
+			Format:         r.Format,
+			Arch:           arch,
+			Section:        section,
+			Rule:           m.Rule,
+			FileOffset:     fileOffset + int64(m.Offset),
+			VirtualAddress: vaddr + uint64(m.Offset),
+			Original:       m.Original,
+			Replacement:    m.Replacement,
+		})
+	}
+	r.Problems = append(r.Problems, withSection(problems, section, arch)...)
+}
+
+// addSkipped records the matches of one section left unpatched
+func (r *PatchReport) addSkipped(arch, section string, skipped []FitProblem) {
+	r.Skipped = append(r.Skipped, withSection(skipped, section, arch)...)
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *PatchReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as a human readable table
+func (r *PatchReport) WriteText(w io.Writer) error {
+	mode := "patch"
+	if r.DryRun {
+		mode = "dry-run"
+	}
+	fmt.Fprintf(w, "File:    %s\n", r.File)
+	fmt.Fprintf(w, "Format:  %s\n", r.Format)
+	fmt.Fprintf(w, "Name:    %s\n", r.Name)
+	fmt.Fprintf(w, "Rules:   %s\n", r.Rules)
+	fmt.Fprintf(w, "Mode:    %s\n", mode)
+	fmt.Fprintf(w, "Matches: %d\n\n", r.Count())
+
+	if len(r.Entries) > 0 {
+		fmt.Fprintf(w, "%-8s %-10s %-12s %-10s %-12s %-24s %s\n", "ARCH", "SECTION", "OFFSET", "VADDR", "RULE", "ORIGINAL", "REPLACEMENT")
+		for _, e := range r.Entries {
+			fmt.Fprintf(w, "%-8s %-10s 0x%-10x 0x%-8x %-12s %-24s %s\n",
+				e.Arch, e.Section, e.FileOffset, e.VirtualAddress, e.Rule,
+				printableBytes(e.Original), printableBytes(e.Replacement))
+		}
+	}
+
+	if len(r.Slices) > 0 || len(r.Removed) > 0 {
+		fmt.Fprintf(w, "\nSlices:  %d", len(r.Slices))
+		if len(r.Removed) > 0 {
+			fmt.Fprintf(w, " (removed %s)", strings.Join(r.Removed, ", "))
+		}
+		fmt.Fprintln(w)
+		for _, s := range r.Slices {
+			fmt.Fprintf(w, "  - %-8s offset 0x%-8x size 0x%-8x %3d match(es) %d problem(s)", s.Arch, s.Offset, s.Size, s.Matches, s.Problems)
+			if len(s.Rules) > 0 {
+				fmt.Fprintf(w, ": %s", strings.Join(s.Rules, ", "))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if r.Dynamic != nil {
+		fmt.Fprintf(w, "\nDynamic: %d name(s)", len(r.Dynamic.Names))
+		if len(r.Dynamic.Tables) > 0 {
+			fmt.Fprintf(w, ", rebuilt %s", strings.Join(r.Dynamic.Tables, ", "))
+		}
+		if r.Dynamic.Reordered > 0 {
+			fmt.Fprintf(w, ", %d symbol(s) reordered", r.Dynamic.Reordered)
+		}
+		fmt.Fprintln(w)
+		for _, n := range r.Dynamic.Names {
+			fmt.Fprintf(w, "  - %-8s %-12s %s -> %s\n", n.Arch, n.Kind, n.Original, n.Replacement)
+		}
+	}
+
+	if len(r.Problems) > 0 {
+		fmt.Fprintf(w, "\nProblems: %d\n", len(r.Problems))
+		for _, p := range r.Problems {
+			fmt.Fprintf(w, "  - %s %s+0x%x %q -> %q: %s\n", p.Arch, p.Section, p.Offset, p.Original, p.Replacement, p.Reason)
+		}
+	}
+
+	if len(r.Skipped) > 0 {
+		fmt.Fprintf(w, "\nSkipped: %d (left unpatched)\n", len(r.Skipped))
+		for _, p := range r.Skipped {
+			fmt.Fprintf(w, "  - %s %s+0x%x %q -> %q: %s\n", p.Arch, p.Section, p.Offset, p.Original, p.Replacement, p.Reason)
+		}
+	}
+
+	if r.Port != nil {
+		fmt.Fprintf(w, "\nPort:    %d -> %d (%d site(s), %d rejected)\n", r.Port.Port, r.Port.NewPort, len(r.Port.Sites), len(r.Port.Rejected))
+		for _, site := range r.Port.Rejected {
+			fmt.Fprintf(w, "  - rejected %s %s 0x%x %s: %s\n", site.Arch, site.Section, site.FileOffset, site.Kind, site.Reason)
+		}
+	}
+
+	if r.Checksum != nil {
+		fmt.Fprintf(w, "\nChecksum: 0x%08x -> 0x%08x\n", r.Checksum.Original, r.Checksum.Updated)
+	}
+
+	if len(r.Signature) > 0 {
+		fmt.Fprintf(w, "\nSigned:  %d slice(s), ad-hoc\n", len(r.Signature))
+		for _, s := range r.Signature {
+			fmt.Fprintf(w, "  - %s %s (%s, %d pages, entitlements %s)\n", s.Arch, s.Identifier, strings.Join(s.HashTypes, "+"), s.CodeSlots, s.Entitlements)
+		}
+	}
+
+	if !r.DryRun && len(r.Problems) == 0 {
+		fmt.Fprintln(w)
+		return writeFingerprintHits(w, r.Residual, 50)
+	}
+	return nil
+}
+
+// printableBytes renders bytes as a quoted string with trailing NUL padding collapsed
+func printableBytes(b []byte) string {
+	trimmed := strings.TrimRight(string(b), "\x00")
+	s := fmt.Sprintf("%q", trimmed)
+	if pad := len(b) - len(trimmed); pad > 0 {
+		s += fmt.Sprintf("+%d*NUL", pad)
+	}
+	return s
+}
+
+// WritePatchReports writes several reports in the given format ("text" or "json");
+// JSON output is a single array so it can be piped into other tools
+func WritePatchReports(w io.Writer, reports []*PatchReport, format string) error {
+	switch format {
+	case "json":
+		if reports == nil {
+			reports = []*PatchReport{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(reports)
+	case "text", "":
+		for i, report := range reports {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if err := report.WriteText(w); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown report format %q (expected text or json)", format)
+	}
+}
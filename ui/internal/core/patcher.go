@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"fmt"
+	"fridare-gui/internal/utils"
 	"io"
 	"os"
 	"path/filepath"
@@ -109,7 +110,7 @@ func (bp *BinaryPatcher) PatchFile(inputPath, outputPath string, patches []Patch
 
 	// 创建备份
 	backupPath := inputPath + ".bak"
-	if err := os.WriteFile(backupPath, data, 0644); err != nil {
+	if err := utils.WriteFileAtomic(backupPath, data, 0644); err != nil {
 		return fmt.Errorf("创建备份文件失败: %w", err)
 	}
 
@@ -136,8 +137,8 @@ func (bp *BinaryPatcher) PatchFile(inputPath, outputPath string, patches []Patch
 		patchedData = bytes.ReplaceAll(patchedData, originalBytes, replacementBytes)
 	}
 
-	// 保存修补后的文件
-	if err := os.WriteFile(outputPath, patchedData, 0755); err != nil {
+	// 保存修补后的文件 (原子替换，失败时输出文件保持不变)
+	if err := utils.WriteFileAtomic(outputPath, patchedData, 0755); err != nil {
 		return fmt.Errorf("写入输出文件失败: %w", err)
 	}
 
@@ -146,8 +147,8 @@ func (bp *BinaryPatcher) PatchFile(inputPath, outputPath string, patches []Patch
 
 // GenerateNamePatch 生成名称修补信息
 func (bp *BinaryPatcher) GenerateNamePatch(newName string) (string, error) {
-	if len(newName) != 5 {
-		return "", fmt.Errorf("名称必须是5个字符")
+	if len(newName) == 0 || len(newName) > utils.MaxSafeMagicNameLen {
+		return "", fmt.Errorf("名称必须是1-%d个字符", utils.MaxSafeMagicNameLen)
 	}
 
 	// 将新名称转换为十六进制，并添加$server后缀
@@ -155,20 +156,15 @@ func (bp *BinaryPatcher) GenerateNamePatch(newName string) (string, error) {
 	return hex.EncodeToString([]byte(nameWithSuffix)), nil
 }
 
-// GeneratePortPatch 生成端口修补信息
+// GeneratePortPatch 生成端口修补信息，返回默认端口和新端口的小端32位立即数
+// 注意: 直接替换这些字节并不安全，实际修补请使用 HexReplacer.Port (经反汇编确认后才会替换)
 func (bp *BinaryPatcher) GeneratePortPatch(port int) (string, string, error) {
 	if port < 1024 || port > 65535 {
 		return "", "", fmt.Errorf("端口号必须在1024-65535范围内")
 	}
 
-	// 这里需要根据具体的二进制格式来生成端口修补
-	// 这是一个简化的实现，实际可能需要更复杂的逻辑
-	originalPort := 27042 // 默认端口
-
-	// 生成原始端口的十六进制表示
-	originalHex := fmt.Sprintf("%04X", originalPort)
-	// 生成新端口的十六进制表示
-	newHex := fmt.Sprintf("%04X", port)
+	originalHex := strings.ToUpper(hex.EncodeToString(putUint32(DefaultFridaPort)))
+	newHex := strings.ToUpper(hex.EncodeToString(putUint32(uint32(port))))
 
 	return originalHex, newHex, nil
 }
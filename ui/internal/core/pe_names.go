@@ -0,0 +1,517 @@
+package core
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf16"
+)
+
+// Resource types rewritten by the resource stage
+const (
+	peResourceVersion  = 16 // RT_VERSION
+	peResourceManifest = 24 // RT_MANIFEST
+)
+
+// PEChecksum records the optional header checksum recomputed after patching
+type PEChecksum struct {
+	Original uint32 `json:"original"`
+	Updated  uint32 `json:"updated"`
+}
+
+// peRegion is the content of an RVA range of a PE file
+type peRegion struct {
+	rva        uint32
+	fileOffset int64
+	data       []byte
+}
+
+// readPERegion reads an RVA range with the pending patches applied, so
+// structured stages build on the raw section replacements
+func readPERegion(file *pe.File, rva, size uint32, pending []sectionPatch) (*peRegion, error) {
+	for _, s := range file.Sections {
+		if rva < s.VirtualAddress || uint64(rva)+uint64(size) > uint64(s.VirtualAddress)+uint64(s.Size) {
+			continue
+		}
+		region := &peRegion{
+			rva:        rva,
+			fileOffset: int64(s.Offset) + int64(rva-s.VirtualAddress),
+			data:       make([]byte, size),
+		}
+		if _, err := s.ReadAt(region.data, int64(rva-s.VirtualAddress)); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", s.Name, err)
+		}
+		for _, patch := range pending {
+			copyOverlap(region.data, region.fileOffset, patch.Data, patch.Offset)
+		}
+		return region, nil
+	}
+	return nil, fmt.Errorf("RVA range 0x%x+0x%x is not backed by file data", rva, size)
+}
+
+// offset returns the offset of an RVA inside the region
+func (r *peRegion) offset(rva uint32, size int) (int, bool) {
+	if rva < r.rva || int64(rva-r.rva)+int64(size) > int64(len(r.data)) {
+		return 0, false
+	}
+	return int(rva - r.rva), true
+}
+
+// planPEExports renames the export names, forwarders and the DLL name of
+// the export directory in place. The name pointer table is sorted again
+// with its ordinals afterwards, since GetProcAddress binary-searches it and
+// the raw section rules may have renamed names as well.
+func planPEExports(file *pe.File, items []*Replacement, arch string, report *PatchReport, pending []sectionPatch) ([]sectionPatch, error) {
+	dir := peDataDirectory(file, pe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if dir.Size < 40 {
+		return nil, nil
+	}
+	region, err := readPERegion(file, dir.VirtualAddress, dir.Size, pending)
+	if err != nil {
+		return nil, fmt.Errorf("error reading export directory: %v", err)
+	}
+	data := region.data
+
+	functionCount := binary.LittleEndian.Uint32(data[20:])
+	nameCount := int(binary.LittleEndian.Uint32(data[24:]))
+	functions, okFunctions := region.offset(binary.LittleEndian.Uint32(data[28:]), int(functionCount)*4)
+	names, okNames := region.offset(binary.LittleEndian.Uint32(data[32:]), nameCount*4)
+	ordinals, okOrdinals := region.offset(binary.LittleEndian.Uint32(data[36:]), nameCount*2)
+	if !okFunctions || !okNames || !okOrdinals {
+		return nil, fmt.Errorf("export tables lie outside the export directory")
+	}
+
+	// The DLL name, the export names and forwarder strings all live inside
+	// the export directory
+	var refs []stringRef
+	if off, ok := region.offset(binary.LittleEndian.Uint32(data[12:]), 1); ok {
+		refs = append(refs, stringRef{offset: uint32(off), kind: "dll"})
+	}
+	for i := 0; i < nameCount; i++ {
+		off, ok := region.offset(binary.LittleEndian.Uint32(data[names+i*4:]), 1)
+		if !ok {
+			return nil, fmt.Errorf("export name %d lies outside the export directory", i)
+		}
+		refs = append(refs, stringRef{offset: uint32(off), kind: "export"})
+	}
+	for i := 0; i < int(functionCount); i++ {
+		if off, ok := region.offset(binary.LittleEndian.Uint32(data[functions+i*4:]), 1); ok {
+			refs = append(refs, stringRef{offset: uint32(off), kind: "forwarder"})
+		}
+	}
+
+	renamed, matches, problems := renameStringTable(data, refs, items)
+	report.addSection(arch, ".edata", region.fileOffset, peImageBase(file)+uint64(region.rva), matches, problems)
+	if len(problems) > 0 {
+		return nil, nil
+	}
+
+	// Sort the name pointers and their ordinals by the new names
+	type exportName struct {
+		rva     uint32
+		ordinal uint16
+		name    string
+	}
+	table := make([]exportName, nameCount)
+	for i := range table {
+		rva := binary.LittleEndian.Uint32(data[names+i*4:])
+		off, _ := region.offset(rva, 1)
+		table[i] = exportName{rva: rva, ordinal: binary.LittleEndian.Uint16(data[ordinals+i*2:]), name: cString(data, uint32(off))}
+	}
+	sorted := sort.SliceIsSorted(table, func(i, j int) bool { return table[i].name < table[j].name })
+	if len(renamed) == 0 && sorted {
+		return nil, nil
+	}
+
+	rename := &DynamicRename{}
+	for _, name := range renamed {
+		name.Arch = arch
+		rename.Names = append(rename.Names, name)
+	}
+	if !sorted {
+		sort.SliceStable(table, func(i, j int) bool { return table[i].name < table[j].name })
+		for i, e := range table {
+			binary.LittleEndian.PutUint32(data[names+i*4:], e.rva)
+			binary.LittleEndian.PutUint16(data[ordinals+i*2:], e.ordinal)
+		}
+		rename.Tables = append(rename.Tables, "export name pointers")
+	}
+	report.addDynamic(rename)
+	return []sectionPatch{{Section: ".edata", Offset: region.fileOffset, Data: data}}, nil
+}
+
+// peResource is a leaf of the resource directory
+type peResource struct {
+	typeID uint32
+	entry  int // offset of the IMAGE_RESOURCE_DATA_ENTRY inside the resource region
+	rva    uint32
+	size   uint32
+}
+
+// planPEResources renames the strings of the version information and the
+// application manifest. Each resource is rewritten inside the space it
+// already has and its data entry gets the new size.
+func planPEResources(file *pe.File, items []*Replacement, arch string, report *PatchReport, pending []sectionPatch) ([]sectionPatch, error) {
+	dir := peDataDirectory(file, pe.IMAGE_DIRECTORY_ENTRY_RESOURCE)
+	if dir.Size == 0 || len(items) == 0 {
+		return nil, nil
+	}
+	region, err := readPERegion(file, dir.VirtualAddress, dir.Size, pending)
+	if err != nil {
+		return nil, fmt.Errorf("error reading resources: %v", err)
+	}
+	resources, err := parsePEResources(region.data)
+	if err != nil {
+		return nil, err
+	}
+
+	imageBase := peImageBase(file)
+	var patches []sectionPatch
+	for _, res := range resources {
+		if res.typeID != peResourceVersion && res.typeID != peResourceManifest {
+			continue
+		}
+		off, ok := region.offset(res.rva, int(res.size))
+		if !ok {
+			return nil, fmt.Errorf("resource data at 0x%x lies outside the resource directory", res.rva)
+		}
+		original := region.data[off : off+int(res.size)]
+
+		var rewritten []byte
+		var matches []sectionMatch
+		if res.typeID == peResourceVersion {
+			root, err := parseVersionNode(original, 0)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing version information: %v", err)
+			}
+			matches = root.rename(items)
+			if len(matches) == 0 {
+				continue
+			}
+			rewritten = root.encode()
+		} else {
+			text, rule := renameString(string(original), items)
+			if rule == "" {
+				continue
+			}
+			rewritten = []byte(text)
+			matches = []sectionMatch{{Rule: rule, Original: append([]byte(nil), original...), Replacement: rewritten}}
+		}
+
+		kind := map[uint32]string{peResourceVersion: "version information", peResourceManifest: "manifest"}[res.typeID]
+		if len(rewritten) > len(original) {
+			replacement := string(matches[0].Replacement)
+			if res.typeID == peResourceVersion {
+				replacement = decodeUTF16(matches[0].Replacement)
+			}
+			report.addSection(arch, ".rsrc", region.fileOffset+int64(off), imageBase+uint64(res.rva), nil, []FitProblem{{
+				Original:    kind,
+				Replacement: replacement,
+				Reason:      fmt.Sprintf("rewritten %s needs %d bytes but only %d are available", kind, len(rewritten), len(original)),
+			}})
+			continue
+		}
+		report.addSection(arch, ".rsrc", region.fileOffset+int64(off), imageBase+uint64(res.rva), matches, nil)
+
+		data := make([]byte, len(original))
+		copy(data, rewritten)
+		patches = append(patches, sectionPatch{Section: ".rsrc " + kind, Offset: region.fileOffset + int64(off), Data: data})
+
+		entry := append([]byte(nil), region.data[res.entry:res.entry+16]...)
+		binary.LittleEndian.PutUint32(entry[4:], uint32(len(rewritten)))
+		patches = append(patches, sectionPatch{Section: ".rsrc data entry", Offset: region.fileOffset + int64(res.entry), Data: entry})
+	}
+	return patches, nil
+}
+
+// parsePEResources lists the leaves of a resource directory with their type
+func parsePEResources(data []byte) ([]peResource, error) {
+	var resources []peResource
+	visited := make(map[uint32]bool)
+
+	var walk func(off uint32, depth int, typeID uint32) error
+	walk = func(off uint32, depth int, typeID uint32) error {
+		if depth > 3 || visited[off] || int(off)+16 > len(data) {
+			return fmt.Errorf("malformed resource directory at 0x%x", off)
+		}
+		visited[off] = true
+		count := int(binary.LittleEndian.Uint16(data[off+12:])) + int(binary.LittleEndian.Uint16(data[off+14:]))
+		for i := 0; i < count; i++ {
+			entry := int(off) + 16 + i*8
+			if entry+8 > len(data) {
+				return fmt.Errorf("malformed resource directory at 0x%x", off)
+			}
+			id := binary.LittleEndian.Uint32(data[entry:])
+			target := binary.LittleEndian.Uint32(data[entry+4:])
+			if depth == 0 {
+				typeID = id
+				if id&0x80000000 != 0 {
+					typeID = 0 // named types are never rewritten
+				}
+			}
+			if target&0x80000000 != 0 {
+				if err := walk(target&0x7fffffff, depth+1, typeID); err != nil {
+					return err
+				}
+				continue
+			}
+			if int(target)+16 > len(data) {
+				return fmt.Errorf("malformed resource data entry at 0x%x", target)
+			}
+			resources = append(resources, peResource{
+				typeID: typeID,
+				entry:  int(target),
+				rva:    binary.LittleEndian.Uint32(data[target:]),
+				size:   binary.LittleEndian.Uint32(data[target+4:]),
+			})
+		}
+		return nil
+	}
+
+	if err := walk(0, 0, 0); err != nil {
+		return nil, err
+	}
+	return resources, nil
+}
+
+// versionNode is a block of a VS_VERSIONINFO resource
+type versionNode struct {
+	key      string
+	text     bool
+	value    []byte
+	offset   int // offset of the value inside the original resource
+	children []*versionNode
+}
+
+// parseVersionNode parses the block at off and its children
+func parseVersionNode(data []byte, off int) (*versionNode, error) {
+	if off+6 > len(data) {
+		return nil, fmt.Errorf("truncated block at 0x%x", off)
+	}
+	length := int(binary.LittleEndian.Uint16(data[off:]))
+	valueLength := int(binary.LittleEndian.Uint16(data[off+2:]))
+	end := off + length
+	if length < 6 || end > len(data) {
+		return nil, fmt.Errorf("invalid block length at 0x%x", off)
+	}
+	node := &versionNode{text: binary.LittleEndian.Uint16(data[off+4:]) == 1}
+
+	pos := off + 6
+	var key []uint16
+	for ; pos+2 <= end; pos += 2 {
+		c := binary.LittleEndian.Uint16(data[pos:])
+		if c == 0 {
+			break
+		}
+		key = append(key, c)
+	}
+	node.key = string(utf16.Decode(key))
+	pos = alignTo4(pos + 2)
+
+	if node.text {
+		valueLength *= 2 // text values are counted in WORDs
+	}
+	node.offset = min(pos, end)
+	node.value = data[node.offset:min(pos+valueLength, end)]
+	pos = alignTo4(pos + valueLength)
+
+	for pos < end {
+		child, err := parseVersionNode(data, pos)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+		pos = alignTo4(pos + int(binary.LittleEndian.Uint16(data[pos:])))
+	}
+	return node, nil
+}
+
+// rename applies items to the text values of the node and its children
+func (n *versionNode) rename(items []*Replacement) []sectionMatch {
+	var matches []sectionMatch
+	if n.text && len(n.value) >= 2 && len(n.children) == 0 {
+		text := decodeUTF16(n.value)
+		if renamed, rule := renameString(text, items); rule != "" {
+			value := encodeUTF16(renamed)
+			matches = append(matches, sectionMatch{Offset: n.offset, Rule: rule, Original: n.value, Replacement: value})
+			n.value = value
+		}
+	}
+	for _, child := range n.children {
+		matches = append(matches, child.rename(items)...)
+	}
+	return matches
+}
+
+// decodeUTF16 decodes a NUL-terminated UTF-16LE value
+func decodeUTF16(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// encode serializes the node and its children
+func (n *versionNode) encode() []byte {
+	out := make([]byte, 6)
+	out = append(out, encodeUTF16(n.key)...)
+	out = padTo4(out)
+	out = append(out, n.value...)
+	for _, child := range n.children {
+		out = padTo4(out)
+		out = append(out, child.encode()...)
+	}
+
+	valueLength := len(n.value)
+	var valueType uint16
+	if n.text {
+		valueLength /= 2
+		valueType = 1
+	}
+	binary.LittleEndian.PutUint16(out, uint16(len(out)))
+	binary.LittleEndian.PutUint16(out[2:], uint16(valueLength))
+	binary.LittleEndian.PutUint16(out[4:], valueType)
+	return out
+}
+
+// encodeUTF16 encodes s as NUL-terminated little-endian UTF-16
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	out := make([]byte, 0, len(units)*2+2)
+	for _, u := range units {
+		out = binary.LittleEndian.AppendUint16(out, u)
+	}
+	return append(out, 0, 0)
+}
+
+// alignTo4 rounds n up to a multiple of 4
+func alignTo4(n int) int {
+	return (n + 3) &^ 3
+}
+
+// padTo4 pads b with zeros to a multiple of 4 bytes
+func padTo4(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// peDataDirectory returns a data directory entry of the optional header
+func peDataDirectory(file *pe.File, index int) pe.DataDirectory {
+	switch oh := file.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if index < int(oh.NumberOfRvaAndSizes) {
+			return oh.DataDirectory[index]
+		}
+	case *pe.OptionalHeader64:
+		if index < int(oh.NumberOfRvaAndSizes) {
+			return oh.DataDirectory[index]
+		}
+	}
+	return pe.DataDirectory{}
+}
+
+// verifyPEExports checks that the export name pointers are sorted and name
+// strings inside the export directory
+func verifyPEExports(file *pe.File) error {
+	dir := peDataDirectory(file, pe.IMAGE_DIRECTORY_ENTRY_EXPORT)
+	if dir.Size < 40 {
+		return nil
+	}
+	region, err := readPERegion(file, dir.VirtualAddress, dir.Size, nil)
+	if err != nil {
+		return err
+	}
+	nameCount := int(binary.LittleEndian.Uint32(region.data[24:]))
+	names, ok := region.offset(binary.LittleEndian.Uint32(region.data[32:]), nameCount*4)
+	if !ok {
+		return fmt.Errorf("export name pointers lie outside the export directory")
+	}
+	previous := ""
+	for i := 0; i < nameCount; i++ {
+		off, ok := region.offset(binary.LittleEndian.Uint32(region.data[names+i*4:]), 1)
+		if !ok {
+			return fmt.Errorf("export name %d lies outside the export directory", i)
+		}
+		name := cString(region.data, uint32(off))
+		if i > 0 && name <= previous {
+			return fmt.Errorf("export names are not sorted at %q", name)
+		}
+		previous = name
+	}
+	return nil
+}
+
+// peChecksumOffset returns the file offset of the optional header checksum
+func peChecksumOffset(data []byte) (int, error) {
+	if len(data) < 0x40 {
+		return 0, fmt.Errorf("truncated DOS header")
+	}
+	off := int(binary.LittleEndian.Uint32(data[0x3c:])) + 4 + 20 + 64
+	if off+4 > len(data) {
+		return 0, fmt.Errorf("truncated optional header")
+	}
+	return off, nil
+}
+
+// peChecksum computes the optional header checksum the way the Windows
+// loader and CheckSumMappedFile do: a folded 16-bit sum of the file, skipping
+// the checksum field, plus the file length
+func peChecksum(data []byte, checksumOffset int) uint32 {
+	var sum uint64
+	for i := 0; i < len(data); i += 2 {
+		if i == checksumOffset || i == checksumOffset+2 {
+			continue
+		}
+		word := uint64(data[i])
+		if i+1 < len(data) {
+			word |= uint64(data[i+1]) << 8
+		}
+		sum += word
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	sum = (sum & 0xffff) + (sum >> 16)
+	return uint32(sum) + uint32(len(data))
+}
+
+// updatePEChecksum recomputes the checksum of a staged PE file
+func updatePEChecksum(path string, staged io.WriterAt) (*PEChecksum, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	off, err := peChecksumOffset(data)
+	if err != nil {
+		return nil, err
+	}
+	checksum := &PEChecksum{
+		Original: binary.LittleEndian.Uint32(data[off:]),
+		Updated:  peChecksum(data, off),
+	}
+	if _, err := staged.WriteAt(binary.LittleEndian.AppendUint32(nil, checksum.Updated), int64(off)); err != nil {
+		return nil, err
+	}
+	return checksum, nil
+}
+
+// verifyPEChecksum checks the optional header checksum of a PE file
+func verifyPEChecksum(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	off, err := peChecksumOffset(data)
+	if err != nil {
+		return err
+	}
+	if stored, computed := binary.LittleEndian.Uint32(data[off:]), peChecksum(data, off); stored != computed {
+		return fmt.Errorf("PE checksum is 0x%08x, expected 0x%08x", stored, computed)
+	}
+	return nil
+}
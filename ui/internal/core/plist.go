@@ -0,0 +1,875 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// PlistFormat is the serialization of a property list
+type PlistFormat int
+
+const (
+	PlistXML PlistFormat = iota
+	PlistBinary
+)
+
+// String returns the name plutil uses for the format
+func (f PlistFormat) String() string {
+	if f == PlistBinary {
+		return "binary1"
+	}
+	return "xml1"
+}
+
+// PlistUID is a UID object of a binary plist, as used by NSKeyedArchiver
+type PlistUID uint64
+
+// Property list values are bool, string, int64, float64, []byte, time.Time,
+// PlistUID, []interface{} and map[string]interface{}. Writers also accept int
+// and orderedPlistDict.
+
+// orderedPlistDict is a dictionary written with its keys in a fixed order
+// instead of sorted
+type orderedPlistDict struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+// binaryPlistMagic starts every binary plist
+const binaryPlistMagic = "bplist00"
+
+// maxPlistDepth bounds the nesting of containers, which also stops reference
+// cycles in binary plists
+const maxPlistDepth = 256
+
+// ParsePlist decodes an XML or binary plist and reports its format
+func ParsePlist(data []byte) (interface{}, PlistFormat, error) {
+	if bytes.HasPrefix(data, []byte(binaryPlistMagic)) {
+		value, err := parseBinaryPlist(data)
+		if err != nil {
+			return nil, PlistBinary, fmt.Errorf("invalid binary plist: %v", err)
+		}
+		return value, PlistBinary, nil
+	}
+	value, err := parseXMLPlist(data)
+	if err != nil {
+		return nil, PlistXML, fmt.Errorf("invalid plist: %v", err)
+	}
+	return value, PlistXML, nil
+}
+
+// MarshalPlist encodes v in the given format. Dictionary keys are sorted.
+func MarshalPlist(v interface{}, format PlistFormat) ([]byte, error) {
+	if format == PlistBinary {
+		return marshalBinaryPlist(v)
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	buf.WriteString(`<plist version="1.0">` + "\n")
+	if err := encodePlistValue(&buf, v, 0); err != nil {
+		return nil, err
+	}
+	buf.WriteString("</plist>\n")
+	return buf.Bytes(), nil
+}
+
+// plistTypeName names the plist element of a decoded value, for errors
+func plistTypeName(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "<dict>"
+	case []interface{}:
+		return "<array>"
+	case bool:
+		return "<true/> or <false/>"
+	case string:
+		return "<string>"
+	case int64:
+		return "<integer>"
+	case float64:
+		return "<real>"
+	case []byte:
+		return "<data>"
+	case time.Time:
+		return "<date>"
+	case PlistUID:
+		return "UID"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// sortedPlistKeys returns the keys of a dictionary in sorted order
+func sortedPlistKeys(dict map[string]interface{}) []string {
+	keys := make([]string, 0, len(dict))
+	for key := range dict {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// plistRootKeys returns the keys of the root dictionary in document order,
+// which the decoded map does not keep. It returns nil when the root is not a
+// dictionary or the plist cannot be read.
+func plistRootKeys(data []byte, format PlistFormat) []string {
+	if format == PlistBinary {
+		return binaryPlistRootKeys(data)
+	}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var keys []string
+	depth := 0 // nesting inside the root dict
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return keys
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "plist":
+			case depth == 0 && t.Name.Local != "dict":
+				return nil
+			case depth == 1 && t.Name.Local == "key":
+				var key string
+				if d.DecodeElement(&key, &t) != nil {
+					return nil
+				}
+				keys = append(keys, key)
+			default:
+				depth++
+			}
+		case xml.EndElement:
+			if t.Name.Local != "plist" {
+				depth--
+			}
+			if depth == 0 {
+				return keys
+			}
+		}
+	}
+}
+
+// binaryPlistRootKeys returns the keys of the root dictionary of a binary
+// plist in the order they are stored
+func binaryPlistRootKeys(data []byte) []string {
+	r, top, err := newBinaryPlistReader(data)
+	if err != nil {
+		return nil
+	}
+	pos := r.offsets[top]
+	if data[pos]>>4 != 0xD {
+		return nil
+	}
+	n, start, err := r.count(pos)
+	if err != nil {
+		return nil
+	}
+	refs, err := r.refs(start, n)
+	if err != nil {
+		return nil
+	}
+	keys := make([]string, 0, n)
+	for _, ref := range refs {
+		key, err := r.object(ref, 1)
+		if err != nil {
+			return nil
+		}
+		keyString, ok := key.(string)
+		if !ok {
+			return nil
+		}
+		keys = append(keys, keyString)
+	}
+	return keys
+}
+
+// parseXMLPlist decodes the root value of an XML plist
+func parseXMLPlist(data []byte) (interface{}, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := nextPlistElement(d)
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			return nil, fmt.Errorf("unexpected </%s>", tok.(xml.EndElement).Name.Local)
+		}
+		if start.Name.Local == "plist" {
+			continue
+		}
+		return decodePlistValue(d, start)
+	}
+}
+
+// nextPlistElement returns the next start or end element, skipping text,
+// comments and directives
+func nextPlistElement(d *xml.Decoder) (xml.Token, error) {
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("unexpected end of document")
+			}
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			return t, nil
+		}
+	}
+}
+
+// decodePlistValue decodes the value starting with start
+func decodePlistValue(d *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	switch start.Name.Local {
+	case "dict":
+		dict := map[string]interface{}{}
+		for {
+			tok, err := nextPlistElement(d)
+			if err != nil {
+				return nil, err
+			}
+			keyStart, ok := tok.(xml.StartElement)
+			if !ok {
+				return dict, nil
+			}
+			if keyStart.Name.Local != "key" {
+				return nil, fmt.Errorf("expected <key> in dict, got <%s>", keyStart.Name.Local)
+			}
+			var key string
+			if err := d.DecodeElement(&key, &keyStart); err != nil {
+				return nil, err
+			}
+
+			tok, err = nextPlistElement(d)
+			if err != nil {
+				return nil, err
+			}
+			valueStart, ok := tok.(xml.StartElement)
+			if !ok {
+				return nil, fmt.Errorf("missing value for key %q", key)
+			}
+			value, err := decodePlistValue(d, valueStart)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", key, err)
+			}
+			dict[key] = value
+		}
+	case "array":
+		array := []interface{}{}
+		for {
+			tok, err := nextPlistElement(d)
+			if err != nil {
+				return nil, err
+			}
+			elemStart, ok := tok.(xml.StartElement)
+			if !ok {
+				return array, nil
+			}
+			value, err := decodePlistValue(d, elemStart)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+	case "true", "false":
+		if err := d.Skip(); err != nil {
+			return nil, err
+		}
+		return start.Name.Local == "true", nil
+	}
+
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	if start.Name.Local == "string" {
+		return text, nil
+	}
+	text = strings.TrimSpace(text)
+	switch start.Name.Local {
+	case "integer":
+		n, err := strconv.ParseInt(text, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer %q", text)
+		}
+		return n, nil
+	case "real":
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid real %q", text)
+		}
+		return f, nil
+	case "data":
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+		return data, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", text)
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unsupported plist element <%s>", start.Name.Local)
+	}
+}
+
+// encodePlistValue writes v as XML plist, indented with tabs
+func encodePlistValue(buf *bytes.Buffer, v interface{}, depth int) error {
+	indent := strings.Repeat("\t", depth)
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return encodePlistValue(buf, orderedPlistDict{sortedPlistKeys(v), v}, depth)
+	case Entitlements:
+		return encodePlistValue(buf, map[string]interface{}(v), depth)
+	case orderedPlistDict:
+		if len(v.keys) == 0 {
+			buf.WriteString(indent + "<dict/>\n")
+			return nil
+		}
+		buf.WriteString(indent + "<dict>\n")
+		for _, key := range v.keys {
+			buf.WriteString(indent + "\t<key>")
+			xml.EscapeText(buf, []byte(key))
+			buf.WriteString("</key>\n")
+			if err := encodePlistValue(buf, v.values[key], depth+1); err != nil {
+				return fmt.Errorf("key %q: %v", key, err)
+			}
+		}
+		buf.WriteString(indent + "</dict>\n")
+	case []interface{}:
+		if len(v) == 0 {
+			buf.WriteString(indent + "<array/>\n")
+			return nil
+		}
+		buf.WriteString(indent + "<array>\n")
+		for _, elem := range v {
+			if err := encodePlistValue(buf, elem, depth+1); err != nil {
+				return err
+			}
+		}
+		buf.WriteString(indent + "</array>\n")
+	case bool:
+		if v {
+			buf.WriteString(indent + "<true/>\n")
+		} else {
+			buf.WriteString(indent + "<false/>\n")
+		}
+	case string:
+		buf.WriteString(indent + "<string>")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</string>\n")
+	case int64:
+		fmt.Fprintf(buf, "%s<integer>%d</integer>\n", indent, v)
+	case int:
+		fmt.Fprintf(buf, "%s<integer>%d</integer>\n", indent, v)
+	case float64:
+		fmt.Fprintf(buf, "%s<real>%s</real>\n", indent, strconv.FormatFloat(v, 'g', -1, 64))
+	case []byte:
+		fmt.Fprintf(buf, "%s<data>%s</data>\n", indent, base64.StdEncoding.EncodeToString(v))
+	case time.Time:
+		fmt.Fprintf(buf, "%s<date>%s</date>\n", indent, v.UTC().Format(time.RFC3339))
+	case PlistUID:
+		// XML has no UID element; CoreFoundation writes a CF$UID dictionary
+		return encodePlistValue(buf, map[string]interface{}{"CF$UID": int64(v)}, depth)
+	default:
+		return fmt.Errorf("unsupported plist value of type %T", v)
+	}
+	return nil
+}
+
+// plistEpoch is the reference date of binary plist dates
+var plistEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// binaryPlistReader decodes the objects of a binary plist
+type binaryPlistReader struct {
+	data       []byte
+	offsets    []uint64
+	refSize    int
+	tableStart uint64
+	visited    int // objects decoded so far, shared references included
+}
+
+// maxBinaryPlistObjects bounds the objects decoded from one binary plist;
+// containers may share children, so a small file can expand exponentially
+const maxBinaryPlistObjects = 1 << 22
+
+// parseBinaryPlist decodes a bplist00 document
+func parseBinaryPlist(data []byte) (interface{}, error) {
+	r, top, err := newBinaryPlistReader(data)
+	if err != nil {
+		return nil, err
+	}
+	return r.object(top, 0)
+}
+
+// newBinaryPlistReader validates the trailer and offset table of a binary
+// plist, returning a reader and the reference of the top object
+func newBinaryPlistReader(data []byte) (*binaryPlistReader, uint64, error) {
+	if len(data) < len(binaryPlistMagic)+32 {
+		return nil, 0, fmt.Errorf("file too short")
+	}
+	trailer := data[len(data)-32:]
+	offsetSize := int(trailer[6])
+	refSize := int(trailer[7])
+	numObjects := binary.BigEndian.Uint64(trailer[8:])
+	topObject := binary.BigEndian.Uint64(trailer[16:])
+	tableOffset := binary.BigEndian.Uint64(trailer[24:])
+
+	if offsetSize < 1 || offsetSize > 8 || refSize < 1 || refSize > 8 {
+		return nil, 0, fmt.Errorf("invalid trailer")
+	}
+	tableEnd := uint64(len(data) - 32)
+	if tableOffset < uint64(len(binaryPlistMagic)) || tableOffset > tableEnd ||
+		numObjects > (tableEnd-tableOffset)/uint64(offsetSize) || topObject >= numObjects {
+		return nil, 0, fmt.Errorf("offset table out of range")
+	}
+
+	r := &binaryPlistReader{data: data, refSize: refSize, tableStart: tableOffset}
+	r.offsets = make([]uint64, numObjects)
+	for i := range r.offsets {
+		pos := tableOffset + uint64(i*offsetSize)
+		r.offsets[i] = readBigEndian(data[pos : pos+uint64(offsetSize)])
+		if r.offsets[i] < uint64(len(binaryPlistMagic)) || r.offsets[i] >= tableOffset {
+			return nil, 0, fmt.Errorf("object %d out of range", i)
+		}
+	}
+	return r, topObject, nil
+}
+
+// readBigEndian reads an unsigned big-endian integer of up to 8 bytes
+func readBigEndian(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// bytes returns n bytes at pos, which must lie before the offset table
+func (r *binaryPlistReader) bytes(pos, n uint64) ([]byte, error) {
+	if pos > r.tableStart || n > r.tableStart-pos {
+		return nil, fmt.Errorf("object data out of range")
+	}
+	return r.data[pos : pos+n], nil
+}
+
+// count reads the length of the object whose marker is at pos, returning the
+// length and the position of its content
+func (r *binaryPlistReader) count(pos uint64) (uint64, uint64, error) {
+	n := uint64(r.data[pos] & 0x0F)
+	pos++
+	if n != 0x0F {
+		return n, pos, nil
+	}
+	marker, err := r.bytes(pos, 1)
+	if err != nil {
+		return 0, 0, err
+	}
+	if marker[0]&0xF0 != 0x10 || marker[0]&0x0F > 3 {
+		return 0, 0, fmt.Errorf("invalid length marker 0x%02x", marker[0])
+	}
+	size := uint64(1) << (marker[0] & 0x0F)
+	b, err := r.bytes(pos+1, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readBigEndian(b), pos + 1 + size, nil
+}
+
+// refs reads n object references at pos
+func (r *binaryPlistReader) refs(pos, n uint64) ([]uint64, error) {
+	if n > r.tableStart/uint64(r.refSize) {
+		return nil, fmt.Errorf("container too large")
+	}
+	b, err := r.bytes(pos, n*uint64(r.refSize))
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]uint64, n)
+	for i := range refs {
+		refs[i] = readBigEndian(b[i*r.refSize : (i+1)*r.refSize])
+		if refs[i] >= uint64(len(r.offsets)) {
+			return nil, fmt.Errorf("object reference %d out of range", refs[i])
+		}
+	}
+	return refs, nil
+}
+
+// object decodes the object with the given reference
+func (r *binaryPlistReader) object(ref uint64, depth int) (interface{}, error) {
+	if depth > maxPlistDepth {
+		return nil, fmt.Errorf("nesting too deep")
+	}
+	if r.visited++; r.visited > maxBinaryPlistObjects {
+		return nil, fmt.Errorf("too many objects")
+	}
+	pos := r.offsets[ref]
+	marker := r.data[pos]
+	low := uint64(marker & 0x0F)
+
+	switch marker >> 4 {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, fmt.Errorf("unsupported object 0x%02x", marker)
+	case 0x1:
+		if low > 4 {
+			return nil, fmt.Errorf("invalid integer size")
+		}
+		b, err := r.bytes(pos+1, 1<<low)
+		if err != nil {
+			return nil, err
+		}
+		if low == 4 {
+			// 128-bit integers only carry values that fit the low 64 bits
+			b = b[8:]
+		}
+		return int64(readBigEndian(b)), nil
+	case 0x2:
+		switch low {
+		case 2:
+			b, err := r.bytes(pos+1, 4)
+			if err != nil {
+				return nil, err
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+		case 3:
+			b, err := r.bytes(pos+1, 8)
+			if err != nil {
+				return nil, err
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+		}
+		return nil, fmt.Errorf("invalid real size")
+	case 0x3:
+		if marker != 0x33 {
+			return nil, fmt.Errorf("invalid date")
+		}
+		b, err := r.bytes(pos+1, 8)
+		if err != nil {
+			return nil, err
+		}
+		seconds := math.Float64frombits(binary.BigEndian.Uint64(b))
+		return plistEpoch.Add(time.Duration(seconds * float64(time.Second))), nil
+	case 0x4, 0x5:
+		n, start, err := r.count(pos)
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.bytes(start, n)
+		if err != nil {
+			return nil, err
+		}
+		if marker>>4 == 0x5 {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case 0x6:
+		n, start, err := r.count(pos)
+		if err != nil {
+			return nil, err
+		}
+		if n > r.tableStart/2 {
+			return nil, fmt.Errorf("string too long")
+		}
+		b, err := r.bytes(start, n*2)
+		if err != nil {
+			return nil, err
+		}
+		units := make([]uint16, n)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(b[i*2:])
+		}
+		return string(utf16.Decode(units)), nil
+	case 0x8:
+		b, err := r.bytes(pos+1, low+1)
+		if err != nil {
+			return nil, err
+		}
+		return PlistUID(readBigEndian(b)), nil
+	case 0xA:
+		n, start, err := r.count(pos)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := r.refs(start, n)
+		if err != nil {
+			return nil, err
+		}
+		array := make([]interface{}, 0, len(refs))
+		for _, ref := range refs {
+			value, err := r.object(ref, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	case 0xD:
+		n, start, err := r.count(pos)
+		if err != nil {
+			return nil, err
+		}
+		refs, err := r.refs(start, n*2)
+		if err != nil {
+			return nil, err
+		}
+		dict := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			key, err := r.object(refs[i], depth+1)
+			if err != nil {
+				return nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key is %s, not a string", plistTypeName(key))
+			}
+			value, err := r.object(refs[n+i], depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", keyString, err)
+			}
+			dict[keyString] = value
+		}
+		return dict, nil
+	}
+	return nil, fmt.Errorf("unsupported object 0x%02x", marker)
+}
+
+// binaryPlistWriter encodes objects into a binary plist. Objects are numbered
+// depth first and written in that order; values are not deduplicated.
+type binaryPlistWriter struct {
+	buf     bytes.Buffer
+	offsets []uint64
+	refSize int
+}
+
+// marshalBinaryPlist encodes v as a bplist00 document
+func marshalBinaryPlist(v interface{}) ([]byte, error) {
+	numObjects, err := countPlistObjects(v, 0)
+	if err != nil {
+		return nil, err
+	}
+	w := &binaryPlistWriter{refSize: bytesNeeded(uint64(numObjects - 1))}
+	w.buf.WriteString(binaryPlistMagic)
+	if _, err := w.write(v); err != nil {
+		return nil, err
+	}
+
+	tableOffset := uint64(w.buf.Len())
+	offsetSize := bytesNeeded(tableOffset)
+	for _, offset := range w.offsets {
+		w.writeBigEndian(offset, offsetSize)
+	}
+	trailer := make([]byte, 32)
+	trailer[6] = byte(offsetSize)
+	trailer[7] = byte(w.refSize)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(w.offsets)))
+	binary.BigEndian.PutUint64(trailer[24:], tableOffset)
+	w.buf.Write(trailer)
+	return w.buf.Bytes(), nil
+}
+
+// bytesNeeded returns the number of bytes (1, 2, 4 or 8) needed to hold n
+func bytesNeeded(n uint64) int {
+	switch {
+	case n < 1<<8:
+		return 1
+	case n < 1<<16:
+		return 2
+	case n < 1<<32:
+		return 4
+	}
+	return 8
+}
+
+// countPlistObjects counts the objects v is encoded as
+func countPlistObjects(v interface{}, depth int) (int, error) {
+	if depth > maxPlistDepth {
+		return 0, fmt.Errorf("nesting too deep")
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return countPlistObjects(orderedPlistDict{sortedPlistKeys(v), v}, depth)
+	case Entitlements:
+		return countPlistObjects(map[string]interface{}(v), depth)
+	case orderedPlistDict:
+		n := 1 + len(v.keys)
+		for _, key := range v.keys {
+			count, err := countPlistObjects(v.values[key], depth+1)
+			if err != nil {
+				return 0, fmt.Errorf("key %q: %v", key, err)
+			}
+			n += count
+		}
+		return n, nil
+	case []interface{}:
+		n := 1
+		for _, elem := range v {
+			count, err := countPlistObjects(elem, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			n += count
+		}
+		return n, nil
+	case bool, string, int64, int, float64, []byte, time.Time, PlistUID:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported plist value of type %T", v)
+}
+
+// writeBigEndian writes the low size bytes of n
+func (w *binaryPlistWriter) writeBigEndian(n uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		w.buf.WriteByte(byte(n >> (8 * i)))
+	}
+}
+
+// writeMarker writes an object marker with its length, using a following
+// integer object for lengths of 15 and more
+func (w *binaryPlistWriter) writeMarker(kind byte, n int) {
+	if n < 0x0F {
+		w.buf.WriteByte(kind | byte(n))
+		return
+	}
+	w.buf.WriteByte(kind | 0x0F)
+	size := bytesNeeded(uint64(n))
+	w.buf.WriteByte(0x10 | byte(bits.TrailingZeros(uint(size))))
+	w.writeBigEndian(uint64(n), size)
+}
+
+// write encodes v and its children, returning the reference of v
+func (w *binaryPlistWriter) write(v interface{}) (uint64, error) {
+	ref := uint64(len(w.offsets))
+	w.offsets = append(w.offsets, 0)
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		w.offsets = w.offsets[:ref]
+		return w.write(orderedPlistDict{sortedPlistKeys(v), v})
+	case Entitlements:
+		w.offsets = w.offsets[:ref]
+		return w.write(map[string]interface{}(v))
+	case orderedPlistDict:
+		refs := make([]uint64, 0, 2*len(v.keys))
+		for _, key := range v.keys {
+			keyRef, err := w.write(key)
+			if err != nil {
+				return 0, err
+			}
+			refs = append(refs, keyRef)
+		}
+		for _, key := range v.keys {
+			valueRef, err := w.write(v.values[key])
+			if err != nil {
+				return 0, fmt.Errorf("key %q: %v", key, err)
+			}
+			refs = append(refs, valueRef)
+		}
+		w.offsets[ref] = uint64(w.buf.Len())
+		w.writeMarker(0xD0, len(v.keys))
+		for _, r := range refs {
+			w.writeBigEndian(r, w.refSize)
+		}
+		return ref, nil
+	case []interface{}:
+		refs := make([]uint64, 0, len(v))
+		for _, elem := range v {
+			elemRef, err := w.write(elem)
+			if err != nil {
+				return 0, err
+			}
+			refs = append(refs, elemRef)
+		}
+		w.offsets[ref] = uint64(w.buf.Len())
+		w.writeMarker(0xA0, len(v))
+		for _, r := range refs {
+			w.writeBigEndian(r, w.refSize)
+		}
+		return ref, nil
+	}
+
+	w.offsets[ref] = uint64(w.buf.Len())
+	switch v := v.(type) {
+	case bool:
+		if v {
+			w.buf.WriteByte(0x09)
+		} else {
+			w.buf.WriteByte(0x08)
+		}
+	case int:
+		w.writeInt(int64(v))
+	case int64:
+		w.writeInt(v)
+	case float64:
+		w.buf.WriteByte(0x23)
+		w.writeBigEndian(math.Float64bits(v), 8)
+	case time.Time:
+		w.buf.WriteByte(0x33)
+		w.writeBigEndian(math.Float64bits(v.Sub(plistEpoch).Seconds()), 8)
+	case []byte:
+		w.writeMarker(0x40, len(v))
+		w.buf.Write(v)
+	case string:
+		if isASCII(v) {
+			w.writeMarker(0x50, len(v))
+			w.buf.WriteString(v)
+		} else {
+			units := utf16.Encode([]rune(v))
+			w.writeMarker(0x60, len(units))
+			for _, unit := range units {
+				w.writeBigEndian(uint64(unit), 2)
+			}
+		}
+	case PlistUID:
+		size := bytesNeeded(uint64(v))
+		w.buf.WriteByte(0x80 | byte(size-1))
+		w.writeBigEndian(uint64(v), size)
+	default:
+		return 0, fmt.Errorf("unsupported plist value of type %T", v)
+	}
+	return ref, nil
+}
+
+// writeInt writes an integer object; negative values always take 8 bytes
+func (w *binaryPlistWriter) writeInt(n int64) {
+	size := 8
+	if n >= 0 {
+		size = bytesNeeded(uint64(n))
+	}
+	w.buf.WriteByte(0x10 | byte(bits.TrailingZeros(uint(size))))
+	w.writeBigEndian(uint64(n), size)
+}
+
+// isASCII reports whether s only contains 7-bit characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
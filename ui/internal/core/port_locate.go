@@ -0,0 +1,726 @@
+package core
+
+import (
+	"encoding/binary"
+	"sort"
+)
+
+// Default port locators. Each architecture is searched twice: a byte-level
+// encoding scan over the executable sections finds every place the constant
+// could be encoded, and a disassembly pass decodes the instruction stream to
+// confirm which of those candidates really load the constant. Only
+// candidates confirmed by both are patched; everything else is rejected.
+
+// portCandidate is a location whose bytes may encode the port constant
+type portCandidate struct {
+	region int // index into the region list
+	offset int // offset of the bytes to rewrite inside the region
+	size   int // number of bytes to rewrite
+	kind   string
+}
+
+// portDecoded is a candidate confirmed or rejected by the disassembler
+type portDecoded struct {
+	kind        string
+	replacement []byte
+	reason      string // non-empty when the decoder rejects the site
+}
+
+// portKey identifies a location inside the scanned regions
+type portKey struct {
+	region int
+	offset int
+}
+
+// portLocator finds the encodings of a 16-bit constant for one architecture
+type portLocator interface {
+	// candidates scans the raw bytes of the executable regions
+	candidates(regions []scanRegion, value uint16) []portCandidate
+	// decode disassembles the executable regions and returns the sites that
+	// load value, keyed by the location of the bytes to rewrite
+	decode(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded
+}
+
+// locatePort runs a locator and cross-checks the encoding scan against the
+// disassembly
+func locatePort(locator portLocator, regions []scanRegion, value, newValue uint16) (sites, rejected []PortSite) {
+	decoded := locator.decode(regions, value, newValue)
+	for _, c := range locator.candidates(regions, value) {
+		region := regions[c.region]
+		site := PortSite{
+			Arch:           region.Arch,
+			Section:        region.Name,
+			FileOffset:     region.FileOffset + int64(c.offset),
+			VirtualAddress: region.Addr + uint64(c.offset),
+			Kind:           c.kind,
+			Original:       append(HexBytes(nil), region.Data[c.offset:c.offset+c.size]...),
+		}
+
+		d, ok := decoded[portKey{c.region, c.offset}]
+		switch {
+		case !ok:
+			site.Reason = "not confirmed by disassembly"
+		case d.reason != "":
+			site.Kind = d.kind
+			site.Reason = d.reason
+		default:
+			site.Kind = d.kind
+			site.Original = site.Original[:len(d.replacement)]
+			site.Replacement = append(HexBytes(nil), d.replacement...)
+		}
+		if site.Reason != "" {
+			rejected = append(rejected, site)
+		} else {
+			sites = append(sites, site)
+		}
+	}
+	return sites, rejected
+}
+
+// readUint32 reads a little-endian word, returning false when out of range
+func readUint32(data []byte, offset int) (uint32, bool) {
+	if offset < 0 || offset+4 > len(data) {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(data[offset:]), true
+}
+
+// putUint32 returns the little-endian encoding of v
+func putUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// findRegion returns the executable region containing the address range
+func findRegion(regions []scanRegion, addr uint64, size int) (int, int, bool) {
+	for i, r := range regions {
+		if addr >= r.Addr && addr+uint64(size) <= r.Addr+uint64(len(r.Data)) {
+			return i, int(addr - r.Addr), true
+		}
+	}
+	return 0, 0, false
+}
+
+// literalCandidates returns every 32-bit word equal to value, the form the
+// constant takes in a literal pool
+func literalCandidates(regions []scanRegion, value uint16, align int) []portCandidate {
+	var result []portCandidate
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i += align {
+			if w, _ := readUint32(r.Data, i); w == uint32(value) {
+				result = append(result, portCandidate{region: ri, offset: i, size: 4, kind: "literal"})
+			}
+		}
+	}
+	return result
+}
+
+// arm64Locator handles AArch64 code: MOVZ Wd/Xd, #value and LDR (literal)
+type arm64Locator struct{}
+
+func (arm64Locator) candidates(regions []scanRegion, value uint16) []portCandidate {
+	var result []portCandidate
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i++ {
+			w, _ := readUint32(r.Data, i)
+			if w&0x7f800000 == 0x52800000 && (w>>21)&3 == 0 && uint16(w>>5) == value {
+				result = append(result, portCandidate{region: ri, offset: i, size: 4, kind: "movz"})
+			}
+		}
+	}
+	return append(result, literalCandidates(regions, value, 1)...)
+}
+
+func (arm64Locator) decode(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded {
+	result := make(map[portKey]portDecoded)
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i += 4 {
+			w, _ := readUint32(r.Data, i)
+
+			// MOVZ (sf=any, hw=0)
+			if w&0x7f800000 == 0x52800000 && (w>>21)&3 == 0 && uint16(w>>5) == value {
+				d := portDecoded{kind: "movz", replacement: putUint32(w&^(0xffff<<5) | uint32(newValue)<<5)}
+				rd := w & 31
+				for j := i + 4; j < i+36 && j+4 <= len(r.Data); j += 4 {
+					next, _ := readUint32(r.Data, j)
+					if next&0x7f800000 == 0x72800000 && next&31 == rd {
+						d = portDecoded{kind: "movz", reason: "part of a wider constant (MOVK follows)"}
+						break
+					}
+				}
+				result[portKey{ri, i}] = d
+				continue
+			}
+
+			// LDR Wt/Xt/LDRSW (literal)
+			if op := w & 0xff000000; op == 0x18000000 || op == 0x58000000 || op == 0x98000000 {
+				imm19 := int64(int32(w<<8) >> 13)
+				target := uint64(int64(r.Addr) + int64(i) + imm19*4)
+				size := 4
+				if op == 0x58000000 {
+					size = 8
+				}
+				ti, to, ok := findRegion(regions, target, size)
+				if !ok {
+					continue
+				}
+				lo, _ := readUint32(regions[ti].Data, to)
+				hi := uint32(0)
+				if size == 8 {
+					hi, _ = readUint32(regions[ti].Data, to+4)
+				}
+				if lo == uint32(value) && hi == 0 {
+					result[portKey{ti, to}] = portDecoded{kind: "literal", replacement: putUint32(uint32(newValue))}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// armLocator handles 32-bit ARM code in Thumb-2 or A32 state: MOVW and LDR (literal)
+type armLocator struct {
+	thumb bool
+}
+
+// thumbMovw decodes a Thumb-2 MOVW (T3), returning the immediate and Rd
+func thumbMovw(hw1, hw2 uint16) (uint16, uint16, bool) {
+	if hw1&0xfbf0 != 0xf240 || hw2&0x8000 != 0 {
+		return 0, 0, false
+	}
+	imm := (hw1&0xf)<<12 | (hw1>>10&1)<<11 | (hw2>>12&7)<<8 | hw2&0xff
+	return imm, hw2 >> 8 & 0xf, true
+}
+
+// encodeThumbMovw replaces the immediate of a Thumb-2 MOVW
+func encodeThumbMovw(hw1, hw2, imm uint16) []byte {
+	hw1 = hw1&^0x040f | (imm>>12)&0xf | (imm>>11&1)<<10
+	hw2 = hw2&^0x70ff | (imm>>8&7)<<12 | imm&0xff
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint16(b, hw1)
+	binary.LittleEndian.PutUint16(b[2:], hw2)
+	return b
+}
+
+// armMovw decodes an A32 MOVW (A2), returning the immediate and Rd
+func armMovw(w uint32) (uint16, uint32, bool) {
+	if w&0x0ff00000 != 0x03000000 || w>>28 == 0xf {
+		return 0, 0, false
+	}
+	return uint16((w>>16&0xf)<<12 | w&0xfff), w >> 12 & 0xf, true
+}
+
+func (l armLocator) candidates(regions []scanRegion, value uint16) []portCandidate {
+	var result []portCandidate
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i++ {
+			if l.thumb {
+				hw1 := binary.LittleEndian.Uint16(r.Data[i:])
+				hw2 := binary.LittleEndian.Uint16(r.Data[i+2:])
+				if imm, _, ok := thumbMovw(hw1, hw2); ok && imm == value {
+					result = append(result, portCandidate{region: ri, offset: i, size: 4, kind: "movw"})
+				}
+			} else {
+				w, _ := readUint32(r.Data, i)
+				if imm, _, ok := armMovw(w); ok && imm == value {
+					result = append(result, portCandidate{region: ri, offset: i, size: 4, kind: "movw"})
+				}
+			}
+		}
+	}
+	return append(result, literalCandidates(regions, value, 1)...)
+}
+
+func (l armLocator) decode(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded {
+	if l.thumb {
+		return l.decodeThumb(regions, value, newValue)
+	}
+	return l.decodeA32(regions, value, newValue)
+}
+
+// addLiteral records a literal load whose pool word holds value
+func addLiteral(result map[portKey]portDecoded, regions []scanRegion, target uint64, value, newValue uint16) {
+	ti, to, ok := findRegion(regions, target, 4)
+	if !ok {
+		return
+	}
+	if w, _ := readUint32(regions[ti].Data, to); w == uint32(value) {
+		result[portKey{ti, to}] = portDecoded{kind: "literal", replacement: putUint32(uint32(newValue))}
+	}
+}
+
+func (armLocator) decodeThumb(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded {
+	result := make(map[portKey]portDecoded)
+	for ri, r := range regions {
+		for i := 0; i+2 <= len(r.Data); {
+			hw1 := binary.LittleEndian.Uint16(r.Data[i:])
+			pc := r.Addr + uint64(i) + 4
+
+			// 16-bit instruction
+			if hw1>>11 < 0x1d || i+4 > len(r.Data) {
+				if hw1&0xf800 == 0x4800 { // LDR Rt, [PC, #imm8*4]
+					addLiteral(result, regions, pc&^3+uint64(hw1&0xff)*4, value, newValue)
+				}
+				i += 2
+				continue
+			}
+
+			hw2 := binary.LittleEndian.Uint16(r.Data[i+2:])
+			if imm, rd, ok := thumbMovw(hw1, hw2); ok && imm == value {
+				d := portDecoded{kind: "movw", replacement: encodeThumbMovw(hw1, hw2, newValue)}
+				for j := i + 4; j+4 <= len(r.Data) && j < i+20; j += 2 {
+					n1 := binary.LittleEndian.Uint16(r.Data[j:])
+					n2 := binary.LittleEndian.Uint16(r.Data[j+2:])
+					if n1&0xfbf0 == 0xf2c0 && n2&0x8000 == 0 && n2>>8&0xf == rd {
+						d = portDecoded{kind: "movw", reason: "part of a wider constant (MOVT follows)"}
+						break
+					}
+				}
+				result[portKey{ri, i}] = d
+			} else if hw1&0xff7f == 0xf85f { // LDR.W Rt, [PC, #+/-imm12]
+				offset := uint64(hw2 & 0xfff)
+				if hw1&0x80 != 0 {
+					addLiteral(result, regions, pc&^3+offset, value, newValue)
+				} else {
+					addLiteral(result, regions, pc&^3-offset, value, newValue)
+				}
+			}
+			i += 4
+		}
+	}
+	return result
+}
+
+func (armLocator) decodeA32(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded {
+	result := make(map[portKey]portDecoded)
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i += 4 {
+			w, _ := readUint32(r.Data, i)
+			if imm, rd, ok := armMovw(w); ok && imm == value {
+				d := portDecoded{kind: "movw", replacement: putUint32(w&^0x000f0fff | uint32(newValue>>12)<<16 | uint32(newValue&0xfff))}
+				for j := i + 4; j+4 <= len(r.Data) && j < i+20; j += 4 {
+					next, _ := readUint32(r.Data, j)
+					if next&0x0ff00000 == 0x03400000 && next>>12&0xf == rd {
+						d = portDecoded{kind: "movw", reason: "part of a wider constant (MOVT follows)"}
+						break
+					}
+				}
+				result[portKey{ri, i}] = d
+			} else if w&0x0f7f0000 == 0x051f0000 && w>>28 != 0xf { // LDR Rt, [PC, #+/-imm12]
+				pc := r.Addr + uint64(i) + 8
+				offset := uint64(w & 0xfff)
+				if w&(1<<23) != 0 {
+					addLiteral(result, regions, pc+offset, value, newValue)
+				} else {
+					addLiteral(result, regions, pc-offset, value, newValue)
+				}
+			}
+		}
+	}
+	return result
+}
+
+// x86Locator handles x86 and x86-64 code: MOV r, imm; MOV r/m, imm and PUSH imm
+type x86Locator struct {
+	mode64 bool
+}
+
+func (x86Locator) candidates(regions []scanRegion, value uint16) []portCandidate {
+	imm := []byte{byte(value), byte(value >> 8), 0, 0}
+	var result []portCandidate
+	for ri, r := range regions {
+		for i := 0; i+4 <= len(r.Data); i++ {
+			if bytesEqual(r.Data[i:i+4], imm) {
+				result = append(result, portCandidate{region: ri, offset: i, size: 4, kind: "imm32"})
+			} else if i >= 2 && r.Data[i-2] == 0x66 && r.Data[i-1]&0xf8 == 0xb8 && bytesEqual(r.Data[i:i+2], imm[:2]) {
+				result = append(result, portCandidate{region: ri, offset: i, size: 2, kind: "imm16"})
+			}
+		}
+	}
+	return result
+}
+
+func (l x86Locator) decode(regions []scanRegion, value, newValue uint16) map[portKey]portDecoded {
+	result := make(map[portKey]portDecoded)
+	for ri, r := range regions {
+		for i := 0; i < len(r.Data); {
+			inst, ok := decodeX86(r.Data[i:], l.mode64)
+			if !ok {
+				i++ // resynchronise on undecodable bytes
+				continue
+			}
+
+			if inst.immSize >= 2 {
+				immOffset := i + inst.immOffset
+				imm := r.Data[immOffset : immOffset+inst.immSize]
+				kind, isLoad := inst.loadKind()
+				matches := uint16(imm[0])|uint16(imm[1])<<8 == value
+				for _, b := range imm[2:] {
+					matches = matches && b == 0
+				}
+
+				if matches {
+					key := portKey{ri, immOffset}
+					if !isLoad {
+						result[key] = portDecoded{kind: kind, reason: "constant is an operand of " + kind + ", not a load"}
+					} else {
+						replacement := make([]byte, inst.immSize)
+						replacement[0] = byte(newValue)
+						replacement[1] = byte(newValue >> 8)
+						result[key] = portDecoded{kind: kind, replacement: replacement[:min(inst.immSize, 4)]}
+					}
+				}
+			}
+			i += inst.length
+		}
+	}
+	return result
+}
+
+// x86Inst is the decoded layout of an x86 instruction
+type x86Inst struct {
+	length      int
+	opcode      byte
+	opmap       int // 0: one-byte, 1: 0F, 2: 0F38, 3: 0F3A
+	vex         bool
+	modrm       byte
+	modrmOffset int
+	hasModrm    bool
+	immOffset   int
+	immSize     int
+}
+
+// loadKind names the instruction and reports whether it materialises its
+// immediate as a value (MOV/PUSH) rather than using it as an operand
+func (x x86Inst) loadKind() (string, bool) {
+	if x.opmap != 0 || x.vex {
+		return "imm-operand", false
+	}
+	switch {
+	case x.opcode >= 0xb8 && x.opcode <= 0xbf:
+		return "mov-reg-imm", true
+	case x.opcode == 0xc7 && x.modrm>>3&7 == 0:
+		return "mov-mem-imm", true
+	case x.opcode == 0x68:
+		return "push-imm", true
+	case x.opcode == 0x3d || x.opcode == 0x81 && x.modrm>>3&7 == 7:
+		return "cmp-imm", false
+	default:
+		return "imm-operand", false
+	}
+}
+
+// decodeX86 decodes the length and immediate layout of one instruction. It
+// is a length decoder, not a full disassembler: operands other than the
+// immediate are skipped.
+func decodeX86(code []byte, mode64 bool) (x86Inst, bool) {
+	var inst x86Inst
+	i := 0
+	opsize16, addrsize16, rexW := false, false, false
+
+	// Legacy prefixes
+prefixes:
+	for i < len(code) && i < 14 {
+		switch code[i] {
+		case 0xf0, 0xf2, 0xf3, 0x2e, 0x36, 0x3e, 0x26, 0x64, 0x65:
+		case 0x66:
+			opsize16 = true
+		case 0x67:
+			addrsize16 = !mode64
+		default:
+			break prefixes
+		}
+		i++
+	}
+	if i >= len(code) {
+		return inst, false
+	}
+
+	// REX
+	if mode64 && code[i]&0xf0 == 0x40 {
+		rexW = code[i]&8 != 0
+		i++
+		if i >= len(code) {
+			return inst, false
+		}
+	}
+
+	op := code[i]
+	vexLike := func() bool {
+		return mode64 || (i+1 < len(code) && code[i+1]&0xc0 == 0xc0)
+	}
+	switch {
+	case (op == 0xc4 || op == 0xc5) && vexLike():
+		inst.vex = true
+		if op == 0xc5 {
+			inst.opmap = 1
+			i += 2
+		} else {
+			if i+2 >= len(code) {
+				return inst, false
+			}
+			inst.opmap = int(code[i+1] & 0x1f)
+			i += 3
+		}
+	case op == 0x62 && vexLike():
+		if i+3 >= len(code) {
+			return inst, false
+		}
+		inst.vex = true
+		inst.opmap = int(code[i+1] & 3)
+		i += 4
+	case op == 0x0f:
+		i++
+		if i >= len(code) {
+			return inst, false
+		}
+		inst.opmap = 1
+		if code[i] == 0x38 || code[i] == 0x3a {
+			inst.opmap = 2
+			if code[i] == 0x3a {
+				inst.opmap = 3
+			}
+			i++
+		}
+	}
+	if i >= len(code) || inst.opmap < 0 || inst.opmap > 3 {
+		return inst, false
+	}
+	inst.opcode = code[i]
+	i++
+
+	immZ := 4
+	if opsize16 {
+		immZ = 2
+	}
+
+	hasModrm, immSize, valid := x86OperandLayout(inst, opsize16, rexW, addrsize16, mode64, immZ)
+	if !valid {
+		return inst, false
+	}
+
+	if hasModrm {
+		if i >= len(code) {
+			return inst, false
+		}
+		inst.hasModrm = true
+		inst.modrm = code[i]
+		inst.modrmOffset = i
+		i++
+		n, ok := x86ModrmExtra(code[i:], inst.modrm, addrsize16)
+		if !ok {
+			return inst, false
+		}
+		i += n
+
+		// TEST r/m, imm is the only group member with an immediate
+		if inst.opmap == 0 && !inst.vex && (inst.opcode == 0xf6 || inst.opcode == 0xf7) && inst.modrm>>3&7 <= 1 {
+			if inst.opcode == 0xf6 {
+				immSize = 1
+			} else {
+				immSize = immZ
+			}
+		}
+	}
+
+	inst.immOffset = i
+	inst.immSize = immSize
+	inst.length = i + immSize
+	if inst.length > len(code) || inst.length > 15 {
+		return inst, false
+	}
+	return inst, true
+}
+
+// x86OperandLayout returns whether the opcode takes a ModRM byte and the size
+// of its immediate
+func x86OperandLayout(inst x86Inst, opsize16, rexW, addrsize16, mode64 bool, immZ int) (bool, int, bool) {
+	op := inst.opcode
+
+	if inst.vex {
+		if inst.opmap == 1 && op == 0x77 { // VZEROUPPER/VZEROALL
+			return false, 0, true
+		}
+		imm := 0
+		if inst.opmap == 3 || (inst.opmap == 1 && (op >= 0x70 && op <= 0x73 || op == 0xc2 || op == 0xc4 || op == 0xc5 || op == 0xc6)) {
+			imm = 1
+		}
+		return true, imm, inst.opmap != 0
+	}
+
+	switch inst.opmap {
+	case 1:
+		switch {
+		case op >= 0x80 && op <= 0x8f: // Jcc rel
+			return false, 4, true
+		case op == 0x05 || op == 0x06 || op == 0x07 || op == 0x08 || op == 0x09 || op == 0x0b || op == 0x0e,
+			op >= 0x30 && op <= 0x37, op == 0x77, op == 0xa0 || op == 0xa1 || op == 0xa2 || op == 0xa8 || op == 0xa9 || op == 0xaa,
+			op >= 0xc8 && op <= 0xcf:
+			return false, 0, true
+		case op >= 0x70 && op <= 0x73, op == 0xa4, op == 0xac, op == 0xba, op == 0xc2, op >= 0xc4 && op <= 0xc6, op == 0x0f:
+			return true, 1, true
+		default:
+			return true, 0, true
+		}
+	case 2:
+		return true, 0, true
+	case 3:
+		return true, 1, true
+	}
+
+	// One-byte opcode map
+	switch {
+	case op < 0x40 && op&7 < 4:
+		return true, 0, true
+	case op < 0x40 && op&7 == 4:
+		return false, 1, true
+	case op < 0x40 && op&7 == 5:
+		return false, immZ, true
+	case op < 0x40:
+		// segment push/pop and BCD adjust are invalid in 64-bit mode
+		if mode64 && op != 0x26 && op != 0x2e && op != 0x36 && op != 0x3e {
+			return false, 0, false
+		}
+		return false, 0, true
+	case op < 0x60: // INC/DEC (32-bit), PUSH/POP
+		return false, 0, true
+	case op == 0x60 || op == 0x61:
+		return false, 0, !mode64
+	case op == 0x62:
+		return true, 0, !mode64
+	case op == 0x63:
+		return true, 0, true
+	case op == 0x68:
+		return false, immZ, true
+	case op == 0x69:
+		return true, immZ, true
+	case op == 0x6a:
+		return false, 1, true
+	case op == 0x6b:
+		return true, 1, true
+	case op < 0x70:
+		return false, 0, true
+	case op < 0x80: // Jcc rel8
+		return false, 1, true
+	case op == 0x80 || op == 0x83:
+		return true, 1, true
+	case op == 0x81:
+		return true, immZ, true
+	case op == 0x82:
+		return true, 1, !mode64
+	case op < 0x90:
+		return true, 0, true
+	case op == 0x9a:
+		return false, immZ + 2, !mode64
+	case op < 0xa0:
+		return false, 0, true
+	case op < 0xa4: // MOV moffs
+		switch {
+		case mode64:
+			return false, 8, true
+		case addrsize16:
+			return false, 2, true
+		default:
+			return false, 4, true
+		}
+	case op == 0xa8:
+		return false, 1, true
+	case op == 0xa9:
+		return false, immZ, true
+	case op < 0xb0:
+		return false, 0, true
+	case op < 0xb8:
+		return false, 1, true
+	case op < 0xc0:
+		if rexW {
+			return false, 8, true
+		}
+		return false, immZ, true
+	case op == 0xc0 || op == 0xc1 || op == 0xc6:
+		return true, 1, true
+	case op == 0xc2 || op == 0xca:
+		return false, 2, true
+	case op == 0xc4 || op == 0xc5:
+		return true, 0, !mode64
+	case op == 0xc7:
+		return true, immZ, true
+	case op == 0xc8:
+		return false, 3, true
+	case op == 0xcd:
+		return false, 1, true
+	case op < 0xd0:
+		return false, 0, true
+	case op < 0xd4:
+		return true, 0, true
+	case op == 0xd4 || op == 0xd5:
+		return false, 1, !mode64
+	case op < 0xd8:
+		return false, 0, true
+	case op < 0xe0: // x87
+		return true, 0, true
+	case op < 0xe8:
+		return false, 1, true
+	case op == 0xe8 || op == 0xe9:
+		if opsize16 && !mode64 {
+			return false, 2, true
+		}
+		return false, 4, true
+	case op == 0xea:
+		return false, immZ + 2, !mode64
+	case op == 0xeb:
+		return false, 1, true
+	case op < 0xf6:
+		return false, 0, true
+	case op == 0xf6 || op == 0xf7:
+		return true, 0, true
+	case op < 0xfe:
+		return false, 0, true
+	default:
+		return true, 0, true
+	}
+}
+
+// x86ModrmExtra returns the number of SIB and displacement bytes following a ModRM byte
+func x86ModrmExtra(code []byte, modrm byte, addrsize16 bool) (int, bool) {
+	mod, rm := modrm>>6, modrm&7
+	if mod == 3 {
+		return 0, true
+	}
+
+	n := 0
+	if addrsize16 {
+		switch {
+		case mod == 0 && rm == 6, mod == 2:
+			n = 2
+		case mod == 1:
+			n = 1
+		}
+		return n, n <= len(code)
+	}
+
+	if rm == 4 {
+		if len(code) < 1 {
+			return 0, false
+		}
+		sib := code[0]
+		n = 1
+		if mod == 0 && sib&7 == 5 {
+			n += 4
+		}
+	} else if mod == 0 && rm == 5 {
+		n += 4
+	}
+	switch mod {
+	case 1:
+		n++
+	case 2:
+		n += 4
+	}
+	return n, n <= len(code)
+}
+
+// sortPortSites orders sites by file offset
+func sortPortSites(sites []PortSite) {
+	sort.Slice(sites, func(i, j int) bool { return sites[i].FileOffset < sites[j].FileOffset })
+}
@@ -0,0 +1,149 @@
+package core
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DefaultFridaPort is the port frida-server listens on when started without -l
+const DefaultFridaPort = 27042
+
+// PortSite is one location encoding the default port constant
+type PortSite struct {
+	Arch           string   `json:"arch,omitempty"`
+	Section        string   `json:"section"`
+	FileOffset     int64    `json:"file_offset"`
+	VirtualAddress uint64   `json:"virtual_address"`
+	Kind           string   `json:"kind"` // movz, movw, literal, mov-reg-imm, ...
+	Original       HexBytes `json:"original"`
+	Replacement    HexBytes `json:"replacement,omitempty"`
+	Reason         string   `json:"reason,omitempty"` // why the site was rejected
+}
+
+// PortPlan lists the sites that set the default port and the candidates
+// that were rejected as ambiguous
+type PortPlan struct {
+	Port     int        `json:"port"`
+	NewPort  int        `json:"new_port"`
+	Sites    []PortSite `json:"sites"`
+	Rejected []PortSite `json:"rejected,omitempty"`
+}
+
+// LocatePort finds the default port constant of a frida-server binary and
+// plans its replacement with newPort
+func LocatePort(filePath string, newPort int) (*PortPlan, error) {
+	file, _, err := detectAndOpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %v", err)
+	}
+	if closer, ok := file.(io.Closer); ok {
+		defer closer.Close()
+	}
+	return locatePortInFile(file, newPort)
+}
+
+// locatePortInFile locates the default port in every supported image of file.
+// Supported are ELF arm/arm64/x86/x86_64 and Mach-O arm64 (including fat slices).
+// Each image must load the constant at exactly one confirmed site: several
+// sites cannot be told apart from unrelated uses of the same number, so the
+// file is rejected rather than patched at all of them.
+func locatePortInFile(file interface{}, newPort int) (*PortPlan, error) {
+	if newPort < 1 || newPort > 65535 {
+		return nil, fmt.Errorf("invalid port %d", newPort)
+	}
+
+	plan := &PortPlan{Port: DefaultFridaPort, NewPort: newPort}
+	var ambiguous []string
+	add := func(locator portLocator, regions []scanRegion) {
+		sites, rejected := locatePort(locator, executableRegions(regions), DefaultFridaPort, uint16(newPort))
+		if len(sites) > 1 {
+			locations := make([]string, len(sites))
+			for i := range sites {
+				locations[i] = fmt.Sprintf("%s 0x%x (%s)", sites[i].Section, sites[i].FileOffset, sites[i].Kind)
+				sites[i].Reason = fmt.Sprintf("one of %d confirmed sites in the image", len(sites))
+				sites[i].Replacement = nil
+			}
+			ambiguous = append(ambiguous, fmt.Sprintf("%s: %s", sites[0].Arch, strings.Join(locations, ", ")))
+			rejected = append(rejected, sites...)
+			sites = nil
+		}
+		plan.Sites = append(plan.Sites, sites...)
+		plan.Rejected = append(plan.Rejected, rejected...)
+	}
+
+	switch f := file.(type) {
+	case *elf.File:
+		locator, err := elfPortLocator(f)
+		if err != nil {
+			return nil, err
+		}
+		regions, err := elfRegions(f)
+		if err != nil {
+			return nil, err
+		}
+		add(locator, regions)
+	case *macho.File:
+		if f.Cpu != macho.CpuArm64 {
+			return nil, fmt.Errorf("port patching is not supported for Mach-O %s", f.Cpu)
+		}
+		regions, err := machoRegions(f, machoArchName(f.Cpu, f.SubCpu), 0)
+		if err != nil {
+			return nil, err
+		}
+		add(arm64Locator{}, regions)
+	case *macho.FatFile:
+		for _, arch := range f.Arches {
+			if arch.Cpu != macho.CpuArm64 {
+				return nil, fmt.Errorf("port patching is not supported for Mach-O %s", arch.Cpu)
+			}
+			regions, err := machoRegions(arch.File, machoArchName(arch.Cpu, arch.SubCpu), int64(arch.Offset))
+			if err != nil {
+				return nil, err
+			}
+			add(arm64Locator{}, regions)
+		}
+	default:
+		return nil, fmt.Errorf("port patching supports ELF and Mach-O arm64 only")
+	}
+
+	sortPortSites(plan.Sites)
+	sortPortSites(plan.Rejected)
+	if len(ambiguous) > 0 {
+		return plan, fmt.Errorf("default port %d is loaded at more than one site, refusing to patch: %s", DefaultFridaPort, strings.Join(ambiguous, "; "))
+	}
+	if len(plan.Sites) == 0 {
+		return plan, fmt.Errorf("default port %d not found in code (%d ambiguous candidate(s) rejected)", DefaultFridaPort, len(plan.Rejected))
+	}
+	return plan, nil
+}
+
+// elfPortLocator selects the port locator for an ELF machine
+func elfPortLocator(f *elf.File) (portLocator, error) {
+	switch f.Machine {
+	case elf.EM_AARCH64:
+		return arm64Locator{}, nil
+	case elf.EM_ARM:
+		// Bit 0 of the entry point selects Thumb state
+		return armLocator{thumb: f.Entry&1 == 1}, nil
+	case elf.EM_386:
+		return x86Locator{mode64: false}, nil
+	case elf.EM_X86_64:
+		return x86Locator{mode64: true}, nil
+	default:
+		return nil, fmt.Errorf("port patching is not supported for ELF %s", f.Machine)
+	}
+}
+
+// executableRegions filters the regions holding code
+func executableRegions(regions []scanRegion) []scanRegion {
+	var result []scanRegion
+	for _, r := range regions {
+		if r.Exec {
+			result = append(result, r)
+		}
+	}
+	return result
+}
@@ -0,0 +1,463 @@
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RPM header data types
+const (
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeBin         = 7
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// RPM header tags
+const (
+	rpmTagHeaderSignatures = 62
+	rpmTagHeaderImmutable  = 63
+	rpmTagI18NTable        = 100
+
+	rpmSigTagSHA1        = 269
+	rpmSigTagSHA256      = 273
+	rpmSigTagSize        = 1000
+	rpmSigTagMD5         = 1004
+	rpmSigTagPayloadSize = 1007
+
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildTime         = 1006
+	rpmTagBuildHost         = 1007
+	rpmTagSize              = 1009
+	rpmTagVendor            = 1011
+	rpmTagLicense           = 1014
+	rpmTagPackager          = 1015
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagOS                = 1021
+	rpmTagArch              = 1022
+	rpmTagPreIn             = 1023
+	rpmTagPostIn            = 1024
+	rpmTagPreUn             = 1025
+	rpmTagPostUn            = 1026
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileRdevs         = 1033
+	rpmTagFileMtimes        = 1034
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinkTos       = 1036
+	rpmTagFileFlags         = 1037
+	rpmTagFileUserName      = 1039
+	rpmTagFileGroupName     = 1040
+	rpmTagSourceRPM         = 1044
+	rpmTagFileVerifyFlags   = 1045
+	rpmTagProvideName       = 1047
+	rpmTagRequireFlags      = 1048
+	rpmTagRequireName       = 1049
+	rpmTagRequireVersion    = 1050
+	rpmTagPreInProg         = 1085
+	rpmTagPostInProg        = 1086
+	rpmTagPreUnProg         = 1087
+	rpmTagPostUnProg        = 1088
+	rpmTagFileDevices       = 1095
+	rpmTagFileInodes        = 1096
+	rpmTagFileLangs         = 1097
+	rpmTagProvideFlags      = 1112
+	rpmTagProvideVersion    = 1113
+	rpmTagDirIndexes        = 1116
+	rpmTagBaseNames         = 1117
+	rpmTagDirNames          = 1118
+	rpmTagPayloadFormat     = 1124
+	rpmTagPayloadCompressor = 1125
+	rpmTagPayloadFlags      = 1126
+	rpmTagFileDigestAlgo    = 5011
+)
+
+const (
+	rpmSenseLess   = 0x02
+	rpmSenseEqual  = 0x08
+	rpmSenseRPMLib = 0x1000000
+
+	rpmFileConfig    = 1 << 0
+	rpmFileNoReplace = 1 << 4
+
+	rpmDigestSHA256 = 8
+)
+
+var rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+
+// rpmLeadArch are the architecture numbers of the legacy lead
+var rpmLeadArch = map[string]uint16{
+	"i686":    1,
+	"x86_64":  1,
+	"armv7hl": 12,
+	"aarch64": 19,
+}
+
+// rpmFile is a regular file of a binary RPM
+type rpmFile struct {
+	Path   string // absolute install path
+	Data   []byte
+	Mode   os.FileMode // permission bits
+	Config bool        // %config(noreplace)
+}
+
+// rpmPackage describes a binary RPM
+type rpmPackage struct {
+	Name        string
+	Version     string
+	Release     string
+	Arch        string
+	Summary     string
+	Description string
+	License     string
+	Group       string
+	URL         string
+	Vendor      string
+	Packager    string
+	BuildTime   time.Time
+	Files       []rpmFile
+
+	// Scriptlets run by /bin/sh; empty ones are omitted
+	PreIn, PostIn, PreUn, PostUn string
+}
+
+// rpmEntry is one tag of an RPM header
+type rpmEntry struct {
+	tag   int32
+	typ   int32
+	count int
+	data  []byte
+}
+
+// rpmHeader builds an RPM header structure
+type rpmHeader struct {
+	entries []rpmEntry
+}
+
+func (h *rpmHeader) add(tag, typ int32, count int, data []byte) {
+	h.entries = append(h.entries, rpmEntry{tag: tag, typ: typ, count: count, data: data})
+}
+
+func (h *rpmHeader) addString(tag int32, s string) {
+	h.add(tag, rpmTypeString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addI18NString(tag int32, s string) {
+	h.add(tag, rpmTypeI18NString, 1, append([]byte(s), 0))
+}
+
+func (h *rpmHeader) addStrings(tag int32, values ...string) {
+	var data []byte
+	for _, s := range values {
+		data = append(append(data, s...), 0)
+	}
+	h.add(tag, rpmTypeStringArray, len(values), data)
+}
+
+func (h *rpmHeader) addInt32(tag int32, values ...int32) {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[4*i:], uint32(v))
+	}
+	h.add(tag, rpmTypeInt32, len(values), data)
+}
+
+func (h *rpmHeader) addInt16(tag int32, values ...int16) {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[2*i:], uint16(v))
+	}
+	h.add(tag, rpmTypeInt16, len(values), data)
+}
+
+func (h *rpmHeader) addBin(tag int32, data []byte) {
+	h.add(tag, rpmTypeBin, len(data), data)
+}
+
+// bytes serializes the header with a leading region tag covering all entries
+func (h *rpmHeader) bytes(regionTag int32) []byte {
+	entries := append([]rpmEntry(nil), h.entries...)
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+
+	var index, store bytes.Buffer
+	putEntry := func(w *bytes.Buffer, tag, typ, offset int32, count int) {
+		var raw [16]byte
+		binary.BigEndian.PutUint32(raw[0:], uint32(tag))
+		binary.BigEndian.PutUint32(raw[4:], uint32(typ))
+		binary.BigEndian.PutUint32(raw[8:], uint32(offset))
+		binary.BigEndian.PutUint32(raw[12:], uint32(count))
+		w.Write(raw[:])
+	}
+
+	var body bytes.Buffer
+	for _, e := range entries {
+		align := 1
+		switch e.typ {
+		case rpmTypeInt16:
+			align = 2
+		case rpmTypeInt32:
+			align = 4
+		}
+		for store.Len()%align != 0 {
+			store.WriteByte(0)
+		}
+		putEntry(&body, e.tag, e.typ, int32(store.Len()), e.count)
+		store.Write(e.data)
+	}
+
+	// The region trailer closes the data store and points back over the index
+	nindex := len(entries) + 1
+	putEntry(&index, regionTag, rpmTypeBin, int32(store.Len()), 16)
+	index.Write(body.Bytes())
+	putEntry(&store, regionTag, rpmTypeBin, int32(-16*nindex), 16)
+
+	out := append([]byte(nil), rpmHeaderMagic...)
+	out = binary.BigEndian.AppendUint32(out, uint32(nindex))
+	out = binary.BigEndian.AppendUint32(out, uint32(store.Len()))
+	out = append(out, index.Bytes()...)
+	return append(out, store.Bytes()...)
+}
+
+// writeCpioEntry writes one newc cpio entry
+func writeCpioEntry(w *bytes.Buffer, name string, ino, mode uint32, mtime int64, data []byte) {
+	fmt.Fprintf(w, "070701%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X%08X",
+		ino, mode, 0, 0, 1, uint32(mtime), len(data), 0, 0, 0, 0, len(name)+1, 0)
+	w.WriteString(name)
+	w.WriteByte(0)
+	for w.Len()%4 != 0 {
+		w.WriteByte(0)
+	}
+	w.Write(data)
+	for w.Len()%4 != 0 {
+		w.WriteByte(0)
+	}
+}
+
+// buildRPM builds a binary RPM v3 package with a gzip compressed cpio payload
+func buildRPM(pkg *rpmPackage) ([]byte, error) {
+	if pkg.Name == "" || pkg.Version == "" || pkg.Arch == "" {
+		return nil, fmt.Errorf("name, version and arch are required")
+	}
+	if strings.ContainsAny(pkg.Version, "- ") {
+		return nil, fmt.Errorf("invalid version %q", pkg.Version)
+	}
+	release := pkg.Release
+	if release == "" {
+		release = "1"
+	}
+	buildTime := pkg.BuildTime
+	if buildTime.IsZero() {
+		buildTime = time.Now()
+	}
+	mtime := int32(buildTime.Unix())
+
+	files := append([]rpmFile(nil), pkg.Files...)
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	// Payload and per-file metadata
+	var payload bytes.Buffer
+	var (
+		dirNames                          []string
+		dirIndexes, sizes, mtimes, inodes []int32
+		flags, verifyFlags, devices       []int32
+		modes, rdevs                      []int16
+		baseNames, digests, linkTos       []string
+		userNames, groupNames, langs      []string
+		totalSize                         int64
+		dirIndex                          = map[string]int32{}
+	)
+	for i, f := range files {
+		if !path.IsAbs(f.Path) || strings.HasSuffix(f.Path, "/") {
+			return nil, fmt.Errorf("invalid file path %q", f.Path)
+		}
+		dir, base := path.Split(f.Path)
+		if _, ok := dirIndex[dir]; !ok {
+			dirIndex[dir] = int32(len(dirNames))
+			dirNames = append(dirNames, dir)
+		}
+		mode := uint32(0100000 | f.Mode.Perm())
+		sum := sha256.Sum256(f.Data)
+
+		dirIndexes = append(dirIndexes, dirIndex[dir])
+		baseNames = append(baseNames, base)
+		sizes = append(sizes, int32(len(f.Data)))
+		modes = append(modes, int16(mode))
+		rdevs = append(rdevs, 0)
+		mtimes = append(mtimes, mtime)
+		digests = append(digests, hex.EncodeToString(sum[:]))
+		linkTos = append(linkTos, "")
+		fileFlags := int32(0)
+		if f.Config {
+			fileFlags = rpmFileConfig | rpmFileNoReplace
+		}
+		flags = append(flags, fileFlags)
+		verifyFlags = append(verifyFlags, -1)
+		userNames = append(userNames, "root")
+		groupNames = append(groupNames, "root")
+		devices = append(devices, 1)
+		inodes = append(inodes, int32(i+1))
+		langs = append(langs, "")
+		totalSize += int64(len(f.Data))
+
+		writeCpioEntry(&payload, "."+f.Path, uint32(i+1), mode, int64(mtime), f.Data)
+	}
+	writeCpioEntry(&payload, "TRAILER!!!", 0, 0, 0, nil)
+	payloadSize := payload.Len()
+
+	var compressed bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(payload.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	// Main header
+	h := &rpmHeader{}
+	h.addStrings(rpmTagI18NTable, "C")
+	h.addString(rpmTagName, pkg.Name)
+	h.addString(rpmTagVersion, pkg.Version)
+	h.addString(rpmTagRelease, release)
+	h.addI18NString(rpmTagSummary, pkg.Summary)
+	h.addI18NString(rpmTagDescription, pkg.Description)
+	h.addInt32(rpmTagBuildTime, mtime)
+	h.addString(rpmTagBuildHost, "localhost")
+	h.addInt32(rpmTagSize, int32(totalSize))
+	if pkg.Vendor != "" {
+		h.addString(rpmTagVendor, pkg.Vendor)
+	}
+	h.addString(rpmTagLicense, pkg.License)
+	if pkg.Packager != "" {
+		h.addString(rpmTagPackager, pkg.Packager)
+	}
+	h.addI18NString(rpmTagGroup, pkg.Group)
+	if pkg.URL != "" {
+		h.addString(rpmTagURL, pkg.URL)
+	}
+	h.addString(rpmTagOS, "linux")
+	h.addString(rpmTagArch, pkg.Arch)
+	// A binary package is told apart from a source package by SOURCERPM
+	h.addString(rpmTagSourceRPM, fmt.Sprintf("%s-%s-%s.src.rpm", pkg.Name, pkg.Version, release))
+
+	scriptlets := []struct {
+		tag, prog int32
+		script    string
+	}{
+		{rpmTagPreIn, rpmTagPreInProg, pkg.PreIn},
+		{rpmTagPostIn, rpmTagPostInProg, pkg.PostIn},
+		{rpmTagPreUn, rpmTagPreUnProg, pkg.PreUn},
+		{rpmTagPostUn, rpmTagPostUnProg, pkg.PostUn},
+	}
+	for _, s := range scriptlets {
+		if s.script != "" {
+			h.addString(s.tag, s.script)
+			h.addString(s.prog, "/bin/sh")
+		}
+	}
+
+	if len(files) > 0 {
+		h.addInt32(rpmTagFileSizes, sizes...)
+		h.addInt16(rpmTagFileModes, modes...)
+		h.addInt16(rpmTagFileRdevs, rdevs...)
+		h.addInt32(rpmTagFileMtimes, mtimes...)
+		h.addStrings(rpmTagFileDigests, digests...)
+		h.addStrings(rpmTagFileLinkTos, linkTos...)
+		h.addInt32(rpmTagFileFlags, flags...)
+		h.addStrings(rpmTagFileUserName, userNames...)
+		h.addStrings(rpmTagFileGroupName, groupNames...)
+		h.addInt32(rpmTagFileVerifyFlags, verifyFlags...)
+		h.addInt32(rpmTagFileDevices, devices...)
+		h.addInt32(rpmTagFileInodes, inodes...)
+		h.addStrings(rpmTagFileLangs, langs...)
+		h.addInt32(rpmTagDirIndexes, dirIndexes...)
+		h.addStrings(rpmTagBaseNames, baseNames...)
+		h.addStrings(rpmTagDirNames, dirNames...)
+		h.addInt32(rpmTagFileDigestAlgo, rpmDigestSHA256)
+	}
+
+	fullVersion := pkg.Version + "-" + release
+	h.addStrings(rpmTagProvideName, pkg.Name)
+	h.addInt32(rpmTagProvideFlags, rpmSenseEqual)
+	h.addStrings(rpmTagProvideVersion, fullVersion)
+
+	requires := []struct{ name, version string }{
+		{"rpmlib(CompressedFileNames)", "3.0.4-1"},
+		{"rpmlib(FileDigests)", "4.6.0-1"},
+		{"rpmlib(PayloadFilesHavePrefix)", "4.0-1"},
+	}
+	var requireNames, requireVersions []string
+	var requireFlags []int32
+	for _, r := range requires {
+		requireNames = append(requireNames, r.name)
+		requireVersions = append(requireVersions, r.version)
+		requireFlags = append(requireFlags, rpmSenseLess|rpmSenseEqual|rpmSenseRPMLib)
+	}
+	h.addInt32(rpmTagRequireFlags, requireFlags...)
+	h.addStrings(rpmTagRequireName, requireNames...)
+	h.addStrings(rpmTagRequireVersion, requireVersions...)
+
+	h.addString(rpmTagPayloadFormat, "cpio")
+	h.addString(rpmTagPayloadCompressor, "gzip")
+	h.addString(rpmTagPayloadFlags, "9")
+	header := h.bytes(rpmTagHeaderImmutable)
+
+	// Signature header: digests over the main header and the payload
+	headerSHA1 := sha1.Sum(header)
+	headerSHA256 := sha256.Sum256(header)
+	md5sum := md5.New()
+	md5sum.Write(header)
+	md5sum.Write(compressed.Bytes())
+
+	sig := &rpmHeader{}
+	sig.addString(rpmSigTagSHA1, hex.EncodeToString(headerSHA1[:]))
+	sig.addString(rpmSigTagSHA256, hex.EncodeToString(headerSHA256[:]))
+	sig.addInt32(rpmSigTagSize, int32(len(header)+compressed.Len()))
+	sig.addBin(rpmSigTagMD5, md5sum.Sum(nil))
+	sig.addInt32(rpmSigTagPayloadSize, int32(payloadSize))
+	signature := sig.bytes(rpmTagHeaderSignatures)
+
+	// Lead
+	lead := make([]byte, 96)
+	copy(lead, []byte{0xed, 0xab, 0xee, 0xdb, 3, 0})
+	binary.BigEndian.PutUint16(lead[6:], 0) // binary package
+	binary.BigEndian.PutUint16(lead[8:], rpmLeadArch[pkg.Arch])
+	name := fmt.Sprintf("%s-%s", pkg.Name, fullVersion)
+	if len(name) > 65 {
+		name = name[:65]
+	}
+	copy(lead[10:76], name)
+	binary.BigEndian.PutUint16(lead[76:], 1) // Linux
+	binary.BigEndian.PutUint16(lead[78:], 5) // header-style signature
+
+	var out bytes.Buffer
+	out.Write(lead)
+	out.Write(signature)
+	for out.Len()%8 != 0 {
+		out.WriteByte(0)
+	}
+	out.Write(header)
+	out.Write(compressed.Bytes())
+	return out.Bytes(), nil
+}
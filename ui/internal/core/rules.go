@@ -0,0 +1,352 @@
+package core
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"fridare-gui/internal/utils"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRuleProfile is the name of the embedded replacement profile
+const DefaultRuleProfile = "default"
+
+//go:embed rules/default.yaml
+var defaultRulesData []byte
+
+// Rule describes a single declarative hex replacement
+type Rule struct {
+	Format     string   `json:"format" yaml:"format"`   // macho, elf or pe
+	Section    string   `json:"section" yaml:"section"` // section to search, e.g. __cstring
+	Old        string   `json:"old" yaml:"old"`         // original string
+	New        string   `json:"new" yaml:"new"`         // template, supports {name} and {name3}
+	Arch       []string `json:"arch,omitempty" yaml:"arch,omitempty"`
+	MinVersion string   `json:"min_version,omitempty" yaml:"min_version,omitempty"`
+	MaxVersion string   `json:"max_version,omitempty" yaml:"max_version,omitempty"`
+}
+
+// RuleSet is a named collection of replacement rules
+type RuleSet struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	Rules       []Rule `json:"rules" yaml:"rules"`
+}
+
+// RuleProfile describes a rule set available for selection
+type RuleProfile struct {
+	Name    string
+	Path    string // empty for the embedded profile
+	Builtin bool
+}
+
+// DefaultRuleSet returns the embedded default replacement profile
+func DefaultRuleSet() *RuleSet {
+	rs, err := ParseRuleSet(defaultRulesData, ".yaml")
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded rule profile: %v", err))
+	}
+	return rs
+}
+
+// ParseRuleSet parses rule set data; ext selects JSON (".json") or YAML
+func ParseRuleSet(data []byte, ext string) (*RuleSet, error) {
+	var rs RuleSet
+	switch strings.ToLower(ext) {
+	case ".json":
+		if err := json.Unmarshal(data, &rs); err != nil {
+			return nil, fmt.Errorf("error parsing JSON rules: %v", err)
+		}
+	default:
+		if err := yaml.Unmarshal(data, &rs); err != nil {
+			return nil, fmt.Errorf("error parsing YAML rules: %v", err)
+		}
+	}
+
+	if err := rs.Validate(); err != nil {
+		return nil, err
+	}
+	return &rs, nil
+}
+
+// LoadRuleSet loads a rule set from a JSON or YAML file
+func LoadRuleSet(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading rules file: %v", err)
+	}
+
+	rs, err := ParseRuleSet(data, filepath.Ext(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Base(path), err)
+	}
+	if rs.Name == "" {
+		rs.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return rs, nil
+}
+
+// Validate checks that every rule is complete and uses known placeholders
+func (rs *RuleSet) Validate() error {
+	if len(rs.Rules) == 0 {
+		return fmt.Errorf("rule set contains no rules")
+	}
+	for i, rule := range rs.Rules {
+		if _, err := parseFormat(rule.Format); err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if rule.Section == "" {
+			return fmt.Errorf("rule %d: section is required", i+1)
+		}
+		if rule.Old == "" || rule.New == "" {
+			return fmt.Errorf("rule %d: old and new are required", i+1)
+		}
+		rest := strings.NewReplacer("{name}", "", "{name3}", "").Replace(rule.New)
+		if strings.ContainsAny(rest, "{}") {
+			return fmt.Errorf("rule %d: unknown placeholder in %q", i+1, rule.New)
+		}
+	}
+	return nil
+}
+
+// buildReplacements resolves the rules matching format, arch and version
+// into per-section replacements, keeping the order sections first appear in
+func (rs *RuleSet) buildReplacements(fridaNewName string, format ExecutableFormat, arch, version string) ([]Replacements, error) {
+	var result []Replacements
+	index := make(map[string]int)
+
+	matches := func(rule Rule) bool {
+		ruleFormat, _ := parseFormat(rule.Format)
+		return ruleFormat == format && rule.matchesArch(arch) && rule.matchesVersion(version)
+	}
+
+	// A rule constrained to arch overrides the unconstrained rules replacing
+	// the same string in the same section, e.g. an arm64e-only replacement
+	overridden := make(map[string]bool)
+	for _, rule := range rs.Rules {
+		if len(rule.Arch) > 0 && matches(rule) {
+			overridden[rule.Section+"\x00"+rule.Old] = true
+		}
+	}
+
+	for _, rule := range rs.Rules {
+		if !matches(rule) {
+			continue
+		}
+		if len(rule.Arch) == 0 && overridden[rule.Section+"\x00"+rule.Old] {
+			continue
+		}
+
+		newValue := expandRuleTemplate(rule.New, fridaNewName)
+
+		i, ok := index[rule.Section]
+		if !ok {
+			i = len(result)
+			index[rule.Section] = i
+			result = append(result, Replacements{ExecutableFormat: format, SectionName: rule.Section})
+		}
+		result[i].Items = append(result[i].Items, &Replacement{Old: []byte(rule.Old), New: []byte(newValue)})
+	}
+	return result, nil
+}
+
+// matchesArch reports whether the rule applies to arch; an unknown arch
+// only matches rules without an arch constraint
+func (r Rule) matchesArch(arch string) bool {
+	if len(r.Arch) == 0 {
+		return true
+	}
+	for _, a := range r.Arch {
+		if strings.EqualFold(a, arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesVersion reports whether the rule applies to the given Frida version;
+// an empty version matches every rule
+func (r Rule) matchesVersion(version string) bool {
+	version = upstreamVersion(version)
+	if version == "" {
+		return true
+	}
+	if r.MinVersion != "" && compareVersions(version, r.MinVersion) < 0 {
+		return false
+	}
+	if r.MaxVersion != "" && compareVersions(version, r.MaxVersion) > 0 {
+		return false
+	}
+	return true
+}
+
+// upstreamVersion returns the Frida release of a package version, dropping
+// a Debian epoch and any revision or suffix: "1:16.1.4-1" is "16.1.4"
+func upstreamVersion(version string) string {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.Index(version, ":"); i >= 0 {
+		version = version[i+1:]
+	}
+	end := 0
+	for end < len(version) && (version[end] >= '0' && version[end] <= '9' || version[end] == '.') {
+		end++
+	}
+	return strings.TrimRight(version[:end], ".")
+}
+
+// expandRuleTemplate substitutes the name placeholders of a rule template
+func expandRuleTemplate(template, fridaNewName string) string {
+	name3 := fridaNewName
+	if len(name3) > 3 {
+		name3 = name3[:3]
+	}
+	return strings.NewReplacer("{name}", fridaNewName, "{name3}", name3).Replace(template)
+}
+
+// parseFormat converts a rule format name to ExecutableFormat
+func parseFormat(name string) (ExecutableFormat, error) {
+	switch strings.ToLower(name) {
+	case "macho", "mach-o":
+		return MachO, nil
+	case "elf":
+		return ELF, nil
+	case "pe":
+		return PE, nil
+	default:
+		return 0, fmt.Errorf("unknown format %q", name)
+	}
+}
+
+// RulesDir returns the directory user rule profiles are discovered from
+func RulesDir() (string, error) {
+	configDir, err := utils.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "rules"), nil
+}
+
+// ListRuleProfiles returns the embedded profile followed by the user profiles
+// found in RulesDir
+func ListRuleProfiles() ([]RuleProfile, error) {
+	profiles := []RuleProfile{{Name: DefaultRuleProfile, Builtin: true}}
+
+	dir, err := RulesDir()
+	if err != nil {
+		return profiles, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return profiles, nil
+		}
+		return profiles, err
+	}
+
+	var user []RuleProfile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".yaml" && ext != ".yml" && ext != ".json" {
+			continue
+		}
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if name == DefaultRuleProfile {
+			continue // the embedded profile cannot be shadowed
+		}
+		user = append(user, RuleProfile{Name: name, Path: filepath.Join(dir, entry.Name())})
+	}
+	sort.Slice(user, func(i, j int) bool { return user[i].Name < user[j].Name })
+
+	return append(profiles, user...), nil
+}
+
+// LoadRuleProfile loads a profile by name; an empty name selects the default
+func LoadRuleProfile(name string) (*RuleSet, error) {
+	if name == "" || name == DefaultRuleProfile {
+		return DefaultRuleSet(), nil
+	}
+
+	profiles, err := ListRuleProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return LoadRuleSet(p.Path)
+		}
+	}
+	return nil, fmt.Errorf("rule profile %q not found", name)
+}
+
+// ResolveRuleSet loads spec as a rule file path if it exists, otherwise as a
+// profile name
+func ResolveRuleSet(spec string) (*RuleSet, error) {
+	if spec != "" {
+		if info, err := os.Stat(spec); err == nil && !info.IsDir() {
+			return LoadRuleSet(spec)
+		}
+	}
+	return LoadRuleProfile(spec)
+}
+
+// machoArchName returns the rule arch name of a MachO CPU type; arm64e is
+// told apart from arm64 by its CPU subtype
+func machoArchName(cpu macho.Cpu, subCpu uint32) string {
+	switch cpu {
+	case macho.Cpu386:
+		return "x86"
+	case macho.CpuAmd64:
+		return "x86_64"
+	case macho.CpuArm:
+		return "arm"
+	case macho.CpuArm64:
+		if subCpu&cpuSubtypeMask == cpuSubtypeArm64E {
+			return "arm64e"
+		}
+		return "arm64"
+	default:
+		return ""
+	}
+}
+
+// elfArchName returns the rule arch name of an ELF machine
+func elfArchName(machine elf.Machine) string {
+	switch machine {
+	case elf.EM_386:
+		return "x86"
+	case elf.EM_X86_64:
+		return "x86_64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_AARCH64:
+		return "arm64"
+	default:
+		return ""
+	}
+}
+
+// peArchName returns the rule arch name of a PE machine
+func peArchName(machine uint16) string {
+	switch machine {
+	case pe.IMAGE_FILE_MACHINE_I386:
+		return "x86"
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		return "x86_64"
+	case pe.IMAGE_FILE_MACHINE_ARMNT:
+		return "arm"
+	case pe.IMAGE_FILE_MACHINE_ARM64:
+		return "arm64"
+	default:
+		return ""
+	}
+}
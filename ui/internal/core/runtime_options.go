@@ -0,0 +1,190 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RuntimeOptions frida-server 运行参数，各打包格式 (iOS DEB、Magisk 模块、
+// Linux 服务包、Windows 服务) 按它生成启动配置
+type RuntimeOptions struct {
+	Address     string // 监听 (绑定) 地址，默认 0.0.0.0
+	Certificate string // 启用TLS的证书文件 (PEM，包含证书和私钥)，打包时重命名为 <魔改名>.pem 随包安装
+	Token       string // 客户端认证令牌 (--token)
+	Origin      string // 只接受该 Origin 的 WebSocket 连接 (--origin)
+	AssetRoot   string // 通过HTTP提供静态文件的设备上目录 (--asset-root)
+}
+
+// runtimeOptionUnsafe 参数会写入 shell 脚本、批处理、systemd 单元和 plist，拒绝需要转义的字符
+const runtimeOptionUnsafe = " \t\r\n\"'`$\\%^&|<>();"
+
+// listenHost 返回监听地址，未设置时为 0.0.0.0
+func (o *RuntimeOptions) listenHost() string {
+	if o.Address == "" {
+		return "0.0.0.0"
+	}
+	return o.Address
+}
+
+// ListenAddress 返回frida-server -l 参数的 地址:端口 (IPv6 地址加方括号)
+func (o *RuntimeOptions) ListenAddress(port int) string {
+	return net.JoinHostPort(strings.Trim(o.listenHost(), "[]"), strconv.Itoa(port))
+}
+
+// Validate 检查运行参数，证书必须包含匹配的证书和私钥
+func (o *RuntimeOptions) Validate() error {
+	for _, option := range []struct{ name, value string }{
+		{"监听地址", o.Address},
+		{"认证令牌", o.Token},
+		{"Origin", o.Origin},
+		{"静态文件目录", o.AssetRoot},
+	} {
+		if strings.ContainsAny(option.value, runtimeOptionUnsafe) {
+			return fmt.Errorf("%s包含不支持的字符: %s", option.name, option.value)
+		}
+	}
+	if o.Certificate != "" {
+		if _, err := o.certificateData(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certificateData 读取并校验证书文件
+func (o *RuntimeOptions) certificateData() ([]byte, error) {
+	data, err := os.ReadFile(o.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("读取证书失败: %v", err)
+	}
+	// frida-server 从同一个PEM文件读取证书和私钥
+	if _, err := tls.X509KeyPair(data, data); err != nil {
+		return nil, fmt.Errorf("证书 %s 无效 (需要包含证书和私钥的PEM): %v", filepath.Base(o.Certificate), err)
+	}
+	return data, nil
+}
+
+// CertificateName 返回随包安装的证书文件名
+func CertificateName(magicName string) string {
+	return magicName + ".pem"
+}
+
+// extraArgs 返回监听地址以外的frida-server参数，certPath 为证书在设备上的路径
+func (o *RuntimeOptions) extraArgs(certPath string) []string {
+	var args []string
+	if o.Certificate != "" {
+		args = append(args, "--certificate="+certPath)
+	}
+	if o.Token != "" {
+		args = append(args, "--token="+o.Token)
+	}
+	if o.Origin != "" {
+		args = append(args, "--origin="+o.Origin)
+	}
+	if o.AssetRoot != "" {
+		args = append(args, "--asset-root="+o.AssetRoot)
+	}
+	return args
+}
+
+// Args 返回frida-server的完整启动参数
+func (o *RuntimeOptions) Args(port int, certPath string) []string {
+	return append([]string{"-l", o.ListenAddress(port)}, o.extraArgs(certPath)...)
+}
+
+// applyToLaunchDaemon 将运行参数写入 LaunchDaemon: 已有监听参数、端口或地址不是默认值时设置 -l
+func (o *RuntimeOptions) applyToLaunchDaemon(daemon *LaunchDaemon, port int, certPath string) {
+	if _, ok := daemon.ListenAddress(); ok || port != DefaultFridaPort || o.listenHost() != "0.0.0.0" {
+		daemon.SetListenAddress(o.ListenAddress(port))
+	}
+	if o.Certificate != "" {
+		daemon.SetArgument("--certificate", certPath)
+	}
+	if o.Token != "" {
+		daemon.SetArgument("--token", o.Token)
+	}
+	if o.Origin != "" {
+		daemon.SetArgument("--origin", o.Origin)
+	}
+	if o.AssetRoot != "" {
+		daemon.SetArgument("--asset-root", o.AssetRoot)
+	}
+}
+
+// installCertificate 将证书复制到包目录 root 下的 devicePath，仅所有者可读
+func (o *RuntimeOptions) installCertificate(root, devicePath string) error {
+	data, err := o.certificateData()
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(path.Clean(devicePath), "/")))
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	if err := os.WriteFile(target, data, 0600); err != nil {
+		return fmt.Errorf("写入证书失败: %v", err)
+	}
+	return os.Chmod(target, 0600)
+}
+
+// GenerateSelfSignedCertificate 生成自签名TLS证书 (ECDSA P-256)，返回包含证书和私钥的PEM，
+// 可直接作为 RuntimeOptions.Certificate 使用，客户端以同一文件连接 (frida -H 地址 --certificate 文件)。
+// hosts 为写入证书的域名或IP地址，第一个同时作为 CommonName
+func GenerateSelfSignedCertificate(hosts []string, validFor time.Duration) ([]byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %v", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("生成证书序列号失败: %v", err)
+	}
+
+	commonName := "localhost"
+	if len(hosts) > 0 {
+		commonName = hosts[0]
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // 自签名证书同时作为客户端固定的信任根
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("编码私钥失败: %v", err)
+	}
+	out := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(out, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})...), nil
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// elfRefs is the sorted set of virtual addresses an ELF file is known to
+// reference. It is collected from relocation addends, pointer-sized words of
+// the allocated data sections (in-place REL/RELR addends and absolute
+// pointers) and, on arm64 and x86_64, the targets of ADRP+ADD, ADR and
+// RIP-relative instructions. References made by 32-bit ARM and x86 code
+// (literal pools relative to the PC or the GOT) are not decoded, so the set
+// is incomplete for those machines.
+type elfRefs []uint64
+
+// elfReferencesComplete reports whether elfReferences decodes the code
+// references of the machine
+func elfReferencesComplete(machine elf.Machine) bool {
+	return machine != elf.EM_ARM && machine != elf.EM_386
+}
+
+// elfReferences collects the references of an ELF file
+func elfReferences(file *elf.File) (elfRefs, error) {
+	var refs elfRefs
+	wordSize := 4
+	if file.Class == elf.ELFCLASS64 {
+		wordSize = 8
+	}
+
+	for _, section := range file.Sections {
+		if section.Type == elf.SHT_NOBITS || section.Flags&elf.SHF_ALLOC == 0 && section.Type != elf.SHT_RELA {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("error reading section data for %s: %v", section.Name, err)
+		}
+
+		switch {
+		case section.Type == elf.SHT_RELA:
+			refs = append(refs, relaAddends(data, file.Class, file.ByteOrder)...)
+		case section.Flags&elf.SHF_EXECINSTR != 0:
+			switch file.Machine {
+			case elf.EM_AARCH64:
+				refs = append(refs, arm64References(data, section.Addr)...)
+			case elf.EM_X86_64:
+				refs = append(refs, x86RIPReferences(data, section.Addr)...)
+			}
+		default:
+			for i := int((-section.Addr) & uint64(wordSize-1)); i+wordSize <= len(data); i += wordSize {
+				if wordSize == 8 {
+					refs = append(refs, file.ByteOrder.Uint64(data[i:]))
+				} else {
+					refs = append(refs, uint64(file.ByteOrder.Uint32(data[i:])))
+				}
+			}
+		}
+	}
+
+	sort.Slice(refs, func(i, j int) bool { return refs[i] < refs[j] })
+	return refs, nil
+}
+
+// offsets returns the referenced offsets inside the address range
+// [addr, addr+size), relative to addr
+func (refs elfRefs) offsets(addr, size uint64) map[int]bool {
+	result := make(map[int]bool)
+	for i := sort.Search(len(refs), func(i int) bool { return refs[i] >= addr }); i < len(refs) && refs[i] < addr+size; i++ {
+		result[int(refs[i]-addr)] = true
+	}
+	return result
+}
+
+// relaAddends returns the addends of a SHT_RELA section; for relative
+// relocations they are the addresses the relocated pointers hold
+func relaAddends(data []byte, class elf.Class, order binary.ByteOrder) []uint64 {
+	var addends []uint64
+	if class == elf.ELFCLASS64 {
+		for i := 0; i+24 <= len(data); i += 24 {
+			addends = append(addends, order.Uint64(data[i+16:]))
+		}
+	} else {
+		for i := 0; i+12 <= len(data); i += 12 {
+			addends = append(addends, uint64(order.Uint32(data[i+8:])))
+		}
+	}
+	return addends
+}
+
+// arm64References returns the addresses formed by ADR and by ADRP paired
+// with an ADD (immediate) of the same register within the next instructions
+func arm64References(code []byte, addr uint64) []uint64 {
+	const window = 16 // instructions searched for the ADD of an ADRP
+	var refs []uint64
+	for i := 0; i+4 <= len(code); i += 4 {
+		w := binary.LittleEndian.Uint32(code[i:])
+		if w&0x1f000000 != 0x10000000 {
+			continue // not ADR/ADRP
+		}
+		imm := int64(w>>29&3|(w>>5&0x7ffff)<<2) << 43 >> 43 // sign-extended 21 bits
+		pc := addr + uint64(i)
+		if w&0x80000000 == 0 {
+			refs = append(refs, pc+uint64(imm))
+			continue
+		}
+
+		page := pc&^0xfff + uint64(imm<<12)
+		rd := w & 0x1f
+		for j := i + 4; j+4 <= len(code) && j <= i+4*window; j += 4 {
+			add := binary.LittleEndian.Uint32(code[j:])
+			if add&0xffc00000 == 0x91000000 && add>>5&0x1f == rd {
+				refs = append(refs, page+uint64(add>>10&0xfff))
+				break
+			}
+		}
+	}
+	return refs
+}
+
+// x86RIPReferences returns the targets of RIP-relative memory operands found
+// by a linear sweep of x86_64 code
+func x86RIPReferences(code []byte, addr uint64) []uint64 {
+	var refs []uint64
+	for i := 0; i < len(code); {
+		inst, ok := decodeX86(code[i:], true)
+		if !ok {
+			i++ // resynchronise on undecodable bytes
+			continue
+		}
+		if inst.hasModrm && inst.modrm&0xc7 == 0x05 { // mod 00, r/m 101: [rip+disp32]
+			disp := int32(binary.LittleEndian.Uint32(code[i+inst.modrmOffset+1:]))
+			refs = append(refs, addr+uint64(i+inst.length)+uint64(int64(disp)))
+		}
+		i += inst.length
+	}
+	return refs
+}
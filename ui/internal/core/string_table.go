@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DynamicRename summarizes the structured rename of the symbol and library
+// names an ELF or Mach-O file is linked by
+type DynamicRename struct {
+	Names []DynamicName `json:"names"`
+	// Tables lists the sections and tables rebuilt besides the string tables
+	Tables []string `json:"tables,omitempty"`
+	// Reordered counts the ELF dynamic symbols moved to keep .gnu.hash buckets sorted
+	Reordered int `json:"reordered,omitempty"`
+}
+
+// DynamicName is one renamed symbol or library name
+type DynamicName struct {
+	Arch        string `json:"arch,omitempty"`
+	Kind        string `json:"kind"` // symbol, soname, needed, rpath, runpath, filter, version, export, install-name, dylib or bind
+	Original    string `json:"original"`
+	Replacement string `json:"replacement"`
+}
+
+// stringRef is a reference to a string of a string table
+type stringRef struct {
+	offset uint32
+	kind   string
+}
+
+// renameStringTable renames the strings referenced by refs inside table in
+// place. Each string is renamed once however many references it has; a
+// longer name may only use NUL padding no other string starts in. The table
+// is left inconsistent when problems are returned, so callers must then
+// discard it.
+func renameStringTable(table []byte, refs []stringRef, items []*Replacement) ([]DynamicName, []sectionMatch, []FitProblem) {
+	original := append([]byte(nil), table...)
+
+	// Rename each referenced string once
+	starts := make(map[uint32]bool)
+	renamed := make(map[uint32]string)
+	rules := make(map[uint32]string)
+	var changed []stringRef
+	for _, ref := range refs {
+		if starts[ref.offset] {
+			continue
+		}
+		starts[ref.offset] = true
+		name := cString(original, ref.offset)
+		if newName, rule := renameString(name, items); newName != name {
+			renamed[ref.offset] = newName
+			rules[ref.offset] = rule
+			changed = append(changed, ref)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil, nil
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].offset < changed[j].offset })
+
+	var names []DynamicName
+	var matches []sectionMatch
+	var problems []FitProblem
+	for _, ref := range changed {
+		oldName, newName := cString(original, ref.offset), renamed[ref.offset]
+		start := int(ref.offset)
+
+		available := len(oldName) + 1
+		for j := start + available; j < len(original) && original[j] == 0 && !starts[uint32(j)]; j++ {
+			available++
+		}
+		if len(newName)+1 > available {
+			problems = append(problems, FitProblem{
+				Offset:      start,
+				Original:    oldName,
+				Replacement: newName,
+				Reason:      fmt.Sprintf("%s name needs %d bytes but only %d are available", ref.kind, len(newName)+1, available),
+			})
+			delete(renamed, ref.offset)
+			continue
+		}
+
+		region := table[start : start+max(len(newName), len(oldName))+1]
+		match := sectionMatch{
+			Offset:   start,
+			Rule:     rules[ref.offset],
+			Original: append([]byte(nil), region...),
+		}
+		copy(region, newName)
+		for j := len(newName); j < len(region); j++ {
+			region[j] = 0
+		}
+		match.Replacement = append([]byte(nil), region...)
+		matches = append(matches, match)
+		names = append(names, DynamicName{Kind: ref.kind, Original: oldName, Replacement: newName})
+	}
+
+	// Strings sharing bytes with a renamed string (suffix merging) must still
+	// read back as expected
+	problems = append(problems, sharedStringProblems(original, table, starts, renamed)...)
+	sort.Slice(problems, func(i, j int) bool { return problems[i].Offset < problems[j].Offset })
+	return names, matches, problems
+}
+
+// sharedStringProblems checks that every string starting at starts reads
+// back as expected after original was rewritten into table: renamed strings
+// as their new name and every other string unchanged. Linkers merge a string
+// into the tail of a longer one that ends with it, so a rewrite that moves a
+// string's bytes can change strings referenced from inside it.
+func sharedStringProblems(original, table []byte, starts map[uint32]bool, renamed map[uint32]string) []FitProblem {
+	var problems []FitProblem
+	for offset := range starts {
+		want, ok := renamed[offset]
+		if !ok {
+			want = cString(original, offset)
+		}
+		if got := cString(table, offset); got != want {
+			problems = append(problems, FitProblem{
+				Offset:      int(offset),
+				Original:    cString(original, offset),
+				Replacement: got,
+				Reason:      "string shares its bytes with a renamed string",
+			})
+		}
+	}
+	return problems
+}
+
+// renameString applies every replacement to a symbol or library name and
+// returns the result with the rule that matched first
+func renameString(name string, items []*Replacement) (string, string) {
+	var rule string
+	for _, item := range items {
+		oldName := string(item.Old)
+		if !strings.Contains(name, oldName) {
+			continue
+		}
+		if rule == "" {
+			rule = oldName
+		}
+		name = strings.ReplaceAll(name, oldName, string(item.New))
+	}
+	return name, rule
+}
+
+// cString reads the NUL-terminated string at offset
+func cString(data []byte, offset uint32) string {
+	end := int(offset)
+	for end < len(data) && data[end] != 0 {
+		end++
+	}
+	return string(data[offset:end])
+}
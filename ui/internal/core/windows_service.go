@@ -0,0 +1,431 @@
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"debug/pe"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"fridare-gui/internal/utils"
+)
+
+// windowsServiceName Windows 服务名的格式要求
+var windowsServiceName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// winswConfig WinSW 服务包装器的XML配置
+type winswConfig struct {
+	XMLName     xml.Name `xml:"service"`
+	ID          string   `xml:"id"`
+	Name        string   `xml:"name"`
+	Description string   `xml:"description"`
+	Executable  string   `xml:"executable"`
+	Arguments   string   `xml:"arguments"`
+	StartMode   string   `xml:"startmode"`
+	OnFailure   struct {
+		Action string `xml:"action,attr"`
+		Delay  string `xml:"delay,attr"`
+	} `xml:"onfailure"`
+	Log struct {
+		Mode string `xml:"mode,attr"`
+	} `xml:"log"`
+}
+
+// WindowsServicePackager Windows frida-server 服务包构建器: 将魔改并重命名后的
+// frida-server.exe 与 WinSW 服务配置、安装/卸载脚本打包为zip。
+// frida-server 本身不响应服务控制管理器，安装脚本使用随包附带的 WinSW
+// 包装器注册服务，未附带时回退到 PATH 中的 NSSM
+type WindowsServicePackager struct {
+	ServerPath  string // Windows frida-server.exe 路径
+	OutputPath  string
+	MagicName   string
+	Port        int
+	Version     string         // frida-server 版本，用于筛选按版本限定的替换规则 (空表示应用全部规则)
+	ServiceName string         // 服务名，默认魔改名
+	DisplayName string         // 服务显示名 (可选, 自动生成)
+	Description string         // 服务描述 (可选, 自动生成)
+	WrapperPath string         // WinSW 可执行文件 (可选)
+	Firewall    bool           // 安装时添加入站防火墙规则
+	Rules       *RuleSet       // 替换规则集 (nil 使用内置默认规则)
+	PatchPort   bool           // 修补二进制默认端口，PE 不支持，设置时构建失败 (端口由服务参数 -l 指定)
+	Reports     []*PatchReport // 二进制替换报告
+	Arch        string         // 按frida-server识别出的架构
+
+	RuntimeOptions // 监听地址、TLS证书、认证令牌等运行参数
+}
+
+// NewWindowsServicePackager 创建Windows服务包构建器
+func NewWindowsServicePackager(serverPath, outputPath, magicName string, port int) *WindowsServicePackager {
+	return &WindowsServicePackager{
+		ServerPath: serverPath,
+		OutputPath: outputPath,
+		MagicName:  magicName,
+		Port:       port,
+		Firewall:   true,
+
+		RuntimeOptions: RuntimeOptions{Address: "0.0.0.0"},
+	}
+}
+
+// serviceName 返回服务名
+func (wp *WindowsServicePackager) serviceName() string {
+	if wp.ServiceName != "" {
+		return wp.ServiceName
+	}
+	return wp.MagicName
+}
+
+// displayName 返回服务显示名
+func (wp *WindowsServicePackager) displayName() string {
+	if wp.DisplayName != "" {
+		return wp.DisplayName
+	}
+	return wp.MagicName + " server"
+}
+
+// description 返回服务描述
+func (wp *WindowsServicePackager) description() string {
+	if wp.Description != "" {
+		return wp.Description
+	}
+	return fmt.Sprintf("Dynamic instrumentation toolkit server, listening on %s (Modified: %s)", wp.ListenAddress(wp.Port), wp.MagicName)
+}
+
+// exeName 返回包内frida-server的文件名
+func (wp *WindowsServicePackager) exeName() string {
+	return wp.MagicName + ".exe"
+}
+
+// wrapperName 返回包内 WinSW 的文件名，WinSW 读取同名的 .xml 配置
+func (wp *WindowsServicePackager) wrapperName() string {
+	return wp.MagicName + "-service.exe"
+}
+
+// certificateName 返回包内TLS证书的文件名
+func (wp *WindowsServicePackager) certificateName() string {
+	return CertificateName(wp.MagicName)
+}
+
+// listenArgs 返回frida-server的启动参数，installDir 为安装目录 (WinSW 的 %BASE% 或批处理的 %INSTALL_DIR%)
+func (wp *WindowsServicePackager) listenArgs(installDir string) string {
+	// 安装目录位于 Program Files，证书路径需要加引号
+	return strings.Join(wp.Args(wp.Port, `"`+installDir+`\`+wp.certificateName()+`"`), " ")
+}
+
+// CreatePackage 创建服务包zip
+func (wp *WindowsServicePackager) CreatePackage(progressCallback func(float64, string)) error {
+	log.Printf("INFO: 开始创建Windows服务包 - 输入: %s, 输出: %s, 魔改名: %s, 端口: %d", wp.ServerPath, wp.OutputPath, wp.MagicName, wp.Port)
+	if progressCallback == nil {
+		progressCallback = func(float64, string) {}
+	}
+	if err := wp.validate(); err != nil {
+		return err
+	}
+
+	// 1. 识别架构
+	progressCallback(0.1, "识别frida-server架构...")
+	f, err := pe.Open(wp.ServerPath)
+	if err != nil {
+		return fmt.Errorf("frida-server不是有效的PE文件: %v", err)
+	}
+	wp.Arch = peArchName(f.Machine)
+	f.Close()
+	if wp.Arch == "" {
+		return fmt.Errorf("不支持的架构: 0x%x", f.Machine)
+	}
+	log.Printf("INFO: frida-server架构: %s", wp.Arch)
+
+	// 2. 魔改frida-server
+	progressCallback(0.2, "魔改frida-server...")
+	tempDir, err := os.MkdirTemp("", "fridare-windows-*")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hexReplacer := NewHexReplacer()
+	hexReplacer.Rules = wp.Rules
+	hexReplacer.FridaVersion = wp.Version
+	patchedPath := filepath.Join(tempDir, wp.exeName())
+	report, err := hexReplacer.PatchFileWithReport(wp.ServerPath, wp.MagicName, patchedPath, nil)
+	if err != nil {
+		return fmt.Errorf("HEX替换frida-server失败: %v", err)
+	}
+	report.File = wp.exeName()
+	wp.Reports = []*PatchReport{report}
+	server, err := os.ReadFile(patchedPath)
+	if err != nil {
+		return err
+	}
+	log.Printf("INFO: frida-server 魔改完成，替换 %d 处", report.Count())
+
+	// 3. 服务配置和脚本
+	progressCallback(0.6, "生成服务配置...")
+	config, err := wp.winswConfig()
+	if err != nil {
+		return err
+	}
+	dir := wp.serviceName() + "/"
+	entries := []*zipEntry{
+		{name: dir + wp.exeName(), data: server, mode: 0755},
+		{name: dir + wp.MagicName + "-service.xml", data: config, mode: 0644},
+		{name: dir + "install.bat", data: crlf(wp.installScript()), mode: 0644},
+		{name: dir + "uninstall.bat", data: crlf(wp.uninstallScript()), mode: 0644},
+	}
+	if wp.Certificate != "" {
+		cert, err := wp.certificateData()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &zipEntry{name: dir + wp.certificateName(), data: cert, mode: 0600})
+	}
+	if wp.WrapperPath != "" {
+		wrapper, err := os.ReadFile(wp.WrapperPath)
+		if err != nil {
+			return fmt.Errorf("读取WinSW失败: %v", err)
+		}
+		if _, err := pe.NewFile(bytes.NewReader(wrapper)); err != nil {
+			return fmt.Errorf("WinSW不是有效的Windows可执行文件: %v", err)
+		}
+		entries = append(entries, &zipEntry{name: dir + wp.wrapperName(), data: wrapper, mode: 0755})
+	} else {
+		log.Printf("WARNING: 未附带WinSW，安装时需要 PATH 中存在 nssm.exe")
+	}
+
+	// 4. 写出zip
+	progressCallback(0.8, "打包...")
+	staged, err := utils.CreateAtomic(wp.OutputPath, 0644)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer staged.Abort()
+	if err := writeAlignedZip(staged.File, entries); err != nil {
+		return fmt.Errorf("写入服务包失败: %v", err)
+	}
+	if err := staged.Commit(wp.verifyPackage); err != nil {
+		return err
+	}
+
+	logResidualFingerprints(wp.Reports)
+	progressCallback(1.0, "Windows服务包创建完成!")
+	log.Printf("SUCCESS: Windows服务包创建成功: %s", wp.OutputPath)
+	return nil
+}
+
+// validate 检查配置
+func (wp *WindowsServicePackager) validate() error {
+	if wp.MagicName == "" {
+		return fmt.Errorf("未指定魔改名称")
+	}
+	if wp.Port < 1 || wp.Port > 65535 {
+		return fmt.Errorf("端口必须在1-65535范围内")
+	}
+	if wp.Address == "" {
+		wp.Address = "0.0.0.0"
+	}
+	// 端口定位只支持 ELF 和 Mach-O arm64，Windows 服务的端口已由 -l 参数指定
+	if wp.PatchPort {
+		return fmt.Errorf("Windows frida-server (PE) 不支持修补默认端口，端口已由服务参数 -l 指定")
+	}
+	// 运行参数和名称会写入批处理脚本，拒绝 cmd 的特殊字符
+	if err := wp.RuntimeOptions.Validate(); err != nil {
+		return err
+	}
+	if !windowsServiceName.MatchString(wp.serviceName()) {
+		return fmt.Errorf("服务名格式错误: %s", wp.serviceName())
+	}
+	for _, s := range []string{wp.DisplayName, wp.Description} {
+		if strings.ContainsAny(s, "\"%^&|<>\r\n") {
+			return fmt.Errorf("服务显示名或描述包含不支持的字符: %s", s)
+		}
+	}
+	return nil
+}
+
+// winswConfig 生成 WinSW 配置，frida-server 与包装器位于同一目录
+func (wp *WindowsServicePackager) winswConfig() ([]byte, error) {
+	config := winswConfig{
+		ID:          wp.serviceName(),
+		Name:        wp.displayName(),
+		Description: wp.description(),
+		Executable:  `%BASE%\` + wp.exeName(),
+		Arguments:   wp.listenArgs("%BASE%"),
+		StartMode:   "Automatic",
+	}
+	config.OnFailure.Action = "restart"
+	config.OnFailure.Delay = "10 sec"
+	config.Log.Mode = "roll"
+
+	data, err := xml.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("生成WinSW配置失败: %v", err)
+	}
+	return append(append([]byte(xml.Header), data...), '\n'), nil
+}
+
+// installScript 生成 install.bat: 复制文件到 Program Files，注册并启动服务
+func (wp *WindowsServicePackager) installScript() string {
+	firewall := ""
+	if wp.Firewall {
+		firewall = fmt.Sprintf(`
+:: 允许入站连接
+netsh advfirewall firewall delete rule name="%[1]s" >nul 2>&1
+netsh advfirewall firewall add rule name="%[1]s" dir=in action=allow program="%%INSTALL_DIR%%\%[2]s" protocol=TCP localport=%[3]d >nul
+`, wp.serviceName(), wp.exeName(), wp.Port)
+	}
+
+	return fmt.Sprintf(`@echo off
+setlocal
+
+set "SERVICE=%[1]s"
+set "INSTALL_DIR=%%ProgramFiles%%\%[1]s"
+
+:: 需要管理员权限
+net session >nul 2>&1
+if errorlevel 1 goto :noadmin
+
+sc query "%%SERVICE%%" >nul 2>&1
+if not errorlevel 1 goto :exists
+
+:: 复制文件
+if not exist "%%INSTALL_DIR%%" mkdir "%%INSTALL_DIR%%"
+copy /y "%%~dp0%[2]s" "%%INSTALL_DIR%%\" >nul || goto :fail
+copy /y "%%~dp0%[3]s-service.xml" "%%INSTALL_DIR%%\" >nul || goto :fail
+copy /y "%%~dp0uninstall.bat" "%%INSTALL_DIR%%\" >nul
+if exist "%%~dp0%[3]s.pem" copy /y "%%~dp0%[3]s.pem" "%%INSTALL_DIR%%\" >nul
+if exist "%%~dp0%[4]s" copy /y "%%~dp0%[4]s" "%%INSTALL_DIR%%\" >nul
+
+:: 优先使用随包附带的 WinSW，否则使用 NSSM
+if exist "%%INSTALL_DIR%%\%[4]s" goto :winsw
+where nssm >nul 2>&1
+if errorlevel 1 goto :nowrapper
+
+nssm install "%%SERVICE%%" "%%INSTALL_DIR%%\%[2]s" %[5]s || goto :fail
+nssm set "%%SERVICE%%" DisplayName "%[6]s" >nul
+nssm set "%%SERVICE%%" Description "%[7]s" >nul
+nssm set "%%SERVICE%%" Start SERVICE_AUTO_START >nul
+goto :start
+
+:winsw
+"%%INSTALL_DIR%%\%[4]s" install || goto :fail
+
+:start
+sc start "%%SERVICE%%" >nul || goto :fail
+%[8]s
+echo Service %%SERVICE%% installed, frida-server listening on %[9]s
+exit /b 0
+
+:exists
+echo Error: service %%SERVICE%% already exists, run uninstall.bat first.
+exit /b 1
+
+:noadmin
+echo Error: please run this script as Administrator.
+exit /b 1
+
+:nowrapper
+echo Error: %[4]s not found and nssm.exe is not in PATH.
+echo Put WinSW next to this script as %[4]s or install NSSM.
+exit /b 1
+
+:fail
+echo Error: failed to install service %%SERVICE%%.
+exit /b 1
+`, wp.serviceName(), wp.exeName(), wp.MagicName, wp.wrapperName(), wp.listenArgs("%INSTALL_DIR%"),
+		wp.displayName(), wp.description(), firewall, wp.ListenAddress(wp.Port))
+}
+
+// uninstallScript 生成 uninstall.bat: 停止并删除服务，清理防火墙规则和安装目录
+func (wp *WindowsServicePackager) uninstallScript() string {
+	return fmt.Sprintf(`@echo off
+setlocal
+
+set "SERVICE=%[1]s"
+set "INSTALL_DIR=%%ProgramFiles%%\%[1]s"
+
+:: 需要管理员权限
+net session >nul 2>&1
+if errorlevel 1 goto :noadmin
+
+:: WinSW 和 NSSM 注册的服务都可以直接由 sc 删除
+sc query "%%SERVICE%%" >nul 2>&1
+if errorlevel 1 goto :files
+sc stop "%%SERVICE%%" >nul 2>&1
+timeout /t 3 /nobreak >nul
+sc delete "%%SERVICE%%" >nul || goto :fail
+
+:files
+netsh advfirewall firewall delete rule name="%%SERVICE%%" >nul 2>&1
+taskkill /f /im %[2]s >nul 2>&1
+:: 从安装目录运行时先切换出去再删除
+cd /d "%%TEMP%%"
+if exist "%%INSTALL_DIR%%" rmdir /s /q "%%INSTALL_DIR%%"
+echo Service %%SERVICE%% removed.
+exit /b 0
+
+:noadmin
+echo Error: please run this script as Administrator.
+exit /b 1
+
+:fail
+echo Error: failed to remove service %%SERVICE%%.
+exit /b 1
+`, wp.serviceName(), wp.exeName())
+}
+
+// crlf 将脚本换行转换为Windows格式
+func crlf(script string) []byte {
+	return []byte(strings.ReplaceAll(script, "\n", "\r\n"))
+}
+
+// verifyPackage 校验生成的服务包
+func (wp *WindowsServicePackager) verifyPackage(tempPath string) error {
+	reader, err := zip.OpenReader(tempPath)
+	if err != nil {
+		return fmt.Errorf("服务包zip无效: %v", err)
+	}
+	defer reader.Close()
+
+	dir := wp.serviceName() + "/"
+	required := map[string]bool{
+		dir + wp.exeName():                  false,
+		dir + wp.MagicName + "-service.xml": false,
+		dir + "install.bat":                 false,
+		dir + "uninstall.bat":               false,
+	}
+	for _, f := range reader.File {
+		if _, ok := required[f.Name]; !ok {
+			continue
+		}
+		required[f.Name] = true
+		if f.Name != dir+wp.exeName() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		peFile, err := pe.NewFile(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("服务包中的 %s 不是有效的PE文件: %v", wp.exeName(), err)
+		}
+		peFile.Close()
+	}
+	for name, found := range required {
+		if !found {
+			return fmt.Errorf("服务包缺少 %s", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,392 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fridare-gui/internal/config"
+	"fridare-gui/internal/core"
+	"fridare-gui/internal/utils"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// apkTabABIs 界面中可指定gadget的ABI
+var apkTabABIs = []string{"arm64-v8a", "armeabi-v7a", "x86_64", "x86"}
+
+// APKTab Android APK gadget注入标签页
+type APKTab struct {
+	app          fyne.App
+	config       *config.Config
+	updateStatus StatusUpdater
+	addLog       func(string)
+	content      *fyne.Container
+
+	// UI 组件
+	apkEntry        *FixedWidthEntry
+	outputPathEntry *FixedWidthEntry
+	magicNameEntry  *FixedWidthEntry
+	gadgetEntries   map[string]*FixedWidthEntry // ABI -> gadget路径
+	modeSelect      *widget.Select
+	addressEntry    *FixedWidthEntry
+	portEntry       *FixedWidthEntry
+	onLoadSelect    *widget.Select
+	scriptEntry     *FixedWidthEntry
+	keystoreEntry   *FixedWidthEntry
+	ksPassEntry     *widget.Entry
+	ksAliasEntry    *FixedWidthEntry
+	keyPassEntry    *widget.Entry
+	progressBar     *widget.ProgressBar
+	progressLabel   *widget.Label
+	injectBtn       *widget.Button
+}
+
+// NewAPKTab 创建APK注入标签页
+func NewAPKTab(app fyne.App, cfg *config.Config, statusUpdater StatusUpdater, logFunc func(string)) *APKTab {
+	at := &APKTab{
+		app:           app,
+		config:        cfg,
+		updateStatus:  statusUpdater,
+		addLog:        logFunc,
+		gadgetEntries: make(map[string]*FixedWidthEntry),
+	}
+
+	at.setupUI()
+	return at
+}
+
+// setupUI 设置UI界面
+func (at *APKTab) setupUI() {
+	at.apkEntry = fixedWidthEntry(200, "选择APK文件...")
+	at.outputPathEntry = fixedWidthEntry(180, "选择输出APK文件路径...")
+	at.magicNameEntry = fixedWidthEntry(100, "1-5字符")
+	at.magicNameEntry.Validator = utils.ValidateMagicName
+	at.magicNameEntry.SetText(at.config.MagicName)
+
+	// 每个ABI一行gadget选择
+	gadgetRows := container.NewVBox()
+	for _, abi := range apkTabABIs {
+		abi := abi
+		entry := fixedWidthEntry(200, "已魔改的frida-gadget .so (可选)...")
+		at.gadgetEntries[abi] = entry
+		gadgetRows.Add(container.NewBorder(nil, nil,
+			widget.NewLabel(fmt.Sprintf("%12s:", abi)),
+			widget.NewButton("选择", func() { at.selectGadget(abi) }),
+			entry))
+	}
+
+	// gadget配置
+	at.addressEntry = fixedWidthEntry(150, "监听地址")
+	at.addressEntry.SetText("127.0.0.1")
+	at.portEntry = fixedWidthEntry(100, "端口")
+	at.portEntry.SetText(strconv.Itoa(at.config.DefaultPort))
+	at.portEntry.Validator = func(text string) error {
+		if port, err := strconv.Atoi(text); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("端口必须在1-65535范围内")
+		}
+		return nil
+	}
+	at.onLoadSelect = widget.NewSelect([]string{"wait", "resume"}, nil)
+	at.onLoadSelect.SetSelected("wait")
+	at.scriptEntry = fixedWidthEntry(200, "随APK打包的脚本文件...")
+	scriptSelectBtn := widget.NewButton("选择", at.selectScript)
+	at.modeSelect = widget.NewSelect([]string{"listen", "script"}, func(mode string) {
+		if mode == "script" {
+			at.addressEntry.Disable()
+			at.portEntry.Disable()
+			at.onLoadSelect.Disable()
+			at.scriptEntry.Enable()
+			scriptSelectBtn.Enable()
+		} else {
+			at.addressEntry.Enable()
+			at.portEntry.Enable()
+			at.onLoadSelect.Enable()
+			at.scriptEntry.Disable()
+			scriptSelectBtn.Disable()
+		}
+	})
+	at.modeSelect.SetSelected("listen")
+
+	// 签名密钥
+	at.keystoreEntry = fixedWidthEntry(200, "JKS / PKCS#12 / PEM 密钥库...")
+	at.ksPassEntry = widget.NewPasswordEntry()
+	at.ksPassEntry.SetPlaceHolder("密钥库密码")
+	at.ksAliasEntry = fixedWidthEntry(150, "别名 (可选)")
+	at.keyPassEntry = widget.NewPasswordEntry()
+	at.keyPassEntry.SetPlaceHolder("私钥密码 (可选)")
+
+	// 进度显示
+	at.progressBar = widget.NewProgressBar()
+	at.progressLabel = widget.NewLabel("准备就绪")
+
+	at.injectBtn = widget.NewButton("注入并签名", at.injectAPK)
+	at.injectBtn.Importance = widget.HighImportance
+
+	// 文件选择区域
+	fileSection := widget.NewCard("文件选择", "", container.NewVBox(
+		container.NewBorder(nil, nil,
+			widget.NewLabel("     输入APK:"),
+			widget.NewButton("选择", at.selectAPK),
+			at.apkEntry),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("     输出路径:"),
+			widget.NewButton("选择", at.selectOutputPath),
+			at.outputPathEntry),
+	))
+
+	gadgetSection := widget.NewCard("frida-gadget", "APK已包含原生库时只为已有的ABI注入", gadgetRows)
+
+	configSection := widget.NewCard("gadget配置", "", container.NewVBox(
+		container.NewHBox(
+			widget.NewLabel("魔改名称:"), at.magicNameEntry,
+			widget.NewLabel("　　模式:"), at.modeSelect,
+		),
+		container.NewHBox(
+			widget.NewLabel("监听地址:"), at.addressEntry,
+			widget.NewLabel("　　端口:"), at.portEntry,
+			widget.NewLabel("　加载时:"), at.onLoadSelect,
+		),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("　　脚本:"),
+			scriptSelectBtn,
+			at.scriptEntry),
+	))
+
+	signSection := widget.NewCard("签名密钥", "", container.NewVBox(
+		container.NewBorder(nil, nil,
+			widget.NewLabel("　密钥库:"),
+			widget.NewButton("选择", at.selectKeystore),
+			at.keystoreEntry),
+		container.NewGridWithColumns(3,
+			at.ksPassEntry,
+			at.ksAliasEntry,
+			at.keyPassEntry,
+		),
+	))
+
+	actionSection := container.NewBorder(nil, nil,
+		container.NewHBox(at.progressLabel, at.progressBar),
+		at.injectBtn,
+		nil,
+	)
+
+	at.content = container.NewVBox(
+		fileSection,
+		gadgetSection,
+		configSection,
+		signSection,
+		actionSection,
+	)
+}
+
+// selectAPK 选择输入APK，并生成默认输出路径
+func (at *APKTab) selectAPK() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		at.apkEntry.SetText(filePath)
+		if at.outputPathEntry.Text == "" {
+			at.outputPathEntry.SetText(strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "-gadget.apk")
+		}
+		at.addLog(fmt.Sprintf("选择APK文件: %s", filePath))
+	}, at.app.Driver().AllWindows()[0])
+}
+
+// selectOutputPath 选择输出路径
+func (at *APKTab) selectOutputPath() {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		filePath := writer.URI().Path()
+		if !strings.HasSuffix(strings.ToLower(filePath), ".apk") {
+			filePath += ".apk"
+		}
+		at.outputPathEntry.SetText(filePath)
+		at.addLog(fmt.Sprintf("选择输出路径: %s", filePath))
+	}, at.app.Driver().AllWindows()[0])
+}
+
+// selectGadget 选择gadget库，按ELF架构放到对应ABI
+func (at *APKTab) selectGadget(abi string) {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		detected, err := core.DetectGadgetABI(filePath)
+		if err != nil {
+			at.showError(fmt.Sprintf("无法识别gadget库: %v", err))
+			return
+		}
+		if detected != abi {
+			at.addLog(fmt.Sprintf("WARNING: %s 的架构为 %s，已放到对应ABI", filePath, detected))
+		}
+		at.gadgetEntries[detected].SetText(filePath)
+		at.addLog(fmt.Sprintf("选择gadget库 (%s): %s", detected, filePath))
+	}, at.app.Driver().AllWindows()[0])
+}
+
+// selectScript 选择随APK打包的脚本
+func (at *APKTab) selectScript() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		at.scriptEntry.SetText(reader.URI().Path())
+	}, at.app.Driver().AllWindows()[0])
+}
+
+// selectKeystore 选择签名密钥库
+func (at *APKTab) selectKeystore() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		at.keystoreEntry.SetText(reader.URI().Path())
+	}, at.app.Driver().AllWindows()[0])
+}
+
+// injectAPK 验证输入并开始注入
+func (at *APKTab) injectAPK() {
+	if at.apkEntry.Text == "" {
+		at.showError("请选择APK文件")
+		return
+	}
+	if at.outputPathEntry.Text == "" {
+		at.showError("请选择输出路径")
+		return
+	}
+	if err := at.magicNameEntry.Validator(at.magicNameEntry.Text); err != nil {
+		at.showError(fmt.Sprintf("魔改名称格式错误: %v", err))
+		return
+	}
+
+	injector := core.NewAPKInjector(at.apkEntry.Text, at.outputPathEntry.Text, at.magicNameEntry.Text)
+	for abi, entry := range at.gadgetEntries {
+		if entry.Text != "" {
+			injector.Gadgets[abi] = entry.Text
+		}
+	}
+	if len(injector.Gadgets) == 0 {
+		at.showError("请至少选择一个frida-gadget库")
+		return
+	}
+
+	injector.Config.Mode = at.modeSelect.Selected
+	if injector.Config.Mode == "script" {
+		if at.scriptEntry.Text == "" {
+			at.showError("script 模式需要选择脚本文件")
+			return
+		}
+		injector.Config.ScriptFile = at.scriptEntry.Text
+	} else {
+		port, err := strconv.Atoi(at.portEntry.Text)
+		if err != nil || port < 1 || port > 65535 {
+			at.showError("端口必须在1-65535范围内")
+			return
+		}
+		injector.Config.Address = at.addressEntry.Text
+		injector.Config.Port = port
+		injector.Config.OnLoad = at.onLoadSelect.Selected
+	}
+
+	if at.keystoreEntry.Text == "" {
+		at.showError("请选择签名密钥库")
+		return
+	}
+	key, err := core.LoadSigningKey(at.keystoreEntry.Text, at.ksPassEntry.Text, at.ksAliasEntry.Text, at.keyPassEntry.Text)
+	if err != nil {
+		at.showError(fmt.Sprintf("加载签名密钥失败: %v", err))
+		return
+	}
+	injector.Key = key
+
+	at.injectBtn.Disable()
+	at.progressBar.SetValue(0)
+	at.progressLabel.SetText("开始注入...")
+
+	go at.performInject(injector)
+}
+
+// performInject 执行注入
+func (at *APKTab) performInject(injector *core.APKInjector) {
+	defer fyne.Do(at.injectBtn.Enable)
+
+	at.addLog(fmt.Sprintf("INFO: 开始注入APK: %s", injector.InputPath))
+	at.addLog(fmt.Sprintf("INFO: 签名证书: %s", injector.Key.Certificate().Subject))
+
+	err := injector.Inject(func(progress float64, message string) {
+		fyne.Do(func() {
+			at.progressBar.SetValue(progress)
+			at.progressLabel.SetText(message)
+			at.updateStatus(message)
+		})
+	})
+	if err != nil {
+		fyne.Do(func() {
+			at.progressLabel.SetText("注入失败")
+			at.addLog(fmt.Sprintf("ERROR: APK注入失败: %v", err))
+			at.showError(fmt.Sprintf("APK注入失败: %v", err))
+		})
+		return
+	}
+
+	result := injector.Result
+	fyne.Do(func() {
+		at.progressBar.SetValue(1.0)
+		at.progressLabel.SetText("注入完成")
+		at.addLog(fmt.Sprintf("SUCCESS: APK注入完成: %s", injector.OutputPath))
+		at.addLog(fmt.Sprintf("INFO: 加载类 %s (%s), 写入 %d 个文件", result.LoaderClass, result.DexName, len(result.Libraries)))
+		for _, warning := range result.Warnings {
+			at.addLog("WARNING: " + warning)
+		}
+
+		message := fmt.Sprintf("输出文件: %s\n包名: %s\n加载类: %s", injector.OutputPath, result.Package, result.LoaderClass)
+		if len(result.SkippedABIs) > 0 {
+			message += fmt.Sprintf("\n跳过的ABI: %s", strings.Join(result.SkippedABIs, ", "))
+		}
+		at.showSuccess("APK注入成功!", message)
+		at.updateStatus("APK注入完成")
+	})
+}
+
+// showError 显示错误信息
+func (at *APKTab) showError(message string) {
+	dialog.ShowError(fmt.Errorf("%s", message), at.app.Driver().AllWindows()[0])
+}
+
+// showSuccess 显示成功信息
+func (at *APKTab) showSuccess(title, message string) {
+	dialog.ShowInformation(title, message, at.app.Driver().AllWindows()[0])
+}
+
+// Content 返回标签页内容
+func (at *APKTab) Content() *fyne.Container {
+	return at.content
+}
+
+// UpdateGlobalConfig 更新全局配置
+func (at *APKTab) UpdateGlobalConfig(magicName string, port int) {
+	if at.magicNameEntry != nil {
+		at.magicNameEntry.SetText(magicName)
+	}
+	if at.portEntry != nil {
+		at.portEntry.SetText(strconv.Itoa(port))
+	}
+}
@@ -0,0 +1,188 @@
+package ui
+
+import (
+	"bytes"
+	"fmt"
+
+	"fridare-gui/internal/config"
+	"fridare-gui/internal/core"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// DebInspectTab DEB包检查标签页: 查看ar成员、control字段、维护脚本、文件列表、Mach-O签名和越狱布局
+type DebInspectTab struct {
+	app          fyne.App
+	config       *config.Config
+	updateStatus StatusUpdater
+	addLog       func(string)
+	content      *fyne.Container
+
+	// UI 组件
+	debEntry     *FixedWidthEntry
+	formatSelect *widget.Select
+	summaryLabel *widget.Label
+	resultEntry  *widget.Entry
+	inspectBtn   *widget.Button
+	saveBtn      *widget.Button
+
+	inspection *core.DebInspection
+}
+
+// debInspectFormats 输出格式选项
+var debInspectFormats = map[string]string{
+	"文本":   "text",
+	"JSON": "json",
+}
+
+// NewDebInspectTab 创建DEB包检查标签页
+func NewDebInspectTab(app fyne.App, cfg *config.Config, statusUpdater StatusUpdater, logFunc func(string)) *DebInspectTab {
+	dt := &DebInspectTab{
+		app:          app,
+		config:       cfg,
+		updateStatus: statusUpdater,
+		addLog:       logFunc,
+	}
+
+	dt.setupUI()
+	return dt
+}
+
+// setupUI 设置UI界面
+func (dt *DebInspectTab) setupUI() {
+	dt.debEntry = fixedWidthEntry(200, "选择DEB文件...")
+	dt.formatSelect = widget.NewSelect([]string{"文本", "JSON"}, func(string) {
+		dt.render()
+	})
+	dt.formatSelect.SetSelected("文本")
+
+	dt.summaryLabel = widget.NewLabel("未检查")
+	dt.resultEntry = widget.NewMultiLineEntry()
+	dt.resultEntry.TextStyle = fyne.TextStyle{Monospace: true}
+	dt.resultEntry.Wrapping = fyne.TextWrapOff
+	dt.resultEntry.SetPlaceHolder("选择DEB包后点击检查")
+	dt.resultEntry.SetMinRowsVisible(24)
+
+	dt.inspectBtn = widget.NewButton("检查", dt.inspectDeb)
+	dt.inspectBtn.Importance = widget.HighImportance
+	dt.saveBtn = widget.NewButton("保存报告", dt.saveReport)
+	dt.saveBtn.Disable()
+
+	fileSection := widget.NewCard("DEB包", "ar成员、control字段、维护脚本、文件权限/所有者/哈希、Mach-O切片和签名、rootful/rootless布局",
+		container.NewVBox(
+			container.NewBorder(nil, nil,
+				widget.NewLabel("     DEB文件:"),
+				widget.NewButton("选择", dt.selectDeb),
+				dt.debEntry),
+			container.NewHBox(
+				widget.NewLabel("输出格式:"), dt.formatSelect,
+				dt.inspectBtn, dt.saveBtn,
+			),
+		))
+
+	resultSection := widget.NewCard("检查结果", "", container.NewBorder(dt.summaryLabel, nil, nil, nil, dt.resultEntry))
+
+	dt.content = container.NewVBox(
+		fileSection,
+		resultSection,
+	)
+}
+
+// selectDeb 选择要检查的DEB包
+func (dt *DebInspectTab) selectDeb() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		dt.debEntry.SetText(filePath)
+		dt.addLog(fmt.Sprintf("选择DEB文件: %s", filePath))
+	}, dt.app.Driver().AllWindows()[0])
+}
+
+// inspectDeb 在后台检查DEB包
+func (dt *DebInspectTab) inspectDeb() {
+	debPath := dt.debEntry.Text
+	if debPath == "" {
+		dt.showError("请选择DEB文件")
+		return
+	}
+
+	dt.inspectBtn.Disable()
+	dt.summaryLabel.SetText("正在检查...")
+	dt.updateStatus("正在检查DEB包...")
+
+	go func() {
+		defer fyne.Do(dt.inspectBtn.Enable)
+
+		inspection, err := core.InspectDeb(debPath)
+		fyne.Do(func() {
+			if err != nil {
+				dt.summaryLabel.SetText("检查失败")
+				dt.addLog(fmt.Sprintf("ERROR: 检查DEB包失败: %v", err))
+				dt.showError(fmt.Sprintf("检查DEB包失败: %v", err))
+				return
+			}
+
+			dt.inspection = inspection
+			dt.saveBtn.Enable()
+			dt.render()
+			summary := fmt.Sprintf("%s %s (%s), 布局: %s, %d 个文件, %d 个Mach-O",
+				inspection.ControlField("Package"), inspection.ControlField("Version"), inspection.ControlField("Architecture"),
+				inspection.Layout.Kind, len(inspection.Files), len(inspection.MachOFiles()))
+			dt.summaryLabel.SetText(summary)
+			dt.addLog("INFO: DEB包检查完成: " + summary)
+			for _, problem := range inspection.Problems {
+				dt.addLog("WARNING: " + problem)
+			}
+			dt.updateStatus("DEB包检查完成")
+		})
+	}()
+}
+
+// render 按选择的格式显示检查结果
+func (dt *DebInspectTab) render() {
+	if dt.inspection == nil || dt.resultEntry == nil {
+		return
+	}
+	var buf bytes.Buffer
+	if err := core.WriteDebInspection(&buf, dt.inspection, debInspectFormats[dt.formatSelect.Selected]); err != nil {
+		dt.showError(fmt.Sprintf("输出检查结果失败: %v", err))
+		return
+	}
+	dt.resultEntry.SetText(buf.String())
+}
+
+// saveReport 将检查结果保存到文件
+func (dt *DebInspectTab) saveReport() {
+	if dt.inspection == nil {
+		return
+	}
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		if err := core.WriteDebInspection(writer, dt.inspection, debInspectFormats[dt.formatSelect.Selected]); err != nil {
+			dt.showError(fmt.Sprintf("保存检查结果失败: %v", err))
+			return
+		}
+		dt.addLog(fmt.Sprintf("INFO: 检查结果已保存: %s", writer.URI().Path()))
+	}, dt.app.Driver().AllWindows()[0])
+}
+
+// showError 显示错误信息
+func (dt *DebInspectTab) showError(message string) {
+	dialog.ShowError(fmt.Errorf("%s", message), dt.app.Driver().AllWindows()[0])
+}
+
+// Content 返回标签页内容
+func (dt *DebInspectTab) Content() *fyne.Container {
+	return dt.content
+}
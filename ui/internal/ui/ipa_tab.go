@@ -0,0 +1,339 @@
+package ui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"fridare-gui/internal/config"
+	"fridare-gui/internal/core"
+	"fridare-gui/internal/utils"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+// IPATab iOS IPA gadget注入标签页
+type IPATab struct {
+	app          fyne.App
+	config       *config.Config
+	updateStatus StatusUpdater
+	addLog       func(string)
+	content      *fyne.Container
+
+	// UI 组件
+	ipaEntry        *FixedWidthEntry
+	outputPathEntry *FixedWidthEntry
+	magicNameEntry  *FixedWidthEntry
+	gadgetEntry     *FixedWidthEntry
+	patchCheck      *widget.Check
+	modeSelect      *widget.Select
+	addressEntry    *FixedWidthEntry
+	portEntry       *FixedWidthEntry
+	onLoadSelect    *widget.Select
+	scriptEntry     *FixedWidthEntry
+	signingSelect   *widget.Select
+	progressBar     *widget.ProgressBar
+	progressLabel   *widget.Label
+	injectBtn       *widget.Button
+}
+
+// ipaSigningOptions 签名方式选项
+var ipaSigningOptions = map[string]string{
+	"ad-hoc 签名":  core.IPASigningAdhoc,
+	"不签名 (输出清单)": core.IPASigningNone,
+}
+
+// NewIPATab 创建IPA注入标签页
+func NewIPATab(app fyne.App, cfg *config.Config, statusUpdater StatusUpdater, logFunc func(string)) *IPATab {
+	it := &IPATab{
+		app:          app,
+		config:       cfg,
+		updateStatus: statusUpdater,
+		addLog:       logFunc,
+	}
+
+	it.setupUI()
+	return it
+}
+
+// setupUI 设置UI界面
+func (it *IPATab) setupUI() {
+	it.ipaEntry = fixedWidthEntry(200, "选择IPA文件...")
+	it.outputPathEntry = fixedWidthEntry(180, "选择输出IPA文件路径...")
+	it.magicNameEntry = fixedWidthEntry(100, "1-5字符")
+	it.magicNameEntry.Validator = utils.ValidateMagicName
+	it.magicNameEntry.SetText(it.config.MagicName)
+
+	it.gadgetEntry = fixedWidthEntry(200, "FridaGadget.dylib...")
+	it.patchCheck = widget.NewCheck("使用魔改名称魔改gadget", nil)
+	it.patchCheck.SetChecked(true)
+
+	// gadget配置
+	it.addressEntry = fixedWidthEntry(150, "监听地址")
+	it.addressEntry.SetText("127.0.0.1")
+	it.portEntry = fixedWidthEntry(100, "端口")
+	it.portEntry.SetText(strconv.Itoa(it.config.DefaultPort))
+	it.portEntry.Validator = func(text string) error {
+		if port, err := strconv.Atoi(text); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("端口必须在1-65535范围内")
+		}
+		return nil
+	}
+	it.onLoadSelect = widget.NewSelect([]string{"wait", "resume"}, nil)
+	it.onLoadSelect.SetSelected("wait")
+	it.scriptEntry = fixedWidthEntry(200, "随IPA打包的脚本文件...")
+	scriptSelectBtn := widget.NewButton("选择", it.selectScript)
+	it.modeSelect = widget.NewSelect([]string{"listen", "script"}, func(mode string) {
+		if mode == "script" {
+			it.addressEntry.Disable()
+			it.portEntry.Disable()
+			it.onLoadSelect.Disable()
+			it.scriptEntry.Enable()
+			scriptSelectBtn.Enable()
+		} else {
+			it.addressEntry.Enable()
+			it.portEntry.Enable()
+			it.onLoadSelect.Enable()
+			it.scriptEntry.Disable()
+			scriptSelectBtn.Disable()
+		}
+	})
+	it.modeSelect.SetSelected("listen")
+
+	it.signingSelect = widget.NewSelect([]string{"ad-hoc 签名", "不签名 (输出清单)"}, nil)
+	it.signingSelect.SetSelected("ad-hoc 签名")
+
+	// 进度显示
+	it.progressBar = widget.NewProgressBar()
+	it.progressLabel = widget.NewLabel("准备就绪")
+
+	it.injectBtn = widget.NewButton("注入", it.injectIPA)
+	it.injectBtn.Importance = widget.HighImportance
+
+	// 文件选择区域
+	fileSection := widget.NewCard("文件选择", "App Store 下载的IPA需先解密", container.NewVBox(
+		container.NewBorder(nil, nil,
+			widget.NewLabel("     输入IPA:"),
+			widget.NewButton("选择", it.selectIPA),
+			it.ipaEntry),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("     输出路径:"),
+			widget.NewButton("选择", it.selectOutputPath),
+			it.outputPathEntry),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("      gadget:"),
+			widget.NewButton("选择", it.selectGadget),
+			it.gadgetEntry),
+	))
+
+	configSection := widget.NewCard("gadget配置", "", container.NewVBox(
+		container.NewHBox(
+			widget.NewLabel("魔改名称:"), it.magicNameEntry,
+			widget.NewLabel("　　模式:"), it.modeSelect,
+			it.patchCheck,
+		),
+		container.NewHBox(
+			widget.NewLabel("监听地址:"), it.addressEntry,
+			widget.NewLabel("　　端口:"), it.portEntry,
+			widget.NewLabel("　加载时:"), it.onLoadSelect,
+		),
+		container.NewBorder(nil, nil,
+			widget.NewLabel("　　脚本:"),
+			scriptSelectBtn,
+			it.scriptEntry),
+	))
+
+	signSection := widget.NewCard("签名", "ad-hoc 签名的IPA只能在越狱或 TrollStore 等环境安装",
+		container.NewHBox(widget.NewLabel("签名方式:"), it.signingSelect))
+
+	actionSection := container.NewBorder(nil, nil,
+		container.NewHBox(it.progressLabel, it.progressBar),
+		it.injectBtn,
+		nil,
+	)
+
+	it.content = container.NewVBox(
+		fileSection,
+		configSection,
+		signSection,
+		actionSection,
+	)
+}
+
+// selectIPA 选择输入IPA，并生成默认输出路径
+func (it *IPATab) selectIPA() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		it.ipaEntry.SetText(filePath)
+		if it.outputPathEntry.Text == "" {
+			it.outputPathEntry.SetText(strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "-gadget.ipa")
+		}
+		it.addLog(fmt.Sprintf("选择IPA文件: %s", filePath))
+	}, it.app.Driver().AllWindows()[0])
+}
+
+// selectOutputPath 选择输出路径
+func (it *IPATab) selectOutputPath() {
+	dialog.ShowFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil || writer == nil {
+			return
+		}
+		defer writer.Close()
+
+		filePath := writer.URI().Path()
+		if !strings.HasSuffix(strings.ToLower(filePath), ".ipa") {
+			filePath += ".ipa"
+		}
+		it.outputPathEntry.SetText(filePath)
+		it.addLog(fmt.Sprintf("选择输出路径: %s", filePath))
+	}, it.app.Driver().AllWindows()[0])
+}
+
+// selectGadget 选择gadget dylib
+func (it *IPATab) selectGadget() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		it.gadgetEntry.SetText(filePath)
+		it.addLog(fmt.Sprintf("选择gadget库: %s", filePath))
+	}, it.app.Driver().AllWindows()[0])
+}
+
+// selectScript 选择随IPA打包的脚本
+func (it *IPATab) selectScript() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+		it.scriptEntry.SetText(reader.URI().Path())
+	}, it.app.Driver().AllWindows()[0])
+}
+
+// injectIPA 验证输入并开始注入
+func (it *IPATab) injectIPA() {
+	if it.ipaEntry.Text == "" {
+		it.showError("请选择IPA文件")
+		return
+	}
+	if it.outputPathEntry.Text == "" {
+		it.showError("请选择输出路径")
+		return
+	}
+	if it.gadgetEntry.Text == "" {
+		it.showError("请选择frida-gadget库")
+		return
+	}
+	if err := it.magicNameEntry.Validator(it.magicNameEntry.Text); err != nil {
+		it.showError(fmt.Sprintf("魔改名称格式错误: %v", err))
+		return
+	}
+
+	injector := core.NewIPAInjector(it.ipaEntry.Text, it.outputPathEntry.Text, it.magicNameEntry.Text)
+	injector.GadgetPath = it.gadgetEntry.Text
+	injector.PatchGadget = it.patchCheck.Checked
+	injector.Signing = ipaSigningOptions[it.signingSelect.Selected]
+
+	injector.Config.Mode = it.modeSelect.Selected
+	if injector.Config.Mode == "script" {
+		if it.scriptEntry.Text == "" {
+			it.showError("script 模式需要选择脚本文件")
+			return
+		}
+		injector.Config.ScriptFile = it.scriptEntry.Text
+	} else {
+		port, err := strconv.Atoi(it.portEntry.Text)
+		if err != nil || port < 1 || port > 65535 {
+			it.showError("端口必须在1-65535范围内")
+			return
+		}
+		injector.Config.Address = it.addressEntry.Text
+		injector.Config.Port = port
+		injector.Config.OnLoad = it.onLoadSelect.Selected
+	}
+
+	it.injectBtn.Disable()
+	it.progressBar.SetValue(0)
+	it.progressLabel.SetText("开始注入...")
+
+	go it.performInject(injector)
+}
+
+// performInject 执行注入
+func (it *IPATab) performInject(injector *core.IPAInjector) {
+	defer fyne.Do(it.injectBtn.Enable)
+
+	it.addLog(fmt.Sprintf("INFO: 开始注入IPA: %s", injector.InputPath))
+
+	err := injector.Inject(func(progress float64, message string) {
+		fyne.Do(func() {
+			it.progressBar.SetValue(progress)
+			it.progressLabel.SetText(message)
+			it.updateStatus(message)
+		})
+	})
+	if err != nil {
+		fyne.Do(func() {
+			it.progressLabel.SetText("注入失败")
+			it.addLog(fmt.Sprintf("ERROR: IPA注入失败: %v", err))
+			it.showError(fmt.Sprintf("IPA注入失败: %v", err))
+		})
+		return
+	}
+
+	result := injector.Result
+	fyne.Do(func() {
+		it.progressBar.SetValue(1.0)
+		it.progressLabel.SetText("注入完成")
+		it.addLog(fmt.Sprintf("SUCCESS: IPA注入完成: %s", injector.OutputPath))
+		it.addLog(fmt.Sprintf("INFO: %s 加载 %s, 写入 %d 个文件", result.Executable, result.DylibPath, len(result.Files)))
+		for _, warning := range result.Warnings {
+			it.addLog("WARNING: " + warning)
+		}
+
+		message := fmt.Sprintf("输出文件: %s\n应用: %s\n加载命令: %s", injector.OutputPath, result.BundleID, result.DylibPath)
+		if result.Manifest != "" {
+			message += fmt.Sprintf("\n签名清单: %s", result.Manifest)
+		}
+		it.showSuccess("IPA注入成功!", message)
+		it.updateStatus("IPA注入完成")
+	})
+}
+
+// showError 显示错误信息
+func (it *IPATab) showError(message string) {
+	dialog.ShowError(fmt.Errorf("%s", message), it.app.Driver().AllWindows()[0])
+}
+
+// showSuccess 显示成功信息
+func (it *IPATab) showSuccess(title, message string) {
+	dialog.ShowInformation(title, message, it.app.Driver().AllWindows()[0])
+}
+
+// Content 返回标签页内容
+func (it *IPATab) Content() *fyne.Container {
+	return it.content
+}
+
+// UpdateGlobalConfig 更新全局配置
+func (it *IPATab) UpdateGlobalConfig(magicName string, port int) {
+	if it.magicNameEntry != nil {
+		it.magicNameEntry.SetText(magicName)
+	}
+	if it.portEntry != nil {
+		it.portEntry.SetText(strconv.Itoa(port))
+	}
+}
@@ -96,7 +96,10 @@ type MainWindow struct {
 	downloadTab *DownloadTab
 	modifyTab   *ModifyTab
 	packageTab  *PackageTab
-	createTab   *CreateTab // 新增创建标签页
+	inspectTab  *DebInspectTab // DEB包检查标签页
+	createTab   *CreateTab     // 新增创建标签页
+	apkTab      *APKTab        // Android APK 注入标签页
+	ipaTab      *IPATab        // iOS IPA 注入标签页
 	toolsTab    *ToolsTab
 	settingsTab *SettingsTab
 	helpTab     *HelpTab     // 新增帮助标签页
@@ -152,7 +155,10 @@ func (mw *MainWindow) setupUI() {
 	mw.downloadTab = NewDownloadTab(mw.app, mw.config, mw.updateStatus)
 	mw.modifyTab = NewModifyTab(mw.app, mw.config, mw.updateStatus, mw.addLog)
 	mw.packageTab = NewPackageTab(mw.app, mw.config, mw.updateStatus, mw.addLog)
+	mw.inspectTab = NewDebInspectTab(mw.app, mw.config, mw.updateStatus, mw.addLog)
 	mw.createTab = NewCreateTab(mw.app, mw.config, mw.updateStatus, mw.addLog) // 新增创建标签页
+	mw.apkTab = NewAPKTab(mw.app, mw.config, mw.updateStatus, mw.addLog)
+	mw.ipaTab = NewIPATab(mw.app, mw.config, mw.updateStatus, mw.addLog)
 	mw.toolsTab = NewToolsTab(mw.config, mw.updateStatus)
 	mw.toolsTab.SetLogFunction(mw.addLog) // 设置日志函数
 	mw.settingsTab = NewSettingsTab(mw.config, mw.updateStatus, mw.applyTheme, mw.window)
@@ -166,8 +172,14 @@ func (mw *MainWindow) setupUI() {
 		container.NewScroll(mw.modifyTab.Content())))
 	mw.tabContainer.Append(container.NewTabItem("📦 iOS DEB 魔改",
 		container.NewScroll(mw.packageTab.Content())))
+	mw.tabContainer.Append(container.NewTabItem("🔍 DEB 检查",
+		container.NewScroll(mw.inspectTab.Content())))
 	mw.tabContainer.Append(container.NewTabItem("🆕 iOS DEB 打包",
 		container.NewScroll(mw.createTab.Content()))) // 新增创建标签页
+	mw.tabContainer.Append(container.NewTabItem("🤖 Android APK 注入",
+		container.NewScroll(mw.apkTab.Content())))
+	mw.tabContainer.Append(container.NewTabItem("🍎 iOS IPA 注入",
+		container.NewScroll(mw.ipaTab.Content())))
 	mw.tabContainer.Append(container.NewTabItem("🛠️ frida-tools 魔改",
 		container.NewScroll(mw.toolsTab.Content())))
 	mw.tabContainer.Append(container.NewTabItem("🔬 文件分析",
@@ -236,7 +248,7 @@ func (mw *MainWindow) createToolbar() *fyne.Container {
 
 	// 全局魔改配置区域
 	mw.globalMagicNameEntry = NewFixedWidthEntry(80)
-	mw.globalMagicNameEntry.SetPlaceHolder("5字符")
+	mw.globalMagicNameEntry.SetPlaceHolder("1-5字符")
 	if mw.config.MagicName != "" {
 		mw.globalMagicNameEntry.SetText(mw.config.MagicName)
 	} else {
@@ -253,7 +265,7 @@ func (mw *MainWindow) createToolbar() *fyne.Container {
 
 	// 全局配置验证和保存
 	mw.globalMagicNameEntry.OnChanged = func(text string) {
-		if len(text) == 5 && isValidMagicName(text) {
+		if isValidMagicName(text) {
 			mw.updateGlobalMagicName(text)
 		}
 	}
@@ -575,15 +587,7 @@ func (mw *MainWindow) testProxy() {
 
 // isValidMagicName 验证魔改名称
 func isValidMagicName(name string) bool {
-	if len(name) != 5 {
-		return false
-	}
-	for _, c := range name {
-		if !((c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
-			return false
-		}
-	}
-	return true
+	return utils.ValidateMagicName(name) == nil
 }
 
 // updateGlobalMagicName 更新全局魔改名称
@@ -623,6 +627,16 @@ func (mw *MainWindow) updateTabsGlobalConfig() {
 		mw.createTab.UpdateGlobalConfig(mw.config.MagicName, mw.config.DefaultPort)
 	}
 
+	// 更新APKTab
+	if mw.apkTab != nil {
+		mw.apkTab.UpdateGlobalConfig(mw.config.MagicName, mw.config.DefaultPort)
+	}
+
+	// 更新IPATab
+	if mw.ipaTab != nil {
+		mw.ipaTab.UpdateGlobalConfig(mw.config.MagicName, mw.config.DefaultPort)
+	}
+
 	// 更新ToolsTab
 	if mw.toolsTab != nil {
 		mw.toolsTab.UpdateGlobalConfig(mw.config.MagicName, mw.config.DefaultPort)
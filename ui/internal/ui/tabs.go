@@ -43,9 +43,14 @@ type ModifyTab struct {
 	// UI 组件
 	filePathEntry  *widget.Entry
 	magicNameEntry *widget.Entry
+	ruleSelect     *widget.Select
+	patchPortCheck *widget.Check
+	portEntry      *widget.Entry
+	archesEntry    *widget.Entry
 	fileInfoText   *widget.RichText
 	progressBar    *widget.ProgressBar
 	progressLabel  *widget.Label
+	previewBtn     *widget.Button
 	patchBtn       *widget.Button
 
 	// 核心功能
@@ -90,8 +95,8 @@ func (mt *ModifyTab) setupUI() {
 
 	// 魔改选项
 	mt.magicNameEntry = widget.NewEntry()
-	mt.magicNameEntry.SetPlaceHolder("输入5个小写字母")
-	if mt.config.MagicName != "" && len(mt.config.MagicName) == 5 {
+	mt.magicNameEntry.SetPlaceHolder("输入1-5个字母或数字")
+	if utils.ValidateMagicName(mt.config.MagicName) == nil {
 		mt.magicNameEntry.SetText(mt.config.MagicName)
 	} else {
 		mt.magicNameEntry.SetText("frida")
@@ -112,9 +117,46 @@ func (mt *ModifyTab) setupUI() {
 		nil, nil, nil, randomBtn, mt.magicNameEntry,
 	)
 
+	// 替换规则选择
+	mt.ruleSelect = widget.NewSelect(nil, nil)
+	refreshRulesBtn := widget.NewButton("刷新", func() {
+		mt.loadRuleProfiles()
+	})
+	mt.loadRuleProfiles()
+
+	ruleArea := container.NewBorder(
+		nil, nil, nil, refreshRulesBtn, mt.ruleSelect,
+	)
+
+	// 默认端口修补 (仅frida-server)
+	mt.portEntry = widget.NewEntry()
+	mt.portEntry.SetText(strconv.Itoa(mt.config.DefaultPort))
+	mt.portEntry.Disable()
+	mt.patchPortCheck = widget.NewCheck("修补默认端口", func(checked bool) {
+		if checked {
+			mt.portEntry.Enable()
+		} else {
+			mt.portEntry.Disable()
+		}
+	})
+
+	portArea := container.NewBorder(
+		nil, nil, mt.patchPortCheck, nil, mt.portEntry,
+	)
+
+	// fat Mach-O 精简
+	mt.archesEntry = widget.NewEntry()
+	mt.archesEntry.SetPlaceHolder("留空保留全部架构，如 arm64 或 arm64,arm64e")
+
 	optionsForm := container.NewVBox(
-		widget.NewLabel("魔改名称 (必须5个小写字母):"),
+		widget.NewLabel("魔改名称 (1-5个字符，更长名称需字符串有剩余空间):"),
 		magicNameArea,
+		widget.NewLabel("替换规则:"),
+		ruleArea,
+		widget.NewLabel("frida-server 默认端口 (ELF arm/arm64/x86/x86_64, Mach-O arm64):"),
+		portArea,
+		widget.NewLabel("fat Mach-O 保留架构 (逗号分隔):"),
+		mt.archesEntry,
 	)
 
 	// 文件信息显示区域
@@ -133,6 +175,22 @@ func (mt *ModifyTab) setupUI() {
 	mt.patchBtn.Importance = widget.HighImportance
 	mt.patchBtn.Disable() // 初始状态禁用
 
+	// 预览按钮
+	mt.previewBtn = widget.NewButton("预览替换", func() {
+		rules, err := core.LoadRuleProfile(mt.ruleSelect.Selected)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("加载替换规则失败: %v", err), fyne.CurrentApp().Driver().AllWindows()[0])
+			return
+		}
+		mt.hexReplacer.Rules = rules
+		if err := mt.applyPatchOptions(); err != nil {
+			dialog.ShowError(err, fyne.CurrentApp().Driver().AllWindows()[0])
+			return
+		}
+		mt.previewPatch(mt.filePathEntry.Text, mt.magicNameEntry.Text, nil)
+	})
+	mt.previewBtn.Disable()
+
 	// 进度显示
 	mt.progressBar = widget.NewProgressBar()
 	mt.progressBar.Hide()
@@ -149,7 +207,7 @@ func (mt *ModifyTab) setupUI() {
 		widget.NewSeparator(),
 		optionsForm,
 		widget.NewSeparator(),
-		mt.patchBtn,
+		container.NewGridWithColumns(2, mt.previewBtn, mt.patchBtn),
 		mt.progressBar,
 		mt.progressLabel,
 	)
@@ -167,6 +225,30 @@ func (mt *ModifyTab) setupUI() {
 	mt.validateInput(mt.magicNameEntry.Text, mt.filePathEntry.Text)
 }
 
+// loadRuleProfiles 加载可用的替换规则列表
+func (mt *ModifyTab) loadRuleProfiles() {
+	profiles, err := core.ListRuleProfiles()
+	if err != nil {
+		mt.addLog(fmt.Sprintf("WARNING: 读取规则目录失败: %v", err))
+	}
+
+	options := make([]string, 0, len(profiles))
+	for _, p := range profiles {
+		options = append(options, p.Name)
+	}
+	mt.ruleSelect.Options = options
+
+	selected := core.DefaultRuleProfile
+	for _, name := range options {
+		if name == mt.config.RuleProfile {
+			selected = name
+			break
+		}
+	}
+	mt.ruleSelect.SetSelected(selected)
+	mt.ruleSelect.Refresh()
+}
+
 // selectInputFile 选择输入文件
 func (mt *ModifyTab) selectInputFile() {
 	fileDialog := dialog.NewFileOpen(func(reader fyne.URIReadCloser, err error) {
@@ -208,13 +290,15 @@ func (mt *ModifyTab) analyzeFile(filePath string) {
 // validateInput 验证输入
 func (mt *ModifyTab) validateInput(name string, filePath string) {
 	inputValid := name != ""
-	nameValid := len(name) == 5 && utils.IsFridaNewName(name)
+	nameValid := utils.ValidateMagicName(name) == nil
 	filePathValid := utils.FileExists(filePath)
 
 	if inputValid && nameValid && filePathValid {
 		mt.patchBtn.Enable()
+		mt.previewBtn.Enable()
 	} else {
 		mt.patchBtn.Disable()
+		mt.previewBtn.Disable()
 	}
 
 }
@@ -228,6 +312,7 @@ func (mt *ModifyTab) generateRandomName() string {
 func (mt *ModifyTab) startPatching() {
 	inputPath := mt.filePathEntry.Text
 	magicName := mt.magicNameEntry.Text
+	ruleProfile := mt.ruleSelect.Selected
 
 	// 自动生成输出路径
 	dir := filepath.Dir(inputPath)
@@ -244,6 +329,174 @@ func (mt *ModifyTab) startPatching() {
 
 	outputPath := filepath.Join(dir, name+ext)
 
+	// 加载替换规则
+	rules, err := core.LoadRuleProfile(ruleProfile)
+	if err != nil {
+		errorMsg := "加载替换规则失败: " + err.Error()
+		mt.updateStatus(errorMsg)
+		mt.addLog("ERROR: " + errorMsg)
+		dialog.ShowError(fmt.Errorf("%s", errorMsg), fyne.CurrentApp().Driver().AllWindows()[0])
+		return
+	}
+	mt.hexReplacer.Rules = rules
+	if err := mt.applyPatchOptions(); err != nil {
+		mt.updateStatus(err.Error())
+		mt.addLog("ERROR: " + err.Error())
+		dialog.ShowError(err, fyne.CurrentApp().Driver().AllWindows()[0])
+		return
+	}
+
+	// 自动确认时跳过预览
+	if mt.config.AutoConfirm {
+		mt.runPatching(inputPath, magicName, ruleProfile, outputPath)
+		return
+	}
+
+	mt.previewPatch(inputPath, magicName, func() {
+		mt.runPatching(inputPath, magicName, ruleProfile, outputPath)
+	})
+}
+
+// applyPatchOptions 根据端口修补和架构精简选项设置HexReplacer
+func (mt *ModifyTab) applyPatchOptions() error {
+	mt.hexReplacer.Arches = core.ParseArchList(mt.archesEntry.Text)
+	mt.hexReplacer.Port = 0
+	if !mt.patchPortCheck.Checked {
+		return nil
+	}
+	port, err := strconv.Atoi(strings.TrimSpace(mt.portEntry.Text))
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("端口号无效: %s", mt.portEntry.Text)
+	}
+	mt.hexReplacer.Port = port
+	return nil
+}
+
+// previewPatch 预演替换并以表格显示将要修改的内容，onConfirm 为空时仅预览
+func (mt *ModifyTab) previewPatch(inputPath, magicName string, onConfirm func()) {
+	mt.patchBtn.Disable()
+	mt.updateStatus("正在预览替换...")
+
+	go func() {
+		report, err := mt.hexReplacer.DryRun(inputPath, magicName)
+
+		fyne.Do(func() {
+			mt.patchBtn.Enable()
+			window := fyne.CurrentApp().Driver().AllWindows()[0]
+			if err != nil {
+				mt.updateStatus("预览失败: " + err.Error())
+				mt.addLog("ERROR: 预览失败: " + err.Error())
+				dialog.ShowError(fmt.Errorf("预览失败: %v", err), window)
+				return
+			}
+
+			mt.updateStatus(fmt.Sprintf("预览完成: %d 处替换, %d 个问题", report.Count(), len(report.Problems)))
+			mt.addLog(fmt.Sprintf("INFO: 预览 %s: %d 处替换 (规则: %s)", filepath.Base(inputPath), report.Count(), report.Rules))
+
+			content := mt.createPreviewContent(report)
+			if onConfirm == nil || len(report.Problems) > 0 {
+				previewDialog := dialog.NewCustom("替换预览", "关闭", content, window)
+				previewDialog.Resize(fyne.NewSize(900, 500))
+				previewDialog.Show()
+				return
+			}
+
+			confirmDialog := dialog.NewCustomConfirm("替换预览", "开始魔改", "取消", content, func(confirmed bool) {
+				if confirmed {
+					onConfirm()
+				}
+			}, window)
+			confirmDialog.Resize(fyne.NewSize(900, 500))
+			confirmDialog.Show()
+		})
+	}()
+}
+
+// createPreviewContent 创建替换预览表格
+func (mt *ModifyTab) createPreviewContent(report *core.PatchReport) fyne.CanvasObject {
+	headers := []string{"架构", "段", "规则", "文件偏移", "虚拟地址", "原始", "替换"}
+	table := widget.NewTableWithHeaders(
+		func() (int, int) {
+			return len(report.Entries), len(headers)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("Cell Data")
+		},
+		func(id widget.TableCellID, object fyne.CanvasObject) {
+			label := object.(*widget.Label)
+			label.Truncation = fyne.TextTruncateEllipsis
+			if id.Row < 0 || id.Row >= len(report.Entries) {
+				label.SetText("")
+				return
+			}
+
+			entry := report.Entries[id.Row]
+			switch id.Col {
+			case 0:
+				label.SetText(entry.Arch)
+			case 1:
+				label.SetText(entry.Section)
+			case 2:
+				label.SetText(entry.Rule)
+			case 3:
+				label.SetText(fmt.Sprintf("0x%X", entry.FileOffset))
+			case 4:
+				label.SetText(fmt.Sprintf("0x%X", entry.VirtualAddress))
+			case 5:
+				label.SetText(strings.TrimRight(string(entry.Original), "\x00"))
+			case 6:
+				label.SetText(strings.TrimRight(string(entry.Replacement), "\x00"))
+			default:
+				label.SetText("")
+			}
+		},
+	)
+	table.CreateHeader = func() fyne.CanvasObject {
+		return widget.NewLabel("Header")
+	}
+	table.UpdateHeader = func(id widget.TableCellID, object fyne.CanvasObject) {
+		label := object.(*widget.Label)
+		label.TextStyle = fyne.TextStyle{Bold: true}
+		if id.Row < 0 && id.Col >= 0 && id.Col < len(headers) {
+			label.SetText(headers[id.Col])
+		} else if id.Col < 0 && id.Row >= 0 {
+			label.SetText(strconv.Itoa(id.Row + 1))
+		}
+	}
+	for col, width := range []float32{70, 90, 150, 100, 100, 180, 180} {
+		table.SetColumnWidth(col, width)
+	}
+
+	summaryText := fmt.Sprintf("格式: %s    规则: %s    替换: %d 处", report.Format, report.Rules, report.Count())
+	if len(report.Removed) > 0 {
+		summaryText += fmt.Sprintf("    移除架构: %s", strings.Join(report.Removed, ", "))
+	}
+	// fat Mach-O 每个架构切片的匹配情况
+	for _, slice := range report.Slices {
+		summaryText += fmt.Sprintf("\n  %s: 替换 %d 处, 问题 %d 处", slice.Arch, slice.Matches, slice.Problems)
+		if len(slice.Rules) > 0 {
+			summaryText += fmt.Sprintf(" (%s)", strings.Join(slice.Rules, ", "))
+		}
+	}
+	summary := widget.NewLabel(summaryText)
+
+	var bottom fyne.CanvasObject
+	if len(report.Problems) > 0 {
+		var lines []string
+		for _, p := range report.Problems {
+			lines = append(lines, fmt.Sprintf("%s %s+0x%X %q: %s", p.Arch, p.Section, p.Offset, p.Original, p.Reason))
+		}
+		problems := widget.NewLabel(fmt.Sprintf("名称 %q 无法放入以下字符串，请使用更短的名称:\n%s", report.Name, strings.Join(lines, "\n")))
+		problems.Wrapping = fyne.TextWrapWord
+		problems.Importance = widget.DangerImportance
+		bottom = problems
+	}
+
+	return container.NewBorder(summary, bottom, nil, nil, table)
+}
+
+// runPatching 执行魔改
+func (mt *ModifyTab) runPatching(inputPath, magicName, ruleProfile, outputPath string) {
 	// 显示进度
 	mt.progressBar.Show()
 	mt.progressLabel.Show()
@@ -263,6 +516,7 @@ func (mt *ModifyTab) startPatching() {
 		mt.addLog(fmt.Sprintf("INFO: 输入文件: %s", inputPath))
 		mt.addLog(fmt.Sprintf("INFO: 输出文件: %s", outputPath))
 		mt.addLog(fmt.Sprintf("INFO: 魔改名称: %s", magicName))
+		mt.addLog(fmt.Sprintf("INFO: 替换规则: %s (%d 条)", mt.hexReplacer.Rules.Name, len(mt.hexReplacer.Rules.Rules)))
 
 		// 进度回调函数
 		progressCallback := func(progress float64, message string) {
@@ -273,7 +527,7 @@ func (mt *ModifyTab) startPatching() {
 		}
 
 		// 执行修改
-		err := mt.hexReplacer.PatchFile(inputPath, magicName, outputPath, progressCallback)
+		report, err := mt.hexReplacer.PatchFileWithReport(inputPath, magicName, outputPath, progressCallback)
 		if err != nil {
 			errorMsg := "魔改失败: " + err.Error()
 			mt.updateStatus(errorMsg)
@@ -287,12 +541,43 @@ func (mt *ModifyTab) startPatching() {
 
 		mt.progressBar.SetValue(1.0)
 		mt.progressLabel.SetText("魔改完成!")
-		successMsg := fmt.Sprintf("魔改完成! 输出文件: %s", outputPath)
+		successMsg := fmt.Sprintf("魔改完成! 共替换 %d 处, 输出文件: %s", report.Count(), outputPath)
 		mt.updateStatus(successMsg)
 		mt.addLog("SUCCESS: " + successMsg)
 
+		// Mach-O 重新签名结果
+		for _, slice := range report.Signature {
+			mt.addLog(fmt.Sprintf("INFO: 已重新签名 (ad-hoc) %s %s, 权限: %s", slice.Arch, slice.Identifier, slice.Entitlements))
+		}
+
+		// ELF 动态符号 / SONAME 重命名结果
+		if report.Dynamic != nil {
+			for _, name := range report.Dynamic.Names {
+				mt.addLog(fmt.Sprintf("INFO: 动态符号重命名 [%s] %s -> %s", name.Kind, name.Original, name.Replacement))
+			}
+			if len(report.Dynamic.Tables) > 0 {
+				mt.addLog(fmt.Sprintf("INFO: 已重建 %s", strings.Join(report.Dynamic.Tables, ", ")))
+			}
+		}
+
+		// 残留特征扫描结果
+		residual := core.SummarizeFingerprints(report.Residual)
+		if residual.Total > 0 {
+			mt.addLog(fmt.Sprintf("WARNING: 残留特征 %s", residual))
+			for i, hit := range report.Residual {
+				if i >= 20 {
+					mt.addLog(fmt.Sprintf("WARNING:   ... 还有 %d 处", len(report.Residual)-i))
+					break
+				}
+				mt.addLog(fmt.Sprintf("WARNING:   [%s] %s %s+0x%X %q", hit.Severity, hit.Arch, hit.Section, hit.FileOffset, hit.Context))
+			}
+		} else {
+			mt.addLog("INFO: 未发现残留特征")
+		}
+
 		// 更新配置
 		mt.config.MagicName = magicName
+		mt.config.RuleProfile = ruleProfile
 		mt.config.Save()
 		mt.addLog("INFO: 配置已保存")
 
@@ -336,6 +621,7 @@ type PackageTab struct {
 	debFileEntry    *widget.Entry // DEB文件选择
 	outputPathEntry *widget.Entry
 	portEntry       *widget.Entry
+	patchPortCheck  *widget.Check
 	magicNameEntry  *widget.Entry
 	packageBtn      *widget.Button
 	progressBar     *widget.ProgressBar
@@ -406,6 +692,7 @@ func (pt *PackageTab) setupUI() {
 
 	// 魔改配置
 	pt.portEntry = widget.NewEntry()
+	pt.patchPortCheck = widget.NewCheck("修补二进制默认端口", nil)
 	if pt.config.DefaultPort != 0 {
 		pt.portEntry.SetText(fmt.Sprintf("%d", pt.config.DefaultPort))
 	} else {
@@ -414,12 +701,12 @@ func (pt *PackageTab) setupUI() {
 	pt.portEntry.SetPlaceHolder("Frida 服务器端口")
 
 	pt.magicNameEntry = widget.NewEntry()
-	if pt.config.MagicName != "" && len(pt.config.MagicName) == 5 {
+	if utils.ValidateMagicName(pt.config.MagicName) == nil {
 		pt.magicNameEntry.SetText(pt.config.MagicName)
 	} else {
 		pt.magicNameEntry.SetText("frida")
 	}
-	pt.magicNameEntry.SetPlaceHolder("魔改名称 (5个字符)")
+	pt.magicNameEntry.SetPlaceHolder("魔改名称 (1-5个字符)")
 
 	// 验证输入
 	pt.magicNameEntry.OnChanged = func(text string) {
@@ -472,7 +759,7 @@ func (pt *PackageTab) setupUI() {
 			nil, nil, widget.NewLabel("魔改名称:"), nil, magicNameArea,
 		),
 		container.NewBorder(
-			nil, nil, widget.NewLabel("服务端口:"), nil, pt.portEntry,
+			nil, nil, widget.NewLabel("服务端口:"), pt.patchPortCheck, pt.portEntry,
 		),
 		widget.NewSeparator(),
 		packageInfoCard,
@@ -564,7 +851,7 @@ func (pt *PackageTab) selectOutputPath() {
 // validateInput 验证输入
 func (pt *PackageTab) validateInput() {
 	outputPathValid := pt.outputPathEntry.Text != ""
-	magicNameValid := len(pt.magicNameEntry.Text) == 5 && utils.IsFridaNewName(pt.magicNameEntry.Text)
+	magicNameValid := utils.ValidateMagicName(pt.magicNameEntry.Text) == nil
 	portValid := pt.isValidPort(pt.portEntry.Text)
 	fileValid := pt.debFileEntry.Text != ""
 
@@ -629,6 +916,10 @@ func (pt *PackageTab) modifyExistingDebPackage(outputPath string, port int, magi
 
 	// 创建DEB修改器
 	debModifier := core.NewDebModifier(debFile, outputPath, magicName, port)
+	debModifier.PatchPort = pt.patchPortCheck.Checked
+	if debModifier.PatchPort {
+		pt.addLog("INFO: 同时修补frida-server二进制中的默认端口")
+	}
 
 	// 进度回调函数
 	progressCallback := func(progress float64, message string) {
@@ -1433,32 +1724,21 @@ func (tt *ToolsTab) patchSingleSOFile(soFile, magicName, port string) error {
 
 // hexReplace 执行十六进制替换 - 使用HexReplacer进行专业的二进制魔改
 func (tt *ToolsTab) hexReplace(filePath, oldStr, newStr string) error {
-	// 检查新字符串长度（魔改名称必须是5个字符）
-	if len(newStr) != 5 {
-		return fmt.Errorf("魔改名称必须是5个字符，当前为: %s (%d字符)", newStr, len(newStr))
+	// 检查魔改名称 (1-5个字符，更长的名称由HexReplacer检查剩余空间)
+	if err := utils.ValidateMagicName(newStr); err != nil {
+		return fmt.Errorf("%v: %s", err, newStr)
 	}
 
-	// 创建临时输出文件
-	tempFile := filePath + ".tmp"
-
 	// 使用HexReplacer进行专业的二进制魔改
-	err := tt.hexReplacer.PatchFile(filePath, newStr, tempFile, func(progress float64, status string) {
+	// 输出即原文件: HexReplacer先写入同目录下的临时文件，校验通过后才原子替换，失败时原文件保持不变
+	err := tt.hexReplacer.PatchFile(filePath, newStr, filePath, func(progress float64, status string) {
 		// 可以在这里添加进度回调，但对于SO文件魔改我们简化处理
 		tt.addLog(fmt.Sprintf("INFO: %s (%.1f%%)", status, progress*100))
 	})
-
 	if err != nil {
-		// 清理临时文件
-		os.Remove(tempFile)
 		return fmt.Errorf("HexReplacer魔改失败: %v", err)
 	}
 
-	// 替换原文件
-	if err := os.Rename(tempFile, filePath); err != nil {
-		os.Remove(tempFile)
-		return fmt.Errorf("替换原文件失败: %v", err)
-	}
-
 	return nil
 }
 
@@ -1754,7 +2034,7 @@ func (st *SettingsTab) setupUI() {
 	st.defaultPortEntry = fixedWidthEntry(80, "端口")
 	st.defaultPortEntry.SetText(fmt.Sprintf("%d", st.config.DefaultPort))
 
-	st.magicNameEntry = fixedWidthEntry(100, "5字符")
+	st.magicNameEntry = fixedWidthEntry(100, "1-5字符")
 	st.magicNameEntry.SetText(st.config.MagicName)
 
 	st.autoConfirmCheck = widget.NewCheck("自动确认操作", nil)
@@ -1973,10 +2253,10 @@ func (st *SettingsTab) validateAndUpdateConfig() error {
 	}
 
 	magicName := strings.TrimSpace(st.magicNameEntry.Text)
-	if len(magicName) == 5 {
+	if err := utils.ValidateMagicName(magicName); err == nil {
 		st.config.MagicName = magicName
 	} else {
-		return fmt.Errorf("魔改名称必须是5个字符")
+		return err
 	}
 
 	st.config.AutoConfirm = st.autoConfirmCheck.Checked
@@ -2095,20 +2375,31 @@ type CreateTab struct {
 	prioritySelect     *widget.Select
 	homepageEntry      *FixedWidthEntry
 	isRootlessCheck    *widget.Check
+	patchPortCheck     *widget.Check
+	entitlementsCheck  *widget.Check
+	entitlementsEntry  *widget.Entry
 	progressBar        *widget.ProgressBar
 	progressLabel      *widget.Label
 	createBtn          *widget.Button
 
+	// 输出格式 - Magisk/KernelSU 模块使用各ABI的Android frida-server
+	formatSelect        *widget.Select
+	magiskServerEntries map[string]*FixedWidthEntry // ABI -> frida-server路径
+	selinuxEntry        *FixedWidthEntry
+	debSections         []fyne.CanvasObject // 仅DEB格式显示的区域
+	magiskSection       *widget.Card
+
 	// 核心功能 (CreateFridaDeb is instantiated locally when needed)
 }
 
 // NewCreateTab 创建新的创建标签页
 func NewCreateTab(app fyne.App, cfg *config.Config, statusUpdater StatusUpdater, logFunc func(string)) *CreateTab {
 	ct := &CreateTab{
-		app:          app,
-		config:       cfg,
-		updateStatus: statusUpdater,
-		addLog:       logFunc,
+		app:                 app,
+		config:              cfg,
+		updateStatus:        statusUpdater,
+		addLog:              logFunc,
+		magiskServerEntries: make(map[string]*FixedWidthEntry),
 	}
 
 	ct.setupUI()
@@ -2122,7 +2413,7 @@ func (ct *CreateTab) setupUI() {
 	ct.fridaAgentEntry = fixedWidthEntry(200, "选择frida-agent.dylib文件 (可选)...")
 	ct.outputPathEntry = fixedWidthEntry(180, "选择输出DEB文件路径...")
 
-	ct.magicNameEntry = fixedWidthEntry(100, "5字符")
+	ct.magicNameEntry = fixedWidthEntry(100, "1-5字符")
 	ct.portEntry = fixedWidthEntry(100, "端口")
 	ct.packageNameEntry = fixedWidthEntry(300, "包名 (自动生成)")
 	ct.versionEntry = fixedWidthEntry(200, "版本")
@@ -2139,12 +2430,12 @@ func (ct *CreateTab) setupUI() {
 
 	// 基本配置验证器和事件
 	ct.magicNameEntry.Validator = func(text string) error {
-		if len(text) != 5 {
-			return fmt.Errorf("魔改名称必须是5个字符")
-		}
 		if len(text) == 0 {
 			return fmt.Errorf("魔改名称不能为空")
 		}
+		if len(text) > utils.MaxMagicNameLen {
+			return fmt.Errorf("魔改名称不能超过%d个字符", utils.MaxMagicNameLen)
+		}
 
 		// 检查首字符必须是字母
 		first := text[0]
@@ -2173,9 +2464,9 @@ func (ct *CreateTab) setupUI() {
 
 	// 添加实时验证和字符长度限制
 	ct.magicNameEntry.OnChanged = func(text string) {
-		// 限制输入长度为5个字符
-		if len(text) > 5 {
-			ct.magicNameEntry.SetText(text[:5])
+		// 限制输入长度
+		if len(text) > utils.MaxMagicNameLen {
+			ct.magicNameEntry.SetText(text[:utils.MaxMagicNameLen])
 			return
 		}
 
@@ -2185,7 +2476,9 @@ func (ct *CreateTab) setupUI() {
 		// 实时验证显示
 		if err := ct.magicNameEntry.Validator(text); err != nil {
 			ct.updateStatus(fmt.Sprintf("魔改名称错误: %v", err))
-		} else if len(text) == 5 {
+		} else if len(text) > utils.MaxSafeMagicNameLen {
+			ct.updateStatus(fmt.Sprintf("魔改名称超过%d个字符，仅当字符串有剩余空间时可替换", utils.MaxSafeMagicNameLen))
+		} else {
 			ct.updateStatus("魔改名称验证通过")
 		}
 	}
@@ -2199,6 +2492,13 @@ func (ct *CreateTab) setupUI() {
 	}
 
 	ct.isRootlessCheck = widget.NewCheck("Rootless结构", nil)
+	ct.patchPortCheck = widget.NewCheck("修补二进制默认端口", nil)
+
+	// 权限编辑器
+	ct.entitlementsCheck = widget.NewCheck("写入编辑器中的权限 (替换frida-server原有权限)", nil)
+	ct.entitlementsEntry = widget.NewMultiLineEntry()
+	ct.entitlementsEntry.SetPlaceHolder("选择frida-server后自动读取现有权限plist，可在此编辑")
+	ct.entitlementsEntry.SetMinRowsVisible(8)
 
 	// 包信息配置
 	ct.packageNameEntry.Disable() // 设置为只读
@@ -2260,11 +2560,34 @@ func (ct *CreateTab) setupUI() {
 		outputRow,
 	))
 
+	// Magisk模块区域 - 每个ABI一行frida-server选择
+	magiskRows := container.NewVBox()
+	for _, abi := range apkTabABIs {
+		abi := abi
+		entry := fixedWidthEntry(200, "Android frida-server (可选)...")
+		ct.magiskServerEntries[abi] = entry
+		magiskRows.Add(container.NewBorder(nil, nil,
+			widget.NewLabel(fmt.Sprintf("%12s:", abi)),
+			widget.NewButton("选择", func() { ct.selectMagiskServer(abi) }),
+			entry))
+	}
+	ct.selinuxEntry = fixedWidthEntry(200, "如 u:r:magisk:s0 (可选)")
+	magiskRows.Add(container.NewBorder(nil, nil,
+		widget.NewLabel("SELinux上下文:"), nil,
+		ct.selinuxEntry))
+	ct.magiskSection = widget.NewCard("Magisk/KernelSU 模块", "安装时按设备架构选择frida-server，开机后自动启动", magiskRows)
+
+	ct.formatSelect = widget.NewSelect([]string{"iOS DEB", "Android Magisk/KernelSU"}, func(format string) {
+		ct.updateFormat(format == "Android Magisk/KernelSU")
+	})
+
 	// 基本配置区域 - 使用HBox横向排列
 	configSection := widget.NewCard("基本配置", "", container.NewHBox(
+		widget.NewLabel("输出格式:"), ct.formatSelect,
 		widget.NewLabel("魔改名称:"), ct.magicNameEntry,
 		widget.NewLabel("　　端口:"), ct.portEntry,
 		widget.NewLabel("　　　　"), ct.isRootlessCheck,
+		ct.patchPortCheck,
 	))
 
 	// 包信息区域 - 分两行显示
@@ -2294,6 +2617,20 @@ func (ct *CreateTab) setupUI() {
 
 	detailSection := widget.NewCard("详细信息", "", detailRow)
 
+	// 权限区域
+	entitlementsButtons := container.NewHBox(
+		ct.entitlementsCheck,
+		widget.NewButton("读取现有", ct.loadServerEntitlements),
+		widget.NewButton("导入合并", ct.importEntitlements),
+		widget.NewButton("添加常用权限", func() {
+			ct.mergeEntitlements(core.FridaServerEntitlements())
+		}),
+	)
+	entitlementsSection := widget.NewCard("权限 (Entitlements)", "", container.NewBorder(
+		entitlementsButtons, nil, nil, nil,
+		ct.entitlementsEntry,
+	))
+
 	// 操作区域 - 使用Border布局
 	actionSection := container.NewBorder(nil, nil,
 		container.NewHBox(ct.progressLabel, ct.progressBar),
@@ -2302,13 +2639,17 @@ func (ct *CreateTab) setupUI() {
 	)
 
 	// 主布局
+	ct.debSections = []fyne.CanvasObject{serverRow, agentRow, ct.isRootlessCheck, packageSection, detailSection, entitlementsSection}
 	ct.content = container.NewVBox(
 		fileSection,
 		configSection,
+		ct.magiskSection,
 		packageSection,
 		detailSection,
+		entitlementsSection,
 		actionSection,
 	)
+	ct.formatSelect.SetSelected("iOS DEB")
 
 	// 设置监听器 - 魔改名称的OnChanged已在Entry定义时设置
 	ct.isRootlessCheck.OnChanged = func(checked bool) {
@@ -2316,6 +2657,53 @@ func (ct *CreateTab) setupUI() {
 	}
 }
 
+// updateFormat 切换输出格式，显示对应的配置区域
+func (ct *CreateTab) updateFormat(magisk bool) {
+	for _, section := range ct.debSections {
+		if magisk {
+			section.Hide()
+		} else {
+			section.Show()
+		}
+	}
+	if magisk {
+		ct.magiskSection.Show()
+		ct.createBtn.SetText("创建Magisk模块")
+		ct.outputPathEntry.SetPlaceHolder("选择输出模块zip文件路径...")
+	} else {
+		ct.magiskSection.Hide()
+		ct.createBtn.SetText("创建DEB包")
+		ct.outputPathEntry.SetPlaceHolder("选择输出DEB文件路径...")
+	}
+}
+
+// isMagisk 是否输出Magisk模块
+func (ct *CreateTab) isMagisk() bool {
+	return ct.formatSelect.Selected == "Android Magisk/KernelSU"
+}
+
+// selectMagiskServer 选择Android frida-server，按ELF架构放到对应ABI
+func (ct *CreateTab) selectMagiskServer(abi string) {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		filePath := reader.URI().Path()
+		detected, err := core.DetectAndroidABI(filePath)
+		if err != nil {
+			ct.showError(fmt.Sprintf("无法识别frida-server: %v", err))
+			return
+		}
+		if detected != abi {
+			ct.addLog(fmt.Sprintf("WARNING: %s 的架构为 %s，已放到对应ABI", filePath, detected))
+		}
+		ct.magiskServerEntries[detected].SetText(filePath)
+		ct.addLog(fmt.Sprintf("选择frida-server (%s): %s", detected, filePath))
+	}, ct.app.Driver().AllWindows()[0])
+}
+
 // selectFridaServer 选择frida-server文件
 func (ct *CreateTab) selectFridaServer() {
 	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
@@ -2327,9 +2715,78 @@ func (ct *CreateTab) selectFridaServer() {
 		filePath := reader.URI().Path()
 		ct.fridaServerEntry.SetText(filePath)
 		ct.addLog(fmt.Sprintf("选择frida-server文件: %s", filePath))
+
+		// 编辑器为空时自动读取现有权限
+		if strings.TrimSpace(ct.entitlementsEntry.Text) == "" {
+			ct.loadServerEntitlements()
+		}
+	}, ct.app.Driver().AllWindows()[0])
+}
+
+// loadServerEntitlements 读取frida-server代码签名中的现有权限到编辑器
+func (ct *CreateTab) loadServerEntitlements() {
+	serverPath := ct.fridaServerEntry.Text
+	if serverPath == "" {
+		ct.showError("请先选择frida-server文件")
+		return
+	}
+
+	entitlements, err := core.ReadEntitlements(serverPath)
+	if err != nil {
+		ct.addLog(fmt.Sprintf("WARNING: 读取frida-server权限失败: %v", err))
+		return
+	}
+	ct.setEntitlements(entitlements)
+	ct.addLog(fmt.Sprintf("INFO: 已读取frida-server现有权限 %d 项", len(entitlements)))
+}
+
+// importEntitlements 导入plist文件并合并到编辑器中的权限
+func (ct *CreateTab) importEntitlements() {
+	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+		if err != nil || reader == nil {
+			return
+		}
+		defer reader.Close()
+
+		imported, err := core.LoadEntitlementsFile(reader.URI().Path())
+		if err != nil {
+			ct.showError(fmt.Sprintf("加载权限文件失败: %v", err))
+			return
+		}
+		ct.mergeEntitlements(imported)
+		ct.addLog(fmt.Sprintf("INFO: 已合并权限文件 %s (%d 项)", reader.URI().Path(), len(imported)))
 	}, ct.app.Driver().AllWindows()[0])
 }
 
+// mergeEntitlements 将权限合并到编辑器中的权限
+func (ct *CreateTab) mergeEntitlements(extra core.Entitlements) {
+	entitlements, err := ct.editorEntitlements()
+	if err != nil {
+		ct.showError(fmt.Sprintf("编辑器中的权限格式错误: %v", err))
+		return
+	}
+	entitlements.Merge(extra)
+	ct.setEntitlements(entitlements)
+}
+
+// editorEntitlements 解析编辑器中的权限plist，编辑器为空时返回空权限
+func (ct *CreateTab) editorEntitlements() (core.Entitlements, error) {
+	if strings.TrimSpace(ct.entitlementsEntry.Text) == "" {
+		return core.Entitlements{}, nil
+	}
+	return core.ParseEntitlements([]byte(ct.entitlementsEntry.Text))
+}
+
+// setEntitlements 将权限以plist格式显示在编辑器中
+func (ct *CreateTab) setEntitlements(entitlements core.Entitlements) {
+	data, err := entitlements.Plist()
+	if err != nil {
+		ct.showError(fmt.Sprintf("编码权限失败: %v", err))
+		return
+	}
+	ct.entitlementsEntry.SetText(string(data))
+}
+
 // selectFridaAgent 选择frida-agent文件
 func (ct *CreateTab) selectFridaAgent() {
 	dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
@@ -2353,8 +2810,12 @@ func (ct *CreateTab) selectOutputPath() {
 		defer writer.Close()
 
 		filePath := writer.URI().Path()
-		if !strings.HasSuffix(strings.ToLower(filePath), ".deb") {
-			filePath += ".deb"
+		extension := ".deb"
+		if ct.isMagisk() {
+			extension = ".zip"
+		}
+		if !strings.HasSuffix(strings.ToLower(filePath), extension) {
+			filePath += extension
 		}
 		ct.outputPathEntry.SetText(filePath)
 		ct.addLog(fmt.Sprintf("选择输出路径: %s", filePath))
@@ -2391,6 +2852,11 @@ func (ct *CreateTab) updatePackageName(magicName string) {
 
 // createDebPackage 创建DEB包
 func (ct *CreateTab) createDebPackage() {
+	if ct.isMagisk() {
+		ct.createMagiskModule()
+		return
+	}
+
 	// 验证输入
 	if ct.fridaServerEntry.Text == "" {
 		ct.showError("请选择frida-server文件")
@@ -2418,17 +2884,26 @@ func (ct *CreateTab) createDebPackage() {
 		return
 	}
 
+	var entitlements core.Entitlements
+	if ct.entitlementsCheck.Checked {
+		entitlements, err = ct.editorEntitlements()
+		if err != nil {
+			ct.showError(fmt.Sprintf("权限格式错误: %v", err))
+			return
+		}
+	}
+
 	// 禁用按钮
 	ct.createBtn.Disable()
 	ct.progressBar.SetValue(0)
 	ct.progressLabel.SetText("开始创建...")
 
 	// 异步执行
-	go ct.performCreate(port)
+	go ct.performCreate(port, entitlements)
 }
 
-// performCreate 执行创建过程
-func (ct *CreateTab) performCreate(port int) {
+// performCreate 执行创建过程，entitlements 非空时替换frida-server的权限
+func (ct *CreateTab) performCreate(port int, entitlements core.Entitlements) {
 	defer func() {
 		ct.createBtn.Enable()
 	}()
@@ -2454,6 +2929,13 @@ func (ct *CreateTab) performCreate(port int) {
 	if ct.fridaAgentEntry.Text != "" {
 		creator.FridaAgentPath = ct.fridaAgentEntry.Text
 	}
+	creator.PatchPort = ct.patchPortCheck.Checked
+	if entitlements != nil {
+		// 编辑器中是完整的权限列表
+		creator.Entitlements = entitlements
+		creator.ReplaceEntitlements = true
+		ct.addLog(fmt.Sprintf("写入权限: %d 项", len(entitlements)))
+	}
 
 	ct.addLog("开始创建DEB包...")
 	ct.addLog(fmt.Sprintf("魔改名称: %s, 端口: %d, 结构: %s",
@@ -2479,6 +2961,76 @@ func (ct *CreateTab) performCreate(port int) {
 	ct.updateStatus("DEB包创建完成")
 }
 
+// createMagiskModule 验证输入并创建Magisk模块
+func (ct *CreateTab) createMagiskModule() {
+	if ct.outputPathEntry.Text == "" {
+		ct.showError("请选择输出路径")
+		return
+	}
+	if err := ct.magicNameEntry.Validator(ct.magicNameEntry.Text); err != nil {
+		ct.showError(fmt.Sprintf("魔改名称格式错误: %v", err))
+		return
+	}
+	port, err := strconv.Atoi(ct.portEntry.Text)
+	if err != nil || port < 1 || port > 65535 {
+		ct.showError("端口必须在1-65535范围内")
+		return
+	}
+
+	packager := core.NewMagiskModulePackager(ct.outputPathEntry.Text, ct.magicNameEntry.Text, port)
+	for abi, entry := range ct.magiskServerEntries {
+		if entry.Text != "" {
+			packager.Servers[abi] = entry.Text
+		}
+	}
+	if len(packager.Servers) == 0 {
+		ct.showError("请至少选择一个Android frida-server")
+		return
+	}
+	packager.SELinuxContext = strings.TrimSpace(ct.selinuxEntry.Text)
+	packager.PatchPort = ct.patchPortCheck.Checked
+	packager.Version = ct.versionEntry.Text
+
+	ct.createBtn.Disable()
+	ct.progressBar.SetValue(0)
+	ct.progressLabel.SetText("开始创建...")
+
+	go ct.performCreateMagisk(packager)
+}
+
+// performCreateMagisk 执行Magisk模块创建
+func (ct *CreateTab) performCreateMagisk(packager *core.MagiskModulePackager) {
+	defer fyne.Do(ct.createBtn.Enable)
+
+	ct.addLog(fmt.Sprintf("INFO: 开始创建Magisk模块: 魔改名称: %s, 端口: %d", packager.MagicName, packager.Port))
+	err := packager.CreateModule(func(progress float64, message string) {
+		fyne.Do(func() {
+			ct.progressBar.SetValue(progress)
+			ct.progressLabel.SetText(message)
+			ct.updateStatus(message)
+		})
+	})
+	if err != nil {
+		fyne.Do(func() {
+			ct.progressLabel.SetText("创建失败")
+			ct.addLog(fmt.Sprintf("ERROR: Magisk模块创建失败: %v", err))
+			ct.showError(fmt.Sprintf("创建Magisk模块失败: %v", err))
+		})
+		return
+	}
+
+	fyne.Do(func() {
+		ct.progressBar.SetValue(1.0)
+		ct.progressLabel.SetText("创建完成")
+		ct.addLog(fmt.Sprintf("SUCCESS: Magisk模块创建成功: %s", packager.OutputPath))
+		for _, report := range packager.Reports {
+			ct.addLog(fmt.Sprintf("INFO: 残留特征 %s: %s", report.File, core.SummarizeFingerprints(report.Residual)))
+		}
+		ct.showSuccess("Magisk模块创建成功!", fmt.Sprintf("输出文件: %s\n重启后frida-server监听 %s:%d", packager.OutputPath, packager.Address, packager.Port))
+		ct.updateStatus("Magisk模块创建完成")
+	})
+}
+
 // showError 显示错误信息
 func (ct *CreateTab) showError(message string) {
 	dialog.ShowError(fmt.Errorf("%s", message), ct.app.Driver().AllWindows()[0])
@@ -2645,7 +3197,7 @@ Fridare 是一个强大的 Frida 工具集，专为 iOS 逆向工程和安全研
 - 显示文件基本信息
 
 ### 2. 配置参数
-- **魔改名称**：5个字符，必须以字母开头
+- **魔改名称**：1-5个字符，必须以字母开头；更长的名称仅当二进制中的字符串有足够剩余空间时可用
 - **目标端口**：1-65535 范围内的有效端口
 - **输出路径**：可选择覆盖或另存
 
@@ -2655,7 +3207,7 @@ Fridare 是一个强大的 Frida 工具集，专为 iOS 逆向工程和安全研
 - 自动备份原始文件
 
 ## 注意事项
-- 魔改名称必须严格为 5 个字符
+- 魔改名称为 1-5 个字符，更长的名称需要字符串有剩余空间
 - 建议使用随机名称避免被识别
 - 处理前会自动创建备份文件
 - 支持一键恢复到原始状态
@@ -2701,7 +3253,7 @@ Fridare 是一个强大的 Frida 工具集，专为 iOS 逆向工程和安全研
 - 生成新的 DEB 文件
 
 ## 配置选项
-- **魔改名称**：统一的 5 字符标识
+- **魔改名称**：统一的 1-5 字符标识
 - **端口配置**：修改默认监听端口
 - **包信息**：可选择是否修改包标识符
 
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// AtomicFile 原子写入的文件
+// 所有写入先进入目标目录下的临时文件，Commit 时 fsync、校验后重命名覆盖目标文件；
+// 出错或 Abort 时删除临时文件，目标文件 (如已存在) 保持不变
+type AtomicFile struct {
+	*os.File
+	path string
+	perm os.FileMode
+	done bool
+}
+
+// CreateAtomic 在目标文件所在目录创建用于暂存的临时文件
+func CreateAtomic(path string, perm os.FileMode) (*AtomicFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %v", err)
+	}
+
+	// 临时文件与目标文件在同一目录，保证重命名是原子操作
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	return &AtomicFile{File: f, path: path, perm: perm}, nil
+}
+
+// TempPath 返回暂存临时文件的路径
+func (af *AtomicFile) TempPath() string {
+	return af.File.Name()
+}
+
+// Commit 刷新并关闭临时文件，校验通过后原子重命名为目标文件
+// verify 可为 nil，参数为临时文件路径
+func (af *AtomicFile) Commit(verify func(tempPath string) error) error {
+	if af.done {
+		return fmt.Errorf("文件已提交或已放弃: %s", af.path)
+	}
+	af.done = true
+	tempPath := af.TempPath()
+
+	fail := func(err error) error {
+		af.File.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := af.File.Sync(); err != nil {
+		return fail(fmt.Errorf("同步临时文件失败: %v", err))
+	}
+	if err := af.File.Close(); err != nil {
+		return fail(fmt.Errorf("关闭临时文件失败: %v", err))
+	}
+	if err := os.Chmod(tempPath, af.perm); err != nil {
+		return fail(fmt.Errorf("设置文件权限失败: %v", err))
+	}
+	if verify != nil {
+		if err := verify(tempPath); err != nil {
+			return fail(fmt.Errorf("输出文件校验失败: %v", err))
+		}
+	}
+	if err := os.Rename(tempPath, af.path); err != nil {
+		return fail(fmt.Errorf("重命名临时文件失败: %v", err))
+	}
+
+	syncDir(filepath.Dir(af.path))
+	return nil
+}
+
+// Abort 放弃写入并删除临时文件，Commit 之后调用无效，可安全地 defer
+func (af *AtomicFile) Abort() {
+	if af.done {
+		return
+	}
+	af.done = true
+	af.File.Close()
+	os.Remove(af.TempPath())
+}
+
+// WriteFileAtomic 原子地写入整个文件
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	af, err := CreateAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	defer af.Abort()
+
+	if _, err := af.Write(data); err != nil {
+		return fmt.Errorf("写入临时文件失败: %v", err)
+	}
+	return af.Commit(nil)
+}
+
+// syncDir 刷新目录项，使重命名在崩溃后依然生效 (部分平台不支持，忽略错误)
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+	d.Sync()
+}
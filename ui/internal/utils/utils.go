@@ -571,8 +571,32 @@ func GenerateRandomName() string {
 
 	return baseWord
 }
+// MaxSafeMagicNameLen 保证能就地替换的最大魔改名称长度 (与 "frida" 等长)
+const MaxSafeMagicNameLen = 5
+
+// MaxMagicNameLen 魔改名称的最大长度，超过 MaxSafeMagicNameLen 的名称只有在
+// 被替换字符串后有足够的 NUL 剩余空间时才能使用
+const MaxMagicNameLen = 16
+
+// ValidateMagicName 验证魔改名称格式和长度，返回具体原因
+func ValidateMagicName(s string) error {
+	if len(s) == 0 {
+		return fmt.Errorf("魔改名称不能为空")
+	}
+	if len(s) > MaxMagicNameLen {
+		return fmt.Errorf("魔改名称不能超过%d个字符，当前: %d个字符", MaxMagicNameLen, len(s))
+	}
+	if !IsFridaNewName(s) {
+		return fmt.Errorf("魔改名称必须以字母开头，且只能包含字母和数字")
+	}
+	return nil
+}
+
 // isFridaNewName 检查字符串必须是 A-Za-z0-9
 func IsFridaNewName(s string) bool {
+	if s == "" {
+		return false
+	}
 	for _, c := range s {
 		//必须是 A-Za-z0-9
 		if !((c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {